@@ -0,0 +1,231 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnLimitOpts 连接级别的限制，在请求被解析之前生效，用于抵御连接洪水和慢速攻击
+type ConnLimitOpts struct {
+	// MaxConns 同时打开的最大连接数，超过时新连接会被立即关闭，0 表示不限制
+	MaxConns int
+
+	// MaxConnsPerIP 单个客户端 IP 同时打开的最大连接数，0 表示不限制。
+	// 配合 RunOpts.ProxyProtocol 使用时按真实的客户端 IP 计数
+	MaxConnsPerIP int
+
+	// ReadHeaderTimeout 读取请求头的超时时间，防止客户端缓慢地发送请求头占用连接
+	ReadHeaderTimeout time.Duration
+
+	// IdleTimeout keep-alive 连接在两次请求之间的最长空闲时间，超时后连接被回收
+	IdleTimeout time.Duration
+}
+
+// ConnStats 连接计数
+type ConnStats struct {
+	// Open 当前打开的连接数
+	Open int64 `json:"open"`
+	// Active 当前正在处理请求的连接数
+	Active int64 `json:"active"`
+	// Idle 当前处于空闲状态的 keep-alive 连接数
+	Idle int64 `json:"idle"`
+	// Accepted 累计接收的连接数
+	Accepted int64 `json:"accepted"`
+	// Rejected 因超过 MaxConns 被拒绝的连接数
+	Rejected int64 `json:"rejected"`
+	// RejectedPerIP 因超过 MaxConnsPerIP 被拒绝的连接数
+	RejectedPerIP int64 `json:"rejected_per_ip"`
+	// IPs 当前有打开连接的客户端 IP 数
+	IPs int `json:"ips"`
+}
+
+// ConnLimiter 限制并统计服务的连接，通过 RunOpts.ConnLimit 启用：
+//
+//	limiter := api.NewConnLimiter(api.ConnLimitOpts{MaxConns: 10000, MaxConnsPerIP: 100, ReadHeaderTimeout: 5 * time.Second})
+//	go api.RunWithOpts(":8080", r, api.RunOpts{ConnLimit: limiter})
+//	...
+//	stats := limiter.Stats()
+type ConnLimiter struct {
+	opts ConnLimitOpts
+
+	open, active, idle                int64
+	accepted, rejected, rejectedPerIP int64
+
+	mu    sync.Mutex
+	perIP map[string]int
+}
+
+// NewConnLimiter 创建连接限制器
+func NewConnLimiter(opts ConnLimitOpts) *ConnLimiter {
+	if opts.MaxConns < 0 || opts.MaxConnsPerIP < 0 {
+		panic("api: ConnLimiter expects limits to be positive")
+	}
+	return &ConnLimiter{opts: opts, perIP: make(map[string]int)}
+}
+
+// Stats 返回当前的连接计数
+func (l *ConnLimiter) Stats() ConnStats {
+	l.mu.Lock()
+	ips := len(l.perIP)
+	l.mu.Unlock()
+	return ConnStats{
+		Open:          atomic.LoadInt64(&l.open),
+		Active:        atomic.LoadInt64(&l.active),
+		Idle:          atomic.LoadInt64(&l.idle),
+		Accepted:      atomic.LoadInt64(&l.accepted),
+		Rejected:      atomic.LoadInt64(&l.rejected),
+		RejectedPerIP: atomic.LoadInt64(&l.rejectedPerIP),
+		IPs:           ips,
+	}
+}
+
+// Listener 返回一个受限制的监听器，超过限制的连接在被接收后立即关闭
+func (l *ConnLimiter) Listener(ln net.Listener) net.Listener {
+	return &limitListener{Listener: ln, limiter: l}
+}
+
+// configure 将超时配置应用到服务上，并通过 ConnState 统计连接状态
+func (l *ConnLimiter) configure(server *http.Server) {
+	if l.opts.ReadHeaderTimeout > 0 {
+		server.ReadHeaderTimeout = l.opts.ReadHeaderTimeout
+	}
+	if l.opts.IdleTimeout > 0 {
+		server.IdleTimeout = l.opts.IdleTimeout
+	}
+	server.ConnState = l.connState
+}
+
+// connState 统计连接处于活跃或空闲状态的数量
+func (l *ConnLimiter) connState(c net.Conn, state http.ConnState) {
+	lc := findLimitConn(c)
+	if lc == nil {
+		return
+	}
+
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if lc.state == state {
+		return
+	}
+	switch lc.state {
+	case http.StateActive:
+		atomic.AddInt64(&l.active, -1)
+	case http.StateIdle:
+		atomic.AddInt64(&l.idle, -1)
+	}
+	switch state {
+	case http.StateActive:
+		atomic.AddInt64(&l.active, 1)
+	case http.StateIdle:
+		atomic.AddInt64(&l.idle, 1)
+	}
+	lc.state = state
+}
+
+// acquire 为 ip 登记一个连接，超过限制时返回 false
+func (l *ConnLimiter) acquire(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.opts.MaxConns > 0 && atomic.LoadInt64(&l.open) >= int64(l.opts.MaxConns) {
+		atomic.AddInt64(&l.rejected, 1)
+		return false
+	}
+	if l.opts.MaxConnsPerIP > 0 && l.perIP[ip] >= l.opts.MaxConnsPerIP {
+		atomic.AddInt64(&l.rejectedPerIP, 1)
+		return false
+	}
+	l.perIP[ip]++
+	atomic.AddInt64(&l.open, 1)
+	atomic.AddInt64(&l.accepted, 1)
+	return true
+}
+
+// release 释放 ip 的一个连接
+func (l *ConnLimiter) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.perIP[ip]--; l.perIP[ip] <= 0 {
+		delete(l.perIP, ip)
+	}
+	atomic.AddInt64(&l.open, -1)
+}
+
+// limitListener 受连接限制的监听器
+type limitListener struct {
+	net.Listener
+	limiter *ConnLimiter
+}
+
+func (ll *limitListener) Accept() (net.Conn, error) {
+	for {
+		c, err := ll.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		ip := connIP(c.RemoteAddr())
+		if !ll.limiter.acquire(ip) {
+			c.Close()
+			continue
+		}
+		return &limitConn{Conn: c, limiter: ll.limiter, ip: ip}, nil
+	}
+}
+
+// limitConn 被计数的连接，关闭时释放计数
+type limitConn struct {
+	net.Conn
+	limiter *ConnLimiter
+	ip      string
+	once    sync.Once
+
+	mu    sync.Mutex
+	state http.ConnState
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() {
+		c.limiter.connState(c, http.StateClosed)
+		c.limiter.release(c.ip)
+	})
+	return err
+}
+
+// NetConn 返回原始连接
+func (c *limitConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// findLimitConn 在连接的包装链中查找 limitConn
+func findLimitConn(c net.Conn) *limitConn {
+	for c != nil {
+		if lc, ok := c.(*limitConn); ok {
+			return lc
+		}
+		nc, ok := c.(interface{ NetConn() net.Conn })
+		if !ok {
+			return nil
+		}
+		c = nc.NetConn()
+	}
+	return nil
+}
+
+// connIP 返回地址中的 IP 部分
+func connIP(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP.String()
+	case *net.UDPAddr:
+		return a.IP.String()
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
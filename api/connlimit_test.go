@@ -0,0 +1,159 @@
+package api
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func startLimitedServer(t *testing.T, limiter *ConnLimiter) (string, func()) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRouter()
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	stop := make(chan os.Signal, 1)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- serve(ln, r, RunOpts{ConnLimit: limiter}, stop)
+	}()
+	return ln.Addr().String(), func() {
+		stop <- syscall.SIGTERM
+		<-errc
+	}
+}
+
+// roundTrip sends a request on conn and reports whether a response arrived.
+func roundTrip(conn net.Conn) bool {
+	io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestConnLimitPerIP(t *testing.T) {
+	limiter := NewConnLimiter(ConnLimitOpts{MaxConnsPerIP: 2})
+	addr, stop := startLimitedServer(t, limiter)
+	defer stop()
+
+	var conns []net.Conn
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+
+	if !roundTrip(conns[0]) || !roundTrip(conns[1]) {
+		t.Fatal("expecting the first two connections to be served")
+	}
+	if roundTrip(conns[2]) {
+		t.Fatal("expecting the third connection to be rejected")
+	}
+
+	stats := limiter.Stats()
+	if stats.Open != 2 || stats.RejectedPerIP != 1 || stats.IPs != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	waitFor(t, "idle connections", func() bool { return limiter.Stats().Idle == 2 })
+
+	// Closing a connection frees a slot.
+	conns[0].Close()
+	waitFor(t, "released connection", func() bool { return limiter.Stats().Open == 1 })
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if !roundTrip(conn) {
+		t.Fatal("expecting a new connection to be served after one was closed")
+	}
+}
+
+func TestConnLimitMaxConns(t *testing.T) {
+	limiter := NewConnLimiter(ConnLimitOpts{MaxConns: 1})
+	addr, stop := startLimitedServer(t, limiter)
+	defer stop()
+
+	first, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	if !roundTrip(first) {
+		t.Fatal("expecting the first connection to be served")
+	}
+
+	second, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	if roundTrip(second) {
+		t.Fatal("expecting the second connection to be rejected")
+	}
+	if stats := limiter.Stats(); stats.Rejected != 1 || stats.Accepted != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestConnLimitTimeouts(t *testing.T) {
+	limiter := NewConnLimiter(ConnLimitOpts{
+		ReadHeaderTimeout: 50 * time.Millisecond,
+		IdleTimeout:       50 * time.Millisecond,
+	})
+	addr, stop := startLimitedServer(t, limiter)
+	defer stop()
+
+	// A client trickling its headers is disconnected.
+	slow, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+	io.WriteString(slow, "GET / HTTP/1.1\r\n")
+	slow.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := slow.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expecting slow connection to be closed")
+	}
+
+	// An idle keep-alive connection is reaped.
+	idle, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Close()
+	if !roundTrip(idle) {
+		t.Fatal("expecting request to be served")
+	}
+	waitFor(t, "idle connection to be reaped", func() bool { return limiter.Stats().Open == 0 })
+}
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// defaultDiagCPUProfile 诊断包中 CPU 采样的默认时长
+	defaultDiagCPUProfile = 5 * time.Second
+
+	// errDiagRunning 上一次诊断尚未完成
+	errDiagRunning = errors.New("api: a diagnostics dump is already running")
+)
+
+// DiagOpts 诊断信息的配置项
+type DiagOpts struct {
+	// Dir 诊断包的输出目录，每次诊断会在其中创建一个带时间戳的子目录，默认为系统临时目录
+	Dir string
+
+	// CPUProfile CPU 采样的时长，默认 5 秒，小于 0 时不采样
+	CPUProfile time.Duration
+}
+
+// Diagnostics 在不中断服务的情况下导出诊断信息，包括协程、堆、CPU 采样、内存统计、
+// 正在处理的请求以及路由表。配置 RunOpts.Diagnostics 后，服务收到 SIGUSR1 信号时自动导出：
+//
+//	kill -USR1 <pid>
+type Diagnostics struct {
+	opts    DiagOpts
+	routes  Routes
+	running int32
+
+	seq      uint64
+	inflight sync.Map
+}
+
+// inflightRequest 正在处理的请求
+type inflightRequest struct {
+	Method     string    `json:"method"`
+	URL        string    `json:"url"`
+	Proto      string    `json:"proto"`
+	RemoteAddr string    `json:"remote_addr"`
+	Start      time.Time `json:"start"`
+	Elapsed    string    `json:"elapsed"`
+}
+
+// NewDiagnostics 创建诊断器，router 实现了 Routes 接口时诊断包中会包含路由表
+func NewDiagnostics(opts DiagOpts, router http.Handler) *Diagnostics {
+	if opts.Dir == "" {
+		opts.Dir = os.TempDir()
+	}
+	if opts.CPUProfile == 0 {
+		opts.CPUProfile = defaultDiagCPUProfile
+	}
+	d := &Diagnostics{opts: opts}
+	d.routes, _ = router.(Routes)
+	return d
+}
+
+// Handler 记录正在处理的请求
+func (d *Diagnostics) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := atomic.AddUint64(&d.seq, 1)
+		d.inflight.Store(id, inflightRequest{
+			Method:     r.Method,
+			URL:        r.URL.String(),
+			Proto:      r.Proto,
+			RemoteAddr: r.RemoteAddr,
+			Start:      time.Now(),
+		})
+		defer d.inflight.Delete(id)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Dump 导出一份诊断包，返回诊断包所在的目录。同一时间只会有一次导出，
+// 单项信息导出失败时会记录在诊断包的 errors.txt 中，不影响其他信息的导出
+func (d *Diagnostics) Dump() (string, error) {
+	if !atomic.CompareAndSwapInt32(&d.running, 0, 1) {
+		return "", errDiagRunning
+	}
+	defer atomic.StoreInt32(&d.running, 0)
+
+	dir := filepath.Join(d.opts.Dir, "diag-"+time.Now().Format("20060102-150405.000"))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	var errs []string
+	write := func(name string, fn func(buf *bytes.Buffer) error) {
+		var buf bytes.Buffer
+		if err := fn(&buf); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			return
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0o644); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+
+	// 先导出瞬时的状态，再进行耗时的 CPU 采样
+	write("goroutines.txt", func(buf *bytes.Buffer) error {
+		return pprof.Lookup("goroutine").WriteTo(buf, 2)
+	})
+	write("inflight.json", func(buf *bytes.Buffer) error {
+		return json.NewEncoder(buf).Encode(d.inflightRequests())
+	})
+	write("memstats.json", func(buf *bytes.Buffer) error {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		enc := json.NewEncoder(buf)
+		enc.SetIndent("", "  ")
+		return enc.Encode(ms)
+	})
+	write("heap.pprof", func(buf *bytes.Buffer) error {
+		return pprof.Lookup("heap").WriteTo(buf, 0)
+	})
+	if d.routes != nil {
+		write("routes.txt", func(buf *bytes.Buffer) error {
+			return Walk(d.routes, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+				fmt.Fprintf(buf, "%-8s %s\n", method, route)
+				return nil
+			})
+		})
+	}
+	if d.opts.CPUProfile > 0 {
+		write("cpu.pprof", func(buf *bytes.Buffer) error {
+			// 已经有 CPU 采样在进行时（例如 middleware.Profiler），这里会返回错误
+			if err := pprof.StartCPUProfile(buf); err != nil {
+				return err
+			}
+			time.Sleep(d.opts.CPUProfile)
+			pprof.StopCPUProfile()
+			return nil
+		})
+	}
+
+	if len(errs) > 0 {
+		os.WriteFile(filepath.Join(dir, "errors.txt"), []byte(strings.Join(errs, "\n")+"\n"), 0o644)
+	}
+	return dir, nil
+}
+
+// inflightRequests 返回正在处理的请求，按开始时间排序
+func (d *Diagnostics) inflightRequests() []inflightRequest {
+	now := time.Now()
+	reqs := []inflightRequest{}
+	d.inflight.Range(func(_, v interface{}) bool {
+		req := v.(inflightRequest)
+		req.Elapsed = now.Sub(req.Start).String()
+		reqs = append(reqs, req)
+		return true
+	})
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].Start.Before(reqs[j].Start) })
+	return reqs
+}
+
+// watch 每次收到信号时在后台导出诊断包，直到 ctx 结束
+func (d *Diagnostics) watch(ctx context.Context, sig <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+			go func() {
+				dir, err := d.Dump()
+				if err != nil {
+					log.Printf("导出诊断信息失败：%v\n", err)
+					return
+				}
+				log.Printf("诊断信息已导出到 %s\n", dir)
+			}()
+		}
+	}
+}
@@ -0,0 +1,8 @@
+//go:build windows || plan9
+
+package api
+
+import "os"
+
+// notifyDiagnostics 当前平台没有 SIGUSR1 信号，只能通过 Diagnostics.Dump 手动导出
+func notifyDiagnostics(c chan<- os.Signal) {}
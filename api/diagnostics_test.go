@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiagnosticsDump(t *testing.T) {
+	r := NewRouter()
+	release := make(chan struct{})
+	started := make(chan struct{})
+	r.Get("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	})
+	r.Post("/users/{id}", func(w http.ResponseWriter, r *http.Request) {})
+
+	diag := NewDiagnostics(DiagOpts{Dir: t.TempDir(), CPUProfile: 50 * time.Millisecond}, r)
+	ts := httptest.NewServer(diag.Handler(r))
+	defer ts.Close()
+
+	go http.Get(ts.URL + "/slow")
+	<-started
+	defer close(release)
+
+	dir, err := diag.Dump()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"goroutines.txt", "heap.pprof", "cpu.pprof", "memstats.json", "inflight.json", "routes.txt"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("expecting %s in the bundle: %v", name, err)
+		}
+		if info.Size() == 0 {
+			t.Fatalf("expecting %s to be non-empty", name)
+		}
+	}
+
+	var inflight []inflightRequest
+	b, _ := os.ReadFile(filepath.Join(dir, "inflight.json"))
+	if err := json.Unmarshal(b, &inflight); err != nil {
+		t.Fatal(err)
+	}
+	if len(inflight) != 1 || inflight[0].URL != "/slow" {
+		t.Fatalf("expecting the in-flight /slow request but got %+v", inflight)
+	}
+
+	routes, _ := os.ReadFile(filepath.Join(dir, "routes.txt"))
+	if !strings.Contains(string(routes), "POST") || !strings.Contains(string(routes), "/users/{id}") {
+		t.Fatalf("expecting route table but got '%s'", routes)
+	}
+}
+
+func TestDiagnosticsSingleDump(t *testing.T) {
+	diag := NewDiagnostics(DiagOpts{Dir: t.TempDir(), CPUProfile: 200 * time.Millisecond}, http.NotFoundHandler())
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := diag.Dump()
+		errc <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := diag.Dump(); err != errDiagRunning {
+		t.Fatalf("expecting concurrent dump to be refused but got %v", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiagnosticsWatch(t *testing.T) {
+	dir := t.TempDir()
+	diag := NewDiagnostics(DiagOpts{Dir: dir, CPUProfile: -1}, http.NotFoundHandler())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	go diag.watch(ctx, sig)
+	sig <- os.Interrupt
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		matches, _ := filepath.Glob(filepath.Join(dir, "diag-*", "memstats.json"))
+		if len(matches) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expecting a diagnostics bundle after the signal")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
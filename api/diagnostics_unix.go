@@ -0,0 +1,14 @@
+//go:build !windows && !plan9
+
+package api
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyDiagnostics 将 SIGUSR1 信号转发到 c
+func notifyDiagnostics(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
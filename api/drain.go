@@ -0,0 +1,210 @@
+package api
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// defaultDrainTimeout 长连接收到关闭通知后的默认收尾时间
+	defaultDrainTimeout = 10 * time.Second
+
+	// ConnRegistryCtxKey 是用于存储长连接登记表的 context.Context 密钥
+	ConnRegistryCtxKey = &contextKey{"ConnRegistry"}
+)
+
+// ConnRegistry 长连接登记表。
+//
+// http.Server.Shutdown 不会等待被劫持的连接（例如 WebSocket），也不会通知 SSE 等长时间运行的处理器，
+// 这些连接在服务退出时会被直接断开。处理器可以通过 RegisterConn 登记长连接，
+// 服务关闭时登记表会先通知它们，给它们一段时间发送关闭帧或者最后的事件，然后强制关闭剩余的连接。
+type ConnRegistry struct {
+	mu       sync.Mutex
+	conns    map[*LongLived]struct{}
+	draining bool
+	empty    chan struct{}
+}
+
+// NewConnRegistry 创建长连接登记表，RunWithOpts 会为每个服务自动创建一个
+func NewConnRegistry() *ConnRegistry {
+	return &ConnRegistry{conns: make(map[*LongLived]struct{})}
+}
+
+// Len 返回当前登记的长连接数量
+func (reg *ConnRegistry) Len() int {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return len(reg.conns)
+}
+
+// Register 登记一个长连接，closer 用于强制关闭，可以为 nil。
+// 登记表已经开始关闭时，返回的长连接会立即收到关闭通知
+func (reg *ConnRegistry) Register(closer io.Closer) *LongLived {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &LongLived{reg: reg, closer: closer, ctx: ctx, cancel: cancel}
+
+	reg.mu.Lock()
+	reg.conns[l] = struct{}{}
+	draining := reg.draining
+	reg.mu.Unlock()
+
+	if draining {
+		l.notify()
+	}
+	return l
+}
+
+// Drain 通知所有长连接服务即将关闭，等待它们在 window 内调用 Done，
+// 超时或者 ctx 结束后强制关闭剩余的连接，返回被强制关闭的连接数
+func (reg *ConnRegistry) Drain(ctx context.Context, window time.Duration) int {
+	reg.mu.Lock()
+	reg.draining = true
+	reg.empty = make(chan struct{})
+	conns := make([]*LongLived, 0, len(reg.conns))
+	for l := range reg.conns {
+		conns = append(conns, l)
+	}
+	if len(reg.conns) == 0 {
+		close(reg.empty)
+	}
+	empty := reg.empty
+	reg.mu.Unlock()
+
+	for _, l := range conns {
+		go l.notify()
+	}
+
+	timer := time.NewTimer(window)
+	defer timer.Stop()
+	select {
+	case <-empty:
+		return 0
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	reg.mu.Lock()
+	conns = conns[:0]
+	for l := range reg.conns {
+		conns = append(conns, l)
+	}
+	reg.mu.Unlock()
+
+	for _, l := range conns {
+		if l.closer != nil {
+			l.closer.Close()
+		}
+		l.Done()
+	}
+	return len(conns)
+}
+
+// remove 移除一个长连接
+func (reg *ConnRegistry) remove(l *LongLived) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	delete(reg.conns, l)
+	if reg.draining && len(reg.conns) == 0 {
+		select {
+		case <-reg.empty:
+		default:
+			close(reg.empty)
+		}
+	}
+}
+
+// LongLived 一个登记在 ConnRegistry 中的长连接
+type LongLived struct {
+	reg    *ConnRegistry
+	closer io.Closer
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu         sync.Mutex
+	notified   bool
+	onShutdown []func()
+	doneOnce   sync.Once
+}
+
+// RegisterConn 在处理请求的服务的登记表中登记一个长连接，closer 用于强制关闭，可以为 nil。
+// 处理器结束时必须调用 Done：
+//
+//	func Events(w http.ResponseWriter, r *http.Request) {
+//		conn := api.RegisterConn(r, nil)
+//		defer conn.Done()
+//		for {
+//			select {
+//			case <-conn.Context().Done():
+//				fmt.Fprint(w, "event: bye\ndata: server shutting down\n\n")
+//				return
+//			case <-r.Context().Done():
+//				return
+//			case ev := <-events:
+//				...
+//			}
+//		}
+//	}
+//
+// 请求不是由 RunWithOpts 启动的服务处理时，返回的长连接不会收到关闭通知
+func RegisterConn(r *http.Request, closer io.Closer) *LongLived {
+	reg, _ := r.Context().Value(ConnRegistryCtxKey).(*ConnRegistry)
+	if reg == nil {
+		reg = NewConnRegistry()
+	}
+	return reg.Register(closer)
+}
+
+// Context 返回一个在服务开始关闭时被取消的上下文
+func (l *LongLived) Context() context.Context {
+	return l.ctx
+}
+
+// OnShutdown 注册服务开始关闭时执行的回调，例如发送 WebSocket 关闭帧，
+// 服务已经开始关闭时回调会立即执行
+func (l *LongLived) OnShutdown(fn func()) {
+	l.mu.Lock()
+	if !l.notified {
+		l.onShutdown = append(l.onShutdown, fn)
+		l.mu.Unlock()
+		return
+	}
+	l.mu.Unlock()
+	fn()
+}
+
+// Done 表示长连接已经结束，将它从登记表中移除，可以多次调用
+func (l *LongLived) Done() {
+	l.doneOnce.Do(func() {
+		l.cancel()
+		l.reg.remove(l)
+	})
+}
+
+// notify 通知长连接服务即将关闭
+func (l *LongLived) notify() {
+	l.mu.Lock()
+	if l.notified {
+		l.mu.Unlock()
+		return
+	}
+	l.notified = true
+	fns := l.onShutdown
+	l.onShutdown = nil
+	l.mu.Unlock()
+
+	l.cancel()
+	for _, fn := range fns {
+		func() {
+			defer func() {
+				if rvr := recover(); rvr != nil {
+					log.Printf("长连接关闭回调异常：%v\n", rvr)
+				}
+			}()
+			fn()
+		}()
+	}
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type testCloser struct{ closed int32 }
+
+func (c *testCloser) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	return nil
+}
+
+func TestConnRegistryDrain(t *testing.T) {
+	reg := NewConnRegistry()
+
+	polite := reg.Register(nil)
+	polite.OnShutdown(func() { polite.Done() })
+
+	stubborn := &testCloser{}
+	reg.Register(stubborn)
+
+	if reg.Len() != 2 {
+		t.Fatalf("expecting 2 registered connections but got %d", reg.Len())
+	}
+
+	forced := reg.Drain(context.Background(), 50*time.Millisecond)
+	if forced != 1 {
+		t.Fatalf("expecting 1 forced connection but got %d", forced)
+	}
+	if atomic.LoadInt32(&stubborn.closed) != 1 {
+		t.Fatal("expecting stubborn connection to be closed")
+	}
+	if reg.Len() != 0 {
+		t.Fatalf("expecting registry to be empty but got %d", reg.Len())
+	}
+
+	// Connections registered while draining are notified right away.
+	late := reg.Register(nil)
+	select {
+	case <-late.Context().Done():
+	default:
+		t.Fatal("expecting late connection to be notified")
+	}
+	late.Done()
+}
+
+func TestConnRegistryDrainAllDone(t *testing.T) {
+	reg := NewConnRegistry()
+	for i := 0; i < 3; i++ {
+		l := reg.Register(nil)
+		go func() {
+			<-l.Context().Done()
+			l.Done()
+		}()
+	}
+
+	start := time.Now()
+	if forced := reg.Drain(context.Background(), time.Second); forced != 0 {
+		t.Fatalf("expecting no forced connections but got %d", forced)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatal("expecting drain to return once all connections are done")
+	}
+}
+
+func TestServeDrainLongLived(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+
+	r := NewRouter()
+	r.Get("/events", func(w http.ResponseWriter, r *http.Request) {
+		conn := RegisterConn(r, nil)
+		defer conn.Done()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: hello\n\n")
+		w.(http.Flusher).Flush()
+
+		<-conn.Context().Done()
+		fmt.Fprint(w, "data: bye\n\n")
+	})
+	r.Get("/ws", func(w http.ResponseWriter, r *http.Request) {
+		c, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n\r\n")
+		rw.Flush()
+		// Register after the handshake so OnShutdown never writes concurrently with it.
+		conn := RegisterConn(r, c)
+		conn.OnShutdown(func() {
+			rw.WriteString("closing\n")
+			rw.Flush()
+		})
+		// Never calls Done, so the registry has to force-close it.
+	})
+
+	stop := make(chan os.Signal, 1)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- serve(ln, r, RunOpts{DrainTimeout: 100 * time.Millisecond}, stop)
+	}()
+
+	resp, err := http.Get("http://" + addr + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	events := bufio.NewReader(resp.Body)
+	if line, _ := events.ReadString('\n'); line != "data: hello\n" {
+		t.Fatalf("expecting first event but got '%s'", line)
+	}
+
+	ws, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	io.WriteString(ws, "GET /ws HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	wsr := bufio.NewReader(ws)
+	if line, _ := wsr.ReadString('\n'); !strings.HasPrefix(line, "HTTP/1.1 101") {
+		t.Fatalf("expecting upgrade response but got '%s'", line)
+	}
+	wsr.ReadString('\n')
+
+	stop <- syscall.SIGTERM
+
+	// The SSE handler gets to send its final event.
+	body, _ := io.ReadAll(events)
+	if !strings.Contains(string(body), "data: bye") {
+		t.Fatalf("expecting final event but got '%s'", body)
+	}
+
+	// The hijacked connection is notified, then force-closed after the drain window.
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if line, _ := wsr.ReadString('\n'); line != "closing\n" {
+		t.Fatalf("expecting close notification but got '%s'", line)
+	}
+	if _, err := wsr.ReadByte(); err != io.EOF {
+		t.Fatalf("expecting hijacked connection to be closed but got %v", err)
+	}
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"golang.org/x/net/http/httpguts"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// maxH2CUpgradeBody 通过 Upgrade: h2c 升级的首个请求会被完整读入内存，这里限制它的大小
+var maxH2CUpgradeBody int64 = 1 << 20
+
+// H2CHandler 返回一个支持 h2c（明文 HTTP/2）的处理器，适合服务之间不经过 TLS 的内部调用。
+// 同时支持两种建立 h2c 连接的方式：
+//
+//   - prior knowledge：客户端直接发送 HTTP/2 连接前言（RFC 7540 3.4）
+//   - Upgrade: h2c：客户端先发送 HTTP/1.1 请求并要求升级（RFC 7540 3.2）
+//
+// 其他请求仍然以 HTTP/1.1 交给 h 处理。被劫持的 h2c 连接需要 s 参与优雅关机，
+// 因此 s 应当先通过 http2.ConfigureServer 与 http.Server 关联，RunOpts.H2C 会自动完成这一步。
+func H2CHandler(h http.Handler, s *http2.Server) http.Handler {
+	upgraded := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 升级后的首个请求在 stream 1 上以 HTTP/2 处理，但仍然是原来的 HTTP/1.1 请求，
+		// 依赖 r.ProtoMajor 的中间件（例如 middleware.NewWrapResponseWriter）需要看到正确的协议版本
+		if r.ProtoMajor == 1 && isH2CUpgrade(r.Header) {
+			r.Proto, r.ProtoMajor, r.ProtoMinor = "HTTP/2.0", 2, 0
+			r.Header.Del("Upgrade")
+			r.Header.Del("Connection")
+			r.Header.Del("Http2-Settings")
+		}
+		h.ServeHTTP(w, r)
+	})
+	hh := h2c.NewHandler(upgraded, s)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isH2CUpgrade(r.Header) {
+			// h2c.NewHandler 读取请求体失败时响应 500，因此在交给它之前检查大小并响应 413
+			if r.ContentLength > maxH2CUpgradeBody {
+				http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if r.ContentLength < 0 {
+				// 长度未知的请求体先读到内存中，不超过限制时再交给 h2c.NewHandler
+				body, err := io.ReadAll(io.LimitReader(r.Body, maxH2CUpgradeBody+1))
+				if err != nil {
+					http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+					return
+				}
+				if int64(len(body)) > maxH2CUpgradeBody {
+					http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				r.ContentLength = int64(len(body))
+			}
+		}
+		hh.ServeHTTP(w, r)
+	})
+}
+
+// isH2CUpgrade 判断请求是否要求升级为 h2c，与 h2c.NewHandler 的判断一致
+func isH2CUpgrade(h http.Header) bool {
+	return httpguts.HeaderValuesContainsToken(h["Upgrade"], "h2c") &&
+		httpguts.HeaderValuesContainsToken(h["Connection"], "HTTP2-Settings")
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+func newH2CTestServer(t *testing.T) *httptest.Server {
+	r := NewRouter()
+	r.Post("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte(r.Proto + " " + string(body)))
+	})
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+
+	ts := httptest.NewUnstartedServer(nil)
+	h2s := &http2.Server{}
+	if err := http2.ConfigureServer(ts.Config, h2s); err != nil {
+		t.Fatal(err)
+	}
+	ts.Config.Handler = H2CHandler(r, h2s)
+	ts.Start()
+	return ts
+}
+
+func TestH2CPriorKnowledge(t *testing.T) {
+	ts := newH2CTestServer(t)
+	defer ts.Close()
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+
+	resp, err := client.Post(ts.URL+"/echo", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "HTTP/2.0 hello" {
+		t.Fatalf("expecting 'HTTP/2.0 hello' but got '%s'", body)
+	}
+}
+
+func TestH2CHTTP1Fallback(t *testing.T) {
+	ts := newH2CTestServer(t)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "HTTP/1.1" {
+		t.Fatalf("expecting 'HTTP/1.1' but got '%s'", body)
+	}
+}
+
+func TestH2CUpgrade(t *testing.T) {
+	ts := newH2CTestServer(t)
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	io.WriteString(conn, "POST /echo HTTP/1.1\r\n"+
+		"Host: localhost\r\n"+
+		"Connection: Upgrade, HTTP2-Settings\r\n"+
+		"Upgrade: h2c\r\n"+
+		"HTTP2-Settings: AAMAAABkAAQAAP__\r\n"+
+		"Content-Length: 5\r\n\r\n"+
+		"hello")
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expecting 101 but got %d", resp.StatusCode)
+	}
+
+	// After the upgrade the client sends the connection preface and the
+	// response to the original request arrives on stream 1.
+	io.WriteString(conn, http2.ClientPreface)
+	framer := http2.NewFramer(conn, br)
+	if err := framer.WriteSettings(); err != nil {
+		t.Fatal(err)
+	}
+
+	var status, body string
+	dec := hpack.NewDecoder(4096, func(f hpack.HeaderField) {
+		if f.Name == ":status" {
+			status = f.Value
+		}
+	})
+	for {
+		f, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				framer.WriteSettingsAck()
+			}
+		case *http2.HeadersFrame:
+			if f.StreamID != 1 {
+				t.Fatalf("expecting response on stream 1 but got %d", f.StreamID)
+			}
+			dec.Write(f.HeaderBlockFragment())
+		case *http2.DataFrame:
+			body += string(f.Data())
+			if f.StreamEnded() {
+				if status != "200" || body != "HTTP/2.0 hello" {
+					t.Fatalf("unexpected response: %s '%s'", status, body)
+				}
+				return
+			}
+		}
+	}
+}
+
+func TestH2CUpgradeTooLarge(t *testing.T) {
+	ts := newH2CTestServer(t)
+	defer ts.Close()
+
+	old := maxH2CUpgradeBody
+	maxH2CUpgradeBody = 4
+	defer func() { maxH2CUpgradeBody = old }()
+
+	for _, framing := range []string{"Content-Length: 5\r\n\r\nhello", "Transfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n"} {
+		conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(conn, "POST /echo HTTP/1.1\r\n"+
+			"Host: localhost\r\n"+
+			"Connection: Upgrade, HTTP2-Settings\r\n"+
+			"Upgrade: h2c\r\n"+
+			"HTTP2-Settings: AAMAAABkAAQAAP__\r\n"+
+			framing)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Fatalf("%q: expecting 413 but got %d", framing, resp.StatusCode)
+		}
+	}
+}
+
+func TestServeH2C(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRouter()
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+
+	stop := make(chan os.Signal, 1)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- serve(ln, r, RunOpts{H2C: true}, stop)
+	}()
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	resp, err := client.Get("http://" + ln.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "HTTP/2.0" {
+		t.Fatalf("expecting 'HTTP/2.0' but got '%s'", body)
+	}
+
+	stop <- syscall.SIGTERM
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,462 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// defaultProxyReadTimeout 读取 PROXY 头的默认超时时间
+	defaultProxyReadTimeout = 5 * time.Second
+
+	// ProxyHeaderCtxKey 是用于存储 PROXY 头的 context.Context 密钥
+	ProxyHeaderCtxKey = &contextKey{"ProxyHeader"}
+
+	// proxyV1Prefix PROXY 协议 v1 的前缀
+	proxyV1Prefix = []byte("PROXY ")
+
+	// proxyV2Signature PROXY 协议 v2 的签名
+	proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	// errProxyHeaderMissing 受信任的连接没有携带 PROXY 头
+	errProxyHeaderMissing = errors.New("api: missing PROXY protocol header")
+)
+
+const (
+	// proxyV1MaxLength v1 头部的最大长度，包括结尾的 CRLF
+	proxyV1MaxLength = 107
+
+	// ProxyCommandLocal 负载均衡自身发起的连接，例如健康检查，此时不替换连接地址
+	ProxyCommandLocal = 0x0
+	// ProxyCommandProxy 代理客户端发起的连接
+	ProxyCommandProxy = 0x1
+)
+
+// 常见的 PROXY 协议 v2 TLV 类型
+const (
+	ProxyTLVALPN      = 0x01
+	ProxyTLVAuthority = 0x02
+	ProxyTLVCRC32C    = 0x03
+	ProxyTLVNoop      = 0x04
+	ProxyTLVUniqueID  = 0x05
+	ProxyTLVSSL       = 0x20
+	ProxyTLVNetNS     = 0x30
+)
+
+// ProxyProtoOpts PROXY 协议的配置项
+type ProxyProtoOpts struct {
+	// TrustedCIDRs 受信任的负载均衡地址段，例如 10.0.0.0/8，只有来自这些地址的连接才会解析 PROXY 头，
+	// 其余连接原样处理。为空时信任所有来源，只应在服务无法被直接访问时这样配置
+	TrustedCIDRs []string
+
+	// ReadTimeout 读取 PROXY 头的超时时间，默认 5 秒
+	ReadTimeout time.Duration
+
+	// RequireHeader 来自受信任地址的连接是否必须携带 PROXY 头，不携带时直接关闭连接
+	RequireHeader bool
+}
+
+// ProxyTLV PROXY 协议 v2 中携带的扩展数据
+type ProxyTLV struct {
+	Type  byte
+	Value []byte
+}
+
+// ProxyHeader 解析后的 PROXY 头
+type ProxyHeader struct {
+	// Version 协议版本，1 或 2
+	Version int
+
+	// Command ProxyCommandLocal 或 ProxyCommandProxy，v1 总是 ProxyCommandProxy
+	Command byte
+
+	// SourceAddr 客户端地址，DestAddr 客户端连接的负载均衡地址，
+	// 地址族未知（v1 的 UNKNOWN 或 v2 的 UNSPEC）时为空
+	SourceAddr net.Addr
+	DestAddr   net.Addr
+
+	// TLVs v2 头部携带的扩展数据
+	TLVs []ProxyTLV
+}
+
+// TLV 返回第一个类型为 typ 的扩展数据
+func (h *ProxyHeader) TLV(typ byte) ([]byte, bool) {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == typ {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// ProxyHeaderFromContext 从请求的上下文中获取 PROXY 头，连接没有携带 PROXY 头时返回 nil
+//
+//	if h := api.ProxyHeaderFromContext(r.Context()); h != nil {
+//		id, _ := h.TLV(api.ProxyTLVUniqueID)
+//	}
+func ProxyHeaderFromContext(ctx context.Context) *ProxyHeader {
+	h, _ := ctx.Value(ProxyHeaderCtxKey).(*ProxyHeader)
+	return h
+}
+
+// NewProxyListener 返回一个解析 PROXY 协议 v1/v2 头部的监听器，
+// 接收到的连接的 RemoteAddr 为真实的客户端地址，因此 r.RemoteAddr 同样是真实的客户端地址。
+//
+// PROXY 头在后台协程中读取，慢速或者恶意的连接不会阻塞其他连接的接收。
+func NewProxyListener(ln net.Listener, opts ProxyProtoOpts) (net.Listener, error) {
+	trusted := make([]*net.IPNet, 0, len(opts.TrustedCIDRs))
+	for _, cidr := range opts.TrustedCIDRs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		trusted = append(trusted, ipNet)
+	}
+	if opts.ReadTimeout <= 0 {
+		opts.ReadTimeout = defaultProxyReadTimeout
+	}
+
+	pl := &proxyListener{
+		Listener: ln,
+		opts:     opts,
+		trusted:  trusted,
+		conns:    make(chan net.Conn),
+		errc:     make(chan error),
+		done:     make(chan struct{}),
+	}
+	go pl.acceptLoop()
+	return pl, nil
+}
+
+// proxyListener 解析 PROXY 头的监听器
+type proxyListener struct {
+	net.Listener
+	opts    ProxyProtoOpts
+	trusted []*net.IPNet
+
+	conns     chan net.Conn
+	errc      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (pl *proxyListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-pl.conns:
+		return c, nil
+	case err := <-pl.errc:
+		return nil, err
+	case <-pl.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (pl *proxyListener) Close() error {
+	pl.closeOnce.Do(func() { close(pl.done) })
+	return pl.Listener.Close()
+}
+
+// acceptLoop 接收原始连接，并在单独的协程中读取 PROXY 头。
+// 与 http.Server.Serve 一样，EMFILE 等临时错误之后等待一段时间继续接收，
+// 只有原始监听器关闭后才退出，否则之后的 Accept 会一直阻塞
+func (pl *proxyListener) acceptLoop() {
+	var tempDelay time.Duration
+	for {
+		c, err := pl.Listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				pl.closeOnce.Do(func() { close(pl.done) })
+				return
+			}
+			select {
+			case pl.errc <- err:
+			case <-pl.done:
+				return
+			}
+			if tempDelay == 0 {
+				tempDelay = 5 * time.Millisecond
+			} else if tempDelay *= 2; tempDelay > time.Second {
+				tempDelay = time.Second
+			}
+			select {
+			case <-time.After(tempDelay):
+			case <-pl.done:
+				return
+			}
+			continue
+		}
+		tempDelay = 0
+		go pl.handshake(c)
+	}
+}
+
+// handshake 读取连接的 PROXY 头，读取失败时关闭连接
+func (pl *proxyListener) handshake(c net.Conn) {
+	if !pl.isTrusted(c.RemoteAddr()) {
+		pl.deliver(c)
+		return
+	}
+
+	c.SetReadDeadline(time.Now().Add(pl.opts.ReadTimeout))
+	br := bufio.NewReader(c)
+	header, err := readProxyHeader(br)
+	if err == nil && header == nil && pl.opts.RequireHeader {
+		err = errProxyHeaderMissing
+	}
+	if err != nil {
+		log.Printf("读取 %s 的 PROXY 头失败：%v\n", c.RemoteAddr(), err)
+		c.Close()
+		return
+	}
+	c.SetReadDeadline(time.Time{})
+
+	pl.deliver(&proxyConn{bufferedConn: bufferedConn{Conn: c, r: br}, header: header})
+}
+
+// deliver 将连接交给 Accept 的调用方，监听器已关闭时关闭连接
+func (pl *proxyListener) deliver(c net.Conn) {
+	select {
+	case pl.conns <- c:
+	case <-pl.done:
+		c.Close()
+	}
+}
+
+// isTrusted 判断连接是否来自受信任的负载均衡
+func (pl *proxyListener) isTrusted(addr net.Addr) bool {
+	if len(pl.trusted) == 0 {
+		return true
+	}
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, ipNet := range pl.trusted {
+		if ipNet.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedConn 先读取解析 PROXY 头时 bufio.Reader 多读的数据，再从原始连接读取，
+// 缓冲的数据读完后不再经过 bufio.Reader
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	if c.r == nil {
+		return c.Conn.Read(p)
+	}
+	n := c.r.Buffered()
+	if n == 0 {
+		c.r = nil
+		return c.Conn.Read(p)
+	}
+	if n < len(p) {
+		p = p[:n]
+	}
+	return c.r.Read(p)
+}
+
+// proxyConn 携带 PROXY 头的连接
+type proxyConn struct {
+	bufferedConn
+	header *ProxyHeader
+}
+
+// RemoteAddr 返回 PROXY 头中的客户端地址
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.header != nil && c.header.Command == ProxyCommandProxy && c.header.SourceAddr != nil {
+		return c.header.SourceAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr 返回 PROXY 头中客户端连接的地址
+func (c *proxyConn) LocalAddr() net.Addr {
+	if c.header != nil && c.header.Command == ProxyCommandProxy && c.header.DestAddr != nil {
+		return c.header.DestAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+// NetConn 返回原始连接
+func (c *proxyConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// readProxyHeader 读取 PROXY 头，连接没有携带 PROXY 头时返回 nil
+func readProxyHeader(br *bufio.Reader) (*ProxyHeader, error) {
+	// 连接建立后客户端可能不会立即发送数据，这里按需读取，避免等待不存在的数据
+	for i := 1; i <= len(proxyV2Signature); i++ {
+		b, err := br.Peek(i)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.HasPrefix(proxyV1Prefix, b[:min(i, len(proxyV1Prefix))]) && !bytes.HasPrefix(proxyV2Signature, b) {
+			return nil, nil
+		}
+		if i == len(proxyV1Prefix) && bytes.Equal(b, proxyV1Prefix) {
+			return readProxyHeaderV1(br)
+		}
+	}
+	return readProxyHeaderV2(br)
+}
+
+// readProxyHeaderV1 解析文本格式的 v1 头部，例如 "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"
+func readProxyHeaderV1(br *bufio.Reader) (*ProxyHeader, error) {
+	var line []byte
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= proxyV1MaxLength {
+			return nil, errors.New("api: PROXY v1 header too long")
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, errors.New("api: PROXY v1 header must end with CRLF")
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	header := &ProxyHeader{Version: 1, Command: ProxyCommandProxy}
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return header, nil
+	}
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("api: invalid PROXY v1 header %q", line)
+	}
+
+	src, dst := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	if src == nil || dst == nil {
+		return nil, fmt.Errorf("api: invalid PROXY v1 address in %q", line)
+	}
+	switch fields[1] {
+	case "TCP4":
+		if src.To4() == nil || dst.To4() == nil {
+			return nil, fmt.Errorf("api: expecting IPv4 addresses in %q", line)
+		}
+	case "TCP6":
+		if src.To4() != nil || dst.To4() != nil {
+			return nil, fmt.Errorf("api: expecting IPv6 addresses in %q", line)
+		}
+	default:
+		return nil, fmt.Errorf("api: unsupported PROXY v1 protocol %q", fields[1])
+	}
+	srcPort, err := parseProxyPort(fields[4])
+	if err != nil {
+		return nil, err
+	}
+	dstPort, err := parseProxyPort(fields[5])
+	if err != nil {
+		return nil, err
+	}
+
+	header.SourceAddr = &net.TCPAddr{IP: src, Port: srcPort}
+	header.DestAddr = &net.TCPAddr{IP: dst, Port: dstPort}
+	return header, nil
+}
+
+// parseProxyPort 解析 v1 头部中的端口
+func parseProxyPort(s string) (int, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 0 || port > 65535 || (len(s) > 1 && s[0] == '0') {
+		return 0, fmt.Errorf("api: invalid PROXY v1 port %q", s)
+	}
+	return port, nil
+}
+
+// readProxyHeaderV2 解析二进制格式的 v2 头部
+func readProxyHeaderV2(br *bufio.Reader) (*ProxyHeader, error) {
+	var fixed [16]byte
+	if _, err := io.ReadFull(br, fixed[:]); err != nil {
+		return nil, err
+	}
+	if fixed[12]>>4 != 2 {
+		return nil, fmt.Errorf("api: unsupported PROXY protocol version %d", fixed[12]>>4)
+	}
+	header := &ProxyHeader{Version: 2, Command: fixed[12] & 0x0f}
+	if header.Command != ProxyCommandLocal && header.Command != ProxyCommandProxy {
+		return nil, fmt.Errorf("api: unsupported PROXY v2 command %d", header.Command)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(fixed[14:16]))
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return nil, err
+	}
+
+	// 地址部分的长度取决于地址族
+	var addrLen int
+	family, transport := fixed[13]>>4, fixed[13]&0x0f
+	switch family {
+	case 0x0:
+		addrLen = 0
+	case 0x1:
+		addrLen = 12
+	case 0x2:
+		addrLen = 36
+	case 0x3:
+		addrLen = 216
+	default:
+		return nil, fmt.Errorf("api: unsupported PROXY v2 address family %d", family)
+	}
+	if len(payload) < addrLen {
+		return nil, errors.New("api: PROXY v2 header too short for its address family")
+	}
+
+	addr := payload[:addrLen]
+	switch family {
+	case 0x1, 0x2:
+		ipLen := 4
+		if family == 0x2 {
+			ipLen = 16
+		}
+		src := net.IP(append([]byte(nil), addr[:ipLen]...))
+		dst := net.IP(append([]byte(nil), addr[ipLen:2*ipLen]...))
+		srcPort := int(binary.BigEndian.Uint16(addr[2*ipLen:]))
+		dstPort := int(binary.BigEndian.Uint16(addr[2*ipLen+2:]))
+		if transport == 0x2 {
+			header.SourceAddr = &net.UDPAddr{IP: src, Port: srcPort}
+			header.DestAddr = &net.UDPAddr{IP: dst, Port: dstPort}
+		} else {
+			header.SourceAddr = &net.TCPAddr{IP: src, Port: srcPort}
+			header.DestAddr = &net.TCPAddr{IP: dst, Port: dstPort}
+		}
+	case 0x3:
+		header.SourceAddr = &net.UnixAddr{Name: string(bytes.TrimRight(addr[:108], "\x00")), Net: "unix"}
+		header.DestAddr = &net.UnixAddr{Name: string(bytes.TrimRight(addr[108:], "\x00")), Net: "unix"}
+	}
+
+	tlvs := payload[addrLen:]
+	for len(tlvs) > 0 {
+		if len(tlvs) < 3 {
+			return nil, errors.New("api: truncated PROXY v2 TLV")
+		}
+		n := int(binary.BigEndian.Uint16(tlvs[1:3]))
+		if len(tlvs) < 3+n {
+			return nil, errors.New("api: truncated PROXY v2 TLV")
+		}
+		header.TLVs = append(header.TLVs, ProxyTLV{Type: tlvs[0], Value: tlvs[3 : 3+n]})
+		tlvs = tlvs[3+n:]
+	}
+	return header, nil
+}
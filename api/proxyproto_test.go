@@ -0,0 +1,265 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// proxyV2Header builds a PROXY v2 header for a TCP4 connection with the
+// given TLVs.
+func proxyV2Header(cmd byte, src, dst string, srcPort, dstPort uint16, tlvs ...ProxyTLV) []byte {
+	var payload bytes.Buffer
+	payload.Write(net.ParseIP(src).To4())
+	payload.Write(net.ParseIP(dst).To4())
+	binary.Write(&payload, binary.BigEndian, srcPort)
+	binary.Write(&payload, binary.BigEndian, dstPort)
+	for _, tlv := range tlvs {
+		payload.WriteByte(tlv.Type)
+		binary.Write(&payload, binary.BigEndian, uint16(len(tlv.Value)))
+		payload.Write(tlv.Value)
+	}
+
+	var b bytes.Buffer
+	b.Write(proxyV2Signature)
+	b.WriteByte(0x20 | cmd)
+	b.WriteByte(0x11)
+	binary.Write(&b, binary.BigEndian, uint16(payload.Len()))
+	b.Write(payload.Bytes())
+	return b.Bytes()
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		version int
+		src     string
+		rest    string
+		wantErr bool
+	}{
+		{"v1 tcp4", "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\nGET", 1, "192.168.0.1:56324", "GET", false},
+		{"v1 tcp6", "PROXY TCP6 2001:db8::1 2001:db8::2 4000 443\r\nGET", 1, "[2001:db8::1]:4000", "GET", false},
+		{"v1 unknown", "PROXY UNKNOWN\r\nGET", 1, "", "GET", false},
+		{"v1 bad port", "PROXY TCP4 1.1.1.1 2.2.2.2 99999 443\r\n", 0, "", "", true},
+		{"v1 family mismatch", "PROXY TCP4 2001:db8::1 2.2.2.2 1 443\r\n", 0, "", "", true},
+		{"v1 missing crlf", "PROXY TCP4 1.1.1.1 2.2.2.2 1 443\n", 0, "", "", true},
+		{"v1 too long", "PROXY " + strings.Repeat("A", 200), 0, "", "", true},
+		{"v2 tcp4", string(proxyV2Header(ProxyCommandProxy, "10.1.2.3", "10.0.0.1", 5000, 80)) + "GET", 2, "10.1.2.3:5000", "GET", false},
+		{"none", "GET / HTTP/1.1\r\n", 0, "", "GET / HTTP/1.1\r\n", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			br := bufio.NewReader(strings.NewReader(tt.input))
+			h, err := readProxyHeader(br)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expecting error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.version == 0 {
+				if h != nil {
+					t.Fatalf("expecting no header but got %+v", h)
+				}
+			} else {
+				if h.Version != tt.version {
+					t.Fatalf("expecting version %d but got %d", tt.version, h.Version)
+				}
+				if tt.src != "" && h.SourceAddr.String() != tt.src {
+					t.Fatalf("expecting source %s but got %s", tt.src, h.SourceAddr)
+				}
+			}
+			rest, _ := io.ReadAll(br)
+			if string(rest) != tt.rest {
+				t.Fatalf("expecting remaining '%s' but got '%s'", tt.rest, rest)
+			}
+		})
+	}
+}
+
+func TestReadProxyHeaderV2TLV(t *testing.T) {
+	raw := proxyV2Header(ProxyCommandProxy, "10.1.2.3", "10.0.0.1", 5000, 80,
+		ProxyTLV{Type: ProxyTLVUniqueID, Value: []byte("conn-1")},
+		ProxyTLV{Type: ProxyTLVAuthority, Value: []byte("example.com")})
+
+	h, err := readProxyHeader(bufio.NewReader(bytes.NewReader(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := h.TLV(ProxyTLVAuthority); !ok || string(v) != "example.com" {
+		t.Fatalf("expecting authority TLV 'example.com' but got '%s'", v)
+	}
+	if _, ok := h.TLV(ProxyTLVSSL); ok {
+		t.Fatal("expecting no SSL TLV")
+	}
+
+	// Truncated TLVs are rejected.
+	raw = proxyV2Header(ProxyCommandProxy, "10.1.2.3", "10.0.0.1", 5000, 80, ProxyTLV{Type: 0xE0, Value: []byte("x")})
+	raw[15]--
+	if _, err := readProxyHeader(bufio.NewReader(bytes.NewReader(raw[:len(raw)-1]))); err == nil {
+		t.Fatal("expecting truncated TLV error")
+	}
+}
+
+func TestServeProxyProtocol(t *testing.T) {
+	r := NewRouter()
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		id := ""
+		if h := ProxyHeaderFromContext(r.Context()); h != nil {
+			v, _ := h.TLV(ProxyTLVUniqueID)
+			id = string(v)
+		}
+		w.Write([]byte(r.RemoteAddr + " " + id))
+	})
+
+	start := func(opts ProxyProtoOpts) (string, chan os.Signal, chan error) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		stop := make(chan os.Signal, 1)
+		errc := make(chan error, 1)
+		go func() {
+			errc <- serve(ln, r, RunOpts{ProxyProtocol: &opts}, stop)
+		}()
+		return ln.Addr().String(), stop, errc
+	}
+	get := func(addr string, header []byte) string {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.Write(header)
+		io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			return err.Error()
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	addr, stop, errc := start(ProxyProtoOpts{TrustedCIDRs: []string{"127.0.0.0/8"}, ReadTimeout: 200 * time.Millisecond})
+
+	// A stalled client does not block other connections.
+	stalled, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stalled.Close()
+
+	if body := get(addr, []byte("PROXY TCP4 203.0.113.7 10.0.0.1 40000 80\r\n")); body != "203.0.113.7:40000 " {
+		t.Fatalf("expecting v1 client address but got '%s'", body)
+	}
+	v2 := proxyV2Header(ProxyCommandProxy, "198.51.100.9", "10.0.0.1", 41000, 80, ProxyTLV{Type: ProxyTLVUniqueID, Value: []byte("abc")})
+	if body := get(addr, v2); body != "198.51.100.9:41000 abc" {
+		t.Fatalf("expecting v2 client address and TLV but got '%s'", body)
+	}
+	if body := get(addr, nil); !strings.HasPrefix(body, "127.0.0.1:") {
+		t.Fatalf("expecting connection address without header but got '%s'", body)
+	}
+	stop <- syscall.SIGTERM
+	<-errc
+
+	// Headers from untrusted sources are not interpreted.
+	addr, stop, errc = start(ProxyProtoOpts{TrustedCIDRs: []string{"10.0.0.0/8"}})
+	if body := get(addr, []byte("PROXY TCP4 203.0.113.7 10.0.0.1 40000 80\r\n")); strings.Contains(body, "203.0.113.7") {
+		t.Fatalf("expecting untrusted PROXY header to be ignored but got '%s'", body)
+	}
+	stop <- syscall.SIGTERM
+	<-errc
+
+	// Trusted sources must send a header when it is required.
+	addr, stop, errc = start(ProxyProtoOpts{RequireHeader: true})
+	if body := get(addr, nil); strings.HasPrefix(body, "127.0.0.1:") {
+		t.Fatalf("expecting connection without header to be rejected but got '%s'", body)
+	}
+	stop <- syscall.SIGTERM
+	<-errc
+}
+
+// flakyListener 先返回若干次临时错误，之后返回 net.Pipe 的一端
+type flakyListener struct {
+	net.Listener
+	errs   int
+	closed chan struct{}
+}
+
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "accept: too many open files" }
+func (temporaryError) Timeout() bool   { return false }
+func (temporaryError) Temporary() bool { return true }
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.errs > 0 {
+		l.errs--
+		return nil, temporaryError{}
+	}
+	select {
+	case <-l.closed:
+		return nil, net.ErrClosed
+	default:
+	}
+	c, _ := net.Pipe()
+	return c, nil
+}
+
+func (l *flakyListener) Close() error { return nil }
+
+func TestProxyListenerAcceptErrors(t *testing.T) {
+	raw := &flakyListener{errs: 3, closed: make(chan struct{})}
+	ln, err := NewProxyListener(raw, ProxyProtoOpts{TrustedCIDRs: []string{"10.0.0.0/8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 临时错误交给调用方，之后仍然可以继续接收连接
+	for i := 0; i < 3; i++ {
+		if _, err := ln.Accept(); err == nil {
+			t.Fatalf("expecting a temporary error")
+		}
+	}
+	c, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("expecting a connection after temporary errors but got %v", err)
+	}
+	c.Close()
+
+	// 原始监听器关闭后 Accept 返回 net.ErrClosed，而不是一直阻塞
+	close(raw.closed)
+	errc := make(chan error, 1)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				errc <- err
+				return
+			}
+			c.Close()
+		}
+	}()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Fatalf("expecting net.ErrClosed but got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Accept blocked after the listener was closed")
+	}
+}
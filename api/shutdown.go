@@ -3,13 +3,63 @@ package api
 import (
 	"context"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
 	"time"
+
+	"golang.org/x/net/http2"
 )
 
+var (
+	// defaultShutdownTimeout 优雅关机的默认宽限期
+	defaultShutdownTimeout = 30 * time.Second
+
+	// shuttingDown 标记服务是否已经进入关闭流程
+	shuttingDown int32
+)
+
+// RunOpts 启动服务的配置项
+type RunOpts struct {
+	// ShutdownTimeout 优雅关机的宽限期，超时后强制退出，默认 30 秒
+	ShutdownTimeout time.Duration
+
+	// ShutdownDelay 收到退出信号并将服务标记为未就绪后，
+	// 等待负载均衡摘除流量的时间，之后才开始关闭服务
+	ShutdownDelay time.Duration
+
+	// Funcs 被注册的退出方法，当监听到退出信号的时候自动执行
+	Funcs []func()
+
+	// TLS 不为空时启动 HTTPS 服务
+	TLS *TLSOpts
+
+	// H2C 在明文 TCP 上同时支持 HTTP/2，适合服务之间的内部调用，详见 H2CHandler
+	H2C bool
+
+	// ProxyProtocol 不为空时解析负载均衡发送的 PROXY 协议头，详见 NewProxyListener
+	ProxyProtocol *ProxyProtoOpts
+
+	// ConnLimit 不为空时限制连接数以及读取请求头、空闲连接的超时时间，详见 ConnLimiter
+	ConnLimit *ConnLimiter
+
+	// Diagnostics 不为空时，服务收到 SIGUSR1 信号后导出诊断包，详见 Diagnostics
+	Diagnostics *DiagOpts
+
+	// DrainTimeout 关闭服务时，通过 RegisterConn 登记的长连接收到通知后的收尾时间，
+	// 超时后强制关闭，默认 10 秒，不会超过 ShutdownTimeout
+	DrainTimeout time.Duration
+}
+
+// ShuttingDown 判断服务是否已经进入关闭流程
+// 收到退出信号后立即返回 true，就绪检查可以据此让负载均衡摘除流量
+func ShuttingDown() bool {
+	return atomic.LoadInt32(&shuttingDown) == 1
+}
+
 // Run 天然支持优雅退出的一种启动方式
 // @param addr 服务地址
 // @param router 路由对象，调用 api.NewRouter() 生成
@@ -22,51 +72,177 @@ func Run(addr string, router http.Handler) {
 // @param router 路由对象，调用 api.NewRouter() 生成
 // @param funcs 被注册的退出方法，当监听到退出信号的时候自动执行
 func RunWith(addr string, router http.Handler, funcs ...func()) {
-	// 创建服务
-	server := &http.Server{Addr: addr, Handler: router}
+	RunWithOpts(addr, router, RunOpts{Funcs: funcs})
+}
+
+// RunWithOpts 使用自定义配置启动服务，同样支持优雅退出
+// @param addr 服务地址
+// @param router 路由对象，调用 api.NewRouter() 生成
+// @param opts 启动配置
+func RunWithOpts(addr string, router http.Handler, opts RunOpts) {
 	log.Printf("采用优雅退出的方式启动服务，该HTTP服务将在 %s 启动，当监听到退出信号时会主动释放资源后再退出\n", addr)
 
-	// 创建服务的上下文
-	serverCtx, serverStopCtx := context.WithCancel(context.Background())
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// 监听退出的信号
 	sig := make(chan os.Signal, 1)
 	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer signal.Stop(sig)
+
+	// 收到 SIGUSR1 信号时导出诊断包
+	if opts.Diagnostics != nil {
+		diag := NewDiagnostics(*opts.Diagnostics, router)
+		router = diag.Handler(router)
+
+		diagSig := make(chan os.Signal, 1)
+		notifyDiagnostics(diagSig)
+		defer signal.Stop(diagSig)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go diag.watch(ctx, diagSig)
+	}
+
+	if err = serve(ln, router, opts, sig); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// serve 在 ln 上运行服务，直到 stop 收到信号后执行优雅关机
+func serve(ln net.Listener, router http.Handler, opts RunOpts, stop <-chan os.Signal) error {
+	if opts.ShutdownTimeout <= 0 {
+		opts.ShutdownTimeout = defaultShutdownTimeout
+	}
+	if opts.DrainTimeout <= 0 {
+		opts.DrainTimeout = defaultDrainTimeout
+	}
+
+	// 解析 PROXY 协议头
+	if opts.ProxyProtocol != nil {
+		pl, err := NewProxyListener(ln, *opts.ProxyProtocol)
+		if err != nil {
+			return err
+		}
+		ln = pl
+	}
+
+	// 限制连接数
+	if opts.ConnLimit != nil {
+		ln = opts.ConnLimit.Listener(ln)
+	}
+
+	// 创建服务，长连接登记表可以从所有请求的上下文中获取
+	registry := NewConnRegistry()
+	server := &http.Server{
+		Handler:     router,
+		ConnContext: connContext,
+		BaseContext: func(net.Listener) context.Context {
+			return context.WithValue(context.Background(), ConnRegistryCtxKey, registry)
+		},
+	}
+	if opts.ConnLimit != nil {
+		opts.ConnLimit.configure(server)
+	}
+	atomic.StoreInt32(&shuttingDown, 0)
+
+	// 服务的生命周期，服务退出时停止后台任务
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 配置 TLS，并定期检查证书文件是否变化
+	if opts.TLS != nil {
+		config, store, err := NewTLSConfig(*opts.TLS)
+		if err != nil {
+			return err
+		}
+		server.TLSConfig = config
+
+		interval := opts.TLS.ReloadInterval
+		if interval == 0 {
+			interval = defaultCertReloadInterval
+		}
+		if interval > 0 {
+			go store.Watch(ctx, interval)
+		}
+	}
+
+	// 在明文连接上支持 HTTP/2
+	if opts.H2C && opts.TLS == nil {
+		h2s := &http2.Server{}
+		if err := http2.ConfigureServer(server, h2s); err != nil {
+			return err
+		}
+		server.Handler = H2CHandler(router, h2s)
+	}
+
+	// 服务退出的错误
+	done := make(chan error, 1)
 	go func() {
-		<-sig
-		log.Println("监听到退出信号，等待服务器关闭，30秒后将强制关闭服务")
+		<-stop
+		log.Printf("监听到退出信号，等待服务器关闭，%s后将强制关闭服务\n", opts.ShutdownTimeout)
+
+		// 先标记为未就绪，让负载均衡有机会摘除流量
+		atomic.StoreInt32(&shuttingDown, 1)
+		if opts.ShutdownDelay > 0 {
+			log.Printf("服务已标记为未就绪，%s后开始关闭\n", opts.ShutdownDelay)
+			time.Sleep(opts.ShutdownDelay)
+		}
 
 		// 执行退出方法
 		log.Println("执行被注册的退出方法")
-		for _, f := range funcs {
+		for _, f := range opts.Funcs {
 			f()
 		}
 
-		// 关闭信号，宽限期为 30 秒
-		shutdownCtx, _ := context.WithTimeout(serverCtx, 30*time.Second)
-
+		// 触发优雅关机，同时通知长连接收尾
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), opts.ShutdownTimeout)
+		defer cancel()
+		drained := make(chan struct{})
 		go func() {
-			<-shutdownCtx.Done()
-			if shutdownCtx.Err() == context.DeadlineExceeded {
-				log.Fatal("优雅关机超时......强制退出。")
+			defer close(drained)
+			if n := registry.Drain(shutdownCtx, opts.DrainTimeout); n > 0 {
+				log.Printf("强制关闭了 %d 个未在收尾时间内结束的长连接\n", n)
 			}
 		}()
-
-		// 触发优雅关机
 		log.Println("等待其他服务器资源关闭...")
 		err := server.Shutdown(shutdownCtx)
-		if err != nil {
-			log.Fatal(err)
+		<-drained
+		if err == context.DeadlineExceeded {
+			log.Println("优雅关机超时......强制退出。")
+			server.Close()
 		}
-		serverStopCtx()
+		done <- err
 	}()
 
 	// 运行服务器
-	err := server.ListenAndServe()
+	var err error
+	if opts.TLS != nil {
+		err = server.ServeTLS(ln, "", "")
+	} else {
+		err = server.Serve(ln)
+	}
 	if err != nil && err != http.ErrServerClosed {
-		log.Fatal(err)
+		return err
 	}
 
-	// 等待服务器上下文停止
-	<-serverCtx.Done()
+	// 等待优雅关机完成
+	return <-done
+}
+
+// connContext 将连接相关的数据保存到连接的上下文中，该连接上的所有请求都可以获取这些数据
+func connContext(ctx context.Context, c net.Conn) context.Context {
+	for c != nil {
+		if pc, ok := c.(*proxyConn); ok && pc.header != nil {
+			ctx = context.WithValue(ctx, ProxyHeaderCtxKey, pc.header)
+		}
+		nc, ok := c.(interface{ NetConn() net.Conn })
+		if !ok {
+			break
+		}
+		c = nc.NetConn()
+	}
+	return ctx
 }
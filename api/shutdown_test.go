@@ -0,0 +1,75 @@
+package api
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestServeGracefulShutdown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := NewRouter()
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	called := make(chan struct{}, 1)
+	stop := make(chan os.Signal, 1)
+	errc := make(chan error, 1)
+	opts := RunOpts{
+		ShutdownDelay: 100 * time.Millisecond,
+		Funcs:         []func(){func() { called <- struct{}{} }},
+	}
+	go func() {
+		errc <- serve(ln, r, opts, stop)
+	}()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" {
+		t.Fatalf("expecting 'ok' but got '%s'", body)
+	}
+	if ShuttingDown() {
+		t.Fatal("expecting server not to be shutting down yet")
+	}
+
+	stop <- syscall.SIGTERM
+	time.Sleep(20 * time.Millisecond)
+	if !ShuttingDown() {
+		t.Fatal("expecting server to be shutting down")
+	}
+
+	// The server keeps serving during the shutdown delay.
+	resp, err = http.Get("http://" + ln.Addr().String() + "/")
+	if err != nil {
+		t.Fatalf("expecting server to serve during shutdown delay: %v", err)
+	}
+	resp.Body.Close()
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+
+	select {
+	case <-called:
+	default:
+		t.Fatal("expecting registered shutdown func to be called")
+	}
+}
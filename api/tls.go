@@ -0,0 +1,307 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	// defaultCertReloadInterval 检查证书文件是否变化的默认间隔
+	defaultCertReloadInterval = 30 * time.Second
+)
+
+// CertKeyPair 一组证书文件和私钥文件
+type CertKeyPair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// TLSOpts TLS 服务的配置项
+type TLSOpts struct {
+	// Certificates 证书列表，第一个为默认证书，其余证书根据客户端的 SNI 选择
+	Certificates []CertKeyPair
+
+	// MinVersion 允许的最低 TLS 版本，默认 TLS 1.2
+	MinVersion uint16
+
+	// CipherSuites 允许的加密套件，为空时使用标准库的默认值，对 TLS 1.3 无效
+	CipherSuites []uint16
+
+	// ReloadInterval 检查证书文件是否变化的间隔，默认 30 秒，小于 0 时不检查
+	ReloadInterval time.Duration
+
+	// ClientCAFiles 验证客户端证书的 CA 证书文件（PEM），和服务端证书一样支持热加载
+	ClientCAFiles []string
+
+	// ClientAuth 客户端证书的验证方式，设置了 ClientCAFiles 时默认为 tls.VerifyClientCertIfGiven，
+	// 否则默认不要求客户端证书。内部服务之间的双向认证通常使用 tls.RequireAndVerifyClientCert
+	ClientAuth tls.ClientAuthType
+}
+
+// RunTLS 使用证书启动 HTTPS 服务，同样支持优雅退出
+// @param addr 服务地址
+// @param certFile 证书文件
+// @param keyFile 私钥文件
+// @param router 路由对象，调用 api.NewRouter() 生成
+// @param funcs 被注册的退出方法，当监听到退出信号的时候自动执行
+func RunTLS(addr, certFile, keyFile string, router http.Handler, funcs ...func()) {
+	RunWithOpts(addr, router, RunOpts{
+		TLS:   &TLSOpts{Certificates: []CertKeyPair{{CertFile: certFile, KeyFile: keyFile}}},
+		Funcs: funcs,
+	})
+}
+
+// NewTLSConfig 根据配置创建 tls.Config，证书通过 GetCertificate 从 CertStore 中获取，
+// 客户端 CA 通过 GetConfigForClient 从 CertStore 中获取，因此证书文件更新后无需重启服务
+func NewTLSConfig(opts TLSOpts) (*tls.Config, *CertStore, error) {
+	store, err := NewCertStore(opts.Certificates...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clientAuth := opts.ClientAuth
+	if len(opts.ClientCAFiles) > 0 {
+		if err := store.LoadClientCAs(opts.ClientCAFiles...); err != nil {
+			return nil, nil, err
+		}
+		if clientAuth == tls.NoClientCert {
+			clientAuth = tls.VerifyClientCertIfGiven
+		}
+	} else if clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert {
+		// 没有 CA 时标准库会使用系统的根证书验证客户端证书，内部服务不应该这样做
+		return nil, nil, errors.New("api: ClientCAFiles is required to verify client certificates")
+	}
+
+	minVersion := opts.MinVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
+
+	config := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   opts.CipherSuites,
+		GetCertificate: store.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+		ClientAuth:     clientAuth,
+	}
+	if len(opts.ClientCAFiles) > 0 {
+		config.ClientCAs = store.ClientCAs()
+		config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c := config.Clone()
+			c.ClientCAs = store.ClientCAs()
+			return c, nil
+		}
+	}
+	return config, store, nil
+}
+
+// CertStore 保存已加载的证书，支持按 SNI 选择证书以及从文件热加载
+type CertStore struct {
+	pairs []CertKeyPair
+
+	mu    sync.RWMutex
+	certs []*tls.Certificate
+	stats []certFileStat
+
+	caFiles []string
+	caPool  *x509.CertPool
+	caStats []certFileStat
+}
+
+// certFileStat 证书文件和私钥文件的修改时间和大小，用于判断文件是否变化
+type certFileStat struct {
+	certMod, keyMod   time.Time
+	certSize, keySize int64
+}
+
+// NewCertStore 加载证书，任意一组证书加载失败都会返回错误
+func NewCertStore(pairs ...CertKeyPair) (*CertStore, error) {
+	if len(pairs) == 0 {
+		return nil, errors.New("api: at least one certificate is required")
+	}
+	s := &CertStore{
+		pairs: pairs,
+		certs: make([]*tls.Certificate, len(pairs)),
+		stats: make([]certFileStat, len(pairs)),
+	}
+	for i := range pairs {
+		if err := s.load(i); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// GetCertificate 根据 SNI 选择证书，没有匹配的证书时返回默认证书，可用作 tls.Config.GetCertificate
+func (s *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if hello.ServerName != "" {
+		for _, cert := range s.certs {
+			if cert.Leaf != nil && cert.Leaf.VerifyHostname(hello.ServerName) == nil {
+				return cert, nil
+			}
+		}
+	}
+	return s.certs[0], nil
+}
+
+// Reload 重新加载发生变化的证书文件，加载失败时保留原有的证书
+func (s *CertStore) Reload() error {
+	var errs []error
+	for i, pair := range s.pairs {
+		st, err := statCertKeyPair(pair)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		s.mu.RLock()
+		changed := st != s.stats[i]
+		s.mu.RUnlock()
+		if !changed {
+			continue
+		}
+
+		if err = s.load(i); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		log.Printf("证书 %s 已重新加载\n", pair.CertFile)
+	}
+
+	s.mu.RLock()
+	caFiles := s.caFiles
+	s.mu.RUnlock()
+	if len(caFiles) > 0 {
+		stats, err := statCAFiles(caFiles)
+		s.mu.RLock()
+		changed := err == nil && !slices.Equal(stats, s.caStats)
+		s.mu.RUnlock()
+		if err == nil && changed {
+			err = s.LoadClientCAs(caFiles...)
+			if err == nil {
+				log.Printf("客户端 CA 证书 %v 已重新加载\n", caFiles)
+			}
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LoadClientCAs 加载验证客户端证书的 CA 证书文件，之后 Reload 也会检查这些文件是否变化。
+// 任意一个文件加载失败或者没有证书时返回错误，并保留原有的 CA
+func (s *CertStore) LoadClientCAs(files ...string) error {
+	stats, err := statCAFiles(files)
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return fmt.Errorf("api: no certificates found in %s", file)
+		}
+	}
+
+	s.mu.Lock()
+	s.caFiles = slices.Clone(files)
+	s.caPool = pool
+	s.caStats = stats
+	s.mu.Unlock()
+	return nil
+}
+
+// ClientCAs 返回验证客户端证书的 CA，没有加载时返回 nil
+func (s *CertStore) ClientCAs() *x509.CertPool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.caPool
+}
+
+// Watch 每隔 interval 检查一次证书文件，直到 ctx 结束
+func (s *CertStore) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Reload(); err != nil {
+				log.Printf("重新加载证书失败：%v\n", err)
+			}
+		}
+	}
+}
+
+// load 加载第 i 组证书
+func (s *CertStore) load(i int) error {
+	pair := s.pairs[i]
+	st, err := statCertKeyPair(pair)
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+	if err != nil {
+		return err
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	s.certs[i] = &cert
+	s.stats[i] = st
+	s.mu.Unlock()
+	return nil
+}
+
+// statCAFiles 获取 CA 证书文件的状态，只使用其中的证书文件部分
+func statCAFiles(files []string) ([]certFileStat, error) {
+	stats := make([]certFileStat, len(files))
+	for i, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		stats[i] = certFileStat{certMod: info.ModTime(), certSize: info.Size()}
+	}
+	return stats, nil
+}
+
+// statCertKeyPair 获取证书文件和私钥文件的状态
+func statCertKeyPair(pair CertKeyPair) (certFileStat, error) {
+	certInfo, err := os.Stat(pair.CertFile)
+	if err != nil {
+		return certFileStat{}, err
+	}
+	keyInfo, err := os.Stat(pair.KeyFile)
+	if err != nil {
+		return certFileStat{}, err
+	}
+	return certFileStat{
+		certMod:  certInfo.ModTime(),
+		keyMod:   keyInfo.ModTime(),
+		certSize: certInfo.Size(),
+		keySize:  keyInfo.Size(),
+	}, nil
+}
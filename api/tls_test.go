@@ -0,0 +1,338 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// writeTestCert generates a self-signed certificate for dnsName and writes it
+// with its key into dir, returning the file names.
+func writeTestCert(t *testing.T, dir, dnsName string, serial int64) CertKeyPair {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: dnsName},
+		DNSNames:     []string{dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pair := CertKeyPair{
+		CertFile: filepath.Join(dir, dnsName+".crt"),
+		KeyFile:  filepath.Join(dir, dnsName+".key"),
+	}
+	if err := os.WriteFile(pair.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pair.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return pair
+}
+
+// peerSerial dials addr with the given SNI name and returns the serial
+// number of the certificate presented by the server.
+func peerSerial(t *testing.T, addr, serverName string) int64 {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+}
+
+func TestCertStoreSNI(t *testing.T) {
+	dir := t.TempDir()
+	a := writeTestCert(t, dir, "a.example.com", 1)
+	b := writeTestCert(t, dir, "b.example.com", 2)
+
+	store, err := NewCertStore(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		serverName string
+		serial     int64
+	}{
+		{"a.example.com", 1},
+		{"b.example.com", 2},
+		{"unknown.example.com", 1},
+		{"", 1},
+	}
+	for _, tt := range tests {
+		cert, err := store.GetCertificate(&tls.ClientHelloInfo{ServerName: tt.serverName})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if serial := cert.Leaf.SerialNumber.Int64(); serial != tt.serial {
+			t.Fatalf("%q: expecting certificate %d but got %d", tt.serverName, tt.serial, serial)
+		}
+	}
+}
+
+func TestCertStoreReload(t *testing.T) {
+	dir := t.TempDir()
+	a := writeTestCert(t, dir, "a.example.com", 1)
+
+	store, err := NewCertStore(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A broken file keeps the previous certificate in place.
+	os.WriteFile(a.CertFile, []byte("garbage"), 0600)
+	if err := store.Reload(); err == nil {
+		t.Fatal("expecting reload error for a broken certificate")
+	}
+	cert, _ := store.GetCertificate(&tls.ClientHelloInfo{})
+	if cert.Leaf.SerialNumber.Int64() != 1 {
+		t.Fatal("expecting previous certificate to be kept")
+	}
+
+	writeTestCert(t, dir, "a.example.com", 3)
+	if err := store.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	cert, _ = store.GetCertificate(&tls.ClientHelloInfo{})
+	if cert.Leaf.SerialNumber.Int64() != 3 {
+		t.Fatalf("expecting reloaded certificate 3 but got %d", cert.Leaf.SerialNumber.Int64())
+	}
+}
+
+func TestServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	a := writeTestCert(t, dir, "a.example.com", 1)
+	b := writeTestCert(t, dir, "b.example.com", 2)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+
+	r := NewRouter()
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+
+	stop := make(chan os.Signal, 1)
+	errc := make(chan error, 1)
+	opts := RunOpts{TLS: &TLSOpts{
+		Certificates:   []CertKeyPair{a, b},
+		MinVersion:     tls.VersionTLS13,
+		ReloadInterval: 20 * time.Millisecond,
+	}}
+	go func() {
+		errc <- serve(ln, r, opts, stop)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	if serial := peerSerial(t, addr, "b.example.com"); serial != 2 {
+		t.Fatalf("expecting certificate 2 for b.example.com but got %d", serial)
+	}
+
+	// Clients below the minimum version are rejected.
+	if _, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true, MaxVersion: tls.VersionTLS12}); err == nil {
+		t.Fatal("expecting TLS 1.2 handshake to fail")
+	}
+
+	// HTTP/2 is negotiated over TLS.
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := client.Get("https://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Fatalf("expecting HTTP/2 but got %s", resp.Proto)
+	}
+
+	// Certificates are reloaded from disk without a restart.
+	writeTestCert(t, dir, "b.example.com", 4)
+	deadline := time.Now().Add(2 * time.Second)
+	for peerSerial(t, addr, "b.example.com") != 4 {
+		if time.Now().After(deadline) {
+			t.Fatal("certificate was not reloaded")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	stop <- syscall.SIGTERM
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestCA generates a CA certificate, writes it into dir as name.crt and
+// returns a function issuing client certificates signed by it.
+func writeTestCA(t *testing.T, dir, name string) (string, func(cn string) tls.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(100),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(der)
+	file := filepath.Join(dir, name+".crt")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	issue := func(cn string) tls.Certificate {
+		clientKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(101),
+			Subject:      pkix.Name{CommonName: cn},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &clientKey.PublicKey, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: clientKey}
+	}
+	return file, issue
+}
+
+func TestNewTLSConfigClientAuth(t *testing.T) {
+	dir := t.TempDir()
+	a := writeTestCert(t, dir, "a.example.com", 1)
+	caFile, _ := writeTestCA(t, dir, "ca")
+
+	config, _, err := NewTLSConfig(TLSOpts{Certificates: []CertKeyPair{a}, ClientCAFiles: []string{caFile}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ClientAuth != tls.VerifyClientCertIfGiven || config.ClientCAs == nil {
+		t.Fatalf("expecting client certificates to be verified if given but got %v", config.ClientAuth)
+	}
+
+	// Verifying without a CA would fall back to the system roots.
+	if _, _, err := NewTLSConfig(TLSOpts{Certificates: []CertKeyPair{a}, ClientAuth: tls.RequireAndVerifyClientCert}); err == nil {
+		t.Fatal("expecting an error without ClientCAFiles")
+	}
+	if _, _, err := NewTLSConfig(TLSOpts{Certificates: []CertKeyPair{a}, ClientCAFiles: []string{a.KeyFile}}); err == nil {
+		t.Fatal("expecting an error for a file without certificates")
+	}
+}
+
+func TestServeMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	a := writeTestCert(t, dir, "a.example.com", 1)
+	caFile, issue := writeTestCA(t, dir, "ca")
+	client := issue("orders-service")
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+
+	r := NewRouter()
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName))
+	})
+
+	stop := make(chan os.Signal, 1)
+	errc := make(chan error, 1)
+	opts := RunOpts{TLS: &TLSOpts{
+		Certificates:   []CertKeyPair{a},
+		ClientCAFiles:  []string{caFile},
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		ReloadInterval: 20 * time.Millisecond,
+	}}
+	go func() {
+		errc <- serve(ln, r, opts, stop)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	get := func(certs ...tls.Certificate) (string, error) {
+		c := &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true, Certificates: certs},
+		}}
+		resp, err := c.Get("https://" + addr + "/")
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b := make([]byte, 64)
+		n, _ := resp.Body.Read(b)
+		return string(b[:n]), nil
+	}
+
+	if _, err := get(); err == nil {
+		t.Fatal("expecting a request without a client certificate to fail")
+	}
+	if cn, err := get(client); err != nil || cn != "orders-service" {
+		t.Fatalf("expecting orders-service but got %q %v", cn, err)
+	}
+
+	// The client CA is reloaded from disk, certificates of the old CA are rejected.
+	os.Remove(caFile)
+	_, issueNew := writeTestCA(t, dir, "ca")
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := get(client); err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("client CA was not reloaded")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if cn, err := get(issueNew("billing-service")); err != nil || cn != "billing-service" {
+		t.Fatalf("expecting billing-service but got %q %v", cn, err)
+	}
+
+	stop <- syscall.SIGTERM
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+}
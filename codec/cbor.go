@@ -0,0 +1,341 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// CBOR 主类型
+const (
+	cborUint byte = iota
+	cborNegInt
+	cborBytes
+	cborText
+	cborArray
+	cborMap
+	cborTag
+	cborSimple
+)
+
+// errCBORBreak 不定长数据项的结束标记
+var errCBORBreak = errors.New("codec: cbor: unexpected break")
+
+// cborCodec application/cbor 编解码器（RFC 8949），只依赖标准库。
+// 结构体通过 JSON 转换为映射，字段名称与 JSON 编码相同；解码时支持不定长数据项以及时间标签 0 和 1
+type cborCodec struct{}
+
+func (cborCodec) MediaType() string { return "application/cbor" }
+
+func (cborCodec) Encode(w io.Writer, v interface{}) error {
+	g, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := encodeCBOR(&buf, g); err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func (cborCodec) Decode(r io.Reader, _ map[string]string, v interface{}) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	d := &byteReader{b: b}
+	g, err := d.decodeCBOR(0)
+	if err != nil {
+		return err
+	}
+	if d.off != len(b) {
+		return fmt.Errorf("codec: cbor: %d bytes of trailing data", len(b)-d.off)
+	}
+	return fromGeneric(g, v)
+}
+
+// encodeCBOR 编码通用的数据结构
+func encodeCBOR(buf *bytes.Buffer, g interface{}) error {
+	switch x := g.(type) {
+	case nil:
+		buf.WriteByte(0xf6)
+	case bool:
+		if x {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			if n >= 0 {
+				writeCBORHead(buf, cborUint, uint64(n))
+			} else {
+				writeCBORHead(buf, cborNegInt, uint64(-1-n))
+			}
+		} else if u, err := strconv.ParseUint(string(x), 10, 64); err == nil {
+			writeCBORHead(buf, cborUint, u)
+		} else {
+			f, err := x.Float64()
+			if err != nil {
+				return err
+			}
+			buf.WriteByte(0xfb)
+			binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+		}
+	case string:
+		writeCBORHead(buf, cborText, uint64(len(x)))
+		buf.WriteString(x)
+	case []interface{}:
+		writeCBORHead(buf, cborArray, uint64(len(x)))
+		for _, item := range x {
+			if err := encodeCBOR(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		writeCBORHead(buf, cborMap, uint64(len(x)))
+		for _, k := range sortedMapKeys(x) {
+			encodeCBOR(buf, k)
+			if err := encodeCBOR(buf, x[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("codec: cbor: unsupported type %T", g)
+	}
+	return nil
+}
+
+// writeCBORHead 使用最短的格式编码数据项的头部
+func writeCBORHead(buf *bytes.Buffer, major byte, n uint64) {
+	major <<= 5
+	switch {
+	case n < 24:
+		buf.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		buf.Write([]byte{major | 24, byte(n)})
+	case n <= math.MaxUint16:
+		buf.WriteByte(major | 25)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major | 26)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(major | 27)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+// decodeCBOR 解码一个数据项为通用的数据结构
+func (d *byteReader) decodeCBOR(depth int) (interface{}, error) {
+	if depth > maxNesting {
+		return nil, errors.New("codec: cbor: maximum nesting depth exceeded")
+	}
+	c, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	major, info := c>>5, c&0x1f
+
+	if major == cborSimple {
+		return d.cborSimple(info)
+	}
+
+	indefinite := info == 31
+	var n uint64
+	if !indefinite {
+		if n, err = d.cborArg(info); err != nil {
+			return nil, err
+		}
+	}
+
+	switch major {
+	case cborUint:
+		return n, nil
+	case cborNegInt:
+		if n > math.MaxInt64 {
+			return nil, errors.New("codec: cbor: negative integer overflows int64")
+		}
+		return -1 - int64(n), nil
+	case cborBytes, cborText:
+		var b []byte
+		if indefinite {
+			b, err = d.cborChunks(major)
+		} else {
+			b, err = d.bytes(n)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if major == cborBytes {
+			return b, nil
+		}
+		if !utf8.Valid(b) {
+			return nil, errors.New("codec: cbor: invalid UTF-8 text string")
+		}
+		return string(b), nil
+	case cborArray:
+		if !indefinite && n > uint64(d.remaining()) {
+			return nil, errTruncated
+		}
+		arr := []interface{}{}
+		for i := uint64(0); indefinite || i < n; i++ {
+			item, err := d.decodeCBOR(depth + 1)
+			if indefinite && err == errCBORBreak {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, item)
+		}
+		return arr, nil
+	case cborMap:
+		if !indefinite && n > uint64(d.remaining()/2) {
+			return nil, errTruncated
+		}
+		m := make(map[string]interface{})
+		for i := uint64(0); indefinite || i < n; i++ {
+			k, err := d.decodeCBOR(depth + 1)
+			if indefinite && err == errCBORBreak {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.decodeCBOR(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[mapKey(k)] = v
+		}
+		return m, nil
+	case cborTag:
+		if indefinite {
+			return nil, errors.New("codec: cbor: invalid tag")
+		}
+		item, err := d.decodeCBOR(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return cborTagged(n, item)
+	}
+	return nil, fmt.Errorf("codec: cbor: invalid initial byte 0x%02x", c)
+}
+
+// cborArg 读取数据项头部中的参数
+func (d *byteReader) cborArg(info byte) (uint64, error) {
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info <= 27:
+		return d.uintN(1 << (info - 24))
+	}
+	return 0, fmt.Errorf("codec: cbor: invalid additional information %d", info)
+}
+
+// cborChunks 读取不定长字节串或文本串的所有分块，直到结束标记
+func (d *byteReader) cborChunks(major byte) ([]byte, error) {
+	var b []byte
+	for {
+		c, err := d.byte()
+		if err != nil {
+			return nil, err
+		}
+		if c == 0xff {
+			return b, nil
+		}
+		if c>>5 != major || c&0x1f == 31 {
+			return nil, errors.New("codec: cbor: invalid chunk in indefinite-length string")
+		}
+		n, err := d.cborArg(c & 0x1f)
+		if err != nil {
+			return nil, err
+		}
+		chunk, err := d.bytes(n)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, chunk...)
+	}
+}
+
+// cborSimple 解码简单值和浮点数
+func (d *byteReader) cborSimple(info byte) (interface{}, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		n, err := d.uintN(2)
+		return halfToFloat(uint16(n)), err
+	case 26:
+		n, err := d.uintN(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 27:
+		n, err := d.uintN(8)
+		return math.Float64frombits(n), err
+	case 31:
+		return nil, errCBORBreak
+	}
+	return nil, fmt.Errorf("codec: cbor: unsupported simple value %d", info)
+}
+
+// cborTagged 处理标签，标签 0 和 1 解码为 time.Time，其他标签返回被标记的数据项
+func cborTagged(tag uint64, item interface{}) (interface{}, error) {
+	switch tag {
+	case 0:
+		s, ok := item.(string)
+		if !ok {
+			return nil, errors.New("codec: cbor: tag 0 expects a text string")
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	case 1:
+		switch x := item.(type) {
+		case uint64:
+			return time.Unix(int64(x), 0).UTC(), nil
+		case int64:
+			return time.Unix(x, 0).UTC(), nil
+		case float64:
+			sec, frac := math.Modf(x)
+			return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+		}
+		return nil, errors.New("codec: cbor: tag 1 expects a number")
+	}
+	return item, nil
+}
+
+// halfToFloat 将 IEEE 754 半精度浮点数转换为 float64
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
@@ -0,0 +1,199 @@
+// Package codec 按媒体类型注册请求体和响应体的编解码器，req 根据 Content-Type 解码请求体，
+// resp 根据 Accept 请求头或者 middleware.URLFormat 解析出的扩展名编码响应体。
+//
+// 内置 JSON、XML、application/x-www-form-urlencoded、multipart/form-data、MessagePack 和 CBOR，
+// 可以通过 Register 注册自定义的编解码器：
+//
+//	codec.Register(yamlCodec{}, "yaml", "yml")
+package codec
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrUnsupportedMediaType 没有与 Content-Type 对应的编解码器
+	ErrUnsupportedMediaType = errors.New("codec: unsupported media type")
+
+	// ErrEncodeUnsupported 编解码器不支持编码，例如 multipart/form-data
+	ErrEncodeUnsupported = errors.New("codec: encoding is not supported")
+)
+
+// Codec 一种媒体类型的编解码器
+type Codec interface {
+	// MediaType 返回编解码器对应的媒体类型，例如 application/json
+	MediaType() string
+
+	// Encode 将 v 编码后写入 w
+	Encode(w io.Writer, v interface{}) error
+
+	// Decode 从 r 中读取数据并解码到 v 中，params 是 Content-Type 中的参数，例如 boundary
+	Decode(r io.Reader, params map[string]string, v interface{}) error
+}
+
+// decodeOnly 只能用于解码的编解码器，内容协商时会被跳过
+type decodeOnly interface {
+	decodeOnly()
+}
+
+// 内置的编解码器
+var (
+	JSON      Codec = jsonCodec{}
+	XML       Codec = xmlCodec{}
+	Form      Codec = formCodec{}
+	Multipart Codec = multipartCodec{}
+	MsgPack   Codec = msgpackCodec{}
+	CBOR      Codec = cborCodec{}
+)
+
+// registry 已注册的编解码器
+var registry = struct {
+	sync.RWMutex
+	codecs  []Codec
+	types   map[string]Codec
+	formats map[string]Codec
+}{
+	types:   make(map[string]Codec),
+	formats: make(map[string]Codec),
+}
+
+func init() {
+	Register(JSON, "json")
+	Register(XML, "xml")
+	Register(MsgPack, "msgpack", "mpk")
+	Register(CBOR, "cbor")
+	Register(Form, "form")
+	Register(Multipart)
+
+	registry.types["application/x-msgpack"] = MsgPack
+	registry.types["application/vnd.msgpack"] = MsgPack
+	registry.types["text/xml"] = XML
+}
+
+// Register 注册编解码器，formats 是对应的 URL 扩展名，例如 /articles/1.json 中的 json。
+// 同一媒体类型重复注册时，后注册的编解码器会替换之前的
+func Register(c Codec, formats ...string) {
+	mediaType := strings.ToLower(c.MediaType())
+	if mediaType == "" {
+		panic("codec: media type must not be empty")
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	if old, ok := registry.types[mediaType]; ok {
+		for i, rc := range registry.codecs {
+			if rc == old {
+				registry.codecs = append(registry.codecs[:i], registry.codecs[i+1:]...)
+				break
+			}
+		}
+	}
+	registry.codecs = append(registry.codecs, c)
+	registry.types[mediaType] = c
+	for _, format := range formats {
+		registry.formats[strings.ToLower(format)] = c
+	}
+}
+
+// Lookup 根据 Content-Type 查找编解码器，同时返回 Content-Type 中的参数。
+// 没有注册的结构化后缀类型会使用对应的编解码器，例如 application/problem+json 使用 JSON
+func Lookup(contentType string) (Codec, map[string]string, bool) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	registry.RLock()
+	defer registry.RUnlock()
+	if c, ok := registry.types[mediaType]; ok {
+		return c, params, true
+	}
+	if i := strings.LastIndexByte(mediaType, '+'); i >= 0 {
+		if c, ok := registry.types["application/"+mediaType[i+1:]]; ok {
+			return c, params, true
+		}
+	}
+	return nil, nil, false
+}
+
+// ByFormat 根据 URL 扩展名查找编解码器
+func ByFormat(format string) (Codec, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	c, ok := registry.formats[strings.ToLower(format)]
+	if _, only := c.(decodeOnly); only {
+		return nil, false
+	}
+	return c, ok
+}
+
+// Negotiate 根据 Accept 请求头选择编码响应的编解码器，按 q 值从高到低匹配，
+// 支持 type/* 和 */* 通配符。Accept 为空时返回 JSON
+func Negotiate(accept string) (Codec, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return JSON, true
+	}
+
+	type acceptRange struct {
+		mediaType string
+		q         float64
+	}
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, acceptRange{mediaType, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	registry.RLock()
+	defer registry.RUnlock()
+	for _, ar := range ranges {
+		if c, ok := registry.types[ar.mediaType]; ok {
+			if _, only := c.(decodeOnly); !only {
+				return c, true
+			}
+		}
+		prefix, ok := strings.CutSuffix(ar.mediaType, "*")
+		if !ok {
+			continue
+		}
+		if prefix == "*/" {
+			prefix = ""
+		}
+		for _, c := range registry.codecs {
+			if _, only := c.(decodeOnly); only {
+				continue
+			}
+			if strings.HasPrefix(c.MediaType(), prefix) {
+				return c, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Decode 根据 Content-Type 选择编解码器解码数据
+func Decode(contentType string, r io.Reader, v interface{}) error {
+	c, params, ok := Lookup(contentType)
+	if !ok {
+		return ErrUnsupportedMediaType
+	}
+	return c.Decode(r, params, v)
+}
@@ -0,0 +1,341 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/xml"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type article struct {
+	ID      int64    `json:"id" xml:"id" form:"id"`
+	Title   string   `json:"title" xml:"title" form:"title"`
+	Tags    []string `json:"tags" xml:"tag" form:"tag"`
+	Score   float64  `json:"score" xml:"score" form:"score"`
+	Draft   bool     `json:"draft" xml:"draft" form:"draft"`
+	Balance int64    `json:"balance" xml:"balance" form:"balance"`
+}
+
+func TestRoundTrip(t *testing.T) {
+	in := article{ID: 1, Title: "你好, codec", Tags: []string{"go", "api"}, Score: 4.5, Draft: true, Balance: -70000}
+	for _, c := range []Codec{JSON, XML, Form, MsgPack, CBOR} {
+		var buf bytes.Buffer
+		if err := c.Encode(&buf, in); err != nil {
+			t.Fatalf("%s: %v", c.MediaType(), err)
+		}
+		var out article
+		if err := c.Decode(&buf, nil, &out); err != nil {
+			t.Fatalf("%s: %v", c.MediaType(), err)
+		}
+		if !reflect.DeepEqual(in, out) {
+			t.Fatalf("%s: expecting %+v but got %+v", c.MediaType(), in, out)
+		}
+	}
+}
+
+func TestMsgpackVectors(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want string
+	}{
+		{map[string]interface{}{"a": 1}, "81a16101"},
+		{[]interface{}{-1, -33, 256, nil, false}, "95ffd0dfcd0100c0c2"},
+		{"hello", "a568656c6c6f"},
+		{1.5, "cb3ff8000000000000"},
+		{uint64(1) << 63, "cf8000000000000000"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := MsgPack.Encode(&buf, tt.in); err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(buf.Bytes()); got != tt.want {
+			t.Fatalf("msgpack %v: expecting %s but got %s", tt.in, tt.want, got)
+		}
+	}
+
+	// Timestamp extension (fixext 4, type -1).
+	var ts time.Time
+	b, _ := hex.DecodeString("d6ff514b67b0")
+	if err := MsgPack.Decode(bytes.NewReader(b), nil, &ts); err != nil {
+		t.Fatal(err)
+	}
+	if !ts.Equal(time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected timestamp %v", ts)
+	}
+}
+
+func TestCBORVectors(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want string
+	}{
+		{[]interface{}{1, []interface{}{2, 3}, []interface{}{4, 5}}, "8301820203820405"},
+		{map[string]interface{}{"a": 1, "b": []interface{}{2, 3}}, "a26161016162820203"},
+		{-1000, "3903e7"},
+		{"IETF", "6449455446"},
+		{1.1, "fb3ff199999999999a"},
+		{nil, "f6"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := CBOR.Encode(&buf, tt.in); err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(buf.Bytes()); got != tt.want {
+			t.Fatalf("cbor %v: expecting %s but got %s", tt.in, tt.want, got)
+		}
+	}
+
+	decodes := []struct {
+		in   string
+		want interface{}
+	}{
+		// Indefinite-length array and map (RFC 8949 Appendix A).
+		{"9f018202039f0405ffff", []interface{}{uint64(1), []interface{}{uint64(2), uint64(3)}, []interface{}{uint64(4), uint64(5)}}},
+		{"bf6346756ef563416d7421ff", map[string]interface{}{"Fun": true, "Amt": int64(-2)}},
+		{"7f657374726561646d696e67ff", "streaming"},
+		{"f93c00", 1.0},
+		{"f9c400", -4.0},
+		{"c11a514b67b0", time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC)},
+	}
+	for _, tt := range decodes {
+		b, _ := hex.DecodeString(tt.in)
+		d := &byteReader{b: b}
+		got, err := d.decodeCBOR(0)
+		if err != nil {
+			t.Fatalf("cbor %s: %v", tt.in, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("cbor %s: expecting %#v but got %#v", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	inputs := map[Codec][]string{
+		MsgPack: {"", "dc", "dcffff", "a5616263", "c4ff00", "8182", "0102", "c1"},
+		CBOR:    {"", "9b00000000ffffffff", "7f61", "5f6161ff", "ff", "a1", "0101", "1c"},
+	}
+	for c, cases := range inputs {
+		for _, in := range cases {
+			b, _ := hex.DecodeString(in)
+			var v interface{}
+			if err := c.Decode(bytes.NewReader(b), nil, &v); err == nil {
+				t.Fatalf("%s: expecting error for %s but got %#v", c.MediaType(), in, v)
+			}
+		}
+	}
+
+	// Deeply nested arrays are rejected instead of exhausting the stack.
+	deep := bytes.Repeat([]byte{0x81}, maxNesting+10)
+	var v interface{}
+	if err := CBOR.Decode(bytes.NewReader(append(deep, 0x01)), nil, &v); err == nil {
+		t.Fatal("expecting nesting error")
+	}
+}
+
+func TestMultipart(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("title", "upload")
+	mw.WriteField("tag", "a")
+	mw.WriteField("tag", "b")
+	fw, _ := mw.CreateFormFile("file", "a.txt")
+	fw.Write([]byte("hello"))
+	mw.Close()
+
+	var dst struct {
+		Title string                `form:"title"`
+		Tags  []string              `form:"tag"`
+		File  *multipart.FileHeader `form:"file"`
+	}
+	if err := Decode(mw.FormDataContentType(), &body, &dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.Title != "upload" || len(dst.Tags) != 2 || dst.File == nil || dst.File.Size != 5 {
+		t.Fatalf("unexpected multipart result %+v", dst)
+	}
+	if err := Multipart.Encode(&body, dst); err != ErrEncodeUnsupported {
+		t.Fatalf("expecting multipart encoding to be unsupported but got %v", err)
+	}
+}
+
+func TestMultipartTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	old := MultipartMaxMemory
+	MultipartMaxMemory = 1
+	defer func() { MultipartMaxMemory = old }()
+
+	newBody := func() (*bytes.Buffer, string) {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("title", "upload")
+		fw, _ := mw.CreateFormFile("file", "a.txt")
+		fw.Write(bytes.Repeat([]byte("x"), 1024))
+		mw.Close()
+		return &body, mw.FormDataContentType()
+	}
+	tempFiles := func() int {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(entries)
+	}
+
+	// 没有绑定文件时临时文件在解码后立即删除
+	body, contentType := newBody()
+	var values map[string]string
+	if err := Decode(contentType, body, &values); err != nil {
+		t.Fatal(err)
+	}
+	if values["title"] != "upload" || tempFiles() != 0 {
+		t.Fatalf("expecting temp files to be removed but got %d files, %v", tempFiles(), values)
+	}
+
+	// 绑定了文件时由调用方删除
+	body, contentType = newBody()
+	var dst struct {
+		File *multipart.FileHeader `form:"file"`
+	}
+	if err := Decode(contentType, body, &dst); err != nil {
+		t.Fatal(err)
+	}
+	f, err := dst.File.Open()
+	if err != nil {
+		t.Fatalf("expecting the uploaded file to be readable but got %v", err)
+	}
+	f.Close()
+	if tempFiles() != 1 {
+		t.Fatalf("expecting the temp file to be kept but got %d files", tempFiles())
+	}
+}
+
+func TestFormMaps(t *testing.T) {
+	var buf bytes.Buffer
+	Form.Encode(&buf, map[string]string{"b": "2", "a": "1"})
+	if buf.String() != "a=1&b=2" {
+		t.Fatalf("unexpected form %q", buf.String())
+	}
+	var values url.Values
+	if err := Form.Decode(strings.NewReader("x=1&x=2"), nil, &values); err != nil || len(values["x"]) != 2 {
+		t.Fatalf("unexpected values %v, %v", values, err)
+	}
+}
+
+func TestXMLMap(t *testing.T) {
+	var buf bytes.Buffer
+	err := XML.Encode(&buf, map[string]interface{}{"status": true, "data": []interface{}{"a<b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<response><data><item>a&lt;b</item></data><status>true</status></response>`
+	if !strings.HasSuffix(buf.String(), want) {
+		t.Fatalf("expecting %s but got %s", want, buf.String())
+	}
+}
+
+func TestXMLMapKeys(t *testing.T) {
+	keys := []string{"", "1st", "two words", `a"b`, "a/b", "a><injected/><b", "x:y", "ok", "名称", "ª"}
+	m := make(map[string]interface{})
+	for _, k := range keys {
+		m[k] = "v"
+	}
+	var buf bytes.Buffer
+	if err := XML.Encode(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Elements []struct {
+			XMLName xml.Name
+			Key     *string `xml:"key,attr"`
+			Value   string  `xml:",chardata"`
+		} `xml:",any"`
+	}
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("expecting well-formed XML but got %v: %s", err, buf.String())
+	}
+	got := make(map[string]bool)
+	for _, e := range doc.Elements {
+		k := e.XMLName.Local
+		if e.Key != nil {
+			if k != "entry" {
+				t.Fatalf("expecting key attribute only on entry but got %s", k)
+			}
+			k = *e.Key
+		}
+		if e.Value != "v" {
+			t.Fatalf("%q: expecting value v but got %q", k, e.Value)
+		}
+		got[k] = true
+	}
+	if len(got) != len(keys) {
+		t.Fatalf("expecting %d keys but got %v: %s", len(keys), got, buf.String())
+	}
+	for _, k := range keys {
+		if !got[k] {
+			t.Fatalf("expecting key %q to round-trip: %s", k, buf.String())
+		}
+	}
+	if !strings.Contains(buf.String(), "<ok>v</ok>") || !strings.Contains(buf.String(), "<名称>v</名称>") {
+		t.Fatalf("expecting valid names as elements but got %s", buf.String())
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := map[string]Codec{
+		"application/json; charset=utf-8":   JSON,
+		"application/problem+json":          JSON,
+		"text/xml":                          XML,
+		"application/atom+xml":              XML,
+		"application/x-msgpack":             MsgPack,
+		"application/cbor":                  CBOR,
+		"application/x-www-form-urlencoded": Form,
+	}
+	for ct, want := range tests {
+		if c, _, ok := Lookup(ct); !ok || c != want {
+			t.Fatalf("Lookup(%q): expecting %s but got %v", ct, want.MediaType(), c)
+		}
+	}
+	if _, _, ok := Lookup("text/plain"); ok {
+		t.Fatal("expecting text/plain to be unsupported")
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   Codec
+	}{
+		{"", JSON},
+		{"*/*", JSON},
+		{"application/xml", XML},
+		{"text/html, application/cbor;q=0.9, application/json;q=0.8", CBOR},
+		{"application/json;q=0.5, application/msgpack", MsgPack},
+		{"application/*;q=0.1", JSON},
+		{"multipart/*", nil},
+		{"text/html", nil},
+	}
+	for _, tt := range tests {
+		c, ok := Negotiate(tt.accept)
+		if c != tt.want || ok != (tt.want != nil) {
+			t.Fatalf("Negotiate(%q): expecting %v but got %v", tt.accept, tt.want, c)
+		}
+	}
+
+	if c, ok := ByFormat("XML"); !ok || c != XML {
+		t.Fatal("expecting xml format")
+	}
+	if _, ok := ByFormat("html"); ok {
+		t.Fatal("expecting html format to be unknown")
+	}
+}
@@ -0,0 +1,179 @@
+package codec
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/zhangdapeng520/zdpgo_api/qs"
+)
+
+// MultipartMaxMemory 解析 multipart 表单时保存在内存中的最大字节数，超出部分写入临时文件
+var MultipartMaxMemory int64 = 32 << 20
+
+var fileHeaderType = reflect.TypeOf((*multipart.FileHeader)(nil))
+
+// formCodec application/x-www-form-urlencoded 编解码器。
+// 解码目标可以是 *url.Values、*map[string][]string、*map[string]string，
+// 也可以是结构体、映射的指针，此时支持 qs 包中嵌套的参数名，例如 filter[status][]=open，
+// 结构体字段使用 form 标签指定参数名称
+type formCodec struct{}
+
+func (formCodec) MediaType() string { return "application/x-www-form-urlencoded" }
+
+func (formCodec) Encode(w io.Writer, v interface{}) error {
+	values, err := toValues(v)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, values.Encode())
+	return err
+}
+
+func (formCodec) Decode(r io.Reader, _ map[string]string, v interface{}) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	values, err := url.ParseQuery(string(b))
+	if err != nil {
+		return err
+	}
+	return assignValues(values, nil, v)
+}
+
+// multipartCodec multipart/form-data 解码器，只能用于解码。
+// 除了 formCodec 支持的解码目标，还可以解码到 *multipart.Form，
+// 类型为 *multipart.FileHeader 或 []*multipart.FileHeader 的结构体字段会绑定上传的文件。
+//
+// 超过 MultipartMaxMemory 的文件保存在临时文件中。解码到 *multipart.Form 或者绑定了上传文件时，
+// 临时文件由调用方在使用完后通过 RemoveAll 删除，其他情况下解码后立即删除
+type multipartCodec struct{}
+
+func (multipartCodec) MediaType() string { return "multipart/form-data" }
+
+func (multipartCodec) decodeOnly() {}
+
+func (multipartCodec) Encode(io.Writer, interface{}) error {
+	return ErrEncodeUnsupported
+}
+
+func (multipartCodec) Decode(r io.Reader, params map[string]string, v interface{}) error {
+	boundary := params["boundary"]
+	if boundary == "" {
+		return errors.New("codec: multipart boundary is missing")
+	}
+	form, err := multipart.NewReader(r, boundary).ReadForm(MultipartMaxMemory)
+	if err != nil {
+		return err
+	}
+	if dst, ok := v.(*multipart.Form); ok {
+		*dst = *form
+		return nil
+	}
+	bound := assignFiles(form.File, v)
+	if err := assignValues(form.Value, nil, v); err != nil || !bound {
+		form.RemoveAll()
+		return err
+	}
+	return nil
+}
+
+// DecodeMultipartForm 将已经解析的 multipart 表单解码到 v，支持的解码目标与 multipart/form-data 解码器相同。
+// 上传的文件仍然属于 form，调用方负责在使用完后调用 form.RemoveAll
+func DecodeMultipartForm(form *multipart.Form, v interface{}) error {
+	if dst, ok := v.(*multipart.Form); ok {
+		*dst = *form
+		return nil
+	}
+	return assignValues(form.Value, form.File, v)
+}
+
+// toValues 将映射或者结构体转换为 url.Values
+func toValues(v interface{}) (url.Values, error) {
+	switch x := v.(type) {
+	case url.Values:
+		return x, nil
+	case map[string][]string:
+		return url.Values(x), nil
+	case map[string]string:
+		values := make(url.Values, len(x))
+		for k, s := range x {
+			values.Set(k, s)
+		}
+		return values, nil
+	}
+	return qs.EncodeWithOpts(v, qs.Opts{Tag: "form"})
+}
+
+// assignValues 将表单的值赋给解码目标
+func assignValues(values url.Values, files map[string][]*multipart.FileHeader, v interface{}) error {
+	switch dst := v.(type) {
+	case *url.Values:
+		*dst = values
+		return nil
+	case *map[string][]string:
+		*dst = values
+		return nil
+	case *map[string]string:
+		*dst = make(map[string]string, len(values))
+		for k := range values {
+			(*dst)[k] = values.Get(k)
+		}
+		return nil
+	}
+
+	if len(files) > 0 {
+		assignFiles(files, v)
+	}
+	return qs.DecodeWithOpts(values, v, qs.Opts{Tag: "form"})
+}
+
+// assignFiles 将上传的文件赋值给类型为 *multipart.FileHeader 或 []*multipart.FileHeader 的字段，
+// 返回是否绑定了文件
+func assignFiles(files map[string][]*multipart.FileHeader, v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return false
+	}
+	bound := false
+	rv = rv.Elem()
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Type != fileHeaderType && !(sf.Type.Kind() == reflect.Slice && sf.Type.Elem() == fileHeaderType) {
+			continue
+		}
+		name, ok := formName(sf)
+		if !ok {
+			continue
+		}
+		if fhs := files[name]; len(fhs) > 0 {
+			if sf.Type == fileHeaderType {
+				rv.Field(i).Set(reflect.ValueOf(fhs[0]))
+			} else {
+				rv.Field(i).Set(reflect.ValueOf(fhs))
+			}
+			bound = true
+		}
+	}
+	return bound
+}
+
+// formName 返回字段对应的表单参数名称，未导出或者标记为 - 的字段返回 false
+func formName(sf reflect.StructField) (string, bool) {
+	if !sf.IsExported() {
+		return "", false
+	}
+	name := strings.Split(sf.Tag.Get("form"), ",")[0]
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = sf.Name
+	}
+	return name, true
+}
@@ -0,0 +1,155 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// jsonCodec application/json 编解码器
+type jsonCodec struct{}
+
+func (jsonCodec) MediaType() string { return "application/json" }
+
+func (jsonCodec) Encode(w io.Writer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (jsonCodec) Decode(r io.Reader, _ map[string]string, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+// xmlCodec application/xml 编解码器。
+// encoding/xml 不支持的映射类型（例如 resp.Success 中的数据结构）会以 <response> 为根元素编码，
+// 映射的键作为子元素，键不是合法的元素名称时编码为 <entry key="...">，切片的每一项编码为 <item> 元素
+type xmlCodec struct{}
+
+func (xmlCodec) MediaType() string { return "application/xml" }
+
+func (xmlCodec) Encode(w io.Writer, v interface{}) error {
+	b, err := xml.Marshal(v)
+	if _, unsupported := err.(*xml.UnsupportedTypeError); unsupported {
+		var g interface{}
+		if g, err = toGeneric(v); err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		writeXMLElement(&buf, "response", "", g)
+		b = buf.Bytes()
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (xmlCodec) Decode(r io.Reader, _ map[string]string, v interface{}) error {
+	return xml.NewDecoder(r).Decode(v)
+}
+
+// writeXMLElement 将通用的数据结构编码为 XML 元素，attrs 是开始标签中的属性
+func writeXMLElement(buf *bytes.Buffer, name, attrs string, g interface{}) {
+	switch x := g.(type) {
+	case nil:
+		fmt.Fprintf(buf, "<%s%s/>", name, attrs)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(buf, "<%s%s>", name, attrs)
+		for _, k := range keys {
+			if validXMLName(k) {
+				writeXMLElement(buf, k, "", x[k])
+				continue
+			}
+			// 键可能来自用户输入，不是合法的元素名称时作为属性输出
+			var key bytes.Buffer
+			xml.EscapeText(&key, []byte(k))
+			writeXMLElement(buf, "entry", ` key="`+key.String()+`"`, x[k])
+		}
+		fmt.Fprintf(buf, "</%s>", name)
+	case []interface{}:
+		fmt.Fprintf(buf, "<%s%s>", name, attrs)
+		for _, item := range x {
+			writeXMLElement(buf, "item", "", item)
+		}
+		fmt.Fprintf(buf, "</%s>", name)
+	default:
+		fmt.Fprintf(buf, "<%s%s>", name, attrs)
+		xml.EscapeText(buf, []byte(fmt.Sprint(x)))
+		fmt.Fprintf(buf, "</%s>", name)
+	}
+}
+
+// validXMLName 判断 s 是否可以作为元素名称：以字母或者 _ 开头，之后是字母、数字、_、- 或者 .，
+// 不支持带有 : 的命名空间前缀。包含非 ASCII 字符时交给 encoding/xml 按照它的规则判断
+func validXMLName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= utf8.RuneSelf:
+			return decodableXMLName(s)
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', c == '_':
+		case i > 0 && ('0' <= c && c <= '9' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// decodableXMLName 判断 encoding/xml 能否将 s 解析为没有命名空间的元素名称
+func decodableXMLName(s string) bool {
+	tok, err := xml.NewDecoder(strings.NewReader("<" + s + "/>")).Token()
+	if err != nil {
+		return false
+	}
+	start, ok := tok.(xml.StartElement)
+	return ok && start.Name.Space == "" && start.Name.Local == s && len(start.Attr) == 0
+}
+
+// toGeneric 通过 JSON 将任意值转换为通用的数据结构：nil、bool、json.Number、string、
+// []interface{} 和 map[string]interface{}，结构体的字段名称与 JSON 编码相同
+func toGeneric(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var g interface{}
+	err = dec.Decode(&g)
+	return g, err
+}
+
+// fromGeneric 将解码得到的通用数据结构赋值给 v，结构体的字段按 JSON 标签匹配
+func fromGeneric(g interface{}, v interface{}) error {
+	if p, ok := v.(*interface{}); ok {
+		*p = g
+		return nil
+	}
+	b, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
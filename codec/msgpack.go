@@ -0,0 +1,368 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// maxNesting 解码时数组和映射允许的最大嵌套深度
+const maxNesting = 512
+
+var errTruncated = errors.New("codec: unexpected end of data")
+
+// msgpackCodec application/msgpack 编解码器，只依赖标准库。
+// 结构体通过 JSON 转换为映射，字段名称与 JSON 编码相同；解码时支持时间戳扩展类型
+type msgpackCodec struct{}
+
+func (msgpackCodec) MediaType() string { return "application/msgpack" }
+
+func (msgpackCodec) Encode(w io.Writer, v interface{}) error {
+	g, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := encodeMsgpack(&buf, g); err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func (msgpackCodec) Decode(r io.Reader, _ map[string]string, v interface{}) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	d := &byteReader{b: b}
+	g, err := d.decodeMsgpack(0)
+	if err != nil {
+		return err
+	}
+	if d.off != len(b) {
+		return fmt.Errorf("codec: msgpack: %d bytes of trailing data", len(b)-d.off)
+	}
+	return fromGeneric(g, v)
+}
+
+// encodeMsgpack 编码通用的数据结构
+func encodeMsgpack(buf *bytes.Buffer, g interface{}) error {
+	switch x := g.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if x {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			writeMsgpackInt(buf, n)
+		} else if u, err := strconv.ParseUint(string(x), 10, 64); err == nil {
+			buf.WriteByte(0xcf)
+			binary.Write(buf, binary.BigEndian, u)
+		} else {
+			f, err := x.Float64()
+			if err != nil {
+				return err
+			}
+			buf.WriteByte(0xcb)
+			binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+		}
+	case string:
+		n := len(x)
+		switch {
+		case n < 32:
+			buf.WriteByte(0xa0 | byte(n))
+		case n <= math.MaxUint8:
+			buf.Write([]byte{0xd9, byte(n)})
+		case n <= math.MaxUint16:
+			buf.WriteByte(0xda)
+			binary.Write(buf, binary.BigEndian, uint16(n))
+		default:
+			buf.WriteByte(0xdb)
+			binary.Write(buf, binary.BigEndian, uint32(n))
+		}
+		buf.WriteString(x)
+	case []interface{}:
+		writeMsgpackLen(buf, len(x), 0x90, 0xdc)
+		for _, item := range x {
+			if err := encodeMsgpack(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		writeMsgpackLen(buf, len(x), 0x80, 0xde)
+		for _, k := range sortedMapKeys(x) {
+			encodeMsgpack(buf, k)
+			if err := encodeMsgpack(buf, x[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("codec: msgpack: unsupported type %T", g)
+	}
+	return nil
+}
+
+// writeMsgpackInt 使用最短的格式编码整数
+func writeMsgpackInt(buf *bytes.Buffer, n int64) {
+	switch {
+	case n >= 0 && n <= 0x7f:
+		buf.WriteByte(byte(n))
+	case n >= -32 && n < 0:
+		buf.WriteByte(byte(int8(n)))
+	case n >= 0 && n <= math.MaxUint8:
+		buf.Write([]byte{0xcc, byte(n)})
+	case n >= 0 && n <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n >= 0 && n <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	case n >= 0:
+		buf.WriteByte(0xcf)
+		binary.Write(buf, binary.BigEndian, uint64(n))
+	case n >= math.MinInt8:
+		buf.Write([]byte{0xd0, byte(int8(n))})
+	case n >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(n))
+	case n >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(n))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+// writeMsgpackLen 编码数组或映射的长度，fix 是长度小于 16 时的前缀，wide 是 16 位长度的前缀
+func writeMsgpackLen(buf *bytes.Buffer, n int, fix, wide byte) {
+	switch {
+	case n < 16:
+		buf.WriteByte(fix | byte(n))
+	case n <= math.MaxUint16:
+		buf.WriteByte(wide)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(wide + 1)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+// decodeMsgpack 解码一个值为通用的数据结构
+func (d *byteReader) decodeMsgpack(depth int) (interface{}, error) {
+	if depth > maxNesting {
+		return nil, errors.New("codec: msgpack: maximum nesting depth exceeded")
+	}
+	c, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c >= 0x80 && c <= 0x8f:
+		return d.msgpackMap(int(c&0x0f), depth)
+	case c >= 0x90 && c <= 0x9f:
+		return d.msgpackArray(int(c&0x0f), depth)
+	case c >= 0xa0 && c <= 0xbf:
+		return d.str(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uintN(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return d.bytes(n)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uintN(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.msgpackExt(n)
+	case 0xca:
+		n, err := d.uintN(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := d.uintN(8)
+		return math.Float64frombits(n), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.uintN(1 << (c - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		n, err := d.uintN(size)
+		// 按位宽进行符号扩展
+		shift := 64 - 8*size
+		return int64(n<<shift) >> shift, err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.msgpackExt(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uintN(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xdc, 0xdd:
+		n, err := d.uintN(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.msgpackArray(int(n), depth)
+	case 0xde, 0xdf:
+		n, err := d.uintN(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.msgpackMap(int(n), depth)
+	}
+	return nil, fmt.Errorf("codec: msgpack: invalid format byte 0x%02x", c)
+}
+
+// msgpackArray 解码数组的 n 个元素
+func (d *byteReader) msgpackArray(n int, depth int) (interface{}, error) {
+	if n > d.remaining() {
+		return nil, errTruncated
+	}
+	arr := make([]interface{}, n)
+	for i := range arr {
+		item, err := d.decodeMsgpack(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		arr[i] = item
+	}
+	return arr, nil
+}
+
+// msgpackMap 解码映射的 n 个键值对，非字符串的键会被格式化为字符串
+func (d *byteReader) msgpackMap(n int, depth int) (interface{}, error) {
+	if n > d.remaining()/2 {
+		return nil, errTruncated
+	}
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.decodeMsgpack(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.decodeMsgpack(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		m[mapKey(k)] = v
+	}
+	return m, nil
+}
+
+// msgpackExt 解码扩展类型，时间戳（类型 -1）解码为 time.Time，其他类型返回原始数据
+func (d *byteReader) msgpackExt(n uint64) (interface{}, error) {
+	typ, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.bytes(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ) != -1 {
+		return data, nil
+	}
+	switch len(data) {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0).UTC(), nil
+	case 8:
+		v := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(v&0x3ffffffff), int64(v>>34)).UTC(), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(data[:4])
+		sec := int64(binary.BigEndian.Uint64(data[4:]))
+		return time.Unix(sec, int64(nsec)).UTC(), nil
+	}
+	return nil, fmt.Errorf("codec: msgpack: invalid timestamp length %d", len(data))
+}
+
+// byteReader 在字节切片上顺序读取，所有读取都会检查剩余的长度
+type byteReader struct {
+	b   []byte
+	off int
+}
+
+func (d *byteReader) remaining() int {
+	return len(d.b) - d.off
+}
+
+func (d *byteReader) byte() (byte, error) {
+	if d.off >= len(d.b) {
+		return 0, errTruncated
+	}
+	c := d.b[d.off]
+	d.off++
+	return c, nil
+}
+
+func (d *byteReader) bytes(n uint64) ([]byte, error) {
+	if n > uint64(d.remaining()) {
+		return nil, errTruncated
+	}
+	b := d.b[d.off : d.off+int(n)]
+	d.off += int(n)
+	return append([]byte(nil), b...), nil
+}
+
+func (d *byteReader) str(n int) (string, error) {
+	b, err := d.bytes(uint64(n))
+	return string(b), err
+}
+
+// uintN 读取 size 字节的大端无符号整数
+func (d *byteReader) uintN(size int) (uint64, error) {
+	if size > d.remaining() {
+		return 0, errTruncated
+	}
+	var n uint64
+	for _, c := range d.b[d.off : d.off+size] {
+		n = n<<8 | uint64(c)
+	}
+	d.off += size
+	return n, nil
+}
+
+// mapKey 将映射的键格式化为字符串
+func mapKey(k interface{}) string {
+	if s, ok := k.(string); ok {
+		return s
+	}
+	return fmt.Sprint(k)
+}
+
+// sortedMapKeys 返回排序后的键，保证编码结果稳定
+func sortedMapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,44 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// GoroutineCheck 检查当前协程数量是否超过 max，协程数量持续增长通常意味着泄漏
+func GoroutineCheck(max int) CheckFunc {
+	return func(ctx context.Context) error {
+		if n := runtime.NumGoroutine(); n > max {
+			return fmt.Errorf("too many goroutines: %d > %d", n, max)
+		}
+		return nil
+	}
+}
+
+// DiskSpaceCheck 检查 path 所在磁盘的可用空间是否不少于 minFree 字节
+func DiskSpaceCheck(path string, minFree uint64) CheckFunc {
+	return func(ctx context.Context) error {
+		free, err := diskFree(path)
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("low disk space on %s: %d bytes free, need %d", path, free, minFree)
+		}
+		return nil
+	}
+}
+
+// TCPDialCheck 检查能否与 addr 建立 TCP 连接，适合检查数据库、缓存等依赖是否可达
+func TCPDialCheck(addr string) CheckFunc {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
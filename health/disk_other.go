@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !windows
+
+package health
+
+import "errors"
+
+// diskFree 当前平台不支持查询磁盘空间
+func diskFree(path string) (uint64, error) {
+	return 0, errors.New("disk space check is not supported on this platform")
+}
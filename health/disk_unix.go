@@ -0,0 +1,14 @@
+//go:build linux || darwin
+
+package health
+
+import "syscall"
+
+// diskFree 返回 path 所在磁盘对非特权用户可用的字节数
+func diskFree(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
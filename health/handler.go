@@ -0,0 +1,69 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// LivezHandler 存活检查接口
+func (reg *Registry) LivezHandler() http.Handler {
+	return reportHandler(reg.Liveness)
+}
+
+// ReadyzHandler 就绪检查接口
+func (reg *Registry) ReadyzHandler() http.Handler {
+	return reportHandler(reg.Readiness)
+}
+
+// HealthzHandler 完整的健康检查接口
+func (reg *Registry) HealthzHandler() http.Handler {
+	return reportHandler(reg.Health)
+}
+
+// Endpoints 返回一个中间件，在 prefix 下拦截 livez、readyz、healthz 三个检查接口，
+// 与 middleware.Heartbeat 一样，适合放在鉴权等中间件之前。
+//
+//	r := api.NewRouter()
+//	r.Use(reg.Endpoints("/"))   // /livez /readyz /healthz
+func (reg *Registry) Endpoints(prefix string) func(http.Handler) http.Handler {
+	prefix = strings.TrimSuffix(prefix, "/")
+	handlers := map[string]http.Handler{
+		prefix + "/livez":   reg.LivezHandler(),
+		prefix + "/readyz":  reg.ReadyzHandler(),
+		prefix + "/healthz": reg.HealthzHandler(),
+	}
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "GET" || r.Method == "HEAD" {
+				if h, ok := handlers[strings.ToLower(r.URL.Path)]; ok {
+					h.ServeHTTP(w, r)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// reportHandler 执行检查并以 JSON 的形式响应检查结果，失败时响应 503
+func reportHandler(run func(ctx context.Context) Report) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := run(r.Context())
+
+		status := http.StatusOK
+		if report.Status == StatusFail {
+			status = http.StatusServiceUnavailable
+		}
+
+		v, _ := json.Marshal(report)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		w.WriteHeader(status)
+		if r.Method != "HEAD" {
+			w.Write(v)
+		}
+	})
+}
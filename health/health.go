@@ -0,0 +1,272 @@
+// Package health 提供存活、就绪以及健康检查的能力。
+//
+// 通过 Registry 注册若干检查项，每个检查项可以设置超时时间、是否关键以及结果的缓存时间，
+// 然后挂载 /livez、/readyz、/healthz 三个接口供 Kubernetes 等平台探测：
+//
+//	reg := health.NewRegistry()
+//	reg.Register(health.Check{Name: "goroutines", Check: health.GoroutineCheck(10000), Liveness: true})
+//	reg.Register(health.Check{Name: "db", Check: health.TCPDialCheck("127.0.0.1:3306"), Critical: true, Interval: 5 * time.Second})
+//
+//	r := api.NewRouter()
+//	r.Use(reg.Endpoints("/"))
+//
+// 当 api.RunWithOpts 收到退出信号后，/readyz 会立刻返回失败，负载均衡可以在服务关闭前摘除流量。
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_api/api"
+)
+
+const (
+	// StatusOK 所有检查均通过
+	StatusOK = "ok"
+	// StatusDegraded 存在非关键检查项失败
+	StatusDegraded = "degraded"
+	// StatusFail 存在关键检查项失败
+	StatusFail = "fail"
+)
+
+var (
+	// defaultCheckTimeout 检查项的默认超时时间
+	defaultCheckTimeout = 5 * time.Second
+
+	// shutdownCheckName 服务关闭时就绪检查中附加的检查项名称
+	shutdownCheckName = "shutdown"
+)
+
+// CheckFunc 执行一项检查，返回 nil 表示检查通过
+type CheckFunc func(ctx context.Context) error
+
+// Check 一个检查项的配置
+type Check struct {
+	// Name 检查项名称，在同一个 Registry 中必须唯一
+	Name string
+
+	// Check 检查方法
+	Check CheckFunc
+
+	// Timeout 单次检查的超时时间，默认 5 秒
+	Timeout time.Duration
+
+	// Critical 关键检查项失败时整体状态为 fail，非关键检查项失败时整体状态为 degraded
+	Critical bool
+
+	// Interval 检查结果的缓存时间，为 0 时每次请求都会重新检查
+	Interval time.Duration
+
+	// Liveness 是否参与存活检查，存活检查只应包含进程自身的状态，
+	// 数据库等外部依赖只应参与就绪检查
+	Liveness bool
+}
+
+// Result 单个检查项的结果
+type Result struct {
+	Status    string    `json:"status"`
+	Critical  bool      `json:"critical"`
+	Error     string    `json:"error,omitempty"`
+	Duration  string    `json:"duration"`
+	CheckedAt time.Time `json:"checked_at"`
+	Cached    bool      `json:"cached,omitempty"`
+}
+
+// Report 一组检查项的汇总结果
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Registry 检查项的注册表
+type Registry struct {
+	mu     sync.RWMutex
+	checks []*entry
+}
+
+// entry 注册表中的检查项以及它的缓存结果
+type entry struct {
+	Check
+
+	mu     sync.Mutex
+	last   Result
+	hasRun bool
+}
+
+// NewRegistry 创建一个空的注册表
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register 注册一个检查项，名称为空、重复或者缺少检查方法时会 panic
+func (reg *Registry) Register(c Check) {
+	if c.Name == "" {
+		panic("api/health: check name must not be empty")
+	}
+	if c.Check == nil {
+		panic(fmt.Sprintf("api/health: check '%s' has no check func", c.Name))
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = defaultCheckTimeout
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for _, e := range reg.checks {
+		if e.Name == c.Name {
+			panic(fmt.Sprintf("api/health: check '%s' is already registered", c.Name))
+		}
+	}
+	reg.checks = append(reg.checks, &entry{Check: c})
+}
+
+// Unregister 移除一个检查项
+func (reg *Registry) Unregister(name string) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for i, e := range reg.checks {
+		if e.Name == name {
+			reg.checks = append(reg.checks[:i], reg.checks[i+1:]...)
+			return
+		}
+	}
+}
+
+// Names 返回所有检查项的名称
+func (reg *Registry) Names() []string {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	names := make([]string, 0, len(reg.checks))
+	for _, e := range reg.checks {
+		names = append(names, e.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Liveness 执行所有参与存活检查的检查项
+func (reg *Registry) Liveness(ctx context.Context) Report {
+	return reg.run(ctx, func(e *entry) bool { return e.Liveness })
+}
+
+// Readiness 执行所有检查项，服务进入关闭流程后就绪检查总是失败
+func (reg *Registry) Readiness(ctx context.Context) Report {
+	report := reg.run(ctx, func(e *entry) bool { return true })
+	if api.ShuttingDown() {
+		report.Checks[shutdownCheckName] = Result{
+			Status:    StatusFail,
+			Critical:  true,
+			Error:     "server is shutting down",
+			Duration:  "0s",
+			CheckedAt: time.Now(),
+		}
+		report.Status = StatusFail
+	}
+	return report
+}
+
+// Health 执行所有检查项，返回完整的健康状态
+func (reg *Registry) Health(ctx context.Context) Report {
+	return reg.run(ctx, func(e *entry) bool { return true })
+}
+
+// run 并发执行被 filter 选中的检查项并汇总结果
+func (reg *Registry) run(ctx context.Context, filter func(e *entry) bool) Report {
+	reg.mu.RLock()
+	var selected []*entry
+	for _, e := range reg.checks {
+		if filter(e) {
+			selected = append(selected, e)
+		}
+	}
+	reg.mu.RUnlock()
+
+	results := make([]Result, len(selected))
+	var wg sync.WaitGroup
+	for i, e := range selected {
+		wg.Add(1)
+		go func(i int, e *entry) {
+			defer wg.Done()
+			results[i] = e.run(ctx)
+		}(i, e)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(selected))}
+	for i, e := range selected {
+		res := results[i]
+		report.Checks[e.Name] = res
+		if res.Status == StatusOK {
+			continue
+		}
+		if e.Critical {
+			report.Status = StatusFail
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// run 执行检查，结果在缓存时间内会被复用
+func (e *entry) run(ctx context.Context) Result {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.hasRun && e.Interval > 0 && time.Since(e.last.CheckedAt) < e.Interval {
+		res := e.last
+		res.Cached = true
+		return res
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	errc := make(chan error, 1)
+	go func() {
+		defer func() {
+			if rvr := recover(); rvr != nil {
+				errc <- fmt.Errorf("panic: %v", rvr)
+			}
+		}()
+		errc <- e.Check.Check(ctx)
+	}()
+
+	var err error
+	canceled := false
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.Canceled) {
+			// 调用方取消了请求，例如探测的连接已经断开，不代表检查失败
+			canceled = true
+			err = fmt.Errorf("check canceled: %w", ctx.Err())
+		} else {
+			err = fmt.Errorf("check timed out after %s", e.Timeout)
+		}
+	}
+
+	res := Result{
+		Status:    StatusOK,
+		Critical:  e.Critical,
+		Duration:  time.Since(start).String(),
+		CheckedAt: start,
+	}
+	if err != nil {
+		res.Status = StatusFail
+		res.Error = err.Error()
+	}
+
+	// 取消的结果不缓存，避免影响之后的请求
+	if canceled {
+		return res
+	}
+	e.last = res
+	e.hasRun = true
+	return res
+}
@@ -0,0 +1,191 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRegistryStatus(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register(Check{Name: "ok", Check: func(ctx context.Context) error { return nil }, Critical: true})
+	reg.Register(Check{Name: "cache", Check: func(ctx context.Context) error { return errors.New("down") }})
+
+	report := reg.Health(context.Background())
+	if report.Status != StatusDegraded {
+		t.Fatalf("expecting status '%s' but got '%s'", StatusDegraded, report.Status)
+	}
+	if report.Checks["cache"].Error != "down" {
+		t.Fatalf("expecting cache error 'down' but got '%s'", report.Checks["cache"].Error)
+	}
+
+	reg.Register(Check{Name: "db", Check: func(ctx context.Context) error { return errors.New("down") }, Critical: true})
+	if report = reg.Health(context.Background()); report.Status != StatusFail {
+		t.Fatalf("expecting status '%s' but got '%s'", StatusFail, report.Status)
+	}
+
+	reg.Unregister("db")
+	if report = reg.Health(context.Background()); report.Status != StatusDegraded {
+		t.Fatalf("expecting status '%s' after unregister but got '%s'", StatusDegraded, report.Status)
+	}
+}
+
+func TestRegistryDuplicate(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register(Check{Name: "a", Check: func(ctx context.Context) error { return nil }})
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expecting panic on duplicate check name")
+		}
+	}()
+	reg.Register(Check{Name: "a", Check: func(ctx context.Context) error { return nil }})
+}
+
+func TestCheckTimeout(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register(Check{
+		Name:     "slow",
+		Critical: true,
+		Timeout:  20 * time.Millisecond,
+		Check: func(ctx context.Context) error {
+			<-ctx.Done()
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		},
+	})
+
+	start := time.Now()
+	report := reg.Health(context.Background())
+	if report.Status != StatusFail {
+		t.Fatalf("expecting timed out check to fail but got '%s'", report.Status)
+	}
+	if time.Since(start) > 200*time.Millisecond {
+		t.Fatalf("check did not respect its timeout")
+	}
+}
+
+func TestCheckCanceled(t *testing.T) {
+	var calls int32
+	reg := NewRegistry()
+	reg.Register(Check{
+		Name:     "blocked",
+		Interval: time.Hour,
+		Check: func(ctx context.Context) error {
+			if atomic.AddInt32(&calls, 1) > 1 {
+				return nil
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	res := reg.Health(ctx).Checks["blocked"]
+	if res.Status != StatusFail || res.Error != "check canceled: context canceled" {
+		t.Fatalf("expecting a canceled result but got %+v", res)
+	}
+
+	// 取消的结果不会被缓存
+	if res = reg.Health(context.Background()).Checks["blocked"]; res.Status != StatusOK || res.Cached {
+		t.Fatalf("expecting the check to run again but got %+v", res)
+	}
+}
+
+func TestCheckInterval(t *testing.T) {
+	var calls int32
+	reg := NewRegistry()
+	reg.Register(Check{
+		Name:     "counted",
+		Interval: time.Hour,
+		Check: func(ctx context.Context) error {
+			atomic.AddInt32(&calls, 1)
+			return nil
+		},
+	})
+
+	reg.Health(context.Background())
+	report := reg.Health(context.Background())
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatalf("expecting check to run once but ran %d times", n)
+	}
+	if !report.Checks["counted"].Cached {
+		t.Fatal("expecting second result to be cached")
+	}
+}
+
+func TestEndpoints(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register(Check{Name: "goroutines", Check: GoroutineCheck(1 << 20), Liveness: true})
+	reg.Register(Check{Name: "db", Check: func(ctx context.Context) error { return errors.New("refused") }, Critical: true})
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("next"))
+	})
+	h := reg.Endpoints("/")(next)
+
+	tests := []struct {
+		path   string
+		status int
+		checks int
+	}{
+		{"/livez", http.StatusOK, 1},
+		{"/readyz", http.StatusServiceUnavailable, 2},
+		{"/healthz", http.StatusServiceUnavailable, 2},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.status {
+			t.Fatalf("%s: expecting status %d but got %d", tt.path, tt.status, w.Code)
+		}
+		var report Report
+		if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+			t.Fatalf("%s: invalid json: %v", tt.path, err)
+		}
+		if len(report.Checks) != tt.checks {
+			t.Fatalf("%s: expecting %d checks but got %d", tt.path, tt.checks, len(report.Checks))
+		}
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/other", nil))
+	if w.Body.String() != "next" {
+		t.Fatalf("expecting request to pass through but got '%s'", w.Body.String())
+	}
+}
+
+func TestBuiltinChecks(t *testing.T) {
+	ctx := context.Background()
+
+	if err := GoroutineCheck(0)(ctx); err == nil {
+		t.Fatal("expecting goroutine check to fail with max 0")
+	}
+
+	if err := DiskSpaceCheck(".", 1)(ctx); err != nil {
+		t.Fatalf("expecting disk space check to pass: %v", err)
+	}
+	if err := DiskSpaceCheck(".", 1<<62)(ctx); err == nil {
+		t.Fatal("expecting disk space check to fail")
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	if err := TCPDialCheck(addr)(ctx); err != nil {
+		t.Fatalf("expecting dial check to pass: %v", err)
+	}
+	ln.Close()
+	if err := TCPDialCheck(addr)(ctx); err == nil {
+		t.Fatal("expecting dial check to fail on a closed port")
+	}
+}
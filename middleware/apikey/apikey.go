@@ -0,0 +1,209 @@
+// Package apikey 提供 API 密钥认证中间件。密钥的格式为 <ID>.<secret>，存储中只保存 secret 的 SHA-256，
+// 按照 ID 查找后使用常量时间比较哈希：
+//
+//	store, _ := apikey.NewFileStore("/var/lib/api/keys.json")
+//	r.Use(apikey.Handler(apikey.Options{Store: store, Query: "api_key"}))
+//	r.With(apikey.RequireScope("orders:write")).Post("/orders", createOrder)
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_api/resp"
+)
+
+// 认证失败的错误
+var (
+	ErrKeyMissing = errors.New("apikey: key is missing")
+	ErrKeyInvalid = errors.New("apikey: key is invalid")
+	ErrKeyExpired = errors.New("apikey: key has expired")
+)
+
+// Key 一个 API 密钥
+type Key struct {
+	// ID 密钥 ID，是明文密钥的前半部分，可以出现在日志中
+	ID string `json:"id"`
+	// Hash secret 的 SHA-256，十六进制
+	Hash string `json:"hash"`
+	// Owner 密钥的所有者，例如合作方的名称
+	Owner string `json:"owner"`
+	// Scopes 授权的范围，例如 orders:read，* 表示所有范围
+	Scopes []string `json:"scopes"`
+	// ExpiresAt 过期时间，零值表示不过期
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	// LastUsed 最后一次使用的时间
+	LastUsed time.Time `json:"last_used,omitempty"`
+}
+
+// HasScope 判断密钥是否拥有指定的范围
+func (k *Key) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired 判断密钥在 now 时是否已经过期
+func (k *Key) Expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+// Generate 生成新的密钥，返回只展示一次的明文密钥和需要保存的 Key，ttl 小于等于 0 时不过期
+func Generate(owner string, scopes []string, ttl time.Duration) (string, *Key, error) {
+	var id [8]byte
+	var secret [32]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return "", nil, err
+	}
+	if _, err := rand.Read(secret[:]); err != nil {
+		return "", nil, err
+	}
+	s := base64.RawURLEncoding.EncodeToString(secret[:])
+	k := &Key{
+		ID:     hex.EncodeToString(id[:]),
+		Hash:   hashSecret(s),
+		Owner:  owner,
+		Scopes: scopes,
+	}
+	if ttl > 0 {
+		k.ExpiresAt = time.Now().Add(ttl)
+	}
+	return k.ID + "." + s, k, nil
+}
+
+// hashSecret 计算 secret 的哈希
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify 在存储中查找并验证明文密钥
+func Verify(ctx context.Context, store KeyStore, plaintext string, now time.Time) (*Key, error) {
+	id, secret, ok := strings.Cut(plaintext, ".")
+	if !ok || id == "" || secret == "" {
+		return nil, ErrKeyInvalid
+	}
+	k, err := store.Lookup(ctx, id)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, ErrKeyInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(k.Hash)) != 1 {
+		return nil, ErrKeyInvalid
+	}
+	if k.Expired(now) {
+		return nil, ErrKeyExpired
+	}
+	return k, nil
+}
+
+// contextKey 保存密钥的上下文键
+type contextKey struct{}
+
+// KeyCtxKey 请求上下文中保存认证通过的密钥的键
+var KeyCtxKey = contextKey{}
+
+// FromContext 返回认证通过的密钥，没有通过认证时返回 nil
+func FromContext(ctx context.Context) *Key {
+	k, _ := ctx.Value(KeyCtxKey).(*Key)
+	return k
+}
+
+// Options API 密钥认证中间件的配置
+type Options struct {
+	// Store 密钥的存储
+	Store KeyStore
+
+	// Header 读取密钥的请求头，默认 X-API-Key
+	Header string
+
+	// Query 不为空时，没有请求头的请求从这个查询参数中读取密钥，例如 api_key
+	Query string
+
+	// ErrorHandler 认证失败时的处理，默认通过 resp.Unauthorized 响应 401
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// Handler 创建 API 密钥认证中间件，认证通过的密钥保存在请求上下文中，通过 FromContext 读取，
+// 并且会记录密钥的最后使用时间
+func Handler(options Options) func(next http.Handler) http.Handler {
+	if options.Header == "" {
+		options.Header = "X-API-Key"
+	}
+	if options.ErrorHandler == nil {
+		options.ErrorHandler = defaultErrorHandler
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			plaintext := r.Header.Get(options.Header)
+			if plaintext == "" && options.Query != "" {
+				plaintext = r.URL.Query().Get(options.Query)
+			}
+			if plaintext == "" {
+				options.ErrorHandler(w, r, ErrKeyMissing)
+				return
+			}
+
+			now := time.Now()
+			k, err := Verify(r.Context(), options.Store, plaintext, now)
+			if err != nil {
+				options.ErrorHandler(w, r, err)
+				return
+			}
+			if err := options.Store.Touch(r.Context(), k.ID, now); err != nil {
+				log.Printf("记录 API 密钥 %s 的使用时间失败：%v", k.ID, err)
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), KeyCtxKey, k)))
+		})
+	}
+}
+
+// RequireScope 要求认证通过的密钥拥有所有指定的范围，否则响应 403，需要在 Handler 之后使用：
+//
+//	r.With(apikey.RequireScope("orders:write")).Post("/orders", createOrder)
+func RequireScope(scopes ...string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k := FromContext(r.Context())
+			if k == nil {
+				defaultErrorHandler(w, r, ErrKeyMissing)
+				return
+			}
+			for _, scope := range scopes {
+				if !k.HasScope(scope) {
+					resp.Forbidden(w, "API 密钥没有权限："+scope)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// defaultErrorHandler 通过 resp 的错误格式响应 401
+func defaultErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	msg := "API 密钥无效"
+	switch {
+	case errors.Is(err, ErrKeyMissing):
+		msg = "缺少 API 密钥"
+	case errors.Is(err, ErrKeyExpired):
+		msg = "API 密钥已过期"
+	case !errors.Is(err, ErrKeyInvalid):
+		log.Printf("验证 API 密钥失败：%v", err)
+	}
+	resp.Unauthorized(w, "", msg)
+}
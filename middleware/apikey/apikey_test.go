@@ -0,0 +1,111 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_api/api"
+)
+
+func TestVerify(t *testing.T) {
+	plaintext, key, err := Generate("partner", []string{"orders:read"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(key.Hash, strings.Split(plaintext, ".")[1]) {
+		t.Fatal("expecting only the hash to be stored")
+	}
+	store := NewMemoryStore(key)
+	ctx := context.Background()
+
+	if k, err := Verify(ctx, store, plaintext, time.Now()); err != nil || k.Owner != "partner" {
+		t.Fatalf("expecting valid key but got %v, %v", k, err)
+	}
+	for _, bad := range []string{"", "nodot", key.ID + ".wrong", "unknown." + strings.Split(plaintext, ".")[1]} {
+		if _, err := Verify(ctx, store, bad, time.Now()); !errors.Is(err, ErrKeyInvalid) {
+			t.Fatalf("%q: expecting invalid key but got %v", bad, err)
+		}
+	}
+	if _, err := Verify(ctx, store, plaintext, time.Now().Add(2*time.Hour)); !errors.Is(err, ErrKeyExpired) {
+		t.Fatalf("expecting expired key but got %v", err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	reader, readKey, _ := Generate("reader", []string{"orders:read"}, 0)
+	writer, writeKey, _ := Generate("writer", []string{"orders:read", "orders:write"}, 0)
+	store := NewMemoryStore(readKey, writeKey)
+
+	r := api.NewRouter()
+	r.Use(Handler(Options{Store: store, Query: "api_key"}))
+	r.Get("/orders", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(FromContext(r.Context()).Owner))
+	})
+	r.With(RequireScope("orders:write")).Post("/orders", func(w http.ResponseWriter, r *http.Request) {})
+
+	do := func(method, target, key string) *httptest.ResponseRecorder {
+		rq := httptest.NewRequest(method, target, nil)
+		if key != "" {
+			rq.Header.Set("X-API-Key", key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, rq)
+		return w
+	}
+
+	if w := do("GET", "/orders", reader); w.Code != 200 || w.Body.String() != "reader" {
+		t.Fatalf("expecting reader but got %d %q", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/orders?api_key="+writer, ""); w.Code != 200 || w.Body.String() != "writer" {
+		t.Fatalf("expecting key from query but got %d %q", w.Code, w.Body.String())
+	}
+	if w := do("GET", "/orders", ""); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), `"code":1004`) {
+		t.Fatalf("expecting 401 but got %d %s", w.Code, w.Body.String())
+	}
+	if w := do("POST", "/orders", reader); w.Code != http.StatusForbidden {
+		t.Fatalf("expecting 403 but got %d", w.Code)
+	}
+	if w := do("POST", "/orders", writer); w.Code != 200 {
+		t.Fatalf("expecting 200 but got %d", w.Code)
+	}
+
+	if k, _ := store.Lookup(context.Background(), readKey.ID); k.LastUsed.IsZero() {
+		t.Fatal("expecting last used time to be recorded")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, key, _ := Generate("partner", []string{"*"}, 0)
+	if err := s.Add(key); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	s.Touch(context.Background(), key.ID, now)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := Verify(context.Background(), s, plaintext, now)
+	if err != nil || !k.HasScope("anything") || !k.LastUsed.Equal(now) {
+		t.Fatalf("expecting persisted key but got %+v, %v", k, err)
+	}
+	s.Revoke(key.ID)
+	if _, err := Verify(context.Background(), s, plaintext, now); !errors.Is(err, ErrKeyInvalid) {
+		t.Fatalf("expecting revoked key but got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package apikey
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrKeyNotFound 密钥不存在
+var ErrKeyNotFound = errors.New("apikey: key not found")
+
+// KeyStore 密钥的存储，只保存密钥的哈希
+type KeyStore interface {
+	// Lookup 按照密钥 ID 查找，不存在时返回 ErrKeyNotFound
+	Lookup(ctx context.Context, id string) (*Key, error)
+	// Touch 记录密钥最后一次使用的时间
+	Touch(ctx context.Context, id string, t time.Time) error
+}
+
+// MemoryStore 内存中的密钥存储
+type MemoryStore struct {
+	mu   sync.RWMutex
+	keys map[string]*Key
+}
+
+// NewMemoryStore 创建内存存储
+func NewMemoryStore(keys ...*Key) *MemoryStore {
+	s := &MemoryStore{keys: make(map[string]*Key)}
+	for _, k := range keys {
+		s.keys[k.ID] = k
+	}
+	return s
+}
+
+// Lookup 查找密钥，返回的是副本
+func (s *MemoryStore) Lookup(ctx context.Context, id string) (*Key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	k, ok := s.keys[id]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	c := *k
+	return &c, nil
+}
+
+// Touch 记录最后使用时间
+func (s *MemoryStore) Touch(ctx context.Context, id string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k, ok := s.keys[id]; ok {
+		k.LastUsed = t
+	}
+	return nil
+}
+
+// Add 添加或者替换密钥
+func (s *MemoryStore) Add(k *Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[k.ID] = k
+	return nil
+}
+
+// Revoke 删除密钥
+func (s *MemoryStore) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, id)
+	return nil
+}
+
+// List 返回所有的密钥
+func (s *MemoryStore) List() []Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		list = append(list, *k)
+	}
+	return list
+}
+
+// DefaultFlushInterval FileStore 默认写入最后使用时间的间隔
+const DefaultFlushInterval = time.Minute
+
+// FileStore 保存在 JSON 文件中的密钥存储，文件内容是 Key 的数组。
+// 添加和删除密钥时立即写入文件，最后使用时间最多每 DefaultFlushInterval 写入一次
+type FileStore struct {
+	*MemoryStore
+	path          string
+	flushInterval time.Duration
+
+	mu        sync.Mutex
+	dirty     bool
+	lastFlush time.Time
+}
+
+// NewFileStore 从文件加载密钥，文件不存在时创建空的存储
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{MemoryStore: NewMemoryStore(), path: path, flushInterval: DefaultFlushInterval, lastFlush: time.Now()}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys []*Key
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		s.keys[k.ID] = k
+	}
+	return s, nil
+}
+
+// Touch 记录最后使用时间，距离上次写入超过间隔时写入文件
+func (s *FileStore) Touch(ctx context.Context, id string, t time.Time) error {
+	s.MemoryStore.Touch(ctx, id, t)
+	s.mu.Lock()
+	s.dirty = true
+	due := t.Sub(s.lastFlush) >= s.flushInterval
+	s.mu.Unlock()
+	if due {
+		return s.Flush()
+	}
+	return nil
+}
+
+// Add 添加或者替换密钥并写入文件
+func (s *FileStore) Add(k *Key) error {
+	s.MemoryStore.Add(k)
+	return s.Flush()
+}
+
+// Revoke 删除密钥并写入文件
+func (s *FileStore) Revoke(id string) error {
+	s.MemoryStore.Revoke(id)
+	return s.Flush()
+}
+
+// Flush 将所有的密钥写入文件，先写入临时文件再重命名
+func (s *FileStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := json.MarshalIndent(s.List(), "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(s.path), ".apikeys-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), s.path); err != nil {
+		return err
+	}
+	s.dirty = false
+	s.lastFlush = time.Now()
+	return nil
+}
+
+// Close 写入还没有保存的最后使用时间，程序退出前调用
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	dirty := s.dirty
+	s.mu.Unlock()
+	if dirty {
+		return s.Flush()
+	}
+	return nil
+}
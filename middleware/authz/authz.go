@@ -0,0 +1,266 @@
+// Package authz 提供基于路由模式的授权中间件，在认证中间件之后使用。
+// 授权的资源是匹配的路由模式，例如 /users/{id}，操作是 HTTP 方法，
+// 策略可以是 Go 中定义的 Rules，也可以是类似 casbin 的策略文件：
+//
+//	policy := authz.Rules{
+//		{Name: "admin", Roles: []string{"admin"}},
+//		{Name: "self", Resources: []string{"/users/{id}"}, Actions: []string{"GET", "PUT"},
+//			When: func(r *authz.Request) bool { return r.Param("id") == r.Subject.ID }},
+//	}
+//	r.Use(jwt.Handler(jwtOpts))
+//	r.Use(authz.Handler(authz.Options{Policy: policy, Subject: authz.JWTSubject("roles"), DenyByDefault: true}))
+//	r.Get("/debug/authz", authz.Explain(r, authzOpts).ServeHTTP)
+package authz
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/zhangdapeng520/zdpgo_api/api"
+	"github.com/zhangdapeng520/zdpgo_api/middleware/apikey"
+	"github.com/zhangdapeng520/zdpgo_api/middleware/jwt"
+	"github.com/zhangdapeng520/zdpgo_api/middleware/mtls"
+	"github.com/zhangdapeng520/zdpgo_api/resp"
+)
+
+// AnonymousRole 没有通过认证的主体拥有的角色
+const AnonymousRole = "anonymous"
+
+// Subject 访问资源的主体
+type Subject struct {
+	// ID 主体的 ID，例如用户 ID，没有通过认证时为空
+	ID string `json:"id"`
+	// Roles 主体的角色
+	Roles []string `json:"roles"`
+	// Attrs 主体的属性，用于 Rule.When 中的判断，例如部门、租户
+	Attrs map[string]interface{} `json:"attrs,omitempty"`
+}
+
+// HasRole 判断主体是否拥有角色
+func (s *Subject) HasRole(role string) bool {
+	for _, r := range s.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Anonymous 判断主体是否没有通过认证
+func (s *Subject) Anonymous() bool {
+	return s.ID == ""
+}
+
+// Request 一次授权请求
+type Request struct {
+	// Subject 主体，不为 nil
+	Subject *Subject
+	// Resource 匹配的路由模式，例如 /users/{id}
+	Resource string
+	// Action HTTP 方法
+	Action string
+	// Params 路径参数
+	Params map[string]string
+	// HTTP 原始的请求，Explain 中为 nil
+	HTTP *http.Request
+}
+
+// Param 返回路径参数
+func (r *Request) Param(key string) string {
+	return r.Params[key]
+}
+
+// Decision 授权的结果
+type Decision struct {
+	// Allowed 是否允许访问
+	Allowed bool `json:"allowed"`
+	// Matched 是否有规则匹配，没有规则匹配时 Allowed 由 Options.DenyByDefault 决定
+	Matched bool `json:"matched"`
+	// Rule 决定结果的规则
+	Rule string `json:"rule,omitempty"`
+	// Reason 结果的说明
+	Reason string `json:"reason"`
+	// Subject 授权的主体
+	Subject *Subject `json:"subject"`
+}
+
+// Policy 授权策略
+type Policy interface {
+	Evaluate(req *Request) Decision
+}
+
+// contextKey 保存授权结果的上下文键
+type contextKey struct{}
+
+// DecisionCtxKey 请求上下文中保存授权结果的键
+var DecisionCtxKey = contextKey{}
+
+// FromContext 返回请求的授权结果，没有经过授权中间件时返回 nil
+func FromContext(ctx context.Context) *Decision {
+	d, _ := ctx.Value(DecisionCtxKey).(*Decision)
+	return d
+}
+
+// Options 授权中间件的配置
+type Options struct {
+	// Policy 授权策略
+	Policy Policy
+
+	// Subject 返回请求的主体，返回 nil 表示没有通过认证，例如 JWTSubject、APIKeySubject、MTLSSubject
+	Subject func(r *http.Request) *Subject
+
+	// DenyByDefault 为 true 时拒绝没有规则匹配的请求，为 false 时放行并记录日志，用于逐步接入授权
+	DenyByDefault bool
+
+	// ErrorHandler 拒绝访问时的处理，默认没有通过认证时通过 resp.Unauthorized 响应 401，否则通过 resp.Forbidden 响应 403
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, d Decision)
+}
+
+// Handler 创建授权中间件。中间件在路由之前执行时也可以得到完整的路由模式，
+// 没有匹配路由的请求直接交给路由器响应 404 或者 405
+func Handler(opts Options) func(next http.Handler) http.Handler {
+	if opts.ErrorHandler == nil {
+		opts.ErrorHandler = defaultErrorHandler
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rctx := api.RouteContext(r.Context())
+			if rctx == nil {
+				panic("authz: Handler must be used with an api router")
+			}
+			method := r.Method
+			if rctx.RouteMethod != "" {
+				method = rctx.RouteMethod
+			}
+			pattern, params, ok := resolve(rctx.Routes, method, routePath(r, rctx))
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ar := &Request{Subject: subjectOf(r, opts), Resource: pattern, Action: method, Params: params, HTTP: r}
+			d := decide(opts, ar)
+			if !d.Matched && d.Allowed {
+				log.Printf("授权策略没有匹配的规则，放行请求：%s %s", method, pattern)
+			}
+			if !d.Allowed {
+				opts.ErrorHandler(w, r, d)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), DecisionCtxKey, &d)))
+		})
+	}
+}
+
+// decide 执行策略，没有规则匹配时根据 DenyByDefault 决定结果
+func decide(opts Options, ar *Request) Decision {
+	d := opts.Policy.Evaluate(ar)
+	d.Subject = ar.Subject
+	if !d.Matched {
+		d.Allowed = !opts.DenyByDefault
+		d.Rule = ""
+		d.Reason = "no rule matched, allowed by default"
+		if opts.DenyByDefault {
+			d.Reason = "no rule matched, denied by default"
+		}
+	}
+	return d
+}
+
+// subjectOf 返回请求的主体，没有通过认证时返回拥有 AnonymousRole 的主体
+func subjectOf(r *http.Request, opts Options) *Subject {
+	var s *Subject
+	if opts.Subject != nil {
+		s = opts.Subject(r)
+	}
+	if s == nil {
+		s = &Subject{Roles: []string{AnonymousRole}}
+	}
+	return s
+}
+
+// routePath 返回从根路由开始匹配的路径。路由上下文中的 Routes 总是根路由，
+// 子路由中的 RoutePath 只是剩余的路径，因此只在根路由改写了 RoutePath 时使用它
+func routePath(r *http.Request, rctx *api.Context) string {
+	if rctx.RoutePath != "" && len(rctx.RoutePatterns) == 0 {
+		return rctx.RoutePath
+	}
+	if r.URL.RawPath != "" {
+		return r.URL.RawPath
+	}
+	return r.URL.Path
+}
+
+// resolve 在路由树中查找路径，返回完整的路由模式和路径参数
+func resolve(routes api.Routes, method, path string) (string, map[string]string, bool) {
+	if routes == nil {
+		return "", nil, false
+	}
+	tctx := api.NewRouteContext()
+	if !routes.Match(tctx, method, path) {
+		return "", nil, false
+	}
+	params := make(map[string]string, len(tctx.URLParams.Keys))
+	for i, k := range tctx.URLParams.Keys {
+		params[k] = tctx.URLParams.Values[i]
+	}
+	return tctx.RoutePattern(), params, true
+}
+
+// defaultErrorHandler 没有通过认证时响应 401，否则响应 403
+func defaultErrorHandler(w http.ResponseWriter, r *http.Request, d Decision) {
+	if d.Subject == nil || d.Subject.Anonymous() {
+		resp.Unauthorized(w, "", "请先登录")
+		return
+	}
+	resp.Forbidden(w, "没有访问权限")
+}
+
+// JWTSubject 从 jwt.FromContext 的声明中读取主体，ID 为 sub，角色从 rolesClaim 中读取，
+// 可以是字符串数组或者空格分隔的字符串，例如 roles 或者 scope
+func JWTSubject(rolesClaim string) func(r *http.Request) *Subject {
+	return func(r *http.Request) *Subject {
+		claims := jwt.FromContext(r.Context())
+		if claims == nil || claims.Subject() == "" {
+			return nil
+		}
+		s := &Subject{ID: claims.Subject(), Attrs: map[string]interface{}(claims)}
+		switch roles := claims[rolesClaim].(type) {
+		case string:
+			s.Roles = strings.Fields(roles)
+		case []interface{}:
+			for _, role := range roles {
+				if role, ok := role.(string); ok {
+					s.Roles = append(s.Roles, role)
+				}
+			}
+		}
+		return s
+	}
+}
+
+// APIKeySubject 从 apikey.FromContext 读取主体，ID 为密钥 ID，角色为密钥的 Scopes，属性 owner 为密钥的所有者
+func APIKeySubject(r *http.Request) *Subject {
+	k := apikey.FromContext(r.Context())
+	if k == nil {
+		return nil
+	}
+	return &Subject{ID: k.ID, Roles: k.Scopes, Attrs: map[string]interface{}{"owner": k.Owner}}
+}
+
+// MTLSSubject 从 mtls.FromContext 读取主体，ID 为身份的名称（SPIFFE ID 或者 CN），角色为证书的 OU，
+// 属性 spiffe_id、trust_domain、common_name 和 dns_names 来自证书
+func MTLSSubject(r *http.Request) *Subject {
+	id := mtls.FromContext(r.Context())
+	if id == nil {
+		return nil
+	}
+	return &Subject{ID: id.Name(), Roles: id.OrganizationalUnits, Attrs: map[string]interface{}{
+		"spiffe_id":    id.SPIFFEID,
+		"trust_domain": id.TrustDomain,
+		"common_name":  id.CommonName,
+		"dns_names":    id.DNSNames,
+	}}
+}
@@ -0,0 +1,249 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zhangdapeng520/zdpgo_api/api"
+	"github.com/zhangdapeng520/zdpgo_api/middleware/apikey"
+	"github.com/zhangdapeng520/zdpgo_api/middleware/jwt"
+	"github.com/zhangdapeng520/zdpgo_api/middleware/mtls"
+)
+
+// headerSubject 从测试请求头中读取主体
+func headerSubject(r *http.Request) *Subject {
+	id := r.Header.Get("X-User")
+	if id == "" {
+		return nil
+	}
+	return &Subject{ID: id, Roles: strings.Fields(r.Header.Get("X-Roles"))}
+}
+
+func testRouter(opts Options) http.Handler {
+	r := api.NewRouter()
+	r.Use(Handler(opts))
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		d := FromContext(r.Context())
+		w.Write([]byte(d.Rule))
+	}
+	r.Get("/public", ok)
+	r.Route("/api", func(r api.Router) {
+		r.Get("/users/{id}", ok)
+		r.Put("/users/{id}", ok)
+		r.Delete("/users/{id}", ok)
+		r.Route("/admin", func(r api.Router) {
+			r.Get("/stats", ok)
+		})
+	})
+	r.Get("/debug/authz", Explain(r, opts).ServeHTTP)
+	return r
+}
+
+func do(h http.Handler, method, path, user, roles string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	if user != "" {
+		r.Header.Set("X-User", user)
+		r.Header.Set("X-Roles", roles)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+var testRules = Rules{
+	{Name: "public", Resources: []string{"/public"}},
+	{Name: "no-delete", Deny: true, Resources: []string{"/api/users/{id}"}, Actions: []string{"DELETE"}, When: func(r *Request) bool {
+		return r.Param("id") == "1"
+	}},
+	{Name: "admin", Roles: []string{"admin"}},
+	{Name: "self", Resources: []string{"/api/users/{id}"}, Actions: []string{"GET", "PUT"}, When: func(r *Request) bool {
+		return r.Param("id") == r.Subject.ID
+	}},
+}
+
+func TestHandlerRules(t *testing.T) {
+	h := testRouter(Options{Policy: testRules, Subject: headerSubject, DenyByDefault: true})
+
+	tests := []struct {
+		method, path, user, roles string
+		code                      int
+		rule                      string
+	}{
+		{"GET", "/public", "", "", 200, "public"},
+		{"GET", "/api/users/7", "", "", 401, ""},
+		{"GET", "/api/users/7", "7", "", 200, "self"},
+		{"PUT", "/api/users/7", "7", "", 200, "self"},
+		{"DELETE", "/api/users/7", "7", "", 403, ""},
+		{"GET", "/api/users/8", "7", "", 403, ""},
+		{"GET", "/api/admin/stats", "7", "", 403, ""},
+		{"GET", "/api/admin/stats", "9", "admin", 200, "admin"},
+		{"DELETE", "/api/users/7", "9", "admin", 200, "admin"},
+		// 拒绝规则优先
+		{"DELETE", "/api/users/1", "9", "admin", 403, ""},
+		// 没有匹配的路由交给路由器处理
+		{"GET", "/missing", "9", "admin", 404, ""},
+		{"POST", "/api/users/7", "9", "admin", 405, ""},
+	}
+	for _, tt := range tests {
+		w := do(h, tt.method, tt.path, tt.user, tt.roles)
+		if w.Code != tt.code {
+			t.Errorf("%s %s as %q: expecting %d but got %d %s", tt.method, tt.path, tt.user, tt.code, w.Code, w.Body.String())
+			continue
+		}
+		if tt.code == 200 && w.Body.String() != tt.rule {
+			t.Errorf("%s %s as %q: expecting rule %q but got %q", tt.method, tt.path, tt.user, tt.rule, w.Body.String())
+		}
+	}
+}
+
+func TestHandlerAllowByDefault(t *testing.T) {
+	h := testRouter(Options{Policy: testRules, Subject: headerSubject})
+	if w := do(h, "GET", "/api/admin/stats", "7", ""); w.Code != 200 {
+		t.Fatalf("expecting unmatched requests to be allowed but got %d", w.Code)
+	}
+	// 拒绝规则仍然生效
+	if w := do(h, "DELETE", "/api/users/1", "7", ""); w.Code != 403 {
+		t.Fatalf("expecting 403 but got %d", w.Code)
+	}
+}
+
+func TestFilePolicy(t *testing.T) {
+	policy, err := ParsePolicy(strings.NewReader(`
+# 管理员
+p, admin, /api/*, *, allow
+p, member, /api/users/{id}, GET|put, allow, self
+p, *, /public, GET, allow
+p, *, /api/users/{id}, DELETE, deny, first
+p, user:dave, /api/admin/*, GET, allow
+
+g, user:alice, admin
+g, admin, member
+g, member, viewer
+g, viewer, member
+`), map[string]func(r *Request) bool{
+		"self":  func(r *Request) bool { return r.Param("id") == r.Subject.ID },
+		"first": func(r *Request) bool { return r.Param("id") == "1" },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roles := policy.RolesFor(&Subject{ID: "alice"}); strings.Join(roles, ",") != "user:alice,admin,member,viewer" {
+		t.Fatalf("expecting inherited roles but got %v", roles)
+	}
+
+	h := testRouter(Options{Policy: policy, Subject: headerSubject, DenyByDefault: true})
+	tests := []struct {
+		method, path, user, roles string
+		code                      int
+	}{
+		{"GET", "/public", "", "", 200},
+		{"GET", "/api/admin/stats", "alice", "", 200},
+		{"DELETE", "/api/users/2", "alice", "", 200},
+		{"DELETE", "/api/users/1", "alice", "", 403},
+		{"GET", "/api/users/bob", "bob", "member", 200},
+		{"PUT", "/api/users/bob", "bob", "member", 200},
+		{"GET", "/api/users/carol", "bob", "member", 403},
+		{"GET", "/api/admin/stats", "bob", "member", 403},
+		{"GET", "/api/admin/stats", "dave", "", 200},
+		// 主体 ID 和角色不在同一个命名空间中
+		{"GET", "/api/admin/stats", "admin", "", 403},
+		{"GET", "/api/admin/stats", "bob", "user:dave", 403},
+		{"GET", "/api/admin/stats", "bob", "user:alice", 403},
+	}
+	for _, tt := range tests {
+		if w := do(h, tt.method, tt.path, tt.user, tt.roles); w.Code != tt.code {
+			t.Errorf("%s %s as %q: expecting %d but got %d", tt.method, tt.path, tt.user, tt.code, w.Code)
+		}
+	}
+
+	for _, bad := range []string{
+		"p, admin, /api/*, *",
+		"p, admin, /api/*, *, maybe",
+		"p, admin, /api/*, *, allow, unknown",
+		"g, alice",
+		"g, user:bob, user:alice",
+		"x, alice, admin",
+	} {
+		if _, err := ParsePolicy(strings.NewReader(bad), nil); err == nil {
+			t.Errorf("expecting an error for %q", bad)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	h := testRouter(Options{Policy: Rules(append(testRules, Rule{Name: "debug", Resources: []string{"/debug/*"}, Roles: []string{"admin"}})), Subject: headerSubject, DenyByDefault: true})
+
+	explain := func(query, user, roles string) Explanation {
+		t.Helper()
+		w := do(h, "GET", "/debug/authz?"+query, user, roles)
+		if w.Code != 200 {
+			t.Fatalf("expecting 200 but got %d %s", w.Code, w.Body.String())
+		}
+		var e Explanation
+		if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+
+	// 解释接口本身也需要授权
+	if w := do(h, "GET", "/debug/authz?path=/public", "7", ""); w.Code != 403 {
+		t.Fatalf("expecting 403 but got %d", w.Code)
+	}
+
+	e := explain("method=put&path=/api/users/7&subject=7", "9", "admin")
+	if !e.Routed || e.Resource != "/api/users/{id}" || e.Params["id"] != "7" || e.Method != "PUT" {
+		t.Fatalf("unexpected explanation %+v", e)
+	}
+	if !e.Decision.Allowed || e.Decision.Rule != "self" || e.Decision.Subject.ID != "7" {
+		t.Fatalf("expecting allowed by self but got %+v", e.Decision)
+	}
+	if len(e.Rules) != 5 || e.Rules[2].Reason != "role" || !e.Rules[3].Matched {
+		t.Fatalf("unexpected rule results %+v", e.Rules)
+	}
+
+	// 默认使用当前请求的主体
+	e = explain("path=/api/admin/stats", "9", "admin")
+	if !e.Decision.Allowed || e.Decision.Subject.ID != "9" {
+		t.Fatalf("expecting the caller to be used but got %+v", e.Decision)
+	}
+
+	e = explain("path=/api/admin/stats&roles=", "9", "admin")
+	if e.Decision.Allowed || e.Decision.Matched || !e.Decision.Subject.Anonymous() {
+		t.Fatalf("expecting denied by default but got %+v", e.Decision)
+	}
+
+	if e = explain("path=/missing", "9", "admin"); e.Routed || e.Decision != nil {
+		t.Fatalf("expecting an unrouted explanation but got %+v", e)
+	}
+}
+
+func TestSubjects(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if JWTSubject("roles")(r) != nil || APIKeySubject(r) != nil {
+		t.Fatalf("expecting no subject")
+	}
+
+	ctx := context.WithValue(r.Context(), jwt.ClaimsCtxKey, jwt.Claims{"sub": "alice", "roles": []interface{}{"admin", "member"}, "scope": "read write"})
+	s := JWTSubject("roles")(r.WithContext(ctx))
+	if s.ID != "alice" || strings.Join(s.Roles, ",") != "admin,member" {
+		t.Fatalf("unexpected subject %+v", s)
+	}
+	if s = JWTSubject("scope")(r.WithContext(ctx)); strings.Join(s.Roles, ",") != "read,write" {
+		t.Fatalf("unexpected roles %v", s.Roles)
+	}
+
+	ctx = context.WithValue(r.Context(), apikey.KeyCtxKey, &apikey.Key{ID: "k1", Owner: "partner", Scopes: []string{"orders:read"}})
+	if s = APIKeySubject(r.WithContext(ctx)); s.ID != "k1" || !s.HasRole("orders:read") || s.Attrs["owner"] != "partner" {
+		t.Fatalf("unexpected subject %+v", s)
+	}
+
+	ctx = context.WithValue(r.Context(), mtls.IdentityCtxKey, &mtls.Identity{SPIFFEID: "spiffe://prod.example.com/ns/billing", TrustDomain: "prod.example.com", OrganizationalUnits: []string{"platform"}})
+	if s = MTLSSubject(r.WithContext(ctx)); s.ID != "spiffe://prod.example.com/ns/billing" || !s.HasRole("platform") || s.Attrs["trust_domain"] != "prod.example.com" {
+		t.Fatalf("unexpected subject %+v", s)
+	}
+}
@@ -0,0 +1,68 @@
+package authz
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/zhangdapeng520/zdpgo_api/api"
+	"github.com/zhangdapeng520/zdpgo_api/resp"
+)
+
+// Explanation Explain 的响应
+type Explanation struct {
+	Method   string            `json:"method"`
+	Path     string            `json:"path"`
+	Resource string            `json:"resource"`
+	Params   map[string]string `json:"params,omitempty"`
+	// Routed 路径是否匹配了路由，没有匹配时请求不会经过授权
+	Routed   bool         `json:"routed"`
+	Decision *Decision    `json:"decision,omitempty"`
+	Rules    []RuleResult `json:"rules,omitempty"`
+}
+
+// Explain 返回解释授权结果的处理器，通常挂载在 /debug/authz，例如：
+//
+//	GET /debug/authz?method=PUT&path=/users/42
+//	GET /debug/authz?method=DELETE&path=/users/42&subject=alice&roles=member,auditor
+//
+// 默认使用当前请求的主体，subject 和 roles 参数可以模拟其他主体。
+// 这个接口会暴露授权策略，应该只对管理员开放
+func Explain(routes api.Routes, opts Options) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		e := &Explanation{Method: strings.ToUpper(q.Get("method")), Path: q.Get("path")}
+		if e.Method == "" {
+			e.Method = http.MethodGet
+		}
+		if e.Path == "" {
+			resp.ErrorMap(w, http.StatusBadRequest, "status", false, "code", 1001, "msg", "缺少 path 参数")
+			return
+		}
+
+		e.Resource, e.Params, e.Routed = resolve(routes, e.Method, e.Path)
+		if !e.Routed {
+			resp.Json(w, e)
+			return
+		}
+
+		subject := subjectOf(r, opts)
+		if q.Has("subject") || q.Has("roles") {
+			subject = &Subject{ID: q.Get("subject")}
+			for _, role := range strings.Split(q.Get("roles"), ",") {
+				if role = strings.TrimSpace(role); role != "" {
+					subject.Roles = append(subject.Roles, role)
+				}
+			}
+			if subject.Anonymous() && len(subject.Roles) == 0 {
+				subject.Roles = []string{AnonymousRole}
+			}
+		}
+		ar := &Request{Subject: subject, Resource: e.Resource, Action: e.Method, Params: e.Params}
+		d := decide(opts, ar)
+		e.Decision = &d
+		if explainer, ok := opts.Policy.(Explainer); ok {
+			e.Rules = explainer.Explain(ar)
+		}
+		resp.Json(w, e)
+	})
+}
@@ -0,0 +1,280 @@
+package authz
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Rule 一条授权规则，所有条件都满足时规则匹配
+type Rule struct {
+	// Name 规则的名称，出现在 Decision 和 Explain 中
+	Name string
+	// Deny 为 true 时匹配的请求被拒绝，拒绝规则优先于允许规则
+	Deny bool
+	// Subjects 主体 ID，为空时不限制
+	Subjects []string
+	// Roles 主体拥有其中任意一个角色即可，为空时不限制
+	Roles []string
+	// Resources 路由模式，以 * 结尾时匹配前缀，例如 /admin/*，为空时不限制
+	Resources []string
+	// Actions HTTP 方法，为空时不限制
+	Actions []string
+	// When 不为 nil 时还需要返回 true，用于基于属性的判断，例如只能修改自己的资源
+	When func(r *Request) bool
+}
+
+// RuleResult 一条规则的执行结果，用于 Explain
+type RuleResult struct {
+	Rule    string `json:"rule"`
+	Deny    bool   `json:"deny"`
+	Matched bool   `json:"matched"`
+	// Reason 规则不匹配的原因
+	Reason string `json:"reason,omitempty"`
+}
+
+// Explainer 可以解释每条规则执行结果的策略
+type Explainer interface {
+	Explain(req *Request) []RuleResult
+}
+
+// Rules 在 Go 中定义的策略，有拒绝规则匹配时拒绝，否则有允许规则匹配时允许
+type Rules []Rule
+
+// Evaluate 执行策略
+func (rules Rules) Evaluate(req *Request) Decision {
+	return rules.evaluate(req, nil)
+}
+
+// Explain 返回每条规则的执行结果
+func (rules Rules) Explain(req *Request) []RuleResult {
+	results := make([]RuleResult, 0, len(rules))
+	rules.evaluate(req, &results)
+	return results
+}
+
+func (rules Rules) evaluate(req *Request, results *[]RuleResult) Decision {
+	var allow *Rule
+	for i := range rules {
+		rule := &rules[i]
+		reason := rule.mismatch(req)
+		if results != nil {
+			*results = append(*results, RuleResult{Rule: rule.Name, Deny: rule.Deny, Matched: reason == "", Reason: reason})
+		}
+		if reason != "" {
+			continue
+		}
+		if rule.Deny {
+			return Decision{Matched: true, Rule: rule.Name, Reason: "denied by rule " + rule.Name}
+		}
+		if allow == nil {
+			allow = rule
+		}
+	}
+	if allow != nil {
+		return Decision{Allowed: true, Matched: true, Rule: allow.Name, Reason: "allowed by rule " + allow.Name}
+	}
+	return Decision{}
+}
+
+// mismatch 返回规则不匹配的原因，匹配时返回空字符串
+func (rule *Rule) mismatch(req *Request) string {
+	if len(rule.Subjects) > 0 && !contains(rule.Subjects, req.Subject.ID) {
+		return "subject"
+	}
+	if len(rule.Roles) > 0 && !anyRole(rule.Roles, req.Subject) {
+		return "role"
+	}
+	if len(rule.Resources) > 0 && !anyResource(rule.Resources, req.Resource) {
+		return "resource"
+	}
+	if len(rule.Actions) > 0 && !contains(rule.Actions, req.Action) && !contains(rule.Actions, "*") {
+		return "action"
+	}
+	if rule.When != nil && !rule.When(req) {
+		return "condition"
+	}
+	return ""
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func anyRole(roles []string, s *Subject) bool {
+	for _, role := range roles {
+		if role == "*" || s.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+func anyResource(patterns []string, resource string) bool {
+	for _, p := range patterns {
+		if matchResource(p, resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchResource 判断路由模式是否匹配，* 匹配所有，以 * 结尾时匹配前缀
+func matchResource(p, resource string) bool {
+	if p == "*" || p == resource {
+		return true
+	}
+	if strings.HasSuffix(p, "*") {
+		prefix := strings.TrimSuffix(p, "*")
+		// /admin/* 也匹配 /admin
+		return strings.HasPrefix(resource, prefix) || resource == strings.TrimSuffix(prefix, "/")
+	}
+	return false
+}
+
+// SubjectPrefix 策略文件中主体 ID 的前缀，没有前缀的名称都是角色
+const SubjectPrefix = "user:"
+
+// FilePolicy 从类似 casbin 的策略文件加载的策略，每行是一条规则或者一个角色关系，# 开头的行是注释：
+//
+//	# p, 主体或者角色, 路由模式, HTTP 方法, allow 或者 deny[, 条件]
+//	p, admin, /admin/*, *, allow
+//	p, member, /users/{id}, GET|PUT, allow, self
+//	p, user:bob, /reports/*, GET, allow
+//	p, *, /users/{id}, DELETE, deny
+//	# g, 主体或者角色, 继承的角色
+//	g, user:alice, admin
+//	g, admin, member
+//
+// 主体 ID 需要加上 SubjectPrefix，例如 user:alice，没有前缀的名称都是角色，
+// 因此 ID 为 admin 的主体不会获得 admin 角色的权限。Subject.Roles 中带有前缀的角色会被忽略，
+// 避免令牌中的角色冒充其他主体。
+//
+// 条件是 ParsePolicy 传入的具名函数，用于基于属性的判断。角色可以多级继承，
+// 主体 ID 和 Subject.Roles 中的角色都会按照 g 展开
+type FilePolicy struct {
+	rules  Rules
+	groups map[string][]string
+}
+
+// LoadPolicyFile 从文件加载策略
+func LoadPolicyFile(path string, conditions map[string]func(r *Request) bool) (*FilePolicy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParsePolicy(f, conditions)
+}
+
+// ParsePolicy 解析策略，conditions 是策略中可以引用的条件
+func ParsePolicy(r io.Reader, conditions map[string]func(r *Request) bool) (*FilePolicy, error) {
+	p := &FilePolicy{groups: make(map[string][]string)}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		switch fields[0] {
+		case "p":
+			if len(fields) != 5 && len(fields) != 6 {
+				return nil, fmt.Errorf("authz: line %d: expecting p, subject, resource, action, effect[, condition]", n)
+			}
+			rule := Rule{Name: fmt.Sprintf("line %d: %s", n, line)}
+			if fields[1] != "*" {
+				// 主体 ID 带有 SubjectPrefix 展开到了 Roles 中
+				rule.Roles = []string{fields[1]}
+			}
+			rule.Resources = []string{fields[2]}
+			if fields[3] != "*" {
+				rule.Actions = strings.Split(strings.ToUpper(fields[3]), "|")
+			}
+			switch fields[4] {
+			case "allow":
+			case "deny":
+				rule.Deny = true
+			default:
+				return nil, fmt.Errorf("authz: line %d: effect must be allow or deny", n)
+			}
+			if len(fields) == 6 {
+				cond, ok := conditions[fields[5]]
+				if !ok {
+					return nil, fmt.Errorf("authz: line %d: unknown condition %q", n, fields[5])
+				}
+				rule.When = cond
+			}
+			p.rules = append(p.rules, rule)
+		case "g":
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("authz: line %d: expecting g, subject, role", n)
+			}
+			if strings.HasPrefix(fields[2], SubjectPrefix) {
+				return nil, fmt.Errorf("authz: line %d: cannot inherit from subject %q", n, fields[2])
+			}
+			p.groups[fields[1]] = append(p.groups[fields[1]], fields[2])
+		default:
+			return nil, fmt.Errorf("authz: line %d: unknown policy type %q", n, fields[0])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Evaluate 执行策略
+func (p *FilePolicy) Evaluate(req *Request) Decision {
+	return p.rules.Evaluate(p.expand(req))
+}
+
+// Explain 返回每条规则的执行结果
+func (p *FilePolicy) Explain(req *Request) []RuleResult {
+	return p.rules.Explain(p.expand(req))
+}
+
+// RolesFor 返回主体 ID 和角色按照 g 展开后的所有角色，包括加上 SubjectPrefix 的主体 ID 本身
+func (p *FilePolicy) RolesFor(s *Subject) []string {
+	var roles []string
+	seen := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if name == "" || seen[name] {
+			return
+		}
+		seen[name] = true
+		roles = append(roles, name)
+		for _, parent := range p.groups[name] {
+			visit(parent)
+		}
+	}
+	if s.ID != "" {
+		visit(SubjectPrefix + s.ID)
+	}
+	for _, role := range s.Roles {
+		if !strings.HasPrefix(role, SubjectPrefix) {
+			visit(role)
+		}
+	}
+	return roles
+}
+
+// expand 返回角色展开后的请求，不修改原来的主体
+func (p *FilePolicy) expand(req *Request) *Request {
+	subject := *req.Subject
+	subject.Roles = p.RolesFor(req.Subject)
+	expanded := *req
+	expanded.Subject = &subject
+	return &expanded
+}
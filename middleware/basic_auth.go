@@ -1,13 +1,77 @@
 package middleware
 
 import (
+	"context"
+	"crypto/sha256"
 	"crypto/subtle"
 	"fmt"
+	"log"
 	"net/http"
 )
 
+// BasicAuthUserCtxKey is the context.Context key to store the authenticated user name.
+var BasicAuthUserCtxKey = &contextKey{"BasicAuthUser"}
+
+// Verifier 校验基本认证的用户名和密码。用户不存在时应该花费与用户存在时相同的时间，
+// 避免通过响应时间枚举用户名。返回的 error 表示校验本身失败，例如后端存储不可用
+type Verifier interface {
+	Verify(ctx context.Context, user, password string) (bool, error)
+}
+
+// VerifierFunc 把函数转换为 Verifier
+type VerifierFunc func(ctx context.Context, user, password string) (bool, error)
+
+// Verify 调用 f
+func (f VerifierFunc) Verify(ctx context.Context, user, password string) (bool, error) {
+	return f(ctx, user, password)
+}
+
+// Credentials 明文密码，键是用户名，值是密码
+type Credentials map[string]string
+
+// Verify 校验明文密码。比较的是密码的 SHA-256，比较时间与密码长度和用户是否存在无关
+func (c Credentials) Verify(_ context.Context, user, password string) (bool, error) {
+	got := sha256.Sum256([]byte(password))
+	credPass, ok := c[user]
+	if !ok {
+		// 用户不存在时也做一次同样的比较
+		var dummy [sha256.Size]byte
+		subtle.ConstantTimeCompare(got[:], dummy[:])
+		return false, nil
+	}
+	want := sha256.Sum256([]byte(credPass))
+	return subtle.ConstantTimeCompare(got[:], want[:]) == 1, nil
+}
+
+// BasicAuthOpts 基本认证中间件的配置
+type BasicAuthOpts struct {
+	// Realm 响应 WWW-Authenticate 中的 realm
+	Realm string
+
+	// Verifier 校验用户名和密码，例如 Credentials、NewHashedCredentials 或者 NewHtpasswdFile
+	Verifier Verifier
+
+	// Blocked 返回 true 时直接响应 429，不再校验密码，可以和 OnFailure 一起实现失败次数限制
+	Blocked func(r *http.Request, user string) bool
+
+	// OnFailure 认证失败时调用，user 是请求中的用户名，没有提交凭据时为空
+	OnFailure func(r *http.Request, user string)
+
+	// OnSuccess 认证成功时调用，可以用来清除失败次数
+	OnSuccess func(r *http.Request, user string)
+}
+
 // BasicAuth 实现了一个简单的中间件处理程序，用于向路由添加基本的 http 验证。
 func BasicAuth(realm string, creds map[string]string) func(next http.Handler) http.Handler {
+	return BasicAuthWithOpts(BasicAuthOpts{Realm: realm, Verifier: Credentials(creds)})
+}
+
+// BasicAuthWithOpts 使用 BasicAuthOpts 创建基本认证中间件，通过认证的用户名保存在请求上下文中，
+// 通过 BasicAuthUser 读取
+func BasicAuthWithOpts(opts BasicAuthOpts) func(next http.Handler) http.Handler {
+	if opts.Verifier == nil {
+		panic("api/middleware: BasicAuth expects a Verifier")
+	}
 	// 返回一个中间件
 	return func(next http.Handler) http.Handler {
 		// 返回一个处理器
@@ -15,23 +79,48 @@ func BasicAuth(realm string, creds map[string]string) func(next http.Handler) ht
 			// 获取用户名和密码
 			user, pass, ok := r.BasicAuth()
 			if !ok {
-				basicAuthFailed(w, realm)
+				if opts.OnFailure != nil {
+					opts.OnFailure(r, "")
+				}
+				basicAuthFailed(w, opts.Realm)
 				return
 			}
 
-			// 根据用户名获取密码并进行校验
-			credPass, credUserOk := creds[user]
-			if !credUserOk || subtle.ConstantTimeCompare([]byte(pass), []byte(credPass)) != 1 {
-				basicAuthFailed(w, realm)
+			if opts.Blocked != nil && opts.Blocked(r, user) {
+				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
 				return
 			}
 
+			// 校验用户名和密码
+			valid, err := opts.Verifier.Verify(r.Context(), user, pass)
+			if err != nil {
+				log.Printf("校验基本认证失败：%v", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			if !valid {
+				if opts.OnFailure != nil {
+					opts.OnFailure(r, user)
+				}
+				basicAuthFailed(w, opts.Realm)
+				return
+			}
+			if opts.OnSuccess != nil {
+				opts.OnSuccess(r, user)
+			}
+
 			// 校验通过，正常执行后面的逻辑
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), BasicAuthUserCtxKey, user)))
 		})
 	}
 }
 
+// BasicAuthUser 返回通过基本认证的用户名，没有通过认证时返回空字符串
+func BasicAuthUser(ctx context.Context) string {
+	user, _ := ctx.Value(BasicAuthUserCtxKey).(string)
+	return user
+}
+
 // 基本校验失败
 func basicAuthFailed(w http.ResponseWriter, realm string) {
 	w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s"`, realm))
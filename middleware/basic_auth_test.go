@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBasicAuth(t *testing.T) {
+	h := BasicAuth("admin", map[string]string{"alice": "secret"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(BasicAuthUser(r.Context())))
+	}))
+
+	tests := []struct {
+		user, pass string
+		code       int
+	}{
+		{"alice", "secret", 200},
+		{"alice", "wrong", 401},
+		{"bob", "secret", 401},
+		{"", "", 401},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.user != "" {
+			r.SetBasicAuth(tt.user, tt.pass)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%s: expecting %d but got %d", tt.user, tt.code, w.Code)
+		}
+		if tt.code == 200 && w.Body.String() != tt.user {
+			t.Errorf("expecting user %q but got %q", tt.user, w.Body.String())
+		}
+		if tt.code == 401 && w.Header().Get("WWW-Authenticate") != `Basic realm="admin"` {
+			t.Errorf("unexpected challenge %q", w.Header().Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestBasicAuthWithOpts(t *testing.T) {
+	failures := make(map[string]int)
+	h := BasicAuthWithOpts(BasicAuthOpts{
+		Realm: "admin",
+		Verifier: VerifierFunc(func(ctx context.Context, user, password string) (bool, error) {
+			if user == "broken" {
+				return false, errors.New("backend unavailable")
+			}
+			return Credentials{"alice": "secret"}.Verify(ctx, user, password)
+		}),
+		Blocked:   func(r *http.Request, user string) bool { return failures[user] >= 2 },
+		OnFailure: func(r *http.Request, user string) { failures[user]++ },
+		OnSuccess: func(r *http.Request, user string) { delete(failures, user) },
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	do := func(user, pass string) int {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.SetBasicAuth(user, pass)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := do("alice", "wrong"); code != 401 {
+		t.Fatalf("expecting 401 but got %d", code)
+	}
+	if code := do("alice", "secret"); code != 200 || failures["alice"] != 0 {
+		t.Fatalf("expecting 200 and failures reset but got %d %d", code, failures["alice"])
+	}
+	do("alice", "wrong")
+	do("alice", "wrong")
+	if code := do("alice", "secret"); code != 429 {
+		t.Fatalf("expecting 429 after repeated failures but got %d", code)
+	}
+	if code := do("broken", "secret"); code != 500 || failures["broken"] != 0 {
+		t.Fatalf("expecting 500 without counting a failure but got %d", code)
+	}
+}
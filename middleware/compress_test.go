@@ -4,13 +4,13 @@ import (
 	"compress/flate"
 	"compress/gzip"
 	"fmt"
+	"github.com/zhangdapeng520/zdpgo_api/api"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
-	"zdpgo_api/api"
 )
 
 func TestCompressor(t *testing.T) {
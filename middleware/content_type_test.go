@@ -2,10 +2,10 @@ package middleware
 
 import (
 	"bytes"
+	"github.com/zhangdapeng520/zdpgo_api/api"
 	"net/http"
 	"net/http/httptest"
 	"testing"
-	"zdpgo_api/api"
 )
 
 func TestContentType(t *testing.T) {
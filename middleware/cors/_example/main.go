@@ -1,10 +1,10 @@
 package main
 
 import (
+	"github.com/zhangdapeng520/zdpgo_api/api"
+	"github.com/zhangdapeng520/zdpgo_api/middleware"
+	"github.com/zhangdapeng520/zdpgo_api/middleware/cors"
 	"net/http"
-	"zdpgo_api/api"
-	"zdpgo_api/middleware"
-	"zdpgo_api/middleware/cors"
 )
 
 func main() {
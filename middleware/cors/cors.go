@@ -76,11 +76,8 @@ type Logger interface {
 type Cors struct {
 	Log Logger
 
-	// Normalized list of plain allowed origins
-	allowedOrigins []string
-
-	// List of allowed origins containing wildcards
-	allowedWOrigins []wildcard
+	// Matcher of allowed origins
+	allowedOrigins *OriginMatcher
 
 	// Optional origin validator function
 	allowOriginFunc func(r *http.Request, origin string) bool
@@ -129,25 +126,8 @@ func New(options Options) *Cors {
 			c.allowedOriginsAll = true
 		}
 	} else {
-		c.allowedOrigins = []string{}
-		c.allowedWOrigins = []wildcard{}
-		for _, origin := range options.AllowedOrigins {
-			// Normalize
-			origin = strings.ToLower(origin)
-			if origin == "*" {
-				// If "*" is present in the list, turn the whole list into a match all
-				c.allowedOriginsAll = true
-				c.allowedOrigins = nil
-				c.allowedWOrigins = nil
-				break
-			} else if i := strings.IndexByte(origin, '*'); i >= 0 {
-				// Split the origin in two: start and end string without the *
-				w := wildcard{origin[0:i], origin[i+1:]}
-				c.allowedWOrigins = append(c.allowedWOrigins, w)
-			} else {
-				c.allowedOrigins = append(c.allowedOrigins, origin)
-			}
-		}
+		c.allowedOrigins = NewOriginMatcher(options.AllowedOrigins)
+		c.allowedOriginsAll = c.allowedOrigins.All()
 	}
 
 	// Allowed Headers
@@ -338,18 +318,7 @@ func (c *Cors) isOriginAllowed(r *http.Request, origin string) bool {
 	if c.allowedOriginsAll {
 		return true
 	}
-	origin = strings.ToLower(origin)
-	for _, o := range c.allowedOrigins {
-		if o == origin {
-			return true
-		}
-	}
-	for _, w := range c.allowedWOrigins {
-		if w.match(origin) {
-			return true
-		}
-	}
-	return false
+	return c.allowedOrigins.Match(origin)
 }
 
 // isMethodAllowed checks if a given method can be used as part of a cross-domain request
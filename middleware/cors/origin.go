@@ -0,0 +1,52 @@
+package cors
+
+import "strings"
+
+// OriginMatcher 按照来源列表匹配请求的来源，规则与 Options.AllowedOrigins 相同：
+// 忽略大小写，"*" 匹配所有来源，每个来源中可以有一个通配符，例如 https://*.example.com。
+// CSRF 等需要校验来源的中间件可以复用它
+type OriginMatcher struct {
+	all      bool
+	origins  []string
+	wOrigins []wildcard
+}
+
+// NewOriginMatcher 根据来源列表创建 OriginMatcher，空列表不匹配任何来源
+func NewOriginMatcher(origins []string) *OriginMatcher {
+	m := &OriginMatcher{}
+	for _, origin := range origins {
+		origin = strings.ToLower(origin)
+		if origin == "*" {
+			return &OriginMatcher{all: true}
+		} else if i := strings.IndexByte(origin, '*'); i >= 0 {
+			m.wOrigins = append(m.wOrigins, wildcard{origin[0:i], origin[i+1:]})
+		} else {
+			m.origins = append(m.origins, origin)
+		}
+	}
+	return m
+}
+
+// All 判断是否匹配所有来源
+func (m *OriginMatcher) All() bool {
+	return m.all
+}
+
+// Match 判断来源是否匹配，例如 https://admin.example.com
+func (m *OriginMatcher) Match(origin string) bool {
+	if m.all {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	for _, o := range m.origins {
+		if o == origin {
+			return true
+		}
+	}
+	for _, w := range m.wOrigins {
+		if w.match(origin) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,316 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/zhangdapeng520/zdpgo_api/middleware/cors"
+)
+
+// CSRFCtxKey is the context.Context key to store the masked CSRF token
+// and the form field name.
+var CSRFCtxKey = &contextKey{"CSRF"}
+
+// csrfContext 保存在 context 中的令牌和表单字段名称
+type csrfContext struct {
+	token string
+	field string
+}
+
+// CSRF 校验失败的错误
+var (
+	ErrCSRFOrigin = errors.New("middleware: CSRF origin check failed")
+	ErrCSRFToken  = errors.New("middleware: CSRF token is missing or invalid")
+)
+
+// CSRFMode CSRF 令牌的保存方式
+type CSRFMode int
+
+const (
+	// CSRFDoubleSubmit 令牌保存在 Cookie 中，请求需要在请求头或者表单中再提交一次
+	CSRFDoubleSubmit CSRFMode = iota
+	// CSRFSynchronizer 令牌保存在服务端的会话中，需要在 CSRF 之前使用 Session 中间件
+	CSRFSynchronizer
+)
+
+// 默认的令牌名称
+const (
+	DefaultCSRFCookie = "csrf_token"
+	DefaultCSRFHeader = "X-CSRF-Token"
+	DefaultCSRFField  = "csrf_token"
+)
+
+// csrfTokenBytes 令牌的随机字节数
+const csrfTokenBytes = 32
+
+// CSRFOpts CSRF 中间件的配置
+type CSRFOpts struct {
+	// Mode 令牌的保存方式，默认 CSRFDoubleSubmit
+	Mode CSRFMode
+
+	// TrustedOrigins 除了同源之外允许的来源，规则与 cors 的 AllowedOrigins 相同，例如 https://*.example.com
+	TrustedOrigins []string
+
+	// Key 不为空时对 Cookie 中的令牌签名，防止子域名写入的 Cookie 绕过双重提交，只用于 CSRFDoubleSubmit
+	Key []byte
+
+	// CookieName、HeaderName 和 FieldName 分别是 Cookie、请求头和表单字段的名称
+	CookieName string
+	HeaderName string
+	FieldName  string
+
+	// Cookie 的属性，默认 Path 为 /，SameSite 为 Lax，并且设置 HttpOnly 和 Secure。
+	// 设置 DisableHttpOnly 后脚本可以从 Cookie 中读取令牌放到请求头中
+	Path            string
+	Domain          string
+	SameSite        http.SameSite
+	DisableSecure   bool
+	DisableHttpOnly bool
+
+	// ExemptPaths 不需要校验的路径，以 * 结尾时匹配前缀，例如 /webhooks/*
+	ExemptPaths []string
+
+	// ExemptFunc 返回 true 时不校验
+	ExemptFunc func(r *http.Request) bool
+
+	// ErrorHandler 校验失败时的处理，默认响应 403
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// CSRF 是一个防御跨站请求伪造的中间件。GET、HEAD、OPTIONS 和 TRACE 请求不校验，其他请求需要：
+//
+//  1. Origin 或者 Referer 与请求的 Host 同源，或者属于 TrustedOrigins
+//  2. 在请求头或者表单字段中提交令牌
+//
+// 令牌通过 CSRFToken 和 CSRFTemplateField 读取，每次请求都会使用不同的掩码，避免 BREACH 攻击：
+//
+//	r.Use(middleware.CSRF(middleware.CSRFOpts{TrustedOrigins: []string{"https://admin.example.com"}}))
+//	tmpl.Execute(w, map[string]interface{}{"csrf": middleware.CSRFTemplateField(r.Context())})
+func CSRF(opts CSRFOpts) func(http.Handler) http.Handler {
+	if opts.CookieName == "" {
+		opts.CookieName = DefaultCSRFCookie
+	}
+	if opts.HeaderName == "" {
+		opts.HeaderName = DefaultCSRFHeader
+	}
+	if opts.FieldName == "" {
+		opts.FieldName = DefaultCSRFField
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	if opts.SameSite == 0 {
+		opts.SameSite = http.SameSiteLaxMode
+	}
+	if opts.ErrorHandler == nil {
+		opts.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, http.StatusText(http.StatusForbidden)+" - "+err.Error(), http.StatusForbidden)
+		}
+	}
+	trusted := cors.NewOriginMatcher(opts.TrustedOrigins)
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			token := csrfLoadToken(w, r, opts)
+			r = r.WithContext(context.WithValue(r.Context(), CSRFCtxKey, csrfContext{maskCSRFToken(token), opts.FieldName}))
+
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+				next.ServeHTTP(w, r)
+				return
+			}
+			if csrfExempt(r, opts) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !csrfOriginAllowed(r, trusted) {
+				opts.ErrorHandler(w, r, ErrCSRFOrigin)
+				return
+			}
+			sent := r.Header.Get(opts.HeaderName)
+			if sent == "" {
+				sent = r.PostFormValue(opts.FieldName)
+			}
+			sentToken := unmaskCSRFToken(sent)
+			if sentToken == nil && opts.Mode == CSRFDoubleSubmit {
+				// 设置 DisableHttpOnly 时脚本可以直接提交 Cookie 中没有掩码的令牌
+				sentToken, _ = csrfVerifyCookie(sent, opts.Key)
+			}
+			if !csrfTokenEqual(sentToken, token) {
+				opts.ErrorHandler(w, r, ErrCSRFToken)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// CSRFToken 返回加了掩码的令牌，用于请求头或者表单字段，没有使用 CSRF 中间件时返回空字符串
+func CSRFToken(ctx context.Context) string {
+	c, _ := ctx.Value(CSRFCtxKey).(csrfContext)
+	return c.token
+}
+
+// CSRFTemplateField 返回包含令牌的隐藏表单字段，用于 html/template，字段名称为 CSRFOpts.FieldName，
+// 没有使用 CSRF 中间件时返回空字符串
+func CSRFTemplateField(ctx context.Context) template.HTML {
+	c, ok := ctx.Value(CSRFCtxKey).(csrfContext)
+	if !ok {
+		return ""
+	}
+	return template.HTML(`<input type="hidden" name="` + template.HTMLEscapeString(c.field) + `" value="` + template.HTMLEscapeString(c.token) + `">`)
+}
+
+// csrfLoadToken 读取令牌，不存在时生成新的令牌并保存到 Cookie 或者会话中
+func csrfLoadToken(w http.ResponseWriter, r *http.Request, opts CSRFOpts) []byte {
+	if opts.Mode == CSRFSynchronizer {
+		s := GetSession(r.Context())
+		if s == nil {
+			panic("middleware: CSRF synchronizer mode requires the Session middleware")
+		}
+		var encoded string
+		if s.Get(opts.FieldName, &encoded) == nil {
+			if token, err := base64.RawURLEncoding.DecodeString(encoded); err == nil && len(token) == csrfTokenBytes {
+				return token
+			}
+		}
+		token := newCSRFToken()
+		s.Set(opts.FieldName, base64.RawURLEncoding.EncodeToString(token))
+		return token
+	}
+
+	if c, err := r.Cookie(opts.CookieName); err == nil {
+		if token, ok := csrfVerifyCookie(c.Value, opts.Key); ok {
+			return token
+		}
+	}
+	token := newCSRFToken()
+	http.SetCookie(w, &http.Cookie{
+		Name:     opts.CookieName,
+		Value:    csrfSignCookie(token, opts.Key),
+		Path:     opts.Path,
+		Domain:   opts.Domain,
+		SameSite: opts.SameSite,
+		Secure:   !opts.DisableSecure,
+		HttpOnly: !opts.DisableHttpOnly,
+	})
+	return token
+}
+
+// csrfSignCookie 返回 Cookie 的值，有密钥时追加签名
+func csrfSignCookie(token, key []byte) string {
+	value := base64.RawURLEncoding.EncodeToString(token)
+	if len(key) == 0 {
+		return value
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(token)
+	return value + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// csrfVerifyCookie 验证 Cookie 的值并返回令牌
+func csrfVerifyCookie(value string, key []byte) ([]byte, bool) {
+	encoded, sig, signed := strings.Cut(value, ".")
+	if signed != (len(key) > 0) {
+		return nil, false
+	}
+	token, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(token) != csrfTokenBytes {
+		return nil, false
+	}
+	if signed && !hmac.Equal([]byte(csrfSignCookie(token, key)), []byte(encoded+"."+sig)) {
+		return nil, false
+	}
+	return token, true
+}
+
+// newCSRFToken 生成随机的令牌
+func newCSRFToken() []byte {
+	token := make([]byte, csrfTokenBytes)
+	if _, err := rand.Read(token); err != nil {
+		panic("middleware: failed to generate CSRF token: " + err.Error())
+	}
+	return token
+}
+
+// maskCSRFToken 使用随机的掩码加密令牌，结果为 base64(掩码 + 令牌 XOR 掩码)
+func maskCSRFToken(token []byte) string {
+	otp := newCSRFToken()
+	masked := make([]byte, 2*csrfTokenBytes)
+	copy(masked, otp)
+	for i := range token {
+		masked[csrfTokenBytes+i] = token[i] ^ otp[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+// unmaskCSRFToken 还原加了掩码的令牌，格式不对时返回 nil
+func unmaskCSRFToken(s string) []byte {
+	masked, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(masked) != 2*csrfTokenBytes {
+		return nil
+	}
+	token := make([]byte, csrfTokenBytes)
+	for i := range token {
+		token[i] = masked[i] ^ masked[csrfTokenBytes+i]
+	}
+	return token
+}
+
+// csrfTokenEqual 使用常量时间比较令牌
+func csrfTokenEqual(a, b []byte) bool {
+	return len(a) == csrfTokenBytes && subtle.ConstantTimeCompare(a, b) == 1
+}
+
+// csrfExempt 判断请求是否不需要校验
+func csrfExempt(r *http.Request, opts CSRFOpts) bool {
+	for _, p := range opts.ExemptPaths {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(r.URL.Path, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+		} else if r.URL.Path == p {
+			return true
+		}
+	}
+	return opts.ExemptFunc != nil && opts.ExemptFunc(r)
+}
+
+// csrfOriginAllowed 校验 Origin，没有 Origin 时校验 Referer。HTTPS 请求两者都没有时拒绝，
+// HTTP 请求两者都没有时放行，因为部分浏览器和代理会去掉它们
+func csrfOriginAllowed(r *http.Request, trusted *cors.OriginMatcher) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		referer := r.Header.Get("Referer")
+		if referer == "" {
+			return r.TLS == nil
+		}
+		u, err := url.Parse(referer)
+		if err != nil || u.Host == "" {
+			return false
+		}
+		origin = u.Scheme + "://" + u.Host
+	}
+	if origin == "null" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) && (r.TLS == nil || u.Scheme == "https") {
+		return true
+	}
+	return trusted.Match(origin)
+}
@@ -0,0 +1,238 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/zhangdapeng520/zdpgo_api/api"
+)
+
+func csrfRouter(opts CSRFOpts, withSession bool) http.Handler {
+	r := api.NewRouter()
+	if withSession {
+		r.Use(Session(SessionOpts{DisableSecure: true}))
+	}
+	r.Use(CSRF(opts))
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(CSRFToken(r.Context())))
+	})
+	r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	r.Post("/webhooks/github", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	return r
+}
+
+// csrfFetch 发送 GET 请求，返回令牌和响应中的 Cookie
+func csrfFetch(t *testing.T, h http.Handler, cookies []*http.Cookie) (string, []*http.Cookie) {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != 200 || w.Body.Len() == 0 {
+		t.Fatalf("expecting a token but got %d %q", w.Code, w.Body.String())
+	}
+	if c := w.Result().Cookies(); len(c) > 0 {
+		cookies = c
+	}
+	return w.Body.String(), cookies
+}
+
+func csrfPost(h http.Handler, cookies []*http.Cookie, header map[string]string, form url.Values) *httptest.ResponseRecorder {
+	var r *http.Request
+	if form != nil {
+		r = httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		r = httptest.NewRequest("POST", "/", nil)
+	}
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestCSRFDoubleSubmit(t *testing.T) {
+	h := csrfRouter(CSRFOpts{TrustedOrigins: []string{"https://*.example.com"}}, false)
+
+	token, cookies := csrfFetch(t, h, nil)
+	if len(cookies) != 1 || cookies[0].Name != DefaultCSRFCookie || !cookies[0].HttpOnly || !cookies[0].Secure {
+		t.Fatalf("expecting a secure csrf cookie but got %v", cookies)
+	}
+
+	// 已有 Cookie 时不会重新设置，但每次请求的令牌掩码不同
+	again, next := csrfFetch(t, h, cookies)
+	if next[0].Value != cookies[0].Value {
+		t.Fatalf("expecting the cookie to be reused")
+	}
+	if again == token {
+		t.Fatalf("expecting a freshly masked token")
+	}
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		form   url.Values
+		code   int
+	}{
+		{"no token", nil, nil, 403},
+		{"bad token", map[string]string{DefaultCSRFHeader: "abc"}, nil, 403},
+		{"header", map[string]string{DefaultCSRFHeader: token}, nil, 200},
+		{"older mask", map[string]string{DefaultCSRFHeader: again}, nil, 200},
+		{"form", nil, url.Values{DefaultCSRFField: {token}}, 200},
+		{"raw cookie", map[string]string{DefaultCSRFHeader: cookies[0].Value}, nil, 200},
+		{"same origin", map[string]string{DefaultCSRFHeader: token, "Origin": "http://example.com"}, nil, 200},
+		{"trusted origin", map[string]string{DefaultCSRFHeader: token, "Origin": "https://admin.example.com"}, nil, 200},
+		{"cross origin", map[string]string{DefaultCSRFHeader: token, "Origin": "https://evil.com"}, nil, 403},
+		{"null origin", map[string]string{DefaultCSRFHeader: token, "Origin": "null"}, nil, 403},
+		{"cross referer", map[string]string{DefaultCSRFHeader: token, "Referer": "https://evil.com/form"}, nil, 403},
+		{"same referer", map[string]string{DefaultCSRFHeader: token, "Referer": "http://example.com/form"}, nil, 200},
+	}
+	for _, tt := range tests {
+		w := csrfPost(h, cookies, tt.header, tt.form)
+		if w.Code != tt.code {
+			t.Errorf("%s: expecting %d but got %d %q", tt.name, tt.code, w.Code, w.Body.String())
+		}
+	}
+
+	// 另一个 Cookie 对应的令牌无效
+	other, _ := csrfFetch(t, h, nil)
+	if w := csrfPost(h, cookies, map[string]string{DefaultCSRFHeader: other}, nil); w.Code != 403 {
+		t.Fatalf("expecting 403 but got %d", w.Code)
+	}
+}
+
+func TestCSRFSignedCookie(t *testing.T) {
+	h := csrfRouter(CSRFOpts{Key: []byte("0123456789abcdef0123456789abcdef")}, false)
+
+	token, cookies := csrfFetch(t, h, nil)
+	if !strings.Contains(cookies[0].Value, ".") {
+		t.Fatalf("expecting a signed cookie but got %q", cookies[0].Value)
+	}
+	if w := csrfPost(h, cookies, map[string]string{DefaultCSRFHeader: token}, nil); w.Code != 200 {
+		t.Fatalf("expecting 200 but got %d", w.Code)
+	}
+
+	// 攻击者写入的没有签名的 Cookie 会被替换，配套的令牌无效
+	forged := &http.Cookie{Name: DefaultCSRFCookie, Value: strings.Split(cookies[0].Value, ".")[0]}
+	if w := csrfPost(h, []*http.Cookie{forged}, map[string]string{DefaultCSRFHeader: token}, nil); w.Code != 403 {
+		t.Fatalf("expecting 403 for an unsigned cookie but got %d", w.Code)
+	}
+}
+
+func TestCSRFExempt(t *testing.T) {
+	h := csrfRouter(CSRFOpts{
+		ExemptPaths: []string{"/webhooks/*"},
+		ExemptFunc: func(r *http.Request) bool {
+			return r.Header.Get("Authorization") != ""
+		},
+	}, false)
+
+	r := httptest.NewRequest("POST", "/webhooks/github", nil)
+	r.Header.Set("Origin", "https://github.com")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != 200 {
+		t.Fatalf("expecting exempt path to pass but got %d", w.Code)
+	}
+
+	if w := csrfPost(h, nil, map[string]string{"Authorization": "Bearer abc"}, nil); w.Code != 200 {
+		t.Fatalf("expecting exempt func to pass but got %d", w.Code)
+	}
+	if w := csrfPost(h, nil, nil, nil); w.Code != 403 {
+		t.Fatalf("expecting 403 but got %d", w.Code)
+	}
+}
+
+func TestCSRFHTTPSOrigin(t *testing.T) {
+	h := csrfRouter(CSRFOpts{}, false)
+	token, cookies := csrfFetch(t, h, nil)
+
+	post := func(header map[string]string) int {
+		r := httptest.NewRequest("POST", "https://example.com/", nil)
+		r.AddCookie(cookies[0])
+		r.Header.Set(DefaultCSRFHeader, token)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	// HTTPS 请求必须有 Origin 或者 Referer，并且协议也要相同
+	if code := post(nil); code != 403 {
+		t.Fatalf("expecting 403 without origin but got %d", code)
+	}
+	if code := post(map[string]string{"Origin": "http://example.com"}); code != 403 {
+		t.Fatalf("expecting 403 for http origin but got %d", code)
+	}
+	if code := post(map[string]string{"Origin": "https://example.com"}); code != 200 {
+		t.Fatalf("expecting 200 but got %d", code)
+	}
+}
+
+func TestCSRFSynchronizer(t *testing.T) {
+	h := csrfRouter(CSRFOpts{Mode: CSRFSynchronizer}, true)
+
+	token, cookies := csrfFetch(t, h, nil)
+	for _, c := range cookies {
+		if c.Name == DefaultCSRFCookie {
+			t.Fatalf("expecting no csrf cookie in synchronizer mode")
+		}
+	}
+	if len(cookies) != 1 || cookies[0].Name != DefaultSessionCookie {
+		t.Fatalf("expecting a session cookie but got %v", cookies)
+	}
+
+	if w := csrfPost(h, cookies, map[string]string{DefaultCSRFHeader: token}, nil); w.Code != 200 {
+		t.Fatalf("expecting 200 but got %d", w.Code)
+	}
+	// 会话中的令牌不能通过原始值提交
+	if w := csrfPost(h, nil, map[string]string{DefaultCSRFHeader: token}, nil); w.Code != 403 {
+		t.Fatalf("expecting 403 without session but got %d", w.Code)
+	}
+}
+
+func TestCSRFSynchronizerWithoutSession(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expecting a panic without the Session middleware")
+		}
+	}()
+	h := CSRF(CSRFOpts{Mode: CSRFSynchronizer})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestCSRFTemplateField(t *testing.T) {
+	h := CSRF(CSRFOpts{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(CSRFTemplateField(r.Context())))
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if !strings.HasPrefix(w.Body.String(), `<input type="hidden" name="csrf_token" value="`) {
+		t.Fatalf("expecting a hidden input but got %q", w.Body.String())
+	}
+
+	// 使用配置的字段名称
+	h = CSRF(CSRFOpts{FieldName: "_csrf"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(CSRFTemplateField(r.Context())))
+	}))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if !strings.HasPrefix(w.Body.String(), `<input type="hidden" name="_csrf" value="`) {
+		t.Fatalf("expecting the configured field name but got %q", w.Body.String())
+	}
+}
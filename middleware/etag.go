@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_api/req"
+	"github.com/zhangdapeng520/zdpgo_api/util"
+)
+
+// DefaultETagMaxBytes ETag 中间件默认缓存的最大响应字节数
+const DefaultETagMaxBytes = 1 << 20
+
+// ETagOpts ETag 中间件的配置
+type ETagOpts struct {
+	// MaxBytes 缓存的最大响应字节数，超出时直接输出响应而不计算 ETag，默认 DefaultETagMaxBytes
+	MaxBytes int
+}
+
+// ETag 使用默认配置计算 GET 响应的弱 ETag
+func ETag(next http.Handler) http.Handler {
+	return ETagWithOpts(ETagOpts{})(next)
+}
+
+// ETagWithOpts 是一个缓存 GET 的 200 响应并使用 util.XXHash64 计算弱 ETag 的中间件，
+// 请求的 If-None-Match 或 If-Modified-Since 与响应匹配时只响应 304，没有变化的列表不需要重新传输。
+// 处理器已经设置了 ETag 时使用处理器的 ETag。
+//
+// HEAD 响应通常没有响应体，计算出的 ETag 与 GET 不一致，因此直接交给处理器。
+// 处理器调用 Flush 或者 Hijack 时（例如 SSE 和 WebSocket）不再缓存，之后的响应直接输出
+func ETagWithOpts(opts ETagOpts) func(http.Handler) http.Handler {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultETagMaxBytes
+	}
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ew := &etagWriter{ResponseWriter: w, max: opts.MaxBytes, digest: util.NewXXHash64()}
+			next.ServeHTTP(ew, r)
+			ew.finish(r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// etagWriter 缓存响应并计算 xxhash，响应超出限制或者状态码不是 200 时直接输出
+type etagWriter struct {
+	http.ResponseWriter
+	max         int
+	code        int
+	buf         bytes.Buffer
+	digest      *util.XXHash64Digest
+	passthrough bool
+}
+
+func (ew *etagWriter) WriteHeader(code int) {
+	if ew.code != 0 || ew.passthrough {
+		return
+	}
+	ew.code = code
+	if code != http.StatusOK {
+		ew.passthrough = true
+		ew.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (ew *etagWriter) Write(b []byte) (int, error) {
+	if ew.code == 0 {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if ew.passthrough {
+		return ew.ResponseWriter.Write(b)
+	}
+	if ew.buf.Len()+len(b) > ew.max {
+		if err := ew.startPassthrough(); err != nil {
+			return 0, err
+		}
+		return ew.ResponseWriter.Write(b)
+	}
+	ew.digest.Write(b)
+	return ew.buf.Write(b)
+}
+
+// startPassthrough 输出缓存的响应，之后的响应直接输出
+func (ew *etagWriter) startPassthrough() error {
+	if ew.passthrough {
+		return nil
+	}
+	ew.passthrough = true
+	if ew.code == 0 {
+		ew.code = http.StatusOK
+	}
+	ew.ResponseWriter.WriteHeader(ew.code)
+	_, err := ew.ResponseWriter.Write(ew.buf.Bytes())
+	ew.buf.Reset()
+	return err
+}
+
+func (ew *etagWriter) Flush() {
+	ew.startPassthrough()
+	if f, ok := ew.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (ew *etagWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := ew.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("api/middleware: http.Hijacker is unavailable on the writer")
+	}
+	ew.passthrough = true
+	return hj.Hijack()
+}
+
+// Unwrap 返回原始的 http.ResponseWriter，用于 http.ResponseController
+func (ew *etagWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+// finish 计算 ETag，判断条件请求后输出缓存的响应
+func (ew *etagWriter) finish(r *http.Request) {
+	if ew.passthrough {
+		return
+	}
+	if ew.code == 0 {
+		ew.code = http.StatusOK
+	}
+
+	h := ew.Header()
+	etag := h.Get("ETag")
+	if etag == "" {
+		etag = fmt.Sprintf(`W/"%016x"`, ew.digest.Sum64())
+		h.Set("ETag", etag)
+	}
+	lastModified, _ := time.Parse(http.TimeFormat, h.Get("Last-Modified"))
+
+	if req.CheckPreconditions(r, etag, lastModified) == req.PreconditionNotModified {
+		h.Del("Content-Type")
+		h.Del("Content-Length")
+		ew.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
+	}
+	ew.ResponseWriter.WriteHeader(ew.code)
+	ew.ResponseWriter.Write(ew.buf.Bytes())
+}
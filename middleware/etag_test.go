@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zhangdapeng520/zdpgo_api/api"
+)
+
+func TestETag(t *testing.T) {
+	r := api.NewRouter()
+	r.Use(ETagWithOpts(ETagOpts{MaxBytes: 16}))
+	r.Get("/list", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[1,2,3]`))
+	})
+	r.Get("/large", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", 10)))
+		w.Write([]byte(strings.Repeat("b", 10)))
+	})
+	r.Get("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/list", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != 200 || w.Body.String() != `[1,2,3]` || !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("expecting 200 with weak ETag but got %d %q %q", w.Code, w.Body.String(), etag)
+	}
+
+	rq := httptest.NewRequest("GET", "/list", nil)
+	rq.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, rq)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("Content-Type") != "" {
+		t.Fatalf("expecting 304 without body but got %d %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/large", nil))
+	if w.Body.String() != strings.Repeat("a", 10)+strings.Repeat("b", 10) || w.Header().Get("ETag") != "" {
+		t.Fatalf("expecting large response to pass through but got %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+	if w.Code != http.StatusNotFound || w.Header().Get("ETag") != "" {
+		t.Fatalf("expecting 404 without ETag but got %d", w.Code)
+	}
+}
+
+// hijackRecorder 支持 Hijack 的 httptest.ResponseRecorder
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (h *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	return nil, nil, nil
+}
+
+func TestETagStreaming(t *testing.T) {
+	h := ETag(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/events":
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("data: 1\n\n"))
+			if err := http.NewResponseController(w).Flush(); err != nil {
+				t.Errorf("expecting flush to succeed but got %v", err)
+			}
+			w.Write([]byte("data: 2\n\n"))
+		case "/ws":
+			if _, _, err := http.NewResponseController(w).Hijack(); err != nil {
+				t.Errorf("expecting hijack to succeed but got %v", err)
+			}
+		default:
+			w.Write([]byte("hello"))
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/events", nil))
+	if !w.Flushed || w.Body.String() != "data: 1\n\ndata: 2\n\n" || w.Header().Get("ETag") != "" {
+		t.Fatalf("expecting a flushed stream without ETag but got %v %q %q", w.Flushed, w.Body.String(), w.Header().Get("ETag"))
+	}
+
+	hw := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(hw, httptest.NewRequest("GET", "/ws", nil))
+	if !hw.hijacked || hw.Header().Get("ETag") != "" {
+		t.Fatalf("expecting the connection to be hijacked without ETag")
+	}
+
+	// HEAD 不计算 ETag
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("HEAD", "/", nil))
+	if w.Header().Get("ETag") != "" {
+		t.Fatalf("expecting no ETag for HEAD but got %q", w.Header().Get("ETag"))
+	}
+}
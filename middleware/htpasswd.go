@@ -0,0 +1,500 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnsupportedHash 不支持的密码哈希格式，例如 bcrypt 和传统的 DES crypt
+var ErrUnsupportedHash = errors.New("middleware: unsupported password hash")
+
+// MaxPasswordLength 校验的密码的最大长度，SHA crypt 的开销随密码长度增长，
+// 更长的密码不计算哈希直接校验失败
+const MaxPasswordLength = 1024
+
+// HtpasswdCheckInterval HtpasswdFile 检查文件是否变化的最小间隔
+var HtpasswdCheckInterval = time.Second
+
+// VerifyPasswordHash 校验 htpasswd 格式的密码哈希，支持以下格式：
+//
+//	{SHA}...          htpasswd -s，SHA1
+//	$apr1$salt$...    htpasswd -m，APR1-MD5
+//	$1$salt$...       MD5 crypt
+//	$5$salt$...       SHA-256 crypt，可以有 rounds=N$
+//	$6$salt$...       SHA-512 crypt，可以有 rounds=N$
+//
+// 长度超过 MaxPasswordLength 的密码返回 false
+func VerifyPasswordHash(hash, password string) (bool, error) {
+	if len(password) > MaxPasswordLength {
+		return false, nil
+	}
+	computed, err := computePasswordHash(hash, password)
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1, nil
+}
+
+// computePasswordHash 使用 hash 的格式、盐值和轮数计算 password 的哈希
+func computePasswordHash(hash, password string) (string, error) {
+	switch {
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		return "{SHA}" + base64.StdEncoding.EncodeToString(sum[:]), nil
+	case strings.HasPrefix(hash, "$apr1$"), strings.HasPrefix(hash, "$1$"):
+		magic, salt, err := parseMD5Crypt(hash)
+		if err != nil {
+			return "", err
+		}
+		return md5Crypt([]byte(password), []byte(salt), magic), nil
+	case strings.HasPrefix(hash, "$5$"):
+		c, err := parseSHACrypt(hash)
+		if err != nil {
+			return "", err
+		}
+		return c.compute(sha256.New, sha256CryptOrder, password), nil
+	case strings.HasPrefix(hash, "$6$"):
+		c, err := parseSHACrypt(hash)
+		if err != nil {
+			return "", err
+		}
+		return c.compute(sha512.New, sha512CryptOrder, password), nil
+	}
+	return "", unsupportedHash(hash)
+}
+
+// passwordHashCost 检查哈希的格式，返回计算哈希的大致开销，用于为不存在的用户选择校验的哈希
+func passwordHashCost(hash string) (int, error) {
+	switch {
+	case strings.HasPrefix(hash, "{SHA}"):
+		return 1, nil
+	case strings.HasPrefix(hash, "$apr1$"), strings.HasPrefix(hash, "$1$"):
+		// MD5 crypt 固定 1000 轮
+		_, _, err := parseMD5Crypt(hash)
+		return 1000, err
+	case strings.HasPrefix(hash, "$5$"), strings.HasPrefix(hash, "$6$"):
+		c, err := parseSHACrypt(hash)
+		if err != nil {
+			return 0, err
+		}
+		return c.rounds, nil
+	}
+	return 0, unsupportedHash(hash)
+}
+
+// unsupportedHash 返回带有哈希标识的 ErrUnsupportedHash，不包含哈希本身
+func unsupportedHash(hash string) error {
+	if rest, ok := strings.CutPrefix(hash, "$"); ok {
+		if id, _, ok := strings.Cut(rest, "$"); ok {
+			return fmt.Errorf("%w: $%s$", ErrUnsupportedHash, id)
+		}
+	}
+	return ErrUnsupportedHash
+}
+
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// cryptGroup crypt 编码时的一组字节，-1 表示 0，n 是输出的字符数
+type cryptGroup struct {
+	b2, b1, b0, n int
+}
+
+var (
+	md5CryptOrder = []cryptGroup{
+		{0, 6, 12, 4}, {1, 7, 13, 4}, {2, 8, 14, 4}, {3, 9, 15, 4}, {4, 10, 5, 4}, {-1, -1, 11, 2},
+	}
+	sha256CryptOrder = []cryptGroup{
+		{0, 10, 20, 4}, {21, 1, 11, 4}, {12, 22, 2, 4}, {3, 13, 23, 4}, {24, 4, 14, 4},
+		{15, 25, 5, 4}, {6, 16, 26, 4}, {27, 7, 17, 4}, {18, 28, 8, 4}, {9, 19, 29, 4},
+		{-1, 31, 30, 3},
+	}
+	sha512CryptOrder = []cryptGroup{
+		{0, 21, 42, 4}, {22, 43, 1, 4}, {44, 2, 23, 4}, {3, 24, 45, 4}, {25, 46, 4, 4},
+		{47, 5, 26, 4}, {6, 27, 48, 4}, {28, 49, 7, 4}, {50, 8, 29, 4}, {9, 30, 51, 4},
+		{31, 52, 10, 4}, {53, 11, 32, 4}, {12, 33, 54, 4}, {34, 55, 13, 4}, {56, 14, 35, 4},
+		{15, 36, 57, 4}, {37, 58, 16, 4}, {59, 17, 38, 4}, {18, 39, 60, 4}, {40, 61, 19, 4},
+		{62, 20, 41, 4}, {-1, -1, 63, 2},
+	}
+)
+
+// cryptEncode 使用 crypt 的 base64 字母表按照 order 编码 sum
+func cryptEncode(sum []byte, order []cryptGroup) string {
+	at := func(i int) uint {
+		if i < 0 {
+			return 0
+		}
+		return uint(sum[i])
+	}
+	var b strings.Builder
+	for _, g := range order {
+		v := at(g.b2)<<16 | at(g.b1)<<8 | at(g.b0)
+		for i := 0; i < g.n; i++ {
+			b.WriteByte(cryptAlphabet[v&0x3f])
+			v >>= 6
+		}
+	}
+	return b.String()
+}
+
+// parseMD5Crypt 解析 $apr1$ 或者 $1$ 哈希的标识和盐值
+func parseMD5Crypt(hash string) (string, string, error) {
+	magic := "$1$"
+	if strings.HasPrefix(hash, "$apr1$") {
+		magic = "$apr1$"
+	}
+	salt, _, ok := strings.Cut(hash[len(magic):], "$")
+	if !ok {
+		return "", "", fmt.Errorf("middleware: malformed %s hash", magic)
+	}
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	return magic, salt, nil
+}
+
+// md5Crypt 实现 MD5 crypt，magic 为 $1$ 或者 $apr1$
+func md5Crypt(password, salt []byte, magic string) string {
+	d := md5.New()
+	d.Write(password)
+	d.Write(salt)
+	d.Write(password)
+	alt := d.Sum(nil)
+
+	d = md5.New()
+	d.Write(password)
+	d.Write([]byte(magic))
+	d.Write(salt)
+	for i := len(password); i > 0; i -= md5.Size {
+		d.Write(alt[:min(i, md5.Size)])
+	}
+	for i := len(password); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			d.Write([]byte{0})
+		} else {
+			d.Write(password[:1])
+		}
+	}
+	sum := d.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		d = md5.New()
+		if i&1 != 0 {
+			d.Write(password)
+		} else {
+			d.Write(sum)
+		}
+		if i%3 != 0 {
+			d.Write(salt)
+		}
+		if i%7 != 0 {
+			d.Write(password)
+		}
+		if i&1 != 0 {
+			d.Write(sum)
+		} else {
+			d.Write(password)
+		}
+		sum = d.Sum(nil)
+	}
+	return magic + string(salt) + "$" + cryptEncode(sum, md5CryptOrder)
+}
+
+// shaCrypt SHA-256 和 SHA-512 crypt 的参数
+type shaCrypt struct {
+	magic  string
+	salt   string
+	rounds int
+	// custom 哈希中是否指定了轮数
+	custom bool
+}
+
+// parseSHACrypt 解析 $5$ 或者 $6$ 哈希的参数
+func parseSHACrypt(hash string) (*shaCrypt, error) {
+	c := &shaCrypt{magic: hash[:3], rounds: 5000}
+	rest := hash[3:]
+	if s, ok := strings.CutPrefix(rest, "rounds="); ok {
+		n, after, ok := strings.Cut(s, "$")
+		rounds, err := strconv.Atoi(n)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("middleware: malformed %s hash rounds", c.magic)
+		}
+		c.rounds = min(max(rounds, 1000), 999999999)
+		c.custom = true
+		rest = after
+	}
+	salt, _, ok := strings.Cut(rest, "$")
+	if !ok {
+		return nil, fmt.Errorf("middleware: malformed %s hash", c.magic)
+	}
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+	c.salt = salt
+	return c, nil
+}
+
+// compute 计算 password 的哈希
+func (c *shaCrypt) compute(newHash func() hash.Hash, order []cryptGroup, password string) string {
+	p, s := []byte(password), []byte(c.salt)
+
+	d := newHash()
+	d.Write(p)
+	d.Write(s)
+	d.Write(p)
+	b := d.Sum(nil)
+	size := len(b)
+
+	d = newHash()
+	d.Write(p)
+	d.Write(s)
+	for i := len(p); i > 0; i -= size {
+		d.Write(b[:min(i, size)])
+	}
+	for i := len(p); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			d.Write(b)
+		} else {
+			d.Write(p)
+		}
+	}
+	a := d.Sum(nil)
+
+	// 摘要 DP 的输入是 len(p) 个 p，按规范开销是密码长度的平方，由 MaxPasswordLength 限制
+	d = newHash()
+	for i := 0; i < len(p); i++ {
+		d.Write(p)
+	}
+	pSeq := repeatBytes(d.Sum(nil), len(p))
+
+	d = newHash()
+	for i := 0; i < 16+int(a[0]); i++ {
+		d.Write(s)
+	}
+	sSeq := repeatBytes(d.Sum(nil), len(s))
+
+	sum := a
+	for i := 0; i < c.rounds; i++ {
+		d = newHash()
+		if i&1 != 0 {
+			d.Write(pSeq)
+		} else {
+			d.Write(sum)
+		}
+		if i%3 != 0 {
+			d.Write(sSeq)
+		}
+		if i%7 != 0 {
+			d.Write(pSeq)
+		}
+		if i&1 != 0 {
+			d.Write(sum)
+		} else {
+			d.Write(pSeq)
+		}
+		sum = d.Sum(nil)
+	}
+
+	prefix := c.magic
+	if c.custom {
+		prefix += "rounds=" + strconv.Itoa(c.rounds) + "$"
+	}
+	return prefix + c.salt + "$" + cryptEncode(sum, order)
+}
+
+// repeatBytes 重复 b 直到长度为 n
+func repeatBytes(b []byte, n int) []byte {
+	out := make([]byte, n)
+	for i := 0; i < n; i += len(b) {
+		copy(out[i:], b)
+	}
+	return out
+}
+
+// verifyHash 校验密码哈希，测试时替换以记录计算过的哈希
+var verifyHash = VerifyPasswordHash
+
+// hashedUsers 用户名到密码哈希的映射
+type hashedUsers struct {
+	hashes map[string]string
+	costs  map[string]int
+	// dummy 开销最大的哈希，用户不存在或者用户的哈希开销更小时同样用它校验，
+	// 使所有用户名的响应时间都与开销最大的哈希相近，无法通过响应时间枚举用户名
+	dummy     string
+	dummyCost int
+}
+
+func newHashedUsers(hashes map[string]string) (*hashedUsers, error) {
+	u := &hashedUsers{hashes: hashes, costs: make(map[string]int, len(hashes))}
+	for user, h := range hashes {
+		cost, err := passwordHashCost(h)
+		if err != nil {
+			return nil, fmt.Errorf("user %q: %w", user, err)
+		}
+		u.costs[user] = cost
+		if cost > u.dummyCost || (cost == u.dummyCost && h < u.dummy) {
+			u.dummyCost, u.dummy = cost, h
+		}
+	}
+	return u, nil
+}
+
+func (u *hashedUsers) verify(user, password string) bool {
+	if len(password) > MaxPasswordLength {
+		return false
+	}
+	h, ok := u.hashes[user]
+	if !ok || u.costs[user] < u.dummyCost {
+		// 结果被丢弃，只是为了与开销最大的哈希做同样的计算
+		if u.dummy != "" {
+			verifyHash(u.dummy, password)
+		}
+	}
+	if !ok {
+		return false
+	}
+	valid, _ := verifyHash(h, password)
+	return valid
+}
+
+// HashedCredentials 哈希后的密码，哈希的格式参考 VerifyPasswordHash
+type HashedCredentials struct {
+	users *hashedUsers
+}
+
+// NewHashedCredentials 创建哈希密码的 Verifier，键是用户名，值是密码哈希，
+// 有不支持的哈希格式时返回错误
+func NewHashedCredentials(hashes map[string]string) (*HashedCredentials, error) {
+	copied := make(map[string]string, len(hashes))
+	for user, h := range hashes {
+		copied[user] = h
+	}
+	users, err := newHashedUsers(copied)
+	if err != nil {
+		return nil, fmt.Errorf("middleware: %w", err)
+	}
+	return &HashedCredentials{users: users}, nil
+}
+
+// Verify 校验用户名和密码
+func (c *HashedCredentials) Verify(_ context.Context, user, password string) (bool, error) {
+	return c.users.verify(user, password), nil
+}
+
+// HtpasswdFile 从 htpasswd 文件读取的密码，每行为 user:hash，# 开头的行是注释，
+// 哈希的格式参考 VerifyPasswordHash，不支持 bcrypt。
+// 校验时最多每 HtpasswdCheckInterval 检查一次文件，文件变化后自动重新加载，
+// 重新加载失败时继续使用之前的内容
+type HtpasswdFile struct {
+	path string
+
+	mu      sync.Mutex
+	users   *hashedUsers
+	modTime time.Time
+	size    int64
+	checked time.Time
+	nowFunc func() time.Time
+}
+
+// NewHtpasswdFile 加载 htpasswd 文件
+func NewHtpasswdFile(path string) (*HtpasswdFile, error) {
+	f := &HtpasswdFile{path: path, nowFunc: time.Now}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Reload 重新加载文件
+func (f *HtpasswdFile) Reload() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reload()
+}
+
+func (f *HtpasswdFile) reload() error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	hashes, err := parseHtpasswd(file)
+	if err != nil {
+		return fmt.Errorf("middleware: %s: %w", f.path, err)
+	}
+	users, err := newHashedUsers(hashes)
+	if err != nil {
+		return fmt.Errorf("middleware: %s: %w", f.path, err)
+	}
+	f.users = users
+	f.modTime, f.size = info.ModTime(), info.Size()
+	f.checked = f.nowFunc()
+	return nil
+}
+
+// current 返回当前的用户，文件变化后先重新加载
+func (f *HtpasswdFile) current() *hashedUsers {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.nowFunc()
+	if now.Sub(f.checked) < HtpasswdCheckInterval {
+		return f.users
+	}
+	f.checked = now
+	info, err := os.Stat(f.path)
+	if err != nil {
+		log.Printf("检查 htpasswd 文件失败：%v", err)
+		return f.users
+	}
+	if !info.ModTime().Equal(f.modTime) || info.Size() != f.size {
+		if err := f.reload(); err != nil {
+			log.Printf("重新加载 htpasswd 文件失败：%v", err)
+		}
+	}
+	return f.users
+}
+
+// Verify 校验用户名和密码
+func (f *HtpasswdFile) Verify(_ context.Context, user, password string) (bool, error) {
+	return f.current().verify(user, password), nil
+}
+
+// parseHtpasswd 解析 htpasswd 文件
+func parseHtpasswd(r io.Reader) (map[string]string, error) {
+	hashes := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, h, ok := strings.Cut(line, ":")
+		if !ok || user == "" || h == "" {
+			return nil, fmt.Errorf("line %d: expecting user:hash", n)
+		}
+		hashes[user] = h
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyPasswordHash(t *testing.T) {
+	// 使用 openssl passwd 生成
+	tests := []struct {
+		hash, password string
+	}{
+		{"{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=", "secret"},
+		{"$apr1$qHDFfhPC$nITSVHgYbDAK1Y0acGRnY0", "myPassword"},
+		{"$1$saltsalt$9xy1btjgzLYfb7hivXtC//", "secret"},
+		{"$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5", "Hello world!"},
+		{"$5$rounds=5000$toolongsaltstrin$Un/5jzAHMgOGZ5.mWJpuVolil07guHPvOW8mGRcvxa5", "This is just a test"},
+		{"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1", "Hello world!"},
+		{"$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.", "Hello world!"},
+	}
+	for _, tt := range tests {
+		if ok, err := VerifyPasswordHash(tt.hash, tt.password); !ok || err != nil {
+			t.Errorf("%s: expecting the password to match but got %v %v", tt.hash, ok, err)
+		}
+		if ok, _ := VerifyPasswordHash(tt.hash, tt.password+"x"); ok {
+			t.Errorf("%s: expecting a wrong password to fail", tt.hash)
+		}
+	}
+
+	for _, bad := range []string{"$2y$10$abcdefghijklmnopqrstuu", "plaintext", "$apr1$nosalt", "$6$rounds=x$salt$hash"} {
+		if _, err := VerifyPasswordHash(bad, "secret"); err == nil {
+			t.Errorf("%s: expecting an error", bad)
+		}
+	}
+	if _, err := VerifyPasswordHash("$2y$10$abcdefghijklmnopqrstuu", "secret"); !errors.Is(err, ErrUnsupportedHash) {
+		t.Fatalf("expecting ErrUnsupportedHash but got %v", err)
+	}
+}
+
+func TestHashedCredentials(t *testing.T) {
+	creds, err := NewHashedCredentials(map[string]string{
+		"alice": "{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=",
+		"bob":   "$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.",
+		"carol": "$apr1$qHDFfhPC$nITSVHgYbDAK1Y0acGRnY0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 不存在的用户使用开销最大的哈希校验
+	if creds.users.dummy[:3] != "$6$" {
+		t.Fatalf("expecting the SHA-512 hash as dummy but got %q", creds.users.dummy)
+	}
+	ctx := context.Background()
+	if ok, _ := creds.Verify(ctx, "alice", "secret"); !ok {
+		t.Fatalf("expecting alice to be verified")
+	}
+	if ok, _ := creds.Verify(ctx, "mallory", "Hello world!"); ok {
+		t.Fatalf("expecting an unknown user to fail even with the dummy password")
+	}
+
+	if _, err := NewHashedCredentials(map[string]string{"dave": "$2y$10$abcdefghijklmnopqrstuu"}); err == nil {
+		t.Fatalf("expecting an error for bcrypt")
+	}
+}
+
+func TestHashedUsersSameWork(t *testing.T) {
+	users, err := newHashedUsers(map[string]string{
+		"alice": "{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=",
+		"bob":   "$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v.",
+		"carol": "$apr1$qHDFfhPC$nITSVHgYbDAK1Y0acGRnY0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var verified []string
+	verifyHash = func(hash, password string) (bool, error) {
+		verified = append(verified, hash)
+		return VerifyPasswordHash(hash, password)
+	}
+	defer func() { verifyHash = VerifyPasswordHash }()
+
+	// 存在与不存在的用户都要计算一次开销最大的哈希
+	for _, user := range []string{"alice", "bob", "carol", "mallory"} {
+		verified = nil
+		users.verify(user, "secret")
+		n := 0
+		for _, h := range verified {
+			if cost, _ := passwordHashCost(h); cost == users.dummyCost {
+				n++
+			}
+		}
+		if n != 1 {
+			t.Errorf("%s: expecting exactly one hash with the highest cost but got %q", user, verified)
+		}
+	}
+}
+
+func TestLongPassword(t *testing.T) {
+	for _, n := range []int{MaxPasswordLength, MaxPasswordLength + 1} {
+		password := strings.Repeat("a", n)
+		hash, err := computePasswordHash("$6$saltstring$", password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 超过长度限制的密码即使正确也不会计算哈希
+		if ok, _ := VerifyPasswordHash(hash, password); ok != (n <= MaxPasswordLength) {
+			t.Fatalf("%d bytes: expecting %v but got %v", n, n <= MaxPasswordLength, ok)
+		}
+		creds, err := NewHashedCredentials(map[string]string{"alice": hash})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, _ := creds.Verify(context.Background(), "alice", password); ok != (n <= MaxPasswordLength) {
+			t.Fatalf("%d bytes: expecting credentials to return %v but got %v", n, n <= MaxPasswordLength, ok)
+		}
+	}
+}
+
+func TestHtpasswdFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".htpasswd")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("# users\nalice:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n\ncarol:$apr1$qHDFfhPC$nITSVHgYbDAK1Y0acGRnY0\n")
+
+	f, err := NewHtpasswdFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	f.nowFunc = func() time.Time { return now }
+
+	ctx := context.Background()
+	if ok, _ := f.Verify(ctx, "carol", "myPassword"); !ok {
+		t.Fatalf("expecting carol to be verified")
+	}
+
+	write("alice:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\n")
+	// 检查间隔内不会重新加载
+	if ok, _ := f.Verify(ctx, "carol", "myPassword"); !ok {
+		t.Fatalf("expecting carol to be verified before the check interval")
+	}
+	now = now.Add(HtpasswdCheckInterval)
+	if ok, _ := f.Verify(ctx, "carol", "myPassword"); ok {
+		t.Fatalf("expecting carol to be removed after reloading")
+	}
+
+	// 重新加载失败时继续使用之前的内容
+	write("alice:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=\nbroken\n")
+	now = now.Add(HtpasswdCheckInterval)
+	if ok, _ := f.Verify(ctx, "alice", "secret"); !ok {
+		t.Fatalf("expecting the previous content to be kept")
+	}
+
+	if _, err := NewHtpasswdFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatalf("expecting an error for a missing file")
+	}
+}
@@ -0,0 +1,131 @@
+package jwt
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_api/resp"
+)
+
+// contextKey 保存声明的上下文键
+type contextKey struct{}
+
+// ClaimsCtxKey 请求上下文中保存声明的键
+var ClaimsCtxKey = contextKey{}
+
+// Options Bearer 认证中间件的配置
+type Options struct {
+	// Keys 验证令牌的密钥集合，例如 StaticKeys 或者 JWKS
+	Keys KeySet
+
+	// Issuer、Audience、ClockSkew 和 AllowMissingExp 参考 ParseOpts
+	Issuer          string
+	Audience        string
+	ClockSkew       time.Duration
+	AllowMissingExp bool
+
+	// Cookie 不为空时，没有 Authorization 请求头的请求从这个 Cookie 中读取令牌
+	Cookie string
+
+	// Optional 为 true 时没有令牌的请求也会被放行，上下文中没有声明
+	Optional bool
+
+	// ErrorHandler 验证失败时的处理，默认通过 resp.Unauthorized 响应 401
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// Handler 创建 Bearer 认证中间件，验证通过后声明保存在请求上下文中，通过 FromContext 读取
+func Handler(options Options) func(next http.Handler) http.Handler {
+	if options.ErrorHandler == nil {
+		options.ErrorHandler = defaultErrorHandler
+	}
+	parseOpts := ParseOpts{
+		Issuer:          options.Issuer,
+		Audience:        options.Audience,
+		ClockSkew:       options.ClockSkew,
+		AllowMissingExp: options.AllowMissingExp,
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := tokenFromRequest(r, options.Cookie)
+			if token == "" {
+				if options.Optional {
+					next.ServeHTTP(w, r)
+					return
+				}
+				options.ErrorHandler(w, r, ErrTokenMissing)
+				return
+			}
+
+			keys, err := options.Keys.Keys(r.Context(), kidOf(token))
+			if err != nil {
+				options.ErrorHandler(w, r, err)
+				return
+			}
+			claims, err := Parse(token, keys, parseOpts)
+			if err != nil {
+				options.ErrorHandler(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ClaimsCtxKey, claims)))
+		})
+	}
+}
+
+// FromContext 返回请求上下文中的声明，没有通过认证时返回 nil
+func FromContext(ctx context.Context) Claims {
+	claims, _ := ctx.Value(ClaimsCtxKey).(Claims)
+	return claims
+}
+
+// tokenFromRequest 从 Authorization 请求头或者 Cookie 中读取令牌
+func tokenFromRequest(r *http.Request, cookie string) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+			return strings.TrimSpace(auth[7:])
+		}
+		return ""
+	}
+	if cookie != "" {
+		if c, err := r.Cookie(cookie); err == nil {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// kidOf 读取令牌头部的 kid，用于选择密钥，格式错误时返回空字符串，由 Parse 报告错误
+func kidOf(token string) string {
+	i := strings.IndexByte(token, '.')
+	if i < 0 {
+		return ""
+	}
+	b, err := base64.RawURLEncoding.DecodeString(token[:i])
+	if err != nil {
+		return ""
+	}
+	var h header
+	json.Unmarshal(b, &h)
+	return h.KID
+}
+
+// defaultErrorHandler 通过 resp 的错误格式响应 401
+func defaultErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	msg := "访问令牌无效"
+	challenge := `Bearer error="invalid_token"`
+	switch {
+	case errors.Is(err, ErrTokenMissing):
+		msg = "缺少访问令牌"
+		challenge = "Bearer"
+	case errors.Is(err, ErrTokenExpired):
+		msg = "访问令牌已过期"
+		challenge = `Bearer error="invalid_token", error_description="token expired"`
+	}
+	resp.Unauthorized(w, challenge, msg)
+}
@@ -0,0 +1,254 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// KeySet 验证令牌时使用的密钥集合，kid 是令牌头部的密钥 ID，可能为空
+type KeySet interface {
+	Keys(ctx context.Context, kid string) ([]Key, error)
+}
+
+// StaticKeys 固定的密钥集合
+type StaticKeys []Key
+
+// Keys 返回所有的密钥
+func (s StaticKeys) Keys(ctx context.Context, kid string) ([]Key, error) {
+	return s, nil
+}
+
+// DefaultJWKSRefresh JWKS 默认的刷新间隔
+const DefaultJWKSRefresh = 10 * time.Minute
+
+// minJWKSRefresh 遇到未知的 kid 时两次重新加载的最小间隔，避免伪造的 kid 导致频繁加载
+const minJWKSRefresh = 30 * time.Second
+
+// jwksLoadTimeout 加载 JWKS 的超时时间，加载不使用请求的 ctx，请求取消不会中断共享的加载
+const jwksLoadTimeout = 10 * time.Second
+
+// JWKS 从文件或者 URL 加载的 JWKS 文档（RFC 7517），加载结果会被缓存，
+// 超过刷新间隔或者遇到未知的 kid 时在后台重新加载，加载失败时继续使用之前的密钥。
+// 并发的请求共享同一次加载，缓存过期时直接返回缓存的密钥，遇到未知的 kid 时等待加载完成
+type JWKS struct {
+	load    func(ctx context.Context) ([]byte, error)
+	refresh time.Duration
+
+	mu      sync.Mutex
+	keys    []Key
+	fetched time.Time
+	loading chan struct{} // 正在进行的加载，加载完成时关闭
+	now     func() time.Time
+}
+
+// NewJWKSFile 从文件加载 JWKS，refresh 小于等于 0 时使用 DefaultJWKSRefresh
+func NewJWKSFile(path string, refresh time.Duration) (*JWKS, error) {
+	return newJWKS(func(ctx context.Context) ([]byte, error) {
+		return os.ReadFile(path)
+	}, refresh)
+}
+
+// NewJWKSURL 从 URL 加载 JWKS，通常是内网认证服务的 /.well-known/jwks.json，
+// refresh 小于等于 0 时使用 DefaultJWKSRefresh
+func NewJWKSURL(url string, refresh time.Duration) (*JWKS, error) {
+	client := &http.Client{Timeout: jwksLoadTimeout}
+	return newJWKS(func(ctx context.Context) ([]byte, error) {
+		r, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := client.Do(r)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("jwt: fetching %s: unexpected status %d", url, res.StatusCode)
+		}
+		return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	}, refresh)
+}
+
+func newJWKS(load func(ctx context.Context) ([]byte, error), refresh time.Duration) (*JWKS, error) {
+	if refresh <= 0 {
+		refresh = DefaultJWKSRefresh
+	}
+	j := &JWKS{load: load, refresh: refresh, now: time.Now}
+	keys, err := j.fetch()
+	if err != nil {
+		return nil, err
+	}
+	j.keys = keys
+	j.fetched = j.now()
+	return j, nil
+}
+
+// Keys 返回缓存的密钥，缓存过期时在后台重新加载，没有 kid 对应的密钥时等待重新加载完成
+func (j *JWKS) Keys(ctx context.Context, kid string) ([]Key, error) {
+	j.mu.Lock()
+	since := j.now().Sub(j.fetched)
+	unknown := kid != "" && !hasKID(j.keys, kid)
+	if j.loading == nil && (since > j.refresh || (unknown && since > minJWKSRefresh)) {
+		j.loading = make(chan struct{})
+		go j.reload(j.loading)
+	}
+	keys, loading := j.keys, j.loading
+	j.mu.Unlock()
+
+	if !unknown || loading == nil {
+		return keys, nil
+	}
+	select {
+	case <-loading:
+	case <-ctx.Done():
+		return keys, nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.keys, nil
+}
+
+// reload 重新加载密钥，完成后关闭 done
+func (j *JWKS) reload(done chan struct{}) {
+	keys, err := j.fetch()
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	// 无论成功与否都更新时间，加载失败时不会在每个请求中重试
+	j.fetched = j.now()
+	if err != nil {
+		log.Printf("加载 JWKS 失败，继续使用缓存的密钥：%v", err)
+	} else {
+		j.keys = keys
+	}
+	j.loading = nil
+	close(done)
+}
+
+// fetch 加载并解析 JWKS 文档
+func (j *JWKS) fetch() ([]Key, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), jwksLoadTimeout)
+	defer cancel()
+	b, err := j.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(b)
+}
+
+// hasKID 判断是否存在 kid 对应的密钥
+func hasKID(keys []Key, kid string) bool {
+	for _, k := range keys {
+		if k.KID == kid {
+			return true
+		}
+	}
+	return false
+}
+
+// jwk JWKS 中的一个密钥
+type jwk struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	KID string `json:"kid"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// ParseJWKS 解析 JWKS 文档，支持 RSA、P-256 的 EC 和 oct 密钥，忽略用于加密的密钥和不支持的密钥
+func ParseJWKS(b []byte) ([]Key, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("jwt: invalid JWKS: %v", err)
+	}
+	var keys []Key
+	for _, k := range doc.Keys {
+		if k.Use == "enc" {
+			continue
+		}
+		key, err := k.key()
+		if err != nil {
+			return nil, fmt.Errorf("jwt: invalid key %q in JWKS: %v", k.KID, err)
+		}
+		if key.Key != nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// key 将 JWK 转换为 Key，不支持的密钥返回空的 Key
+func (k jwk) key() (Key, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		if k.Alg != "" && k.Alg != RS256 {
+			return Key{}, nil
+		}
+		n, err := decode(k.N)
+		if err != nil {
+			return Key{}, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return Key{}, err
+		}
+		exp := new(big.Int).SetBytes(e)
+		if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+			return Key{}, fmt.Errorf("invalid exponent")
+		}
+		return Key{KID: k.KID, Alg: RS256, Key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}}, nil
+
+	case "EC":
+		if k.Crv != "P-256" || (k.Alg != "" && k.Alg != ES256) {
+			return Key{}, nil
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return Key{}, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return Key{}, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return Key{}, fmt.Errorf("point is not on the curve")
+		}
+		return Key{KID: k.KID, Alg: ES256, Key: pub}, nil
+
+	case "oct":
+		secret, err := decode(k.K)
+		if err != nil {
+			return Key{}, err
+		}
+		alg := k.Alg
+		if alg == "" {
+			alg = HS256
+		}
+		if alg != HS256 && alg != HS384 && alg != HS512 {
+			return Key{}, nil
+		}
+		return Key{KID: k.KID, Alg: alg, Key: secret}, nil
+	}
+	return Key{}, nil
+}
@@ -0,0 +1,449 @@
+// Package jwt 只使用标准库实现 JWT 的签发和验证，并提供 Bearer 认证中间件。
+// 支持 HS256、HS384、HS512、RS256 和 ES256，密钥可以从 JWKS 文档中加载：
+//
+//	keys, _ := jwt.NewJWKSFile("/etc/api/jwks.json", 10*time.Minute)
+//	r.Use(jwt.Handler(jwt.Options{Keys: keys, Issuer: "https://auth.example.com", Audience: "api"}))
+//	r.Get("/me", func(w http.ResponseWriter, r *http.Request) {
+//		claims := jwt.FromContext(r.Context())
+//		resp.Success(w, claims.Subject())
+//	})
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// 验证失败的错误，可以使用 errors.Is 判断
+var (
+	ErrTokenMissing     = errors.New("jwt: token is missing")
+	ErrTokenMalformed   = errors.New("jwt: token is malformed")
+	ErrTokenSignature   = errors.New("jwt: signature is invalid")
+	ErrTokenExpired     = errors.New("jwt: token has expired")
+	ErrTokenNotYetValid = errors.New("jwt: token is not valid yet")
+	ErrTokenIssuedAt    = errors.New("jwt: token is issued in the future")
+	ErrTokenIssuer      = errors.New("jwt: issuer is invalid")
+	ErrTokenAudience    = errors.New("jwt: audience is invalid")
+	ErrAlgorithm        = errors.New("jwt: algorithm is not allowed")
+	ErrKeyNotFound      = errors.New("jwt: key is not found")
+)
+
+// 支持的签名算法
+const (
+	HS256 = "HS256"
+	HS384 = "HS384"
+	HS512 = "HS512"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+// Claims JWT 的载荷
+type Claims map[string]interface{}
+
+// String 返回字符串类型的声明
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Subject 返回 sub
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+// Issuer 返回 iss
+func (c Claims) Issuer() string {
+	return c.String("iss")
+}
+
+// Audience 返回 aud，aud 可以是字符串或者字符串数组
+func (c Claims) Audience() []string {
+	switch aud := c["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		var list []string
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	case []string:
+		return aud
+	}
+	return nil
+}
+
+// Time 返回 exp、nbf、iat 等时间类型的声明，不存在时返回 false
+func (c Claims) Time(name string) (time.Time, bool) {
+	switch v := c[name].(type) {
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(0, int64(f*float64(time.Second))), true
+	case float64:
+		return time.Unix(0, int64(v*float64(time.Second))), true
+	case int64:
+		return time.Unix(v, 0), true
+	case int:
+		return time.Unix(int64(v), 0), true
+	case time.Time:
+		return v, true
+	}
+	return time.Time{}, false
+}
+
+// Decode 将声明解码到结构体中
+// 注意：dst要传其指针，比如 claims.Decode(&user)
+func (c Claims) Decode(dst interface{}) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dst)
+}
+
+// Key 签名或者验证使用的密钥。Key 的类型：HS 系列为 []byte，RS256 为 *rsa.PrivateKey 或者 *rsa.PublicKey，
+// ES256 为 *ecdsa.PrivateKey 或者 *ecdsa.PublicKey
+type Key struct {
+	// KID 密钥 ID，签发时写入头部的 kid，验证时用于选择密钥
+	KID string
+	// Alg 密钥使用的算法，验证时令牌的 alg 必须与之相同
+	Alg string
+	// Key 密钥
+	Key interface{}
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	KID string `json:"kid,omitempty"`
+}
+
+// Sign 签发令牌，time.Time 类型的声明会被编码为 Unix 时间戳
+func Sign(claims Claims, key Key) (string, error) {
+	payload := make(Claims, len(claims))
+	for k, v := range claims {
+		if t, ok := v.(time.Time); ok {
+			v = t.Unix()
+		}
+		payload[k] = v
+	}
+
+	h, err := json.Marshal(header{Alg: key.Alg, Typ: "JWT", KID: key.KID})
+	if err != nil {
+		return "", err
+	}
+	p, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	signing := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(p)
+	sig, err := sign(key, []byte(signing))
+	if err != nil {
+		return "", err
+	}
+	return signing + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// ParseOpts 验证令牌的配置
+type ParseOpts struct {
+	// Issuer 不为空时 iss 必须与之相同
+	Issuer string
+	// Audience 不为空时 aud 必须包含它
+	Audience string
+	// ClockSkew 验证 exp、nbf 和 iat 时允许的时钟误差，默认 DefaultClockSkew，小于 0 时不允许误差
+	ClockSkew time.Duration
+	// AllowMissingExp 允许没有 exp 的令牌，默认必须有 exp
+	AllowMissingExp bool
+	// Now 返回当前时间，默认 time.Now
+	Now func() time.Time
+}
+
+// DefaultClockSkew 默认允许的时钟误差
+const DefaultClockSkew = 30 * time.Second
+
+// Parse 验证令牌的签名和声明，keys 是候选的密钥，使用 kid 和 alg 选择。
+// 令牌的 alg 必须与密钥的 Alg 相同，避免算法混淆攻击
+func Parse(token string, keys []Key, opts ParseOpts) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+	hb, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	var h header
+	if err := json.Unmarshal(hb, &h); err != nil {
+		return nil, ErrTokenMalformed
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+
+	candidates := selectKeys(keys, h.KID, h.Alg)
+	if len(candidates) == 0 {
+		if len(selectKeys(keys, h.KID, "")) > 0 {
+			return nil, ErrAlgorithm
+		}
+		return nil, ErrKeyNotFound
+	}
+	signing := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range candidates {
+		if verify(key, signing, sig) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrTokenSignature
+	}
+
+	pb, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+	var claims Claims
+	dec := json.NewDecoder(bytes.NewReader(pb))
+	dec.UseNumber()
+	if err := dec.Decode(&claims); err != nil || claims == nil {
+		return nil, ErrTokenMalformed
+	}
+	if err := validate(claims, opts); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// selectKeys 按照 kid 和 alg 选择密钥，令牌没有 kid 时使用所有的密钥
+func selectKeys(keys []Key, kid, alg string) []Key {
+	var selected []Key
+	for _, k := range keys {
+		if kid != "" && k.KID != "" && k.KID != kid {
+			continue
+		}
+		if alg != "" && k.Alg != alg {
+			continue
+		}
+		selected = append(selected, k)
+	}
+	return selected
+}
+
+// validate 验证时间、签发者和受众
+func validate(claims Claims, opts ParseOpts) error {
+	now := time.Now()
+	if opts.Now != nil {
+		now = opts.Now()
+	}
+	skew := opts.ClockSkew
+	if skew == 0 {
+		skew = DefaultClockSkew
+	} else if skew < 0 {
+		skew = 0
+	}
+
+	if exp, ok := claims.Time("exp"); ok {
+		if !now.Before(exp.Add(skew)) {
+			return ErrTokenExpired
+		}
+	} else if !opts.AllowMissingExp {
+		return ErrTokenExpired
+	}
+	if nbf, ok := claims.Time("nbf"); ok && now.Add(skew).Before(nbf) {
+		return ErrTokenNotYetValid
+	}
+	if iat, ok := claims.Time("iat"); ok && now.Add(skew).Before(iat) {
+		return ErrTokenIssuedAt
+	}
+	if opts.Issuer != "" && claims.Issuer() != opts.Issuer {
+		return ErrTokenIssuer
+	}
+	if opts.Audience != "" {
+		for _, aud := range claims.Audience() {
+			if aud == opts.Audience {
+				return nil
+			}
+		}
+		return ErrTokenAudience
+	}
+	return nil
+}
+
+// hashFor 返回算法使用的哈希
+func hashFor(alg string) (crypto.Hash, func() hash.Hash, error) {
+	switch alg {
+	case HS256, RS256, ES256:
+		return crypto.SHA256, sha256.New, nil
+	case HS384:
+		return crypto.SHA384, sha512.New384, nil
+	case HS512:
+		return crypto.SHA512, sha512.New, nil
+	}
+	return 0, nil, ErrAlgorithm
+}
+
+// sign 计算签名
+func sign(key Key, data []byte) ([]byte, error) {
+	hashID, newHash, err := hashFor(key.Alg)
+	if err != nil {
+		return nil, err
+	}
+	switch key.Alg {
+	case HS256, HS384, HS512:
+		secret, ok := key.Key.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("jwt: %s requires a []byte key, got %T", key.Alg, key.Key)
+		}
+		mac := hmac.New(newHash, secret)
+		mac.Write(data)
+		return mac.Sum(nil), nil
+	case RS256:
+		priv, ok := key.Key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("jwt: RS256 requires an *rsa.PrivateKey, got %T", key.Key)
+		}
+		sum := sha256.Sum256(data)
+		return rsa.SignPKCS1v15(rand.Reader, priv, hashID, sum[:])
+	case ES256:
+		priv, ok := key.Key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("jwt: ES256 requires an *ecdsa.PrivateKey, got %T", key.Key)
+		}
+		sum := sha256.Sum256(data)
+		r, s, err := ecdsa.Sign(rand.Reader, priv, sum[:])
+		if err != nil {
+			return nil, err
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig, nil
+	}
+	return nil, ErrAlgorithm
+}
+
+// verify 验证签名，验证时也可以使用私钥
+func verify(key Key, data, sig []byte) error {
+	hashID, newHash, err := hashFor(key.Alg)
+	if err != nil {
+		return err
+	}
+	switch key.Alg {
+	case HS256, HS384, HS512:
+		secret, ok := key.Key.([]byte)
+		if !ok {
+			return ErrAlgorithm
+		}
+		mac := hmac.New(newHash, secret)
+		mac.Write(data)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrTokenSignature
+		}
+		return nil
+	case RS256:
+		pub, ok := key.Key.(*rsa.PublicKey)
+		if priv, isPriv := key.Key.(*rsa.PrivateKey); isPriv {
+			pub, ok = &priv.PublicKey, true
+		}
+		if !ok {
+			return ErrAlgorithm
+		}
+		sum := sha256.Sum256(data)
+		if rsa.VerifyPKCS1v15(pub, hashID, sum[:], sig) != nil {
+			return ErrTokenSignature
+		}
+		return nil
+	case ES256:
+		pub, ok := key.Key.(*ecdsa.PublicKey)
+		if priv, isPriv := key.Key.(*ecdsa.PrivateKey); isPriv {
+			pub, ok = &priv.PublicKey, true
+		}
+		if !ok || len(sig) != 64 {
+			return ErrTokenSignature
+		}
+		sum := sha256.Sum256(data)
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, sum[:], r, s) {
+			return ErrTokenSignature
+		}
+		return nil
+	}
+	return ErrAlgorithm
+}
+
+// Issuer 签发令牌的辅助类型，用于登录接口：
+//
+//	issuer := &jwt.Issuer{Key: key, Issuer: "https://auth.example.com", Audience: []string{"api"}, TTL: time.Hour}
+//	token, err := issuer.Issue(user.ID, jwt.Claims{"role": user.Role})
+type Issuer struct {
+	// Key 签名使用的密钥
+	Key Key
+	// Issuer 写入 iss
+	Issuer string
+	// Audience 写入 aud
+	Audience []string
+	// TTL 有效期，默认 DefaultTTL
+	TTL time.Duration
+	// Now 返回当前时间，默认 time.Now
+	Now func() time.Time
+}
+
+// DefaultTTL 签发的令牌默认的有效期
+const DefaultTTL = time.Hour
+
+// Issue 签发令牌，设置 sub、iss、aud、iat、nbf、exp 和随机的 jti，extra 中的声明会覆盖它们
+func (i *Issuer) Issue(subject string, extra Claims) (string, error) {
+	now := time.Now()
+	if i.Now != nil {
+		now = i.Now()
+	}
+	ttl := i.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	var jti [16]byte
+	if _, err := rand.Read(jti[:]); err != nil {
+		return "", err
+	}
+
+	claims := Claims{
+		"sub": subject,
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": now.Add(ttl).Unix(),
+		"jti": base64.RawURLEncoding.EncodeToString(jti[:]),
+	}
+	if i.Issuer != "" {
+		claims["iss"] = i.Issuer
+	}
+	if len(i.Audience) == 1 {
+		claims["aud"] = i.Audience[0]
+	} else if len(i.Audience) > 1 {
+		claims["aud"] = i.Audience
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	return Sign(claims, i.Key)
+}
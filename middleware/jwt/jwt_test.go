@@ -0,0 +1,257 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_api/api"
+)
+
+func testKeys(t *testing.T) (*rsa.PrivateKey, *ecdsa.PrivateKey) {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rsaKey, ecKey
+}
+
+func TestSignAndParse(t *testing.T) {
+	rsaKey, ecKey := testKeys(t)
+	keys := []Key{
+		{KID: "hs256", Alg: HS256, Key: []byte("secret")},
+		{KID: "hs384", Alg: HS384, Key: []byte("secret")},
+		{KID: "hs512", Alg: HS512, Key: []byte("secret")},
+		{KID: "rs256", Alg: RS256, Key: rsaKey},
+		{KID: "es256", Alg: ES256, Key: ecKey},
+	}
+	public := []Key{keys[0], keys[1], keys[2], {KID: "rs256", Alg: RS256, Key: &rsaKey.PublicKey}, {KID: "es256", Alg: ES256, Key: &ecKey.PublicKey}}
+
+	for _, key := range keys {
+		token, err := Sign(Claims{"sub": "42", "exp": time.Now().Add(time.Minute)}, key)
+		if err != nil {
+			t.Fatalf("%s: %v", key.Alg, err)
+		}
+		claims, err := Parse(token, public, ParseOpts{})
+		if err != nil || claims.Subject() != "42" {
+			t.Fatalf("%s: expecting valid token but got %v, %v", key.Alg, claims, err)
+		}
+
+		parts := strings.Split(token, ".")
+		payload, _ := json.Marshal(Claims{"sub": "admin", "exp": time.Now().Add(time.Minute).Unix()})
+		forged := parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+		if _, err := Parse(forged, public, ParseOpts{}); !errors.Is(err, ErrTokenSignature) {
+			t.Fatalf("%s: expecting signature error but got %v", key.Alg, err)
+		}
+	}
+}
+
+func TestParseAlgorithmConfusion(t *testing.T) {
+	rsaKey, _ := testKeys(t)
+	pub := []Key{{KID: "k", Alg: RS256, Key: &rsaKey.PublicKey}}
+
+	// 使用 RSA 公钥作为 HMAC 密钥伪造的令牌
+	token, _ := Sign(Claims{"exp": time.Now().Add(time.Minute)}, Key{KID: "k", Alg: HS256, Key: []byte("public key bytes")})
+	if _, err := Parse(token, pub, ParseOpts{}); !errors.Is(err, ErrAlgorithm) {
+		t.Fatalf("expecting algorithm error but got %v", err)
+	}
+
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(`{}`)) + "."
+	if _, err := Parse(none, pub, ParseOpts{}); err == nil {
+		t.Fatal("expecting alg none to be rejected")
+	}
+}
+
+func TestParseClaims(t *testing.T) {
+	key := Key{Alg: HS256, Key: []byte("secret")}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	opts := ParseOpts{Issuer: "auth", Audience: "api", ClockSkew: 10 * time.Second, Now: func() time.Time { return now }}
+
+	tests := []struct {
+		claims Claims
+		err    error
+	}{
+		{Claims{"iss": "auth", "aud": "api", "exp": now.Add(time.Minute)}, nil},
+		{Claims{"iss": "auth", "aud": []string{"web", "api"}, "exp": now.Add(-5 * time.Second)}, nil},
+		{Claims{"iss": "auth", "aud": "api", "exp": now.Add(-11 * time.Second)}, ErrTokenExpired},
+		{Claims{"iss": "auth", "aud": "api"}, ErrTokenExpired},
+		{Claims{"iss": "auth", "aud": "api", "exp": now.Add(time.Hour), "nbf": now.Add(time.Minute)}, ErrTokenNotYetValid},
+		{Claims{"iss": "auth", "aud": "api", "exp": now.Add(time.Hour), "nbf": now.Add(5 * time.Second)}, nil},
+		{Claims{"iss": "auth", "aud": "api", "exp": now.Add(time.Hour), "iat": now.Add(time.Minute)}, ErrTokenIssuedAt},
+		{Claims{"iss": "other", "aud": "api", "exp": now.Add(time.Hour)}, ErrTokenIssuer},
+		{Claims{"iss": "auth", "aud": "web", "exp": now.Add(time.Hour)}, ErrTokenAudience},
+	}
+	for i, tt := range tests {
+		token, err := Sign(tt.claims, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Parse(token, []Key{key}, opts); !errors.Is(err, tt.err) {
+			t.Fatalf("%d: expecting %v but got %v", i, tt.err, err)
+		}
+	}
+}
+
+func TestIssuer(t *testing.T) {
+	key := Key{KID: "v1", Alg: HS512, Key: []byte("secret")}
+	issuer := &Issuer{Key: key, Issuer: "auth", Audience: []string{"api"}, TTL: time.Minute}
+	token, err := issuer.Issue("42", Claims{"role": "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := Parse(token, []Key{key}, ParseOpts{Issuer: "auth", Audience: "api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var user struct {
+		Sub  string `json:"sub"`
+		Role string `json:"role"`
+		JTI  string `json:"jti"`
+	}
+	if err := claims.Decode(&user); err != nil || user.Sub != "42" || user.Role != "admin" || user.JTI == "" {
+		t.Fatalf("unexpected claims %+v, %v", user, err)
+	}
+	if exp, ok := claims.Time("exp"); !ok || time.Until(exp) > time.Minute {
+		t.Fatalf("unexpected exp %v", exp)
+	}
+}
+
+func b64(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, ecKey := testKeys(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	write := func(keys ...map[string]string) {
+		b, _ := json.Marshal(map[string]interface{}{"keys": keys})
+		os.WriteFile(path, b, 0600)
+	}
+	rsaJWK := map[string]string{"kty": "RSA", "kid": "rsa1", "n": b64(rsaKey.N), "e": b64(big.NewInt(int64(rsaKey.E)))}
+	ecJWK := map[string]string{"kty": "EC", "kid": "ec1", "crv": "P-256", "x": b64(ecKey.X), "y": b64(ecKey.Y)}
+	write(rsaJWK, map[string]string{"kty": "RSA", "use": "enc", "kid": "enc"})
+
+	jwks, err := NewJWKSFile(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	jwks.now = func() time.Time { return now }
+
+	rsaToken, _ := Sign(Claims{"exp": now.Add(time.Minute)}, Key{KID: "rsa1", Alg: RS256, Key: rsaKey})
+	keys, _ := jwks.Keys(context.Background(), "rsa1")
+	if _, err := Parse(rsaToken, keys, ParseOpts{}); err != nil {
+		t.Fatalf("expecting RSA key from JWKS but got %v", err)
+	}
+
+	// 新增的密钥在最小刷新间隔之后才会被加载
+	write(rsaJWK, ecJWK)
+	ecToken, _ := Sign(Claims{"exp": now.Add(time.Minute)}, Key{KID: "ec1", Alg: ES256, Key: ecKey})
+	keys, _ = jwks.Keys(context.Background(), "ec1")
+	if _, err := Parse(ecToken, keys, ParseOpts{}); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("expecting unknown kid before refresh but got %v", err)
+	}
+	now = now.Add(time.Minute)
+	keys, _ = jwks.Keys(context.Background(), "ec1")
+	if _, err := Parse(ecToken, keys, ParseOpts{}); err != nil {
+		t.Fatalf("expecting EC key after refresh but got %v", err)
+	}
+}
+
+func TestJWKSReload(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	jwks, err := newJWKS(func(ctx context.Context) ([]byte, error) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			<-release
+			return []byte(`{"keys":[{"kty":"oct","kid":"new","k":"c2VjcmV0"}]}`), nil
+		}
+		return []byte(`{"keys":[{"kty":"oct","kid":"old","k":"c2VjcmV0"}]}`), nil
+	}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Add(time.Hour)
+	jwks.now = func() time.Time { return now }
+
+	// 缓存过期时直接返回缓存的密钥，并发的请求只触发一次加载
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if keys, _ := jwks.Keys(context.Background(), "old"); len(keys) != 1 || keys[0].KID != "old" {
+				t.Errorf("expecting cached keys during reload but got %v", keys)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 请求取消时不再等待加载，加载本身不会被中断
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if keys, _ := jwks.Keys(ctx, "new"); len(keys) != 1 || keys[0].KID != "old" {
+		t.Fatalf("expecting cached keys for canceled request but got %v", keys)
+	}
+
+	close(release)
+	if keys, _ := jwks.Keys(context.Background(), "new"); len(keys) != 1 || keys[0].KID != "new" {
+		t.Fatalf("expecting reloaded keys but got %v", keys)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("expecting 2 loads but got %d", n)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	key := Key{Alg: HS256, Key: []byte("secret")}
+	r := api.NewRouter()
+	r.Use(Handler(Options{Keys: StaticKeys{key}, Audience: "api"}))
+	r.Get("/me", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(FromContext(r.Context()).Subject()))
+	})
+
+	token, _ := (&Issuer{Key: key, Audience: []string{"api"}}).Issue("42", nil)
+	rq := httptest.NewRequest("GET", "/me", nil)
+	rq.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, rq)
+	if w.Code != 200 || w.Body.String() != "42" {
+		t.Fatalf("expecting subject in context but got %d %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/me", nil))
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != "Bearer" || !strings.Contains(w.Body.String(), `"code":1004`) {
+		t.Fatalf("expecting 401 envelope but got %d %v %s", w.Code, w.Header(), w.Body.String())
+	}
+
+	expired, _ := Sign(Claims{"aud": "api", "exp": time.Now().Add(-time.Hour)}, key)
+	rq = httptest.NewRequest("GET", "/me", nil)
+	rq.Header.Set("Authorization", "Bearer "+expired)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, rq)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Header().Get("WWW-Authenticate"), "invalid_token") {
+		t.Fatalf("expecting invalid_token challenge but got %d %v", w.Code, w.Header())
+	}
+}
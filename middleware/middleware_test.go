@@ -1,9 +1,12 @@
 package middleware
 
 import (
+	"bufio"
+	"context"
 	"crypto/tls"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"path"
@@ -11,6 +14,9 @@ import (
 	"runtime"
 	"testing"
 	"time"
+
+	"github.com/zhangdapeng520/zdpgo_api/api"
+	"golang.org/x/net/http2"
 )
 
 var testdataDir string
@@ -80,6 +86,63 @@ func TestWrapWriterHTTP2(t *testing.T) {
 	}
 }
 
+func TestWrapWriterH2C(t *testing.T) {
+	flushed := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			t.Errorf("request proto should be HTTP/2.0 but was %s", r.Proto)
+		}
+		if _, ok := w.(*http2FancyWriter); !ok {
+			t.Errorf("expecting http2FancyWriter but got %T", w)
+		}
+		if _, hj := w.(http.Hijacker); hj {
+			t.Error("request should not have been a http.Hijacker")
+		}
+
+		// The first line must reach the client before the handler returns.
+		w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		<-flushed
+		w.Write([]byte("second\n"))
+	})
+
+	wmw := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(NewWrapResponseWriter(w, r.ProtoMajor), r)
+		})
+	}
+
+	ts := httptest.NewUnstartedServer(nil)
+	h2s := &http2.Server{}
+	http2.ConfigureServer(ts.Config, h2s)
+	ts.Config.Handler = api.H2CHandler(wmw(handler), h2s)
+	ts.Start()
+	defer ts.Close()
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("could not get server: %v", err)
+	}
+	defer resp.Body.Close()
+
+	br := bufio.NewReader(resp.Body)
+	line, err := br.ReadString('\n')
+	if err != nil || line != "first\n" {
+		t.Fatalf("expecting flushed line 'first' but got '%s' (%v)", line, err)
+	}
+	close(flushed)
+	if line, _ = br.ReadString('\n'); line != "second\n" {
+		t.Fatalf("expecting line 'second' but got '%s'", line)
+	}
+}
+
 func testRequest(t *testing.T, ts *httptest.Server, method, path string, body io.Reader) (*http.Response, string) {
 	req, err := http.NewRequest(method, ts.URL+path, body)
 	if err != nil {
@@ -0,0 +1,278 @@
+// Package mtls 提供客户端证书认证中间件，需要在 api.TLSOpts 中配置 ClientCAFiles。
+// 中间件把验证通过的客户端证书映射为 Identity，Allow 按照路由分组限制可以访问的身份：
+//
+//	api.RunWithOpts(":8443", r, api.RunOpts{TLS: &api.TLSOpts{
+//		Certificates:  []api.CertKeyPair{{CertFile: "server.crt", KeyFile: "server.key"}},
+//		ClientCAFiles: []string{"internal-ca.crt"},
+//		ClientAuth:    tls.RequireAndVerifyClientCert,
+//	}})
+//
+//	r.Use(mtls.Handler(mtls.Options{TrustDomains: []string{"prod.example.com"}}))
+//	r.Route("/internal/billing", func(r api.Router) {
+//		r.Use(mtls.Allow("spiffe://prod.example.com/ns/billing/*", "cn:ops-cli"))
+//		...
+//	})
+package mtls
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/zhangdapeng520/zdpgo_api/resp"
+)
+
+// 认证失败的错误
+var (
+	ErrNoCertificate   = errors.New("mtls: no verified client certificate")
+	ErrInvalidSPIFFEID = errors.New("mtls: invalid SPIFFE ID")
+	ErrUntrustedDomain = errors.New("mtls: SPIFFE trust domain is not allowed")
+)
+
+// Identity 客户端证书对应的身份
+type Identity struct {
+	// SPIFFEID 证书 URI SAN 中的 SPIFFE ID，例如 spiffe://prod.example.com/ns/billing/sa/api
+	SPIFFEID string `json:"spiffe_id,omitempty"`
+	// TrustDomain SPIFFE ID 的信任域，例如 prod.example.com
+	TrustDomain string `json:"trust_domain,omitempty"`
+	// CommonName 证书主题的 CN
+	CommonName string `json:"common_name"`
+	// OrganizationalUnits 证书主题的 OU
+	OrganizationalUnits []string `json:"organizational_units,omitempty"`
+	// Subject 证书主题
+	Subject string `json:"subject"`
+	// DNSNames、Emails 和 URIs 证书的 SAN
+	DNSNames []string `json:"dns_names,omitempty"`
+	Emails   []string `json:"emails,omitempty"`
+	URIs     []string `json:"uris,omitempty"`
+	// Serial 证书序列号，十六进制
+	Serial string `json:"serial"`
+	// Certificate 客户端证书
+	Certificate *x509.Certificate `json:"-"`
+}
+
+// Name 返回身份的名称，有 SPIFFE ID 时为 SPIFFE ID，否则为 CN
+func (id *Identity) Name() string {
+	if id.SPIFFEID != "" {
+		return id.SPIFFEID
+	}
+	return id.CommonName
+}
+
+// NewIdentity 从证书中读取身份。证书的 URI SAN 中最多只能有一个 SPIFFE ID
+func NewIdentity(cert *x509.Certificate) (*Identity, error) {
+	id := &Identity{
+		CommonName:          cert.Subject.CommonName,
+		OrganizationalUnits: cert.Subject.OrganizationalUnit,
+		Subject:             cert.Subject.String(),
+		DNSNames:            cert.DNSNames,
+		Emails:              cert.EmailAddresses,
+		Serial:              cert.SerialNumber.Text(16),
+		Certificate:         cert,
+	}
+	for _, u := range cert.URIs {
+		id.URIs = append(id.URIs, u.String())
+		if u.Scheme != "spiffe" {
+			continue
+		}
+		if id.SPIFFEID != "" {
+			return nil, fmt.Errorf("%w: multiple SPIFFE IDs", ErrInvalidSPIFFEID)
+		}
+		// SPIFFE ID 不能有端口、用户信息、查询参数和片段，信任域必须为小写
+		if u.Host == "" || u.Port() != "" || u.User != nil || u.RawQuery != "" || u.Fragment != "" || u.Host != strings.ToLower(u.Host) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidSPIFFEID, u)
+		}
+		id.SPIFFEID = u.String()
+		id.TrustDomain = u.Host
+	}
+	return id, nil
+}
+
+// contextKey 保存身份的上下文键
+type contextKey struct{}
+
+// IdentityCtxKey 请求上下文中保存身份的键
+var IdentityCtxKey = contextKey{}
+
+// FromContext 返回客户端证书对应的身份，没有通过认证时返回 nil
+func FromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(IdentityCtxKey).(*Identity)
+	return id
+}
+
+// Options 客户端证书认证中间件的配置
+type Options struct {
+	// Identify 自定义证书到身份的映射，默认 NewIdentity
+	Identify func(cert *x509.Certificate) (*Identity, error)
+
+	// TrustDomains 不为空时只接受这些信任域的 SPIFFE ID，没有 SPIFFE ID 的证书不受限制
+	TrustDomains []string
+
+	// Optional 为 true 时没有客户端证书的请求也会被放行，上下文中没有身份
+	Optional bool
+
+	// ErrorHandler 认证失败时的处理，默认通过 resp.Unauthorized 响应 401
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// Handler 创建客户端证书认证中间件，只使用 TLS 握手时验证过的证书链，
+// 身份保存在请求上下文中，通过 FromContext 读取
+func Handler(options Options) func(next http.Handler) http.Handler {
+	if options.Identify == nil {
+		options.Identify = NewIdentity
+	}
+	if options.ErrorHandler == nil {
+		options.ErrorHandler = defaultErrorHandler
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// PeerCertificates 在 tls.RequestClientCert 时没有经过验证，不能使用
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+				if options.Optional {
+					next.ServeHTTP(w, r)
+					return
+				}
+				options.ErrorHandler(w, r, ErrNoCertificate)
+				return
+			}
+
+			id, err := options.Identify(r.TLS.VerifiedChains[0][0])
+			if err != nil {
+				options.ErrorHandler(w, r, err)
+				return
+			}
+			if id.TrustDomain != "" && len(options.TrustDomains) > 0 && !contains(options.TrustDomains, id.TrustDomain) {
+				options.ErrorHandler(w, r, fmt.Errorf("%w: %s", ErrUntrustedDomain, id.TrustDomain))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), IdentityCtxKey, id)))
+		})
+	}
+}
+
+// Allow 只允许匹配任意一个规则的身份访问，否则响应 403，需要在 Handler 之后使用。规则的格式为：
+//
+//	spiffe://prod.example.com/ns/billing/*  匹配 SPIFFE ID
+//	cn:orders-service                       匹配 CN
+//	ou:platform                             匹配任意一个 OU
+//	dns:*.internal.example.com              匹配任意一个 DNS SAN
+//	email:ops@example.com                   匹配任意一个 Email SAN
+//	uri:https://example.com/*               匹配任意一个 URI SAN
+//
+// 规则中的 * 匹配任意字符，包括 /
+func Allow(rules ...string) func(next http.Handler) http.Handler {
+	for _, rule := range rules {
+		if _, _, err := parseRule(rule); err != nil {
+			panic(err)
+		}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := FromContext(r.Context())
+			if id == nil {
+				defaultErrorHandler(w, r, ErrNoCertificate)
+				return
+			}
+			if !Match(id, rules...) {
+				resp.Forbidden(w, "客户端证书没有权限："+id.Name())
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Match 判断身份是否匹配任意一个规则，规则的格式参考 Allow，格式错误的规则不匹配任何身份
+func Match(id *Identity, rules ...string) bool {
+	for _, rule := range rules {
+		kind, pattern, err := parseRule(rule)
+		if err != nil {
+			continue
+		}
+		var values []string
+		switch kind {
+		case "spiffe":
+			values = []string{id.SPIFFEID}
+		case "cn":
+			values = []string{id.CommonName}
+		case "ou":
+			values = id.OrganizationalUnits
+		case "dns":
+			values = id.DNSNames
+		case "email":
+			values = id.Emails
+		case "uri":
+			values = id.URIs
+		}
+		for _, v := range values {
+			if v != "" && matchWildcard(pattern, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseRule 解析规则，返回规则的类型和模式
+func parseRule(rule string) (string, string, error) {
+	if strings.HasPrefix(rule, "spiffe://") {
+		return "spiffe", rule, nil
+	}
+	kind, pattern, ok := strings.Cut(rule, ":")
+	if !ok || pattern == "" {
+		return "", "", fmt.Errorf("mtls: invalid rule %q", rule)
+	}
+	switch kind {
+	case "cn", "ou", "dns", "email", "uri":
+		return kind, pattern, nil
+	}
+	return "", "", fmt.Errorf("mtls: invalid rule %q", rule)
+}
+
+// matchWildcard 判断 s 是否匹配 pattern，* 匹配任意字符
+func matchWildcard(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return len(s) >= len(last) && strings.HasSuffix(s, last)
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultErrorHandler 通过 resp 的错误格式响应 401
+func defaultErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	msg := "客户端证书无效"
+	switch {
+	case errors.Is(err, ErrNoCertificate):
+		msg = "缺少客户端证书"
+	case errors.Is(err, ErrUntrustedDomain):
+		msg = "客户端证书的信任域不被允许"
+	case !errors.Is(err, ErrInvalidSPIFFEID):
+		log.Printf("验证客户端证书失败：%v", err)
+	}
+	resp.Unauthorized(w, "", msg)
+}
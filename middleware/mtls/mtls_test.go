@@ -0,0 +1,183 @@
+package mtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_api/api"
+)
+
+// testCert 生成自签名的客户端证书
+func testCert(t *testing.T, cn string, ou []string, uris ...string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(255),
+		Subject:      pkix.Name{CommonName: cn, OrganizationalUnit: ou},
+		DNSNames:     []string{cn + ".internal.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	for _, s := range uris {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.URIs = append(tmpl.URIs, u)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// request 返回 TLS 握手验证过 cert 的请求
+func request(path string, cert *x509.Certificate) *http.Request {
+	r := httptest.NewRequest("GET", path, nil)
+	if cert != nil {
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	return r
+}
+
+func TestNewIdentity(t *testing.T) {
+	id, err := NewIdentity(testCert(t, "orders", []string{"platform"}, "https://example.com/orders", "spiffe://prod.example.com/ns/orders/sa/api"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.SPIFFEID != "spiffe://prod.example.com/ns/orders/sa/api" || id.TrustDomain != "prod.example.com" || id.Name() != id.SPIFFEID {
+		t.Fatalf("unexpected SPIFFE identity %+v", id)
+	}
+	if id.CommonName != "orders" || id.Serial != "ff" || len(id.URIs) != 2 || id.DNSNames[0] != "orders.internal.example.com" {
+		t.Fatalf("unexpected identity %+v", id)
+	}
+
+	if id, _ := NewIdentity(testCert(t, "ops-cli", nil)); id.Name() != "ops-cli" {
+		t.Fatalf("expecting the CN as name but got %q", id.Name())
+	}
+
+	for _, uris := range [][]string{
+		{"spiffe://a.example.com/x", "spiffe://b.example.com/y"},
+		{"spiffe://Prod.example.com/x"},
+		{"spiffe://prod.example.com:8443/x"},
+		{"spiffe://prod.example.com/x?q=1"},
+	} {
+		if _, err := NewIdentity(testCert(t, "bad", nil, uris...)); err == nil {
+			t.Errorf("expecting an error for %v", uris)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := api.NewRouter()
+	r.Use(Handler(Options{TrustDomains: []string{"prod.example.com"}}))
+	r.Route("/billing", func(r api.Router) {
+		r.Use(Allow("spiffe://prod.example.com/ns/billing/*", "cn:ops-cli", "ou:sre"))
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(FromContext(r.Context()).Name()))
+		})
+	})
+	r.Get("/any", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(FromContext(r.Context()).Name()))
+	})
+
+	billing := testCert(t, "billing", nil, "spiffe://prod.example.com/ns/billing/sa/worker")
+	orders := testCert(t, "orders", nil, "spiffe://prod.example.com/ns/orders/sa/api")
+	staging := testCert(t, "billing", nil, "spiffe://staging.example.com/ns/billing/sa/worker")
+	ops := testCert(t, "ops-cli", nil)
+	sre := testCert(t, "alice", []string{"sre"})
+
+	tests := []struct {
+		path string
+		cert *x509.Certificate
+		code int
+		body string
+	}{
+		{"/any", nil, 401, ""},
+		{"/any", orders, 200, "spiffe://prod.example.com/ns/orders/sa/api"},
+		{"/any", staging, 401, ""},
+		{"/billing", billing, 200, "spiffe://prod.example.com/ns/billing/sa/worker"},
+		{"/billing", orders, 403, ""},
+		{"/billing", ops, 200, "ops-cli"},
+		{"/billing", sre, 200, "alice"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request(tt.path, tt.cert))
+		if w.Code != tt.code || (tt.code == 200 && w.Body.String() != tt.body) {
+			t.Errorf("%s: expecting %d %q but got %d %q", tt.path, tt.code, tt.body, w.Code, w.Body.String())
+		}
+	}
+
+	// 只有 PeerCertificates 的证书没有经过验证
+	req := request("/any", orders)
+	req.TLS.VerifiedChains = nil
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != 401 {
+		t.Fatalf("expecting 401 for an unverified certificate but got %d", w.Code)
+	}
+}
+
+func TestOptional(t *testing.T) {
+	h := Handler(Options{Optional: true})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if FromContext(r.Context()) != nil {
+			t.Fatalf("expecting no identity")
+		}
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, request("/", nil))
+	if w.Code != 200 {
+		t.Fatalf("expecting 200 but got %d", w.Code)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	id := &Identity{SPIFFEID: "spiffe://prod.example.com/ns/billing/sa/api", CommonName: "billing", DNSNames: []string{"billing.internal.example.com"}, Emails: []string{"ops@example.com"}}
+	tests := []struct {
+		rule  string
+		match bool
+	}{
+		{"spiffe://prod.example.com/ns/billing/*", true},
+		{"spiffe://prod.example.com/*/sa/api", true},
+		{"spiffe://prod.example.com/ns/orders/*", false},
+		{"spiffe://prod.example.com/ns/billing", false},
+		{"cn:billing", true},
+		{"cn:bill", false},
+		{"dns:*.internal.example.com", true},
+		{"dns:*.example.org", false},
+		{"email:ops@example.com", true},
+		{"uri:*", false},
+		{"bad-rule", false},
+	}
+	for _, tt := range tests {
+		if got := Match(id, tt.rule); got != tt.match {
+			t.Errorf("%s: expecting %v but got %v", tt.rule, tt.match, got)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expecting Allow to panic for an invalid rule")
+		}
+	}()
+	Allow("role:admin")
+}
@@ -28,6 +28,11 @@ var xRealIP = http.CanonicalHeaderKey("X-Real-IP")
 // values from the client, or if you use this middleware without a reverse
 // proxy, malicious clients will be able to make you very sad (or, depending on
 // how you're using RemoteAddr, vulnerable to an attack of some sort).
+//
+// If your load balancer speaks the PROXY protocol instead of setting these
+// headers, configure api.RunOpts.ProxyProtocol: the connection's RemoteAddr,
+// and therefore r.RemoteAddr, is then the real client address and this
+// middleware is not needed.
 func RealIP(h http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		if rip := realIP(r); rip != "" {
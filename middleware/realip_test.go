@@ -1,10 +1,10 @@
 package middleware
 
 import (
+	"github.com/zhangdapeng520/zdpgo_api/api"
 	"net/http"
 	"net/http/httptest"
 	"testing"
-	"zdpgo_api/api"
 )
 
 func TestXRealIP(t *testing.T) {
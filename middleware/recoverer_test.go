@@ -2,11 +2,11 @@ package middleware
 
 import (
 	"bytes"
+	"github.com/zhangdapeng520/zdpgo_api/api"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
-	"zdpgo_api/api"
 )
 
 func panickingHandler(http.ResponseWriter, *http.Request) { panic("foo") }
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/zhangdapeng520/zdpgo_api/req"
+)
+
+// ReplayableBody 是一个缓存请求体的中间件，之后的中间件和处理器可以通过 req.Body 多次读取请求体，
+// 通过 req.BufferBody 得到请求体的大小和哈希。超出 opts.MemoryBytes 的部分写入临时文件，
+// 请求结束后删除；请求体超出 opts.MaxBytes 时响应 413
+//
+//	r.Use(middleware.ReplayableBody(req.BodyOpts{MaxBytes: 10 << 20}))
+func ReplayableBody(opts req.BodyOpts) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if _, err := req.BufferBody(r, opts); err != nil {
+				status := http.StatusBadRequest
+				var be *req.BodyError
+				if errors.As(err, &be) {
+					status = be.Status
+				}
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zhangdapeng520/zdpgo_api/api"
+	"github.com/zhangdapeng520/zdpgo_api/req"
+)
+
+func TestReplayableBody(t *testing.T) {
+	r := api.NewRouter()
+	r.Use(ReplayableBody(req.BodyOpts{MaxBytes: 16}))
+
+	// 模拟读取请求体的签名校验中间件
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.ReadAll(r.Body)
+			next.ServeHTTP(w, r)
+		})
+	})
+	r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		body, err := req.Body(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(w, body)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader("hello")))
+	if w.Body.String() != "hello" {
+		t.Fatalf("expecting replayed body but got %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(strings.Repeat("a", 17))))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expecting 413 but got %d", w.Code)
+	}
+}
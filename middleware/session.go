@@ -0,0 +1,433 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SessionCtxKey is the context.Context key to store the request session.
+var SessionCtxKey = &contextKey{"Session"}
+
+// ErrSessionKeyNotFound 会话中不存在指定的键
+var ErrSessionKeyNotFound = errors.New("middleware: session key not found")
+
+// errSessionNotSaved 会话保存失败并已经响应 500 之后，处理器写入的响应被丢弃
+var errSessionNotSaved = errors.New("middleware: session could not be saved")
+
+// 会话的默认配置
+const (
+	DefaultSessionCookie          = "session_id"
+	DefaultSessionIdleTimeout     = 30 * time.Minute
+	DefaultSessionAbsoluteTimeout = 24 * time.Hour
+)
+
+// SessionOpts 会话中间件的配置
+type SessionOpts struct {
+	// Store 会话的存储，默认使用容量为 DefaultMemoryStoreSize 的 MemoryStore
+	Store Store
+
+	// CookieName 保存会话 ID 的 Cookie 名称，默认 DefaultSessionCookie
+	CookieName string
+
+	// Header 不为空时通过请求头和响应头传递会话 ID，例如 X-Session-Id，不再使用 Cookie
+	Header string
+
+	// IdleTimeout 空闲超时，超过这段时间没有请求时会话失效，默认 DefaultSessionIdleTimeout
+	IdleTimeout time.Duration
+
+	// AbsoluteTimeout 绝对超时，会话创建后超过这段时间一定失效，默认 DefaultSessionAbsoluteTimeout
+	AbsoluteTimeout time.Duration
+
+	// Cookie 的属性，默认 Path 为 /，SameSite 为 Lax，并且设置 HttpOnly 和 Secure
+	Path          string
+	Domain        string
+	SameSite      http.SameSite
+	DisableSecure bool
+}
+
+// SessionData 一个会话，值序列化为 JSON 保存，只有修改过的会话才会被保存
+type SessionData struct {
+	mu         sync.Mutex
+	id         string
+	oldID      string
+	values     map[string]json.RawMessage
+	created    time.Time
+	lastAccess time.Time
+	isNew      bool
+	saved      bool
+	modified   bool
+	destroyed  bool
+}
+
+// sessionRecord 会话在存储中的格式
+type sessionRecord struct {
+	Values     map[string]json.RawMessage `json:"values"`
+	Created    time.Time                  `json:"created"`
+	LastAccess time.Time                  `json:"last_access"`
+}
+
+// ID 返回会话 ID，新会话在第一次修改前 ID 也已经确定
+func (s *SessionData) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
+
+// IsNew 判断会话是否在这次请求中创建
+func (s *SessionData) IsNew() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.isNew
+}
+
+// Get 读取值并解码到 dst 中，键不存在时返回 ErrSessionKeyNotFound
+// 注意：dst要传其指针，比如 session.Get("user_id", &userID)
+func (s *SessionData) Get(key string, dst interface{}) error {
+	s.mu.Lock()
+	raw, ok := s.values[key]
+	s.mu.Unlock()
+	if !ok {
+		return ErrSessionKeyNotFound
+	}
+	return json.Unmarshal(raw, dst)
+}
+
+// Has 判断键是否存在
+func (s *SessionData) Has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.values[key]
+	return ok
+}
+
+// Set 设置值，value 必须可以编码为 JSON
+func (s *SessionData) Set(key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = raw
+	s.modified = true
+	return nil
+}
+
+// Delete 删除值
+func (s *SessionData) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.modified = true
+	}
+}
+
+// Keys 返回所有的键
+func (s *SessionData) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.values))
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Regenerate 更换会话 ID 并保留数据，登录和提升权限后应该调用，防止会话固定攻击
+func (s *SessionData) Regenerate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if (!s.isNew || s.saved) && s.oldID == "" {
+		s.oldID = s.id
+	}
+	s.id = newSessionID()
+	s.created = time.Now()
+	s.modified = true
+}
+
+// Destroy 删除会话，退出登录时调用
+func (s *SessionData) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values = make(map[string]json.RawMessage)
+	s.destroyed = true
+	s.modified = true
+}
+
+// GetSession 返回请求上下文中的会话，没有使用 Session 中间件时返回 nil
+func GetSession(ctx context.Context) *SessionData {
+	s, _ := ctx.Value(SessionCtxKey).(*SessionData)
+	return s
+}
+
+// Session 是一个会话中间件，会话 ID 通过 Cookie 或者请求头传递，处理器中通过 GetSession 读写会话：
+//
+//	r.Use(middleware.Session(middleware.SessionOpts{IdleTimeout: time.Hour}))
+//	r.Post("/login", func(w http.ResponseWriter, r *http.Request) {
+//		s := middleware.GetSession(r.Context())
+//		s.Regenerate()
+//		s.Set("user_id", user.ID)
+//		...
+//	})
+//
+// 会话只在被修改时保存，没有修改的会话在空闲时间过去四分之一后才会刷新过期时间。
+// 会话在响应头写出之前保存并发送会话 ID，保存失败时响应 500，处理器需要在写响应之前修改会话。
+// 响应头写出之后的修改在请求结束后保存，保存失败时只记录日志
+func Session(opts SessionOpts) func(http.Handler) http.Handler {
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore(0)
+	}
+	if opts.CookieName == "" {
+		opts.CookieName = DefaultSessionCookie
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = DefaultSessionIdleTimeout
+	}
+	if opts.AbsoluteTimeout <= 0 {
+		opts.AbsoluteTimeout = DefaultSessionAbsoluteTimeout
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	if opts.SameSite == 0 {
+		opts.SameSite = http.SameSiteLaxMode
+	}
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			s, err := loadSession(r, opts)
+			if err != nil {
+				log.Printf("加载会话失败：%v", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			sw := &sessionWriter{ResponseWriter: w, ctx: r.Context(), session: s, opts: opts}
+			next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), SessionCtxKey, s)))
+			sw.writeID()
+			if sw.failed {
+				return
+			}
+			// 响应头写出之后才修改的会话
+			if err := saveSession(r.Context(), s, opts); err != nil {
+				log.Printf("保存会话失败：%v", err)
+			}
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// loadSession 读取请求中的会话，会话不存在或者超时时创建新的会话
+func loadSession(r *http.Request, opts SessionOpts) (*SessionData, error) {
+	now := time.Now()
+	fresh := &SessionData{id: newSessionID(), values: make(map[string]json.RawMessage), created: now, lastAccess: now, isNew: true}
+
+	id := sessionIDFromRequest(r, opts)
+	if !validSessionID(id) {
+		return fresh, nil
+	}
+	data, err := opts.Store.Load(r.Context(), id)
+	if errors.Is(err, ErrSessionNotFound) {
+		return fresh, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rec sessionRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return fresh, nil
+	}
+	if now.Sub(rec.LastAccess) > opts.IdleTimeout || now.Sub(rec.Created) > opts.AbsoluteTimeout {
+		opts.Store.Delete(r.Context(), id)
+		return fresh, nil
+	}
+	if rec.Values == nil {
+		rec.Values = make(map[string]json.RawMessage)
+	}
+	s := &SessionData{id: id, values: rec.Values, created: rec.Created, lastAccess: rec.LastAccess}
+	if now.Sub(rec.LastAccess) > opts.IdleTimeout/4 {
+		s.modified = true
+	}
+	s.lastAccess = now
+	return s, nil
+}
+
+// saveSession 保存修改过的会话，然后删除更换 ID 前的旧会话。保存成功后清除修改标记，
+// 同一个请求中再次调用时只保存之后的修改
+func saveSession(ctx context.Context, s *SessionData, opts SessionOpts) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.modified {
+		return nil
+	}
+	if s.destroyed {
+		if !s.isNew || s.saved {
+			if err := opts.Store.Delete(ctx, s.id); err != nil {
+				return err
+			}
+		}
+	} else {
+		data, err := json.Marshal(sessionRecord{Values: s.values, Created: s.created, LastAccess: s.lastAccess})
+		if err != nil {
+			return err
+		}
+		ttl := opts.IdleTimeout
+		if remaining := s.created.Add(opts.AbsoluteTimeout).Sub(time.Now()); remaining < ttl {
+			ttl = remaining
+		}
+		if err := opts.Store.Save(ctx, s.id, data, ttl); err != nil {
+			return err
+		}
+		s.saved = true
+	}
+	if s.oldID != "" {
+		if err := opts.Store.Delete(ctx, s.oldID); err != nil {
+			return err
+		}
+		s.oldID = ""
+	}
+	s.modified = false
+	return nil
+}
+
+// sessionIDFromRequest 从 Cookie 或者请求头中读取会话 ID
+func sessionIDFromRequest(r *http.Request, opts SessionOpts) string {
+	if opts.Header != "" {
+		return r.Header.Get(opts.Header)
+	}
+	c, err := r.Cookie(opts.CookieName)
+	if err != nil {
+		return ""
+	}
+	return c.Value
+}
+
+// newSessionID 生成 256 位的随机会话 ID
+func newSessionID() string {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("middleware: failed to generate session id: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(b[:])
+}
+
+// validSessionID 判断会话 ID 的格式，格式不对的 ID 不会被传给存储
+func validSessionID(id string) bool {
+	if len(id) != 43 {
+		return false
+	}
+	_, err := base64.RawURLEncoding.DecodeString(id)
+	return err == nil
+}
+
+// sessionWriter 在写响应头之前保存会话并发送会话 ID
+type sessionWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	session *SessionData
+	opts    SessionOpts
+	wrote   bool
+	// failed 会话保存失败，已经响应 500
+	failed bool
+}
+
+func (sw *sessionWriter) WriteHeader(code int) {
+	sw.writeID()
+	if sw.failed {
+		return
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *sessionWriter) Write(b []byte) (int, error) {
+	sw.writeID()
+	if sw.failed {
+		return 0, errSessionNotSaved
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+func (sw *sessionWriter) Flush() {
+	sw.writeID()
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 用于 WebSocket 等需要接管连接的处理器，劫持之后会话 ID 不会再发送
+func (sw *sessionWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := sw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("api/middleware: http.Hijacker is unavailable on the writer")
+	}
+	sw.wrote = true
+	return hj.Hijack()
+}
+
+// Unwrap 返回原始的 http.ResponseWriter，用于 http.ResponseController
+func (sw *sessionWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// writeID 保存会话并发送会话 ID：新建或者更换 ID 并且修改过的会话设置 ID，删除的会话清除 ID。
+// 保存失败时响应 500，客户端不会收到没有保存的会话 ID
+func (sw *sessionWriter) writeID() {
+	if sw.wrote {
+		return
+	}
+	sw.wrote = true
+
+	s := sw.session
+	s.mu.Lock()
+	id, destroyed := s.id, s.destroyed
+	changed := s.modified && (s.isNew || s.oldID != "")
+	expires := s.created.Add(sw.opts.AbsoluteTimeout)
+	s.mu.Unlock()
+
+	if err := saveSession(sw.ctx, s, sw.opts); err != nil {
+		log.Printf("保存会话失败：%v", err)
+		sw.failed = true
+		http.Error(sw.ResponseWriter, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if !destroyed && !changed {
+		return
+	}
+	if sw.opts.Header != "" {
+		if destroyed {
+			id = ""
+		}
+		sw.Header().Set(sw.opts.Header, id)
+		return
+	}
+	c := &http.Cookie{
+		Name:     sw.opts.CookieName,
+		Value:    id,
+		Path:     sw.opts.Path,
+		Domain:   sw.opts.Domain,
+		SameSite: sw.opts.SameSite,
+		Secure:   !sw.opts.DisableSecure,
+		HttpOnly: true,
+		Expires:  expires.UTC(),
+		MaxAge:   int(time.Until(expires) / time.Second),
+	}
+	if destroyed {
+		c.Value = ""
+		c.Expires = time.Unix(0, 0)
+		c.MaxAge = -1
+	}
+	http.SetCookie(sw, c)
+}
@@ -0,0 +1,207 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSessionNotFound 会话不存在或者已经过期
+var ErrSessionNotFound = errors.New("middleware: session not found")
+
+// Store 会话的存储，data 是序列化后的会话数据，ttl 之后会话过期。
+// 会话不存在或者已经过期时 Load 返回 ErrSessionNotFound
+type Store interface {
+	Load(ctx context.Context, id string) ([]byte, error)
+	Save(ctx context.Context, id string, data []byte, ttl time.Duration) error
+	Delete(ctx context.Context, id string) error
+}
+
+// DefaultMemoryStoreSize 内存存储默认最多保存的会话数量
+const DefaultMemoryStoreSize = 10000
+
+// MemoryStore 内存中的会话存储，会话过期后删除，超出容量时淘汰最久没有使用的会话。
+// 只适合单个进程
+type MemoryStore struct {
+	mu      sync.Mutex
+	size    int
+	items   map[string]*list.Element
+	lru     *list.List
+	nowFunc func() time.Time
+}
+
+type memoryEntry struct {
+	id      string
+	data    []byte
+	expires time.Time
+}
+
+// NewMemoryStore 创建内存存储，size 是最多保存的会话数量，小于等于 0 时使用 DefaultMemoryStoreSize
+func NewMemoryStore(size int) *MemoryStore {
+	if size <= 0 {
+		size = DefaultMemoryStoreSize
+	}
+	return &MemoryStore{
+		size:    size,
+		items:   make(map[string]*list.Element),
+		lru:     list.New(),
+		nowFunc: time.Now,
+	}
+}
+
+// Load 读取会话
+func (s *MemoryStore) Load(ctx context.Context, id string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	entry := el.Value.(*memoryEntry)
+	if !s.nowFunc().Before(entry.expires) {
+		s.lru.Remove(el)
+		delete(s.items, id)
+		return nil, ErrSessionNotFound
+	}
+	s.lru.MoveToFront(el)
+	return entry.data, nil
+}
+
+// Save 保存会话
+func (s *MemoryStore) Save(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := &memoryEntry{id: id, data: append([]byte(nil), data...), expires: s.nowFunc().Add(ttl)}
+	if el, ok := s.items[id]; ok {
+		el.Value = entry
+		s.lru.MoveToFront(el)
+		return nil
+	}
+	s.items[id] = s.lru.PushFront(entry)
+	for s.lru.Len() > s.size {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.items, oldest.Value.(*memoryEntry).id)
+	}
+	return nil
+}
+
+// Delete 删除会话
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[id]; ok {
+		s.lru.Remove(el)
+		delete(s.items, id)
+	}
+	return nil
+}
+
+// Len 返回保存的会话数量，包括还没有被删除的过期会话
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+// FileStore 文件系统中的会话存储，每个会话保存为一个文件，文件名是会话 ID 的 SHA-256，
+// 多个进程可以共享同一个目录
+type FileStore struct {
+	dir     string
+	nowFunc func() time.Time
+}
+
+// NewFileStore 创建文件系统存储，目录不存在时会被创建
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir, nowFunc: time.Now}, nil
+}
+
+// path 返回会话文件的路径，会话 ID 不会直接出现在路径中
+func (s *FileStore) path(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return filepath.Join(s.dir, "session_"+hex.EncodeToString(sum[:]))
+}
+
+// Load 读取会话，文件的前 8 个字节是过期时间
+func (s *FileStore) Load(ctx context.Context, id string) ([]byte, error) {
+	b, err := os.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 8 || !s.nowFunc().Before(time.Unix(0, int64(binary.BigEndian.Uint64(b)))) {
+		os.Remove(s.path(id))
+		return nil, ErrSessionNotFound
+	}
+	return b[8:], nil
+}
+
+// Save 保存会话，先写入临时文件再重命名，读取时不会得到写了一半的文件
+func (s *FileStore) Save(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	b := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint64(b, uint64(s.nowFunc().Add(ttl).UnixNano()))
+	b = append(b, data...)
+
+	f, err := os.CreateTemp(s.dir, "tmp_")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), s.path(id))
+}
+
+// Delete 删除会话
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	err := os.Remove(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Cleanup 删除所有过期的会话文件，可以定期调用
+func (s *FileStore) Cleanup() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	now := s.nowFunc()
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), "session_") {
+			continue
+		}
+		name := filepath.Join(s.dir, e.Name())
+		f, err := os.Open(name)
+		if err != nil {
+			continue
+		}
+		var head [8]byte
+		_, err = f.Read(head[:])
+		f.Close()
+		if err != nil || !now.Before(time.Unix(0, int64(binary.BigEndian.Uint64(head[:])))) {
+			os.Remove(name)
+		}
+	}
+	return nil
+}
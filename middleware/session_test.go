@@ -0,0 +1,247 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_api/api"
+)
+
+// countingStore 记录保存次数的存储
+type countingStore struct {
+	Store
+	saves int
+}
+
+func (s *countingStore) Save(ctx context.Context, id string, data []byte, ttl time.Duration) error {
+	s.saves++
+	return s.Store.Save(ctx, id, data, ttl)
+}
+
+func sessionRouter(opts SessionOpts) http.Handler {
+	r := api.NewRouter()
+	r.Use(Session(opts))
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		var user string
+		GetSession(r.Context()).Get("user", &user)
+		w.Write([]byte(user))
+	})
+	r.Post("/login", func(w http.ResponseWriter, r *http.Request) {
+		s := GetSession(r.Context())
+		s.Regenerate()
+		s.Set("user", r.URL.Query().Get("name"))
+	})
+	r.Post("/logout", func(w http.ResponseWriter, r *http.Request) {
+		GetSession(r.Context()).Destroy()
+	})
+	return r
+}
+
+func sessionCookie(t *testing.T, w *httptest.ResponseRecorder) *http.Cookie {
+	t.Helper()
+	for _, c := range w.Result().Cookies() {
+		if c.Name == DefaultSessionCookie {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestSession(t *testing.T) {
+	store := &countingStore{Store: NewMemoryStore(0)}
+	h := sessionRouter(SessionOpts{Store: store})
+
+	// 没有修改的会话不会被保存，也不会发送 Cookie
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if store.saves != 0 || sessionCookie(t, w) != nil {
+		t.Fatalf("expecting lazy session but got %d saves", store.saves)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/login?name=gopher", nil))
+	first := sessionCookie(t, w)
+	if first == nil || !first.HttpOnly || !first.Secure || store.saves != 1 {
+		t.Fatalf("expecting secure session cookie but got %+v", first)
+	}
+
+	rq := httptest.NewRequest("GET", "/", nil)
+	rq.AddCookie(first)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, rq)
+	if w.Body.String() != "gopher" || store.saves != 1 || sessionCookie(t, w) != nil {
+		t.Fatalf("expecting unmodified session to be read but got %q, %d saves", w.Body.String(), store.saves)
+	}
+
+	// 再次登录更换 ID，旧的 ID 失效
+	rq = httptest.NewRequest("POST", "/login?name=admin", nil)
+	rq.AddCookie(first)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, rq)
+	second := sessionCookie(t, w)
+	if second == nil || second.Value == first.Value {
+		t.Fatal("expecting regenerated session id")
+	}
+	if _, err := store.Load(context.Background(), first.Value); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expecting old session to be deleted but got %v", err)
+	}
+
+	rq = httptest.NewRequest("POST", "/logout", nil)
+	rq.AddCookie(second)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, rq)
+	if c := sessionCookie(t, w); c == nil || c.MaxAge != -1 {
+		t.Fatalf("expecting cookie to be cleared but got %+v", c)
+	}
+	if _, err := store.Load(context.Background(), second.Value); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("expecting destroyed session to be deleted but got %v", err)
+	}
+}
+
+// failingStore 保存总是失败的存储
+type failingStore struct {
+	Store
+}
+
+func (failingStore) Save(context.Context, string, []byte, time.Duration) error {
+	return errors.New("store is down")
+}
+
+func TestSessionSavedBeforeHeaders(t *testing.T) {
+	store := NewMemoryStore(0)
+	h := Session(SessionOpts{Store: store})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := GetSession(r.Context())
+		s.Set("user", "gopher")
+		w.Write([]byte("ok"))
+		// 响应头写出时会话已经保存
+		if _, err := store.Load(r.Context(), s.ID()); err != nil {
+			t.Errorf("expecting session to be saved before the response but got %v", err)
+		}
+		// 响应头写出之后的修改在请求结束后保存
+		s.Set("theme", "dark")
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/login", nil))
+	c := sessionCookie(t, w)
+	if c == nil {
+		t.Fatal("expecting a session cookie")
+	}
+	data, err := store.Load(context.Background(), c.Value)
+	if err != nil || !strings.Contains(string(data), "theme") {
+		t.Fatalf("expecting the late change to be saved but got %s, %v", data, err)
+	}
+
+	h = sessionRouter(SessionOpts{Store: failingStore{NewMemoryStore(0)}})
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/login?name=gopher", nil))
+	if w.Code != http.StatusInternalServerError || sessionCookie(t, w) != nil {
+		t.Fatalf("expecting 500 without a session cookie but got %d, %+v", w.Code, sessionCookie(t, w))
+	}
+}
+
+func TestSessionHeaderAndTimeouts(t *testing.T) {
+	store := NewMemoryStore(0)
+	h := sessionRouter(SessionOpts{Store: store, Header: "X-Session-Id", IdleTimeout: time.Minute, AbsoluteTimeout: time.Hour})
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/login?name=gopher", nil))
+	id := w.Header().Get("X-Session-Id")
+	if id == "" || len(w.Result().Cookies()) != 0 {
+		t.Fatal("expecting session id in the response header")
+	}
+
+	get := func() string {
+		rq := httptest.NewRequest("GET", "/", nil)
+		rq.Header.Set("X-Session-Id", id)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, rq)
+		return w.Body.String()
+	}
+	if got := get(); got != "gopher" {
+		t.Fatalf("expecting session from header but got %q", got)
+	}
+
+	// 修改存储中的时间戳，模拟空闲超时和绝对超时
+	for _, rec := range []string{
+		`{"values":{"user":"\"gopher\""},"created":"` + time.Now().Format(time.RFC3339) + `","last_access":"` + time.Now().Add(-2*time.Minute).Format(time.RFC3339) + `"}`,
+		`{"values":{"user":"\"gopher\""},"created":"` + time.Now().Add(-2*time.Hour).Format(time.RFC3339) + `","last_access":"` + time.Now().Format(time.RFC3339) + `"}`,
+	} {
+		store.Save(context.Background(), id, []byte(rec), time.Hour)
+		if got := get(); got != "" {
+			t.Fatalf("expecting expired session but got %q", got)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore(2)
+	now := time.Now()
+	s.nowFunc = func() time.Time { return now }
+
+	s.Save(ctx, "a", []byte("1"), time.Minute)
+	s.Save(ctx, "b", []byte("2"), time.Minute)
+	s.Load(ctx, "a")
+	s.Save(ctx, "c", []byte("3"), time.Minute)
+	if _, err := s.Load(ctx, "b"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatal("expecting least recently used session to be evicted")
+	}
+	if b, err := s.Load(ctx, "a"); err != nil || string(b) != "1" {
+		t.Fatalf("expecting session a but got %q, %v", b, err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := s.Load(ctx, "a"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatal("expecting expired session")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(ctx, "../a", []byte("data"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := s.Load(ctx, "../a"); err != nil || string(b) != "data" {
+		t.Fatalf("expecting saved session but got %q, %v", b, err)
+	}
+	s.Save(ctx, "b", []byte("old"), time.Millisecond)
+	s.nowFunc = func() time.Time { return time.Now().Add(time.Second) }
+	if err := s.Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load(ctx, "b"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatal("expecting expired session to be removed")
+	}
+	s.Delete(ctx, "../a")
+	if _, err := s.Load(ctx, "../a"); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatal("expecting deleted session")
+	}
+}
+
+func TestSessionHijack(t *testing.T) {
+	h := Session(SessionOpts{Store: NewMemoryStore(0)})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		GetSession(r.Context()).Set("user", "gopher")
+		// WebSocket 库通常通过类型断言获取 http.Hijacker
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			t.Fatal("expecting the session writer to implement http.Hijacker")
+		}
+		if _, _, err := hj.Hijack(); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	w := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/ws", nil))
+	if !w.hijacked {
+		t.Fatal("expecting the connection to be hijacked")
+	}
+}
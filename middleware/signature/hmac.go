@@ -0,0 +1,200 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_api/req"
+)
+
+// HMAC 签名的默认请求头
+const (
+	DefaultSignatureHeader = "X-Signature"
+	DefaultTimestampHeader = "X-Timestamp"
+)
+
+// HMACOpts HMAC 签名验证的配置，默认的签名串为 <时间戳>.<请求体>，签名为 HMAC-SHA256 的十六进制
+type HMACOpts struct {
+	// Secrets 共享密钥，有多个时任意一个验证通过即可，用于轮换密钥
+	Secrets [][]byte
+
+	// Hash 哈希算法，默认 sha256.New
+	Hash func() hash.Hash
+
+	// SignatureHeader 签名所在的请求头，默认 DefaultSignatureHeader
+	SignatureHeader string
+
+	// Prefix 签名的前缀，例如 sha256=
+	Prefix string
+
+	// Base64 为 true 时签名使用标准 base64 编码，默认十六进制
+	Base64 bool
+
+	// TimestampHeader 时间戳所在的请求头，值为 Unix 秒，默认 DefaultTimestampHeader
+	TimestampHeader string
+
+	// DisableTimestamp 为 true 时不检查时间戳，签名串中也不包含时间戳，只用于不发送时间戳的平台
+	DisableTimestamp bool
+
+	// Window 时间戳允许的误差，默认 DefaultWindow
+	Window time.Duration
+
+	// Canonical 返回签名串中请求体之前的部分，签名串为 Canonical(r, timestamp) + 请求体。
+	// 默认为 timestamp + "."，不检查时间戳时为空字符串
+	Canonical func(r *http.Request, timestamp string) string
+
+	// NonceHeader 不为空时从这个请求头读取 nonce，否则使用签名作为 nonce，只在配置了 Nonces 时使用。
+	// nonce 需要通过 Canonical 加入签名串，否则可以被随意修改
+	NonceHeader string
+
+	// Nonces 不为 nil 时拒绝时间窗口内重复的请求
+	Nonces NonceCache
+
+	// Body 缓存请求体的配置
+	Body req.BodyOpts
+
+	// ErrorHandler 验证失败时的处理，默认通过 resp.Unauthorized 响应 401
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, err error)
+
+	// Now 返回当前时间，默认 time.Now
+	Now func() time.Time
+}
+
+// HMAC 创建 HMAC 签名验证中间件，验证通过的签名信息通过 FromContext 读取：
+//
+//	r.With(signature.HMAC(signature.HMACOpts{
+//		Secrets:         [][]byte{[]byte(os.Getenv("PAY_WEBHOOK_SECRET"))},
+//		SignatureHeader: "X-Pay-Signature",
+//		Nonces:          signature.NewMemoryNonceCache(),
+//	})).Post("/webhooks/pay", payNotify)
+func HMAC(opts HMACOpts) func(next http.Handler) http.Handler {
+	opts = opts.withDefaults()
+	return middleware(func(r *http.Request) (*Verified, error) {
+		return verifyHMAC(r, opts)
+	}, opts.ErrorHandler)
+}
+
+// VerifyHMAC 验证请求的 HMAC 签名，用于不方便使用中间件的场景
+func VerifyHMAC(r *http.Request, opts HMACOpts) (*Verified, error) {
+	return verifyHMAC(r, opts.withDefaults())
+}
+
+// SignHMAC 计算 HMAC 签名，返回的签名包括 Prefix，用于测试和向其他服务发送 Webhook
+func SignHMAC(r *http.Request, body []byte, timestamp string, secret []byte, opts HMACOpts) string {
+	opts = opts.withDefaults()
+	mac := hmac.New(opts.Hash, secret)
+	io.WriteString(mac, opts.Canonical(r, timestamp))
+	mac.Write(body)
+	return opts.Prefix + opts.encode(mac.Sum(nil))
+}
+
+func (opts HMACOpts) withDefaults() HMACOpts {
+	if opts.Hash == nil {
+		opts.Hash = sha256.New
+	}
+	if opts.SignatureHeader == "" {
+		opts.SignatureHeader = DefaultSignatureHeader
+	}
+	if opts.TimestampHeader == "" {
+		opts.TimestampHeader = DefaultTimestampHeader
+	}
+	if opts.Window <= 0 {
+		opts.Window = DefaultWindow
+	}
+	if opts.Canonical == nil {
+		if opts.DisableTimestamp {
+			opts.Canonical = func(r *http.Request, timestamp string) string { return "" }
+		} else {
+			opts.Canonical = func(r *http.Request, timestamp string) string { return timestamp + "." }
+		}
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return opts
+}
+
+func (opts HMACOpts) encode(sum []byte) string {
+	if opts.Base64 {
+		return base64.StdEncoding.EncodeToString(sum)
+	}
+	return hex.EncodeToString(sum)
+}
+
+func verifyHMAC(r *http.Request, opts HMACOpts) (*Verified, error) {
+	sig := strings.TrimSpace(r.Header.Get(opts.SignatureHeader))
+	if sig == "" {
+		return nil, ErrSignatureMissing
+	}
+	if !strings.HasPrefix(sig, opts.Prefix) {
+		return nil, ErrSignatureInvalid
+	}
+	sig = sig[len(opts.Prefix):]
+	if !opts.Base64 {
+		// 编码后比较，避免大小写不同的十六进制签名被拒绝
+		sig = strings.ToLower(sig)
+	}
+
+	v := &Verified{}
+	var timestamp string
+	if !opts.DisableTimestamp {
+		timestamp = r.Header.Get(opts.TimestampHeader)
+		sec, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return nil, ErrTimestamp
+		}
+		v.Created = time.Unix(sec, 0)
+		if d := opts.Now().Sub(v.Created); d > opts.Window || d < -opts.Window {
+			return nil, ErrTimestamp
+		}
+	}
+
+	bb, err := req.BufferBody(r, opts.Body)
+	if err != nil {
+		return nil, err
+	}
+	prefix := opts.Canonical(r, timestamp)
+	matched := -1
+	for i, secret := range opts.Secrets {
+		mac := hmac.New(opts.Hash, secret)
+		io.WriteString(mac, prefix)
+		body := bb.NewReader()
+		_, err := io.Copy(mac, body)
+		body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if hmac.Equal([]byte(opts.encode(mac.Sum(nil))), []byte(sig)) {
+			matched = i
+			break
+		}
+	}
+	if matched < 0 {
+		return nil, ErrSignatureInvalid
+	}
+	v.KeyID = strconv.Itoa(matched)
+
+	// 签名验证通过后再记录 nonce，避免伪造的请求占用 nonce
+	if opts.Nonces != nil {
+		nonce := sig
+		if opts.NonceHeader != "" {
+			nonce = r.Header.Get(opts.NonceHeader)
+			if nonce == "" {
+				return nil, fmt.Errorf("%w: missing %s", ErrSignatureInvalid, opts.NonceHeader)
+			}
+		}
+		if err := useNonce(r.Context(), opts.Nonces, "hmac:"+nonce, 2*opts.Window); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
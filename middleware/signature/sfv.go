@@ -0,0 +1,360 @@
+package signature
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 这里实现了 RFC 8941 Structured Field Values 中 RFC 9421 用到的部分：
+// 字典、内部列表、参数，以及字符串、token、整数、字节序列和布尔值。不支持小数
+
+// sfToken 结构化字段中的 token，与字符串区分
+type sfToken string
+
+// sfParam 一个参数，value 为 string、sfToken、int64、[]byte 或者 bool
+type sfParam struct {
+	key   string
+	value interface{}
+}
+
+// sfParams 有序的参数
+type sfParams []sfParam
+
+// get 返回参数的值
+func (ps sfParams) get(key string) (interface{}, bool) {
+	for _, p := range ps {
+		if p.key == key {
+			return p.value, true
+		}
+	}
+	return nil, false
+}
+
+// sfItem 一个带参数的值
+type sfItem struct {
+	value  interface{}
+	params sfParams
+}
+
+// sfMember 字典的一个成员，值为内部列表或者单个值
+type sfMember struct {
+	key     string
+	isList  bool
+	list    []sfItem
+	item    sfItem
+	lparams sfParams
+}
+
+// sfParser 结构化字段的解析器
+type sfParser struct {
+	s   string
+	pos int
+}
+
+func (p *sfParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("signature: invalid structured field at %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *sfParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *sfParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *sfParser) skipSP() {
+	for !p.eof() && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *sfParser) skipOWS() {
+	for !p.eof() && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// parseDictionary 解析字典，重复的键以最后一个为准
+func parseDictionary(s string) ([]sfMember, error) {
+	p := &sfParser{s: s}
+	var members []sfMember
+	p.skipSP()
+	for !p.eof() {
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		m := sfMember{key: key}
+		if p.peek() == '=' {
+			p.pos++
+			if p.peek() == '(' {
+				m.isList = true
+				if m.list, m.lparams, err = p.parseInnerList(); err != nil {
+					return nil, err
+				}
+			} else if m.item, err = p.parseItem(); err != nil {
+				return nil, err
+			}
+		} else {
+			m.item.value = true
+			if m.item.params, err = p.parseParams(); err != nil {
+				return nil, err
+			}
+		}
+		for i := range members {
+			if members[i].key == key {
+				members = append(members[:i], members[i+1:]...)
+				break
+			}
+		}
+		members = append(members, m)
+
+		p.skipOWS()
+		if p.eof() {
+			break
+		}
+		if p.peek() != ',' {
+			return nil, p.errorf("expecting ','")
+		}
+		p.pos++
+		p.skipOWS()
+		if p.eof() {
+			return nil, p.errorf("trailing ','")
+		}
+	}
+	return members, nil
+}
+
+// parseInnerList 解析内部列表和它的参数
+func (p *sfParser) parseInnerList() ([]sfItem, sfParams, error) {
+	p.pos++ // (
+	var items []sfItem
+	for {
+		p.skipSP()
+		if p.eof() {
+			return nil, nil, p.errorf("unterminated inner list")
+		}
+		if p.peek() == ')' {
+			p.pos++
+			params, err := p.parseParams()
+			return items, params, err
+		}
+		item, err := p.parseItem()
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, item)
+		if c := p.peek(); c != ' ' && c != ')' {
+			return nil, nil, p.errorf("expecting ' ' or ')'")
+		}
+	}
+}
+
+// parseItem 解析带参数的值
+func (p *sfParser) parseItem() (sfItem, error) {
+	v, err := p.parseBareItem()
+	if err != nil {
+		return sfItem{}, err
+	}
+	params, err := p.parseParams()
+	return sfItem{value: v, params: params}, err
+}
+
+// parseParams 解析参数
+func (p *sfParser) parseParams() (sfParams, error) {
+	var params sfParams
+	for p.peek() == ';' {
+		p.pos++
+		p.skipSP()
+		key, err := p.parseKey()
+		if err != nil {
+			return nil, err
+		}
+		var v interface{} = true
+		if p.peek() == '=' {
+			p.pos++
+			if v, err = p.parseBareItem(); err != nil {
+				return nil, err
+			}
+		}
+		for i := range params {
+			if params[i].key == key {
+				params = append(params[:i], params[i+1:]...)
+				break
+			}
+		}
+		params = append(params, sfParam{key: key, value: v})
+	}
+	return params, nil
+}
+
+// parseKey 解析键，由小写字母、数字和 _-.* 组成，以小写字母或者 * 开头
+func (p *sfParser) parseKey() (string, error) {
+	start := p.pos
+	if c := p.peek(); !(c >= 'a' && c <= 'z') && c != '*' {
+		return "", p.errorf("expecting a key")
+	}
+	for !p.eof() {
+		c := p.s[p.pos]
+		if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && !strings.ContainsRune("_-.*", rune(c)) {
+			break
+		}
+		p.pos++
+	}
+	return p.s[start:p.pos], nil
+}
+
+// parseBareItem 解析不带参数的值
+func (p *sfParser) parseBareItem() (interface{}, error) {
+	c := p.peek()
+	switch {
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.parseInteger()
+	case c == '"':
+		return p.parseString()
+	case c == ':':
+		return p.parseByteSequence()
+	case c == '?':
+		p.pos++
+		switch p.peek() {
+		case '0':
+			p.pos++
+			return false, nil
+		case '1':
+			p.pos++
+			return true, nil
+		}
+		return nil, p.errorf("invalid boolean")
+	case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '*':
+		return p.parseToken(), nil
+	}
+	return nil, p.errorf("unexpected %q", c)
+}
+
+func (p *sfParser) parseInteger() (int64, error) {
+	start := p.pos
+	if p.peek() == '-' {
+		p.pos++
+	}
+	for !p.eof() && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+		p.pos++
+	}
+	if p.peek() == '.' {
+		return 0, p.errorf("decimals are not supported")
+	}
+	digits := p.s[start:p.pos]
+	if len(strings.TrimPrefix(digits, "-")) == 0 || len(strings.TrimPrefix(digits, "-")) > 15 {
+		return 0, p.errorf("invalid integer")
+	}
+	return strconv.ParseInt(digits, 10, 64)
+}
+
+func (p *sfParser) parseString() (string, error) {
+	p.pos++ // "
+	var b strings.Builder
+	for !p.eof() {
+		c := p.s[p.pos]
+		p.pos++
+		switch {
+		case c == '\\':
+			if p.eof() || (p.s[p.pos] != '"' && p.s[p.pos] != '\\') {
+				return "", p.errorf("invalid escape")
+			}
+			b.WriteByte(p.s[p.pos])
+			p.pos++
+		case c == '"':
+			return b.String(), nil
+		case c < 0x20 || c > 0x7e:
+			return "", p.errorf("invalid character in string")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *sfParser) parseByteSequence() ([]byte, error) {
+	p.pos++ // :
+	end := strings.IndexByte(p.s[p.pos:], ':')
+	if end < 0 {
+		return nil, p.errorf("unterminated byte sequence")
+	}
+	encoded := p.s[p.pos : p.pos+end]
+	p.pos += end + 1
+	b, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, p.errorf("invalid base64")
+	}
+	return b, nil
+}
+
+func (p *sfParser) parseToken() sfToken {
+	start := p.pos
+	for !p.eof() {
+		c := p.s[p.pos]
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune(`"(),;<=>?@[\]{}`, rune(c)) {
+			break
+		}
+		p.pos++
+	}
+	return sfToken(p.s[start:p.pos])
+}
+
+// serializeInnerList 序列化内部列表和它的参数
+func serializeInnerList(items []sfItem, params sfParams) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for i, item := range items {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(serializeItem(item))
+	}
+	b.WriteByte(')')
+	b.WriteString(serializeParams(params))
+	return b.String()
+}
+
+// serializeItem 序列化带参数的值
+func serializeItem(item sfItem) string {
+	return serializeBareItem(item.value) + serializeParams(item.params)
+}
+
+func serializeParams(params sfParams) string {
+	var b strings.Builder
+	for _, p := range params {
+		b.WriteByte(';')
+		b.WriteString(p.key)
+		if v, ok := p.value.(bool); ok && v {
+			continue
+		}
+		b.WriteByte('=')
+		b.WriteString(serializeBareItem(p.value))
+	}
+	return b.String()
+}
+
+func serializeBareItem(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+	case sfToken:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case []byte:
+		return ":" + base64.StdEncoding.EncodeToString(v) + ":"
+	case bool:
+		if v {
+			return "?1"
+		}
+		return "?0"
+	}
+	panic(fmt.Sprintf("signature: cannot serialize %T", v))
+}
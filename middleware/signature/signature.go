@@ -0,0 +1,157 @@
+// Package signature 提供请求签名验证中间件，用于接收支付、代码托管等平台的 Webhook：
+//
+//   - HMAC：X-Signature 请求头中的 HMAC，加上 X-Timestamp 请求头中的时间戳防止重放
+//   - HTTPSig：RFC 9421 HTTP Message Signatures，支持 HMAC、RSA、ECDSA 和 Ed25519
+//
+// 两者都通过 req.BufferBody 缓存请求体，验证之后处理器仍然可以读取完整的请求体。
+// 配置 NonceCache 后，时间窗口内重复的签名或者 nonce 会被拒绝：
+//
+//	nonces := signature.NewMemoryNonceCache()
+//	r.With(signature.HMAC(signature.HMACOpts{Secrets: [][]byte{secret}, Nonces: nonces})).Post("/webhooks/pay", payNotify)
+package signature
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_api/req"
+	"github.com/zhangdapeng520/zdpgo_api/resp"
+)
+
+// 验证失败的错误
+var (
+	ErrSignatureMissing = errors.New("signature: signature is missing")
+	ErrSignatureInvalid = errors.New("signature: signature is invalid")
+	ErrTimestamp        = errors.New("signature: timestamp is missing or outside the allowed window")
+	ErrReplayed         = errors.New("signature: request has already been received")
+	ErrUnknownKey       = errors.New("signature: unknown key")
+)
+
+// DefaultWindow 时间戳默认允许的误差
+const DefaultWindow = 5 * time.Minute
+
+// Verified 验证通过的签名信息
+type Verified struct {
+	// KeyID 签名使用的密钥 ID，HMAC 为 Secrets 中的下标
+	KeyID string
+	// Label RFC 9421 签名的标签，HMAC 为空
+	Label string
+	// Created 签名的时间
+	Created time.Time
+}
+
+// contextKey 保存签名信息的上下文键
+type contextKey struct{}
+
+// VerifiedCtxKey 请求上下文中保存验证通过的签名信息的键
+var VerifiedCtxKey = contextKey{}
+
+// FromContext 返回验证通过的签名信息，没有通过验证时返回 nil
+func FromContext(ctx context.Context) *Verified {
+	v, _ := ctx.Value(VerifiedCtxKey).(*Verified)
+	return v
+}
+
+// NonceCache 记录时间窗口内已经使用过的 nonce
+type NonceCache interface {
+	// Use 记录 nonce，ttl 后过期。nonce 已经被使用过时返回 false
+	Use(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+// MemoryNonceCache 保存在内存中的 NonceCache，只适用于单个实例，多实例部署时需要基于 Redis 等实现 NonceCache
+type MemoryNonceCache struct {
+	mu      sync.Mutex
+	nonces  map[string]time.Time
+	nextGC  time.Time
+	nowFunc func() time.Time
+}
+
+// NewMemoryNonceCache 创建内存中的 NonceCache，过期的 nonce 每分钟清理一次
+func NewMemoryNonceCache() *MemoryNonceCache {
+	return &MemoryNonceCache{nonces: make(map[string]time.Time), nowFunc: time.Now}
+}
+
+// Use 记录 nonce，nonce 已经被使用过并且没有过期时返回 false
+func (c *MemoryNonceCache) Use(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.nowFunc()
+	if now.After(c.nextGC) {
+		for k, expires := range c.nonces {
+			if now.After(expires) {
+				delete(c.nonces, k)
+			}
+		}
+		c.nextGC = now.Add(time.Minute)
+	}
+	if expires, ok := c.nonces[nonce]; ok && !now.After(expires) {
+		return false, nil
+	}
+	c.nonces[nonce] = now.Add(ttl)
+	return true, nil
+}
+
+// Len 返回记录的 nonce 数量，包括还没有清理的过期 nonce
+func (c *MemoryNonceCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.nonces)
+}
+
+// useNonce 在 cache 中记录 nonce，cache 为 nil 时不检查
+func useNonce(ctx context.Context, cache NonceCache, nonce string, ttl time.Duration) error {
+	if cache == nil {
+		return nil
+	}
+	ok, err := cache.Use(ctx, nonce, ttl)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrReplayed
+	}
+	return nil
+}
+
+// middleware 使用 verify 验证请求，验证通过后把签名信息保存到请求上下文中
+func middleware(verify func(r *http.Request) (*Verified, error), errorHandler func(w http.ResponseWriter, r *http.Request, err error)) func(next http.Handler) http.Handler {
+	if errorHandler == nil {
+		errorHandler = defaultErrorHandler
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			v, err := verify(r)
+			if err != nil {
+				errorHandler(w, r, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), VerifiedCtxKey, v)))
+		})
+	}
+}
+
+// defaultErrorHandler 通过 resp 的错误格式响应 401，请求体读取失败时响应 BodyError 的状态码
+func defaultErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	var be *req.BodyError
+	if errors.As(err, &be) {
+		resp.ErrorMap(w, be.Status, "status", false, "code", 1001, "msg", be.Msg)
+		return
+	}
+	msg := "签名无效"
+	switch {
+	case errors.Is(err, ErrSignatureMissing):
+		msg = "缺少签名"
+	case errors.Is(err, ErrTimestamp):
+		msg = "签名已过期"
+	case errors.Is(err, ErrReplayed):
+		msg = "重复的请求"
+	case errors.Is(err, ErrUnknownKey), errors.Is(err, ErrSignatureInvalid):
+	default:
+		log.Printf("验证签名失败：%v", err)
+	}
+	resp.Unauthorized(w, "", msg)
+}
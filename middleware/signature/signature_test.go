@@ -0,0 +1,322 @@
+package signature
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_api/req"
+)
+
+var testNow = time.Unix(1700000000, 0)
+
+func testHandler(mw func(http.Handler) http.Handler) http.Handler {
+	return mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 验证之后处理器仍然可以读取完整的请求体
+		body, _ := io.ReadAll(r.Body)
+		v := FromContext(r.Context())
+		w.Write([]byte(v.KeyID + ":" + string(body)))
+	}))
+}
+
+func TestHMAC(t *testing.T) {
+	secret := []byte("whsec_test")
+	opts := HMACOpts{
+		Secrets: [][]byte{[]byte("old"), secret},
+		Prefix:  "sha256=",
+		Nonces:  NewMemoryNonceCache(),
+		Now:     func() time.Time { return testNow },
+	}
+	h := testHandler(HMAC(opts))
+	body := `{"event":"paid","amount":100}`
+	ts := strconv.FormatInt(testNow.Unix(), 10)
+
+	// 使用独立的实现计算签名
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(ts + "." + body))
+	good := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if sig := SignHMAC(nil, []byte(body), ts, secret, opts); sig != good {
+		t.Fatalf("expecting %s but got %s", good, sig)
+	}
+
+	send := func(sig, ts, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/webhooks/pay", strings.NewReader(body))
+		if sig != "" {
+			r.Header.Set(DefaultSignatureHeader, sig)
+		}
+		if ts != "" {
+			r.Header.Set(DefaultTimestampHeader, ts)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := send(good[:7]+strings.ToUpper(good[7:]), ts, body)
+	if w.Code != 200 || w.Body.String() != "1:"+body {
+		t.Fatalf("expecting 200 but got %d %q", w.Code, w.Body.String())
+	}
+	// 重放
+	if w := send(good, ts, body); w.Code != 401 || !strings.Contains(w.Body.String(), "重复的请求") {
+		t.Fatalf("expecting replay to be rejected but got %d %q", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		name string
+		sig  string
+		ts   string
+		body string
+	}{
+		{"missing", "", ts, body},
+		{"no prefix", good[7:], ts, body},
+		{"tampered body", good, ts, body + " "},
+		{"tampered timestamp", good, strconv.FormatInt(testNow.Unix()+1, 10), body},
+		{"missing timestamp", good, "", body},
+		{"old timestamp", SignHMAC(nil, []byte(body), "1699999000", secret, opts), "1699999000", body},
+		{"wrong secret", SignHMAC(nil, []byte(body), ts, []byte("other"), opts), ts, body},
+	}
+	for _, tt := range tests {
+		if w := send(tt.sig, tt.ts, tt.body); w.Code != 401 {
+			t.Errorf("%s: expecting 401 but got %d", tt.name, w.Code)
+		}
+	}
+}
+
+func TestHMACWithoutTimestamp(t *testing.T) {
+	secret := []byte("s")
+	opts := HMACOpts{Secrets: [][]byte{secret}, Base64: true, DisableTimestamp: true}
+	body := []byte("payload")
+	r := httptest.NewRequest("POST", "/", strings.NewReader(string(body)))
+	r.Header.Set(DefaultSignatureHeader, SignHMAC(r, body, "", secret, opts))
+	if _, err := VerifyHMAC(r, opts); err != nil {
+		t.Fatalf("expecting no error but got %v", err)
+	}
+	// 请求体被缓存，仍然可以读取
+	if b, _ := io.ReadAll(r.Body); string(b) != "payload" {
+		t.Fatalf("expecting the body to be replayable but got %q", b)
+	}
+}
+
+func TestHMACBodyTooLarge(t *testing.T) {
+	h := testHandler(HMAC(HMACOpts{Secrets: [][]byte{[]byte("s")}, DisableTimestamp: true, Body: req.BodyOpts{MaxBytes: 4}}))
+	r := httptest.NewRequest("POST", "/", strings.NewReader("too large"))
+	r.Header.Set(DefaultSignatureHeader, "00")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expecting 413 but got %d", w.Code)
+	}
+}
+
+func TestMemoryNonceCache(t *testing.T) {
+	c := NewMemoryNonceCache()
+	now := testNow
+	c.nowFunc = func() time.Time { return now }
+	if ok, _ := c.Use(context.Background(), "a", time.Minute); !ok {
+		t.Fatalf("expecting the first use to succeed")
+	}
+	if ok, _ := c.Use(context.Background(), "a", time.Minute); ok {
+		t.Fatalf("expecting the second use to fail")
+	}
+	now = now.Add(2 * time.Minute)
+	if ok, _ := c.Use(context.Background(), "a", time.Minute); !ok {
+		t.Fatalf("expecting an expired nonce to be reusable")
+	}
+	now = now.Add(2 * time.Minute)
+	c.Use(context.Background(), "b", time.Minute)
+	if c.Len() != 1 {
+		t.Fatalf("expecting expired nonces to be removed but got %d", c.Len())
+	}
+}
+
+func TestStructuredFields(t *testing.T) {
+	in := `sig1=("@method" "@query-param";name="id" "content-digest");created=1618884473;keyid="test-key";alg="ed25519", sig2=("@authority");tag=webhook;x;y=?0`
+	members, err := parseDictionary(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 || !members[0].isList || len(members[0].list) != 3 {
+		t.Fatalf("expecting two inner lists but got %+v", members)
+	}
+	got := members[0].key + "=" + serializeInnerList(members[0].list, members[0].lparams)
+	if want := `sig1=("@method" "@query-param";name="id" "content-digest");created=1618884473;keyid="test-key";alg="ed25519"`; got != want {
+		t.Fatalf("expecting %s but got %s", want, got)
+	}
+	if got := serializeInnerList(members[1].list, members[1].lparams); got != `("@authority");tag=webhook;x;y=?0` {
+		t.Fatalf("unexpected serialization %s", got)
+	}
+
+	sigs, err := parseDictionary(`sig1=:dGVzdA==:`)
+	if err != nil || string(sigs[0].item.value.([]byte)) != "test" {
+		t.Fatalf("expecting a byte sequence but got %v %v", sigs, err)
+	}
+
+	for _, bad := range []string{`sig1=("a"`, `sig1=("a" "b`, `Sig1=1`, `sig1=1,`, `sig1=:!:`, `sig1=1.5`} {
+		if _, err := parseDictionary(bad); err == nil {
+			t.Errorf("expecting an error for %s", bad)
+		}
+	}
+}
+
+func TestSignatureBase(t *testing.T) {
+	// RFC 9421 附录 B.2 中的请求
+	r := httptest.NewRequest("POST", "/foo?param=Value&Pet=dog", strings.NewReader(`{"hello": "world"}`))
+	r.Host = "example.com"
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Content-Digest", "sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:")
+
+	components := make([]sfItem, 0)
+	for _, name := range []string{"@method", "@authority", "@path", `@query-param;name="Pet"`, "content-digest", "content-type"} {
+		c, err := parseComponent(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		components = append(components, c)
+	}
+	params := sfParams{{key: "created", value: int64(1618884473)}, {key: "keyid", value: "test-key-ed25519"}}
+	base, err := signatureBase(r, components, params, "https")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `"@method": POST
+"@authority": example.com
+"@path": /foo
+"@query-param";name="Pet": dog
+"content-digest": sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:
+"content-type": application/json
+"@signature-params": ("@method" "@authority" "@path" "@query-param";name="Pet" "content-digest" "content-type");created=1618884473;keyid="test-key-ed25519"`
+	if string(base) != want {
+		t.Fatalf("expecting\n%s\nbut got\n%s", want, base)
+	}
+
+	bb, _ := req.BufferBody(r, req.BodyOpts{})
+	if err := verifyContentDigest(r.Header.Get("Content-Digest"), bb); err != nil {
+		t.Fatalf("expecting the RFC content digest to match but got %v", err)
+	}
+}
+
+func TestHTTPSig(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	hmacKey := []byte("shared-secret")
+
+	signing := []Key{
+		{ID: "hmac", Key: hmacKey},
+		{ID: "rsa-pss", Alg: AlgRSAPSSSHA512, Key: rsaKey},
+		{ID: "rsa-v15", Alg: AlgRSAv15SHA256, Key: rsaKey},
+		{ID: "p256", Key: p256},
+		{ID: "p384", Key: p384},
+		{ID: "ed25519", Key: edKey},
+	}
+	keys := StaticKeys{
+		{ID: "hmac", Key: hmacKey},
+		{ID: "rsa-pss", Key: &rsaKey.PublicKey},
+		{ID: "rsa-v15", Key: &rsaKey.PublicKey},
+		{ID: "p256", Key: &p256.PublicKey},
+		{ID: "p384", Key: &p384.PublicKey},
+		{ID: "ed25519", Key: edKey.Public()},
+	}
+	h := testHandler(HTTPSig(HTTPSigOpts{Keys: keys, Nonces: NewMemoryNonceCache(), Now: func() time.Time { return testNow }}))
+
+	newRequest := func(body string) *http.Request {
+		r := httptest.NewRequest("POST", "http://example.com/webhooks?id=1", strings.NewReader(body))
+		SetContentDigest(r, []byte(body))
+		return r
+	}
+	for _, key := range signing {
+		r := newRequest(`{"id":1}`)
+		if err := SignRequest(r, key, SignParams{Created: testNow}); err != nil {
+			t.Fatalf("%s: %v", key.ID, err)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != 200 || w.Body.String() != key.ID+`:{"id":1}` {
+			t.Errorf("%s: expecting 200 but got %d %q", key.ID, w.Code, w.Body.String())
+		}
+	}
+
+	sign := func(body string, params SignParams, change func(r *http.Request)) int {
+		r := newRequest(body)
+		if params.Created.IsZero() {
+			params.Created = testNow
+		}
+		if err := SignRequest(r, signing[5], params); err != nil {
+			t.Fatal(err)
+		}
+		if change != nil {
+			change(r)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	tests := []struct {
+		name   string
+		params SignParams
+		change func(r *http.Request)
+		code   int
+	}{
+		{"ok", SignParams{}, nil, 200},
+		{"replayed nonce", SignParams{Nonce: "n1"}, nil, 200},
+		{"replayed nonce again", SignParams{Nonce: "n1"}, nil, 401},
+		{"missing", SignParams{}, func(r *http.Request) { r.Header.Del("Signature") }, 401},
+		{"tampered method", SignParams{}, func(r *http.Request) { r.Method = "PUT" }, 401},
+		{"tampered query", SignParams{}, func(r *http.Request) { r.URL.RawQuery = "id=2" }, 401},
+		{"tampered body", SignParams{}, func(r *http.Request) { r.Body = io.NopCloser(strings.NewReader(`{"id":2}`)) }, 401},
+		{"body not covered", SignParams{Components: []string{"@method", "@target-uri"}}, nil, 401},
+		{"method not covered", SignParams{Components: []string{"@target-uri", "content-digest"}}, nil, 401},
+		{"expired", SignParams{Created: testNow.Add(-time.Hour)}, nil, 401},
+		{"expires", SignParams{Expires: testNow.Add(-time.Second)}, nil, 401},
+		{"unknown key", SignParams{}, func(r *http.Request) {
+			r.Header.Set("Signature-Input", strings.Replace(r.Header.Get("Signature-Input"), `keyid="ed25519"`, `keyid="nope"`, 1))
+		}, 401},
+		{"alg confusion", SignParams{}, func(r *http.Request) {
+			r.Header.Set("Signature-Input", r.Header.Get("Signature-Input")+`;alg="hmac-sha256"`)
+		}, 401},
+	}
+	for _, tt := range tests {
+		if code := sign(`{"id":1}`, tt.params, tt.change); code != tt.code {
+			t.Errorf("%s: expecting %d but got %d", tt.name, tt.code, code)
+		}
+	}
+}
+
+func TestHTTPSigLabelAndTag(t *testing.T) {
+	key := Key{ID: "k", Key: []byte("secret")}
+	opts := HTTPSigOpts{Keys: StaticKeys{key}, Label: "webhook", Tag: "pay", Now: func() time.Time { return testNow }}
+
+	r := httptest.NewRequest("GET", "http://example.com/", nil)
+	SignRequest(r, key, SignParams{Label: "webhook", Tag: "pay", Created: testNow})
+	v, err := VerifyHTTPSig(r, opts)
+	if err != nil || v.Label != "webhook" || v.KeyID != "k" || !v.Created.Equal(testNow) {
+		t.Fatalf("expecting a verified signature but got %+v %v", v, err)
+	}
+
+	r = httptest.NewRequest("GET", "http://example.com/", nil)
+	SignRequest(r, key, SignParams{Label: "other", Tag: "pay", Created: testNow})
+	if _, err := VerifyHTTPSig(r, opts); !errors.Is(err, ErrSignatureMissing) {
+		t.Fatalf("expecting ErrSignatureMissing but got %v", err)
+	}
+
+	r = httptest.NewRequest("GET", "http://example.com/", nil)
+	SignRequest(r, key, SignParams{Label: "webhook", Tag: "login", Created: testNow})
+	if _, err := VerifyHTTPSig(r, opts); !errors.Is(err, ErrSignatureInvalid) {
+		t.Fatalf("expecting ErrSignatureInvalid but got %v", err)
+	}
+}
@@ -1,12 +1,12 @@
 package middleware
 
 import (
+	api2 "github.com/zhangdapeng520/zdpgo_api/api"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
-	api2 "zdpgo_api/api"
 )
 
 func TestStripSlashes(t *testing.T) {
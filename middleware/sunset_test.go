@@ -1,11 +1,11 @@
 package middleware
 
 import (
+	"github.com/zhangdapeng520/zdpgo_api/api"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
-	"zdpgo_api/api"
 )
 
 func TestSunset(t *testing.T) {
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"github.com/zhangdapeng520/zdpgo_api/api"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -8,7 +9,6 @@ import (
 	"sync"
 	"testing"
 	"time"
-	"zdpgo_api/api"
 )
 
 var testContent = []byte("Hello world!")
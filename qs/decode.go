@@ -0,0 +1,220 @@
+package qs
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// Decode 使用默认配置将参数解码到 dst 中
+// 注意：dst要传其指针，比如 Decode(r.URL.Query(), &filter)
+func Decode(values url.Values, dst interface{}) error {
+	return DecodeWithOpts(values, dst, Opts{})
+}
+
+// DecodeWithOpts 将参数解码到 dst 中，dst 可以是结构体、映射或者 interface{} 的指针。
+// 字符串会被转换为整数、浮点数、布尔值以及实现了 encoding.TextUnmarshaler 的类型
+func DecodeWithOpts(values url.Values, dst interface{}, opts Opts) error {
+	opts = opts.withDefaults()
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("qs: Decode expects a non-nil pointer, got %T", dst)
+	}
+	tree, err := ParseWithOpts(values, opts)
+	if err != nil {
+		return err
+	}
+	return assign(rv.Elem(), tree, "", opts)
+}
+
+// assign 将解析得到的节点赋值给 v
+func assign(v reflect.Value, node interface{}, path string, opts Opts) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return assign(v.Elem(), node, path, opts)
+	}
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		v.Set(reflect.ValueOf(node))
+		return nil
+	}
+
+	if reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+		s, err := scalar(node, path)
+		if err != nil {
+			return err
+		}
+		if err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			return fmt.Errorf("qs: %s: %v", path, err)
+		}
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("qs: %s: expecting an object", path)
+		}
+		return assignStruct(v, m, path, opts)
+
+	case reflect.Map:
+		m, ok := node.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("qs: %s: expecting an object", path)
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("qs: %s: unsupported map key type %s", path, v.Type().Key())
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for k, child := range m {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := assign(elem, child, join(path, k), opts); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(k).Convert(v.Type().Key()), elem)
+		}
+		return nil
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			s, err := scalar(node, path)
+			if err != nil {
+				return err
+			}
+			v.SetBytes([]byte(s))
+			return nil
+		}
+		items, ok := node.([]interface{})
+		if !ok {
+			items = []interface{}{node}
+		}
+		slice := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := assign(slice.Index(i), item, fmt.Sprintf("%s[%d]", path, i), opts); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+		return nil
+	}
+
+	s, err := scalar(node, path)
+	if err != nil {
+		return err
+	}
+	if err := setString(v, s); err != nil {
+		return fmt.Errorf("qs: %s: %v", path, err)
+	}
+	return nil
+}
+
+// assignStruct 将对象的各个键赋值给结构体的字段，没有标签的嵌入结构体会被展开
+func assignStruct(v reflect.Value, m map[string]interface{}, path string, opts Opts) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, ok := fieldName(sf, opts.Tag)
+		if !ok {
+			continue
+		}
+		if sf.Anonymous && !hasTag(sf, opts.Tag) && sf.Type.Kind() == reflect.Struct {
+			if err := assignStruct(v.Field(i), m, path, opts); err != nil {
+				return err
+			}
+			continue
+		}
+		node, exists := m[name]
+		if !exists {
+			continue
+		}
+		if err := assign(v.Field(i), node, join(path, name), opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scalar 返回叶子节点的字符串，同名参数有多个值时使用第一个
+func scalar(node interface{}, path string) (string, error) {
+	switch n := node.(type) {
+	case string:
+		return n, nil
+	case []interface{}:
+		if len(n) > 0 {
+			if s, ok := n[0].(string); ok {
+				return s, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("qs: %s: expecting a value", path)
+}
+
+// setString 将字符串转换为 v 的类型
+func setString(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// fieldName 返回字段对应的参数名称，未导出或者标记为 - 的字段返回 false
+func fieldName(sf reflect.StructField, tag string) (string, bool) {
+	if !sf.IsExported() && !(sf.Anonymous && sf.Type.Kind() == reflect.Struct) {
+		return "", false
+	}
+	for _, t := range []string{tag, "json"} {
+		if name := strings.Split(sf.Tag.Get(t), ",")[0]; name != "" {
+			return name, name != "-"
+		}
+	}
+	return sf.Name, true
+}
+
+// hasTag 判断字段是否指定了参数名称
+func hasTag(sf reflect.StructField, tag string) bool {
+	return sf.Tag.Get(tag) != "" || sf.Tag.Get("json") != ""
+}
+
+// join 拼接错误信息中的参数路径
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "[" + key + "]"
+}
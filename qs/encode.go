@@ -0,0 +1,163 @@
+package qs
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Encode 使用默认配置将结构体或映射编码为参数，是 Decode 的逆操作
+func Encode(v interface{}) (url.Values, error) {
+	return EncodeWithOpts(v, Opts{})
+}
+
+// EncodeWithOpts 将结构体或映射编码为参数：嵌套的对象编码为 a[b]=c，
+// 字符串等简单值的切片在顶层编码为重复的参数 a=1&a=2，在嵌套层中编码为 a[b][]=1，
+// 对象的切片编码为 a[0][b]=c。nil 指针以及带有 omitempty 且为零值的字段会被忽略
+func EncodeWithOpts(v interface{}, opts Opts) (url.Values, error) {
+	opts = opts.withDefaults()
+	rv := indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct && rv.Kind() != reflect.Map {
+		return nil, fmt.Errorf("qs: Encode expects a struct or map, got %T", v)
+	}
+	values := make(url.Values)
+	if err := encode(values, "", rv, opts); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// encode 将 v 编码到 prefix 对应的参数中
+func encode(values url.Values, prefix string, v reflect.Value, opts Opts) error {
+	v = indirect(v)
+	if !v.IsValid() {
+		return nil
+	}
+
+	if s, ok, err := text(v); ok {
+		if err != nil {
+			return err
+		}
+		values.Add(prefix, s)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return encodeStruct(values, prefix, v, opts)
+
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j]) })
+		for _, k := range keys {
+			if err := encode(values, child(prefix, fmt.Sprint(k)), v.MapIndex(k), opts); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			values.Add(prefix, string(v.Bytes()))
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			elem := indirect(v.Index(i))
+			key := prefix
+			if strings.ContainsRune(prefix, '[') {
+				key += "[]"
+			}
+			if isComposite(elem) {
+				key = fmt.Sprintf("%s[%d]", prefix, i)
+			}
+			if err := encode(values, key, elem, opts); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case reflect.Interface, reflect.Func, reflect.Chan:
+		return nil
+	}
+
+	values.Add(prefix, fmt.Sprint(v.Interface()))
+	return nil
+}
+
+// encodeStruct 编码结构体的所有字段，没有标签的嵌入结构体会被展开
+func encodeStruct(values url.Values, prefix string, v reflect.Value, opts Opts) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name, ok := fieldName(sf, opts.Tag)
+		if !ok {
+			continue
+		}
+		fv := v.Field(i)
+		if sf.Anonymous && !hasTag(sf, opts.Tag) && sf.Type.Kind() == reflect.Struct {
+			if err := encodeStruct(values, prefix, fv, opts); err != nil {
+				return err
+			}
+			continue
+		}
+		if strings.Contains(sf.Tag.Get(opts.Tag), ",omitempty") && fv.IsZero() {
+			continue
+		}
+		if err := encode(values, child(prefix, name), fv, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// text 将实现了 encoding.TextMarshaler 的值编码为字符串
+func text(v reflect.Value) (string, bool, error) {
+	if !v.CanInterface() {
+		return "", false, nil
+	}
+	tm, ok := v.Interface().(encoding.TextMarshaler)
+	if !ok {
+		return "", false, nil
+	}
+	b, err := tm.MarshalText()
+	return string(b), true, err
+}
+
+// isComposite 判断值是否需要编码为嵌套的参数
+func isComposite(v reflect.Value) bool {
+	if !v.IsValid() {
+		return false
+	}
+	if _, ok, _ := text(v); ok {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Struct, reflect.Map:
+		return true
+	case reflect.Slice, reflect.Array:
+		return v.Type().Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
+// indirect 解引用指针和接口，nil 时返回无效的值
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// child 返回子节点的参数名
+func child(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "[" + key + "]"
+}
@@ -0,0 +1,267 @@
+// Package qs 解析和生成嵌套的查询参数与表单参数，支持方括号和点号两种写法：
+//
+//	filter[status][]=open&filter[owner]=5&sort.field=created&items[0][name]=a
+//
+// 解析为：
+//
+//	{
+//		"filter": {"status": ["open"], "owner": "5"},
+//		"sort":   {"field": "created"},
+//		"items":  [{"name": "a"}]
+//	}
+//
+// 结果可以继续解码到结构体中，字段名称默认使用 query 标签，其次是 json 标签，最后是字段名。
+package qs
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 默认的解析限制
+const (
+	DefaultMaxDepth = 5
+	DefaultMaxIndex = 100
+)
+
+// Opts 解析和生成参数的配置项
+type Opts struct {
+	// MaxDepth 参数名中最多允许的嵌套层数，例如 a[b][c] 为 2 层，默认 DefaultMaxDepth
+	MaxDepth int
+
+	// MaxIndex 数组下标的最大值，例如 a[100]，默认 DefaultMaxIndex
+	MaxIndex int
+
+	// DisableDots 不把点号当作嵌套的分隔符，a.b 将作为普通的参数名
+	DisableDots bool
+
+	// Tag 结构体字段使用的标签名称，默认 query，标签不存在时依次使用 json 标签和字段名
+	Tag string
+}
+
+func (o Opts) withDefaults() Opts {
+	if o.MaxDepth <= 0 {
+		o.MaxDepth = DefaultMaxDepth
+	}
+	if o.MaxIndex <= 0 {
+		o.MaxIndex = DefaultMaxIndex
+	}
+	if o.Tag == "" {
+		o.Tag = "query"
+	}
+	return o
+}
+
+// list 解析过程中的数组，下标可能是稀疏的，解析结束后会被压缩为切片
+type list struct {
+	indexed  map[int]interface{}
+	appended []interface{}
+}
+
+// Parse 使用默认配置将参数解析为嵌套的映射
+func Parse(values url.Values) (map[string]interface{}, error) {
+	return ParseWithOpts(values, Opts{})
+}
+
+// ParseWithOpts 将参数解析为嵌套的映射，叶子节点是字符串，同名参数有多个值时是 []interface{}。
+// 嵌套层数或数组下标超出限制、同一个参数既是值又是对象时返回错误
+func ParseWithOpts(values url.Values, opts Opts) (map[string]interface{}, error) {
+	opts = opts.withDefaults()
+
+	// 按参数名排序，保证冲突时的错误信息稳定
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	root := make(map[string]interface{})
+	for _, key := range keys {
+		segments, err := splitKey(key, opts)
+		if err != nil {
+			return nil, err
+		}
+		if err := insert(root, segments, values[key], key, opts); err != nil {
+			return nil, err
+		}
+	}
+	return finalize(root).(map[string]interface{}), nil
+}
+
+// splitKey 将参数名拆分为路径，a[b][]、a.b 分别拆分为 [a b ""] 和 [a b]
+func splitKey(key string, opts Opts) ([]string, error) {
+	end := len(key)
+	if i := strings.IndexByte(key, '['); i > 0 {
+		end = i
+	}
+	if !opts.DisableDots {
+		if i := strings.IndexByte(key[:end], '.'); i > 0 {
+			end = i
+		}
+	}
+	segments := []string{key[:end]}
+
+	rest := key[end:]
+	for rest != "" {
+		switch {
+		case rest[0] == '[':
+			j := strings.IndexByte(rest, ']')
+			if j < 0 {
+				// 方括号没有闭合时，剩余的部分作为普通的参数名
+				segments[len(segments)-1] += rest
+				rest = ""
+				continue
+			}
+			segments = append(segments, rest[1:j])
+			rest = rest[j+1:]
+		case rest[0] == '.' && !opts.DisableDots:
+			j := strings.IndexAny(rest[1:], ".[")
+			if j < 0 {
+				j = len(rest) - 1
+			}
+			segments = append(segments, rest[1:j+1])
+			rest = rest[j+1:]
+		default:
+			return nil, fmt.Errorf("qs: malformed key %q", key)
+		}
+	}
+
+	if len(segments)-1 > opts.MaxDepth {
+		return nil, fmt.Errorf("qs: key %q exceeds the maximum depth of %d", key, opts.MaxDepth)
+	}
+	for i, seg := range segments[:len(segments)-1] {
+		if seg == "" && i > 0 {
+			return nil, fmt.Errorf("qs: empty brackets must be last in key %q", key)
+		}
+	}
+	return segments, nil
+}
+
+// insert 将参数值插入到路径对应的位置
+func insert(node map[string]interface{}, segments []string, vals []string, key string, opts Opts) error {
+	var cur interface{} = node
+	for i, seg := range segments {
+		last := i == len(segments)-1
+
+		switch n := cur.(type) {
+		case map[string]interface{}:
+			if seg == "" {
+				return fmt.Errorf("qs: conflicting key %q", key)
+			}
+			if last {
+				if _, exists := n[seg]; exists {
+					return fmt.Errorf("qs: conflicting key %q", key)
+				}
+				n[seg] = leaf(vals)
+				return nil
+			}
+			child, exists := n[seg]
+			if !exists {
+				child = newContainer(segments[i+1])
+				n[seg] = child
+			}
+			if !sameContainer(child, segments[i+1]) {
+				return fmt.Errorf("qs: conflicting key %q", key)
+			}
+			cur = child
+
+		case *list:
+			if seg == "" {
+				for _, v := range vals {
+					n.appended = append(n.appended, v)
+				}
+				return nil
+			}
+			idx, err := strconv.Atoi(seg)
+			if err != nil {
+				return fmt.Errorf("qs: conflicting key %q", key)
+			}
+			if idx < 0 || idx > opts.MaxIndex {
+				return fmt.Errorf("qs: index %d in key %q exceeds the maximum of %d", idx, key, opts.MaxIndex)
+			}
+			if last {
+				if _, exists := n.indexed[idx]; exists {
+					return fmt.Errorf("qs: conflicting key %q", key)
+				}
+				n.indexed[idx] = leaf(vals)
+				return nil
+			}
+			child, exists := n.indexed[idx]
+			if !exists {
+				child = newContainer(segments[i+1])
+				n.indexed[idx] = child
+			}
+			if !sameContainer(child, segments[i+1]) {
+				return fmt.Errorf("qs: conflicting key %q", key)
+			}
+			cur = child
+		}
+	}
+	return nil
+}
+
+// isIndex 判断路径中的一段是否为数组下标
+func isIndex(seg string) bool {
+	if seg == "" {
+		return true
+	}
+	_, err := strconv.Atoi(seg)
+	return err == nil
+}
+
+// newContainer 根据下一段路径创建数组或者对象
+func newContainer(next string) interface{} {
+	if isIndex(next) {
+		return &list{indexed: make(map[int]interface{})}
+	}
+	return make(map[string]interface{})
+}
+
+// sameContainer 判断已有的节点能否容纳下一段路径
+func sameContainer(node interface{}, next string) bool {
+	switch node.(type) {
+	case *list:
+		return isIndex(next)
+	case map[string]interface{}:
+		return !isIndex(next)
+	}
+	return false
+}
+
+// leaf 返回叶子节点的值
+func leaf(vals []string) interface{} {
+	if len(vals) == 1 {
+		return vals[0]
+	}
+	items := make([]interface{}, len(vals))
+	for i, v := range vals {
+		items[i] = v
+	}
+	return items
+}
+
+// finalize 将解析过程中的数组压缩为切片
+func finalize(node interface{}) interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, v := range n {
+			n[k] = finalize(v)
+		}
+		return n
+	case *list:
+		idx := make([]int, 0, len(n.indexed))
+		for i := range n.indexed {
+			idx = append(idx, i)
+		}
+		sort.Ints(idx)
+		items := make([]interface{}, 0, len(idx)+len(n.appended))
+		for _, i := range idx {
+			items = append(items, finalize(n.indexed[i]))
+		}
+		return append(items, n.appended...)
+	}
+	return node
+}
@@ -0,0 +1,160 @@
+package qs
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustQuery(t *testing.T, s string) url.Values {
+	t.Helper()
+	values, err := url.ParseQuery(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+func TestParse(t *testing.T) {
+	got, err := Parse(mustQuery(t, "filter[status][]=open&filter[status][]=closed&filter[owner]=5&sort.field=created&items[1][name]=b&items[0][name]=a&tag=x&tag=y&a.b[c].d=1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"filter": map[string]interface{}{
+			"status": []interface{}{"open", "closed"},
+			"owner":  "5",
+		},
+		"sort":  map[string]interface{}{"field": "created"},
+		"items": []interface{}{map[string]interface{}{"name": "a"}, map[string]interface{}{"name": "b"}},
+		"tag":   []interface{}{"x", "y"},
+		"a":     map[string]interface{}{"b": map[string]interface{}{"c": map[string]interface{}{"d": "1"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expecting %v but got %v", want, got)
+	}
+}
+
+func TestParseSparseIndex(t *testing.T) {
+	got, err := Parse(mustQuery(t, "a[10]=c&a[2]=b&a[]=d"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got["a"], []interface{}{"b", "c", "d"}) {
+		t.Fatalf("expecting compacted array but got %v", got["a"])
+	}
+}
+
+func TestParseOpts(t *testing.T) {
+	got, err := ParseWithOpts(mustQuery(t, "sort.field=created&a[b=1"), Opts{DisableDots: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got["sort.field"] != "created" || got["a[b"] != "1" {
+		t.Fatalf("expecting literal keys but got %v", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"a[b][c][d][e][f][g]=1": "maximum depth",
+		"a[101]=1":              "maximum of 100",
+		"a=1&a[b]=2":            "conflicting",
+		"a[0]=1&a[b]=2":         "conflicting",
+		"a[][b]=1":              "empty brackets",
+		"a[b]x=1":               "malformed",
+	}
+	for query, msg := range tests {
+		_, err := Parse(mustQuery(t, query))
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Fatalf("%s: expecting error containing %q but got %v", query, msg, err)
+		}
+	}
+
+	if _, err := ParseWithOpts(mustQuery(t, "a[3]=1"), Opts{MaxIndex: 2}); err == nil {
+		t.Fatal("expecting index limit error")
+	}
+}
+
+type issueFilter struct {
+	Status []string `query:"status"`
+	Owner  *int     `query:"owner"`
+	Labels map[string]string
+}
+
+type issueQuery struct {
+	Filter issueFilter `query:"filter"`
+	Sort   struct {
+		Field string `query:"field"`
+		Desc  bool   `query:"desc"`
+	} `query:"sort"`
+	Items []struct {
+		Name string `json:"name"`
+		Qty  int    `json:"qty"`
+	} `query:"items"`
+	Since time.Time `query:"since"`
+	Tags  []string  `query:"tag"`
+	Page  int       `query:"page,omitempty"`
+}
+
+func TestDecode(t *testing.T) {
+	var q issueQuery
+	err := Decode(mustQuery(t, "filter[status][]=open&filter[owner]=5&filter.Labels.k=v&sort.field=created&sort[desc]=true&items[0][name]=a&items[0][qty]=2&since=2024-01-02T03:04:05Z&tag=go"), &q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q.Filter.Status) != 1 || q.Filter.Status[0] != "open" || q.Filter.Owner == nil || *q.Filter.Owner != 5 {
+		t.Fatalf("unexpected filter %+v", q.Filter)
+	}
+	if q.Filter.Labels["k"] != "v" || q.Sort.Field != "created" || !q.Sort.Desc {
+		t.Fatalf("unexpected nested fields %+v", q)
+	}
+	if len(q.Items) != 1 || q.Items[0].Name != "a" || q.Items[0].Qty != 2 {
+		t.Fatalf("unexpected items %+v", q.Items)
+	}
+	if q.Since.Year() != 2024 || len(q.Tags) != 1 || q.Tags[0] != "go" {
+		t.Fatalf("unexpected scalars %+v", q)
+	}
+
+	err = Decode(mustQuery(t, "items[0][qty]=many"), &q)
+	if err == nil || !strings.Contains(err.Error(), "items[0][qty]") {
+		t.Fatalf("expecting error with the parameter path but got %v", err)
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	owner := 5
+	var in issueQuery
+	in.Filter = issueFilter{Status: []string{"open", "closed"}, Owner: &owner, Labels: map[string]string{"k": "v"}}
+	in.Sort.Field = "created"
+	in.Items = append(in.Items, struct {
+		Name string `json:"name"`
+		Qty  int    `json:"qty"`
+	}{"a", 2})
+	in.Since = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	in.Tags = []string{"go", "api"}
+
+	values, err := Encode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := values["page"]; ok {
+		t.Fatal("expecting omitempty field to be skipped")
+	}
+	if got := values["filter[status][]"]; len(got) != 2 {
+		t.Fatalf("expecting nested slice as brackets but got %v", values)
+	}
+	if got := values["tag"]; len(got) != 2 {
+		t.Fatalf("expecting top-level slice as repeated keys but got %v", values)
+	}
+
+	var out issueQuery
+	if err := Decode(mustQuery(t, values.Encode()), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("expecting %+v but got %+v", in, out)
+	}
+}
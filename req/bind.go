@@ -0,0 +1,457 @@
+package req
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_api/api"
+	"github.com/zhangdapeng520/zdpgo_api/codec"
+	"github.com/zhangdapeng520/zdpgo_api/validate"
+)
+
+// defaultMultipartMemory 解析 multipart 表单时保存在内存中的最大字节数，超出部分写入临时文件
+const defaultMultipartMemory = 32 << 20
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+)
+
+// bindSources 支持的参数来源，即结构体标签的名称
+var bindSources = []string{"path", "query", "header", "form", "cookie"}
+
+// FieldError 单个字段的绑定错误
+type FieldError struct {
+	// Field 结构体字段的路径，例如 Page 或 Filter.Status
+	Field string
+	// Source 参数来源，即 path、query、header、form、cookie 或 body
+	Source string
+	// Key 参数的名称
+	Key string
+	// Value 转换失败的原始值
+	Value string
+	// Err 转换失败的原因
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	if e.Source == "body" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s %q: cannot convert %q for field %s: %v", e.Source, e.Key, e.Value, e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// BindErrors 所有字段的绑定错误
+type BindErrors []*FieldError
+
+func (errs BindErrors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, e := range errs {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap 返回所有字段的错误，以便使用 errors.As 获取其中的 *BodyError 等错误
+func (errs BindErrors) Unwrap() []error {
+	list := make([]error, len(errs))
+	for i, e := range errs {
+		list[i] = e
+	}
+	return list
+}
+
+// Bind 根据结构体标签从请求中绑定参数
+// 注意：dst要传结构体的指针，比如 Bind(r, &params)
+//
+// 支持的标签：
+//
+//	path:"id"          路径参数，定义语法：/users/{id}
+//	query:"page"       查询参数
+//	header:"X-Token"   请求头参数
+//	form:"name"        表单参数，类型为 *multipart.FileHeader 时绑定上传的文件
+//	cookie:"sid"       Cookie
+//	json:"name"        先根据 Content-Type 解析请求体，支持 codec 中注册的 JSON、XML、MessagePack、CBOR 等格式
+//	default:"10"       参数不存在时使用的默认值
+//	layout:"2006-01-02" time.Time 类型的解析格式，默认 RFC3339
+//
+// 支持字符串、整数、浮点数、布尔值、time.Time、time.Duration、切片、指针（参数不存在时为 nil）
+// 以及实现了 encoding.TextUnmarshaler 的类型。所有字段都会尝试绑定，
+// 转换失败的字段以 BindErrors 的形式一并返回，表单格式错误或者超出大小限制时其中包含 *BodyError。
+func Bind(r *http.Request, dst interface{}) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("req: Bind expects a non-nil pointer to a struct, got %T", dst)
+	}
+
+	var errs BindErrors
+
+	// 先根据 Content-Type 解析请求体，路径、查询等参数的优先级更高。
+	// 表单通过 form 标签绑定，不在这里解析
+	if hasBody(r) {
+		if c, _, ok := codec.Lookup(r.Header.Get("Content-Type")); ok && c != codec.Form && c != codec.Multipart {
+			// 带有 path、header 等标签的字段只能从对应的来源绑定，
+			// 请求体中的同名字段会被还原，否则客户端可以在请求头不存在时通过请求体伪造它们
+			before := make(map[string]reflect.Value)
+			sourcedFields(rv.Elem(), "", before)
+			for path, fv := range before {
+				old := reflect.New(fv.Type()).Elem()
+				old.Set(fv)
+				before[path] = old
+			}
+
+			if err := DecodeBody(r, dst); err != nil && !errors.Is(err, io.EOF) {
+				errs = append(errs, &FieldError{Source: "body", Err: err})
+			}
+
+			after := make(map[string]reflect.Value)
+			sourcedFields(rv.Elem(), "", after)
+			for path, fv := range after {
+				if old, ok := before[path]; ok {
+					fv.Set(old)
+				} else {
+					fv.Set(reflect.Zero(fv.Type()))
+				}
+			}
+		}
+	}
+
+	b := &binder{r: r}
+	b.bindStruct(rv.Elem(), "", &errs)
+	if b.formErr != nil {
+		errs = append(errs, &FieldError{Source: "body", Err: b.formErr})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// BindAndValidate 绑定请求参数后根据 validate 标签校验参数，
+// 绑定失败时返回 BindErrors，校验失败时返回 validate.Errors
+func BindAndValidate(r *http.Request, dst interface{}) error {
+	if err := Bind(r, dst); err != nil {
+		return err
+	}
+	return validate.Struct(dst)
+}
+
+// binder 绑定一次请求的参数，表单只会被解析一次
+type binder struct {
+	r          *http.Request
+	formParsed bool
+	formErr    error
+}
+
+// bindStruct 绑定结构体的所有字段
+func (b *binder) bindStruct(v reflect.Value, prefix string, errs *BindErrors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := v.Field(i)
+		// 未导出类型的嵌入结构体中的导出字段依然可以绑定
+		if !sf.IsExported() && !(sf.Anonymous && sf.Type.Kind() == reflect.Struct) {
+			continue
+		}
+
+		source, key := fieldSource(sf)
+		if source == "" {
+			// 没有参数标签的嵌套结构体，继续绑定其中的字段
+			if isNestedStruct(sf.Type) {
+				if fv.Kind() == reflect.Ptr {
+					if fv.IsNil() {
+						fv.Set(reflect.New(sf.Type.Elem()))
+					}
+					fv = fv.Elem()
+				}
+				if sf.Anonymous {
+					b.bindStruct(fv, prefix, errs)
+				} else {
+					b.bindStruct(fv, prefix+sf.Name+".", errs)
+				}
+			}
+			continue
+		}
+
+		values := b.lookup(source, key)
+		if len(values) == 0 && source == "form" && isFileType(sf.Type) {
+			b.bindFiles(fv, key)
+			continue
+		}
+		if len(values) == 0 {
+			def, ok := sf.Tag.Lookup("default")
+			if !ok {
+				continue
+			}
+			values = []string{def}
+			if isSliceType(sf.Type) {
+				values = strings.Split(def, ",")
+			}
+		}
+
+		if err := setField(fv, values, sf.Tag.Get("layout")); err != nil {
+			*errs = append(*errs, &FieldError{
+				Field:  prefix + sf.Name,
+				Source: source,
+				Key:    key,
+				Value:  strings.Join(values, ","),
+				Err:    err,
+			})
+		}
+	}
+}
+
+// sourcedFields 收集结构体中所有带参数来源标签的字段，键是字段路径，
+// 遍历的方式与 bindStruct 相同，但不会为 nil 的嵌套结构体指针分配内存
+func sourcedFields(v reflect.Value, prefix string, fields map[string]reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := v.Field(i)
+		if !sf.IsExported() && !(sf.Anonymous && sf.Type.Kind() == reflect.Struct) {
+			continue
+		}
+		if source, _ := fieldSource(sf); source != "" {
+			fields[prefix+sf.Name] = fv
+			continue
+		}
+		if !isNestedStruct(sf.Type) {
+			continue
+		}
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		sourcedFields(fv, prefix+sf.Name+".", fields)
+	}
+}
+
+// lookup 从指定的来源中获取参数的所有值
+func (b *binder) lookup(source, key string) []string {
+	r := b.r
+	switch source {
+	case "path":
+		if rctx := api.RouteContext(r.Context()); rctx != nil {
+			for k := len(rctx.URLParams.Keys) - 1; k >= 0; k-- {
+				if rctx.URLParams.Keys[k] == key {
+					return []string{rctx.URLParams.Values[k]}
+				}
+			}
+		}
+	case "query":
+		return r.URL.Query()[key]
+	case "header":
+		return r.Header.Values(key)
+	case "form":
+		b.parseForm()
+		if r.PostForm != nil {
+			return r.PostForm[key]
+		}
+	case "cookie":
+		if c, err := r.Cookie(key); err == nil {
+			return []string{c.Value}
+		}
+	}
+	return nil
+}
+
+// parseForm 解析表单，multipart 表单中的文件会被保存以便绑定到 *multipart.FileHeader。
+// 解析失败时错误保存在 formErr 中，由 Bind 以 *BodyError 的形式返回
+func (b *binder) parseForm() {
+	if b.formParsed {
+		return
+	}
+	b.formParsed = true
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(b.r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		err = b.r.ParseMultipartForm(defaultMultipartMemory)
+	} else {
+		err = b.r.ParseForm()
+	}
+	if err == nil || errors.Is(err, http.ErrNotMultipart) {
+		return
+	}
+	be := &BodyError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("req: failed to parse form: %v", err), Err: err}
+	var me *http.MaxBytesError
+	if errors.As(err, &me) {
+		be.Status = http.StatusRequestEntityTooLarge
+	}
+	b.formErr = be
+}
+
+// bindFiles 绑定上传的文件
+func (b *binder) bindFiles(fv reflect.Value, key string) {
+	b.parseForm()
+	if b.r.MultipartForm == nil {
+		return
+	}
+	files := b.r.MultipartForm.File[key]
+	if len(files) == 0 {
+		return
+	}
+	if fv.Kind() == reflect.Slice {
+		fv.Set(reflect.ValueOf(files))
+		return
+	}
+	fv.Set(reflect.ValueOf(files[0]))
+}
+
+// fieldSource 返回字段的参数来源和参数名称
+func fieldSource(sf reflect.StructField) (string, string) {
+	for _, source := range bindSources {
+		if key, ok := sf.Tag.Lookup(source); ok {
+			key = strings.Split(key, ",")[0]
+			if key == "-" {
+				return "", ""
+			}
+			if key == "" {
+				key = sf.Name
+			}
+			return source, key
+		}
+	}
+	return "", ""
+}
+
+// isNestedStruct 判断字段是否为需要继续绑定的嵌套结构体
+func isNestedStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		return false
+	}
+	return !reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// isFileType 判断字段是否为上传的文件
+func isFileType(t reflect.Type) bool {
+	return t == fileHeaderType || (t.Kind() == reflect.Slice && t.Elem() == fileHeaderType)
+}
+
+// isSliceType 判断字段是否为切片，[]byte 作为字符串处理
+func isSliceType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8
+}
+
+// setField 将参数值转换后赋值给字段
+func setField(fv reflect.Value, values []string, layout string) error {
+	if fv.Kind() == reflect.Ptr {
+		nv := reflect.New(fv.Type().Elem())
+		if err := setField(nv.Elem(), values, layout); err != nil {
+			return err
+		}
+		fv.Set(nv)
+		return nil
+	}
+
+	if isSliceType(fv.Type()) && !fv.Addr().Type().Implements(textUnmarshalerType) {
+		slice := reflect.MakeSlice(fv.Type(), len(values), len(values))
+		for i, s := range values {
+			if err := setValue(slice.Index(i), s, layout); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+
+	return setValue(fv, values[0], layout)
+}
+
+// setValue 将单个字符串转换为字段的类型
+func setValue(v reflect.Value, s string, layout string) error {
+	if v.Kind() == reflect.Ptr {
+		nv := reflect.New(v.Type().Elem())
+		if err := setValue(nv.Elem(), s, layout); err != nil {
+			return err
+		}
+		v.Set(nv)
+		return nil
+	}
+
+	if v.CanAddr() {
+		if tu, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok && v.Type() != timeType {
+			return tu.UnmarshalText([]byte(s))
+		}
+	}
+
+	switch v.Type() {
+	case timeType:
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		t, err := time.Parse(layout, s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(s))
+			return nil
+		}
+		fallthrough
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
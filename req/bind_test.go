@@ -0,0 +1,336 @@
+package req
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_api/api"
+	"github.com/zhangdapeng520/zdpgo_api/codec"
+	"github.com/zhangdapeng520/zdpgo_api/validate"
+)
+
+type bindPage struct {
+	Page int `query:"page" default:"1"`
+	Size int `query:"size" default:"20"`
+}
+
+type bindParams struct {
+	ID      int64         `path:"id"`
+	Tags    []string      `query:"tag"`
+	Since   time.Time     `query:"since" layout:"2006-01-02"`
+	Timeout time.Duration `query:"timeout"`
+	Active  *bool         `query:"active"`
+	Score   *float64      `query:"score"`
+	IP      net.IP        `header:"X-Client-IP"`
+	Token   string        `header:"X-Token"`
+	Session string        `cookie:"sid"`
+	Name    string        `json:"name"`
+	bindPage
+}
+
+func serveBind(r *http.Request, dst interface{}) error {
+	var err error
+	router := api.NewRouter()
+	router.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		err = Bind(r, dst)
+	})
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	return err
+}
+
+func TestBind(t *testing.T) {
+	r := httptest.NewRequest("POST", "/users/42?tag=a&tag=b&since=2024-03-01&timeout=1m30s&active=true&size=50", strings.NewReader(`{"name":"gopher"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Client-IP", "10.0.0.1")
+	r.Header.Set("X-Token", "secret")
+	r.AddCookie(&http.Cookie{Name: "sid", Value: "abc"})
+
+	var p bindParams
+	if err := serveBind(r, &p); err != nil {
+		t.Fatal(err)
+	}
+
+	if p.ID != 42 || p.Name != "gopher" || p.Token != "secret" || p.Session != "abc" {
+		t.Fatalf("unexpected scalar fields %+v", p)
+	}
+	if len(p.Tags) != 2 || p.Tags[0] != "a" || p.Tags[1] != "b" {
+		t.Fatalf("expecting tags [a b] but got %v", p.Tags)
+	}
+	if !p.Since.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) || p.Timeout != 90*time.Second {
+		t.Fatalf("unexpected time fields %v %v", p.Since, p.Timeout)
+	}
+	if p.Active == nil || !*p.Active || p.Score != nil {
+		t.Fatalf("unexpected optional fields %v %v", p.Active, p.Score)
+	}
+	if !p.IP.Equal(net.ParseIP("10.0.0.1")) {
+		t.Fatalf("expecting TextUnmarshaler to parse the IP but got %v", p.IP)
+	}
+	if p.Page != 1 || p.Size != 50 {
+		t.Fatalf("expecting page 1 and size 50 but got %d %d", p.Page, p.Size)
+	}
+}
+
+func TestBindErrors(t *testing.T) {
+	r := httptest.NewRequest("GET", "/users/abc?since=yesterday&page=x&active=maybe", nil)
+
+	var p bindParams
+	err := serveBind(r, &p)
+
+	var errs BindErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expecting BindErrors but got %v", err)
+	}
+	fields := map[string]string{}
+	for _, e := range errs {
+		fields[e.Field] = e.Source + ":" + e.Value
+	}
+	want := map[string]string{
+		"ID":     "path:abc",
+		"Since":  "query:yesterday",
+		"Active": "query:maybe",
+		"Page":   "query:x",
+	}
+	if len(fields) != len(want) {
+		t.Fatalf("expecting %d field errors but got %v", len(want), fields)
+	}
+	for field, v := range want {
+		if fields[field] != v {
+			t.Fatalf("expecting %s error for %s but got %q", v, field, fields[field])
+		}
+	}
+}
+
+func TestBindForm(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("name", "gopher")
+	mw.WriteField("age", "12")
+	fw, _ := mw.CreateFormFile("avatar", "avatar.png")
+	fw.Write([]byte("png"))
+	mw.Close()
+
+	r := httptest.NewRequest("POST", "/users/1", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+
+	var p struct {
+		Name   string                `form:"name"`
+		Age    uint8                 `form:"age"`
+		Avatar *multipart.FileHeader `form:"avatar"`
+	}
+	if err := serveBind(r, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "gopher" || p.Age != 12 {
+		t.Fatalf("unexpected form fields %+v", p)
+	}
+	if p.Avatar == nil || p.Avatar.Filename != "avatar.png" {
+		t.Fatalf("expecting uploaded avatar but got %v", p.Avatar)
+	}
+
+	r = httptest.NewRequest("POST", "/users/1", strings.NewReader(url.Values{"name": {"form"}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	p.Name = ""
+	if err := serveBind(r, &p); err != nil || p.Name != "form" {
+		t.Fatalf("expecting urlencoded form to bind but got %q, %v", p.Name, err)
+	}
+}
+
+func TestBindFormErrors(t *testing.T) {
+	var p struct {
+		Name string `form:"name"`
+	}
+	tests := []struct {
+		contentType, body string
+		status            int
+	}{
+		{"application/x-www-form-urlencoded", "name=%zz", http.StatusBadRequest},
+		{"multipart/form-data; boundary=x", "--x\r\nContent-Disposition: form-data; name=\"name\"\r\n\r\ngopher", http.StatusBadRequest},
+		{"multipart/form-data", "name=gopher", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/users/1", strings.NewReader(tt.body))
+		r.Header.Set("Content-Type", tt.contentType)
+		err := serveBind(r, &p)
+		var be *BodyError
+		if !errors.As(err, &be) || be.Status != tt.status {
+			t.Fatalf("%s: expecting status %d but got %v", tt.body, tt.status, err)
+		}
+	}
+
+	r := httptest.NewRequest("POST", "/users/1", strings.NewReader("name=gopher"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	r.Body = http.MaxBytesReader(w, r.Body, 4)
+	var be *BodyError
+	if err := Bind(r, &p); !errors.As(err, &be) || be.Status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expecting 413 but got %v", err)
+	}
+}
+
+func TestBindInvalidTarget(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	var p bindParams
+	if err := Bind(r, p); err == nil {
+		t.Fatal("expecting error for non-pointer target")
+	}
+}
+
+func TestBindAndValidate(t *testing.T) {
+	var p struct {
+		ID   int64 `path:"id" validate:"min=1"`
+		Page int   `query:"page" validate:"max=100"`
+	}
+	var err error
+	router := api.NewRouter()
+	router.HandleFunc("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		err = BindAndValidate(r, &p)
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/0?page=500", nil))
+
+	var errs validate.Errors
+	if !errors.As(err, &errs) || len(errs) != 2 || errs[0].Field != "id" || errs[1].Field != "page" {
+		t.Fatalf("expecting id and page validation errors but got %v", err)
+	}
+}
+
+func TestBindCodecBody(t *testing.T) {
+	type payload struct {
+		ID   int64  `path:"id"`
+		Name string `json:"name" xml:"name"`
+	}
+
+	var buf bytes.Buffer
+	codec.MsgPack.Encode(&buf, map[string]string{"name": "msgpack"})
+	bodies := map[string]string{
+		"application/xml":     `<payload><name>xml</name></payload>`,
+		"application/msgpack": buf.String(),
+	}
+	for contentType, body := range bodies {
+		r := httptest.NewRequest("POST", "/users/7", strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		var p payload
+		if err := serveBind(r, &p); err != nil {
+			t.Fatalf("%s: %v", contentType, err)
+		}
+		if p.ID != 7 || p.Name == "" || !strings.HasPrefix(contentType, "application/"+p.Name) {
+			t.Fatalf("%s: unexpected result %+v", contentType, p)
+		}
+	}
+
+	r := httptest.NewRequest("POST", "/users/7", strings.NewReader("hello"))
+	r.Header.Set("Content-Type", "text/plain")
+	if err := DecodeBody(r, &struct{}{}); !errors.Is(err, codec.ErrUnsupportedMediaType) {
+		t.Fatalf("expecting unsupported media type but got %v", err)
+	}
+}
+
+func TestDecodeBodyMultipart(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	oldMemory := codec.MultipartMaxMemory
+	codec.MultipartMaxMemory = 1
+	defer func() { codec.MultipartMaxMemory = oldMemory }()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("title", "upload")
+	fw, _ := mw.CreateFormFile("file", "a.txt")
+	fw.Write(bytes.Repeat([]byte("x"), 1024))
+	mw.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var dst struct {
+			Title string                `form:"title"`
+			File  *multipart.FileHeader `form:"file"`
+		}
+		if err := DecodeBody(r, &dst); err != nil {
+			var mbe *http.MaxBytesError
+			if errors.As(err, &mbe) {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+			}
+			return
+		}
+		f, err := dst.File.Open()
+		if err != nil || dst.Title != "upload" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		f.Close()
+	}))
+	post := func() int {
+		resp, err := http.Post(ts.URL, mw.FormDataContentType(), bytes.NewReader(body.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := post(); status != http.StatusOK {
+		t.Fatalf("expecting 200 but got %d", status)
+	}
+
+	oldMax := DefaultMaxMultipartBytes
+	DefaultMaxMultipartBytes = 512
+	defer func() { DefaultMaxMultipartBytes = oldMax }()
+	if status := post(); status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expecting 413 but got %d", status)
+	}
+
+	// 关闭服务器后所有请求都已经结束，临时文件应当已经被删除
+	ts.Close()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("expecting temp files to be removed but got %d", len(entries))
+	}
+}
+
+func TestBindBodyCannotSetSourcedFields(t *testing.T) {
+	type filter struct {
+		Status string `query:"status"`
+		Name   string `json:"name"`
+	}
+	type payload struct {
+		Tenant string  `header:"X-Tenant"`
+		ID     int64   `path:"id"`
+		Role   string  `cookie:"role"`
+		Name   string  `json:"name"`
+		Filter *filter `json:"filter"`
+		bindPage
+	}
+
+	body := `{"Tenant":"evil","ID":1,"Role":"admin","Page":9,"name":"gopher","filter":{"Status":"all","name":"f"}}`
+	r := httptest.NewRequest("POST", "/users/7", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+
+	var p payload
+	if err := serveBind(r, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Tenant != "" || p.Role != "" || p.ID != 7 || p.Page != 1 {
+		t.Fatalf("expecting sourced fields to ignore the body but got %+v", p)
+	}
+	if p.Name != "gopher" || p.Filter == nil || p.Filter.Name != "f" || p.Filter.Status != "" {
+		t.Fatalf("expecting body fields to be bound but got %+v %+v", p, p.Filter)
+	}
+
+	// 请求头存在时仍然使用请求头的值
+	r = httptest.NewRequest("POST", "/users/7", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Tenant", "acme")
+	p = payload{}
+	if err := serveBind(r, &p); err != nil || p.Tenant != "acme" {
+		t.Fatalf("expecting tenant from the header but got %q %v", p.Tenant, err)
+	}
+}
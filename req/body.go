@@ -0,0 +1,63 @@
+package req
+
+import (
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/zhangdapeng520/zdpgo_api/codec"
+)
+
+// DefaultMaxBodyBytes 非 JSON 请求体默认的最大字节数，multipart 表单使用 DefaultMaxMultipartBytes
+var DefaultMaxBodyBytes int64 = 1 << 20
+
+// DefaultMaxMultipartBytes DecodeBody 解码 multipart 表单时默认的最大字节数，包括上传的文件，小于等于 0 时不限制
+var DefaultMaxMultipartBytes int64 = 64 << 20
+
+// DecodeBody 根据 Content-Type 选择 codec 中注册的编解码器解码请求体，
+// JSON 请求体使用 DecodeJSON 解码，没有对应的编解码器时返回 codec.ErrUnsupportedMediaType。
+// multipart 表单保存到 r.MultipartForm 中，上传文件的临时文件在请求结束后由 net/http 删除
+// 注意：dst要传其指针，比如 DecodeBody(r, &user)
+func DecodeBody(r *http.Request, dst interface{}) error {
+	c, params, ok := codec.Lookup(r.Header.Get("Content-Type"))
+	if !ok {
+		return codec.ErrUnsupportedMediaType
+	}
+	if c == codec.JSON {
+		return DecodeJSONWithOpts(r, dst, JSONOpts{AllowAnyContentType: true})
+	}
+	if r.Body == nil {
+		return io.EOF
+	}
+
+	body := requestBody(r)
+	if c == codec.Multipart {
+		return decodeMultipart(r, body, params, dst)
+	}
+	if DefaultMaxBodyBytes > 0 {
+		body = http.MaxBytesReader(nil, body, DefaultMaxBodyBytes)
+	}
+	return c.Decode(body, params, dst)
+}
+
+// decodeMultipart 解析 multipart 表单并保存到 r.MultipartForm，由 net/http 在请求结束后删除临时文件，
+// 与 r.ParseMultipartForm 相同。请求已经解析过表单时直接使用 r.MultipartForm
+func decodeMultipart(r *http.Request, body io.ReadCloser, params map[string]string, dst interface{}) error {
+	if r.MultipartForm != nil {
+		return codec.DecodeMultipartForm(r.MultipartForm, dst)
+	}
+	if DefaultMaxMultipartBytes > 0 {
+		body = http.MaxBytesReader(nil, body, DefaultMaxMultipartBytes)
+	}
+	form := new(multipart.Form)
+	if err := codec.Multipart.Decode(body, params, form); err != nil {
+		return err
+	}
+	r.MultipartForm = form
+	return codec.DecodeMultipartForm(form, dst)
+}
+
+// hasBody 判断请求是否有请求体
+func hasBody(r *http.Request) bool {
+	return r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0
+}
@@ -0,0 +1,93 @@
+package req
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Precondition 条件请求的判断结果
+type Precondition int
+
+const (
+	// PreconditionPassed 条件满足，继续处理请求
+	PreconditionPassed Precondition = iota
+	// PreconditionNotModified 资源没有修改，应该响应 304
+	PreconditionNotModified
+	// PreconditionFailed 条件不满足，应该响应 412
+	PreconditionFailed
+)
+
+// Status 返回对应的状态码，条件满足时返回 0
+func (p Precondition) Status() int {
+	switch p {
+	case PreconditionNotModified:
+		return http.StatusNotModified
+	case PreconditionFailed:
+		return http.StatusPreconditionFailed
+	}
+	return 0
+}
+
+// CheckPreconditions 按照 RFC 9110 13.2.2 的顺序判断 If-Match、If-Unmodified-Since、
+// If-None-Match 和 If-Modified-Since。etag 和 lastModified 是资源的当前版本，
+// 资源不存在时两者都传零值。etag 可以是 "v1"、W/"v1" 或者不带引号的 v1
+func CheckPreconditions(r *http.Request, etag string, lastModified time.Time) Precondition {
+	etag = QuoteETag(etag)
+	exists := etag != "" || !lastModified.IsZero()
+	safe := r.Method == http.MethodGet || r.Method == http.MethodHead
+
+	if im := r.Header.Get("If-Match"); im != "" {
+		if !matchETag(im, etag, exists, false) {
+			return PreconditionFailed
+		}
+	} else if ius := r.Header.Get("If-Unmodified-Since"); ius != "" && !lastModified.IsZero() {
+		if t, err := http.ParseTime(ius); err == nil && lastModified.Truncate(time.Second).After(t) {
+			return PreconditionFailed
+		}
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if matchETag(inm, etag, exists, true) {
+			if safe {
+				return PreconditionNotModified
+			}
+			return PreconditionFailed
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && safe && !lastModified.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil && !lastModified.Truncate(time.Second).After(t) {
+			return PreconditionNotModified
+		}
+	}
+	return PreconditionPassed
+}
+
+// QuoteETag 给没有引号的 ETag 加上引号，空字符串原样返回
+func QuoteETag(etag string) string {
+	if etag == "" || strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
+
+// matchETag 判断请求头中的 ETag 列表是否与 etag 匹配，weak 为 false 时使用强比较，
+// 弱 ETag 不会与任何 ETag 强匹配
+func matchETag(header, etag string, exists, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return exists
+	}
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		} else if !strings.HasPrefix(etag, "W/") && candidate == etag {
+			return true
+		}
+	}
+	return false
+}
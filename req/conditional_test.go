@@ -0,0 +1,58 @@
+package req
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckPreconditions(t *testing.T) {
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	before := modified.Add(-time.Hour).Format(http.TimeFormat)
+	after := modified.Add(time.Hour).Format(http.TimeFormat)
+
+	tests := []struct {
+		method  string
+		headers map[string]string
+		etag    string
+		want    Precondition
+	}{
+		{"GET", nil, "v1", PreconditionPassed},
+		{"GET", map[string]string{"If-None-Match": `"v1"`}, "v1", PreconditionNotModified},
+		{"GET", map[string]string{"If-None-Match": `"v0", W/"v1"`}, `"v1"`, PreconditionNotModified},
+		{"GET", map[string]string{"If-None-Match": `"v0"`}, "v1", PreconditionPassed},
+		{"GET", map[string]string{"If-None-Match": "*"}, "v1", PreconditionNotModified},
+		{"PUT", map[string]string{"If-None-Match": "*"}, "v1", PreconditionFailed},
+		{"PUT", map[string]string{"If-None-Match": "*"}, "", PreconditionPassed},
+		{"PUT", map[string]string{"If-Match": `"v1"`}, "v1", PreconditionPassed},
+		{"PUT", map[string]string{"If-Match": `"v0"`}, "v1", PreconditionFailed},
+		{"PUT", map[string]string{"If-Match": `W/"v1"`}, `W/"v1"`, PreconditionFailed},
+		{"PUT", map[string]string{"If-Match": "*"}, "", PreconditionFailed},
+		{"GET", map[string]string{"If-Modified-Since": after}, "", PreconditionNotModified},
+		{"GET", map[string]string{"If-Modified-Since": before}, "", PreconditionPassed},
+		{"GET", map[string]string{"If-Modified-Since": after, "If-None-Match": `"v0"`}, "v1", PreconditionPassed},
+		{"POST", map[string]string{"If-Modified-Since": after}, "", PreconditionPassed},
+		{"DELETE", map[string]string{"If-Unmodified-Since": before}, "", PreconditionFailed},
+		{"DELETE", map[string]string{"If-Unmodified-Since": after}, "", PreconditionPassed},
+		{"DELETE", map[string]string{"If-Unmodified-Since": before, "If-Match": `"v1"`}, "v1", PreconditionPassed},
+	}
+	for i, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/", nil)
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		// 使用 * 的用例表示资源不存在
+		lastModified := modified
+		if tt.etag == "" && (tt.headers["If-None-Match"] == "*" || tt.headers["If-Match"] == "*") {
+			lastModified = time.Time{}
+		}
+		if got := CheckPreconditions(r, tt.etag, lastModified); got != tt.want {
+			t.Fatalf("%d: expecting %v but got %v", i, tt.want, got)
+		}
+	}
+
+	if PreconditionFailed.Status() != http.StatusPreconditionFailed || PreconditionPassed.Status() != 0 {
+		t.Fatal("unexpected status codes")
+	}
+}
@@ -0,0 +1,230 @@
+package req
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_api/codec"
+)
+
+// DefaultSecureCookieMaxAge 安全 Cookie 默认的有效期
+const DefaultSecureCookieMaxAge = 24 * time.Hour
+
+// maxCookieBytes 浏览器允许的单个 Cookie 的最大字节数
+const maxCookieBytes = 4096
+
+// 安全 Cookie 的错误，Cookie 不存在时返回 http.ErrNoCookie
+var (
+	ErrSecureCookieInvalid  = errors.New("req: secure cookie is invalid")
+	ErrSecureCookieExpired  = errors.New("req: secure cookie has expired")
+	ErrSecureCookieTooLarge = errors.New("req: secure cookie is larger than 4096 bytes")
+	ErrSecureCookieNoKeys   = errors.New("req: secure cookie requires at least one key")
+)
+
+// cookieNow 返回当前时间，测试时可以替换
+var cookieNow = time.Now
+
+// SecureCookieOpts 签名和加密 Cookie 的配置，GetSecureCookie 和 resp.SetSecureCookie 需要使用相同的配置
+type SecureCookieOpts struct {
+	// Keys 密钥，第一个密钥用于签名和加密，其余的密钥只用于验证，轮换密钥时把新密钥放在最前面。
+	// 签名和加密的密钥都从这里派生，建议至少 32 字节
+	Keys [][]byte
+
+	// Encrypt 使用 AES-256-GCM 加密 Cookie 的值，否则只签名
+	Encrypt bool
+
+	// MaxAge 有效期，同时用于 Cookie 的 Max-Age 和签名中的时间戳校验，
+	// 默认 DefaultSecureCookieMaxAge，小于 0 时不校验时间戳并且不设置 Max-Age
+	MaxAge time.Duration
+
+	// Codec 值的编解码器，默认 codec.JSON
+	Codec codec.Codec
+
+	// Path 和 Domain Cookie 的作用范围，Path 默认 /
+	Path   string
+	Domain string
+
+	// SameSite 默认 http.SameSiteLaxMode
+	SameSite http.SameSite
+
+	// DisableSecure 不设置 Secure，只用于本地的 HTTP 开发环境
+	DisableSecure bool
+
+	// DisableHttpOnly 不设置 HttpOnly，允许浏览器中的脚本读取 Cookie
+	DisableHttpOnly bool
+}
+
+func (o SecureCookieOpts) withDefaults() SecureCookieOpts {
+	if o.MaxAge == 0 {
+		o.MaxAge = DefaultSecureCookieMaxAge
+	}
+	if o.Codec == nil {
+		o.Codec = codec.JSON
+	}
+	if o.Path == "" {
+		o.Path = "/"
+	}
+	if o.SameSite == 0 {
+		o.SameSite = http.SameSiteLaxMode
+	}
+	return o
+}
+
+// Cookie 根据配置创建 Cookie，value 是已经编码好的值
+func (o SecureCookieOpts) Cookie(name, value string) *http.Cookie {
+	o = o.withDefaults()
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     o.Path,
+		Domain:   o.Domain,
+		SameSite: o.SameSite,
+		Secure:   !o.DisableSecure,
+		HttpOnly: !o.DisableHttpOnly,
+	}
+	if o.MaxAge > 0 {
+		c.MaxAge = int(o.MaxAge / time.Second)
+		c.Expires = cookieNow().Add(o.MaxAge).UTC()
+	}
+	return c
+}
+
+// GetSecureCookie 读取并验证 resp.SetSecureCookie 设置的 Cookie，解码到 dst 中
+// 注意：dst要传其指针，比如 GetSecureCookie(r, "prefs", &prefs, opts)
+func GetSecureCookie(r *http.Request, name string, dst interface{}, opts SecureCookieOpts) error {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return err
+	}
+	return DecodeSecureCookie(name, c.Value, dst, opts)
+}
+
+// EncodeSecureCookie 编码、签名并加密 Cookie 的值，格式为 base64(时间戳|数据).base64(HMAC-SHA256)。
+// Cookie 的名称也参与签名，值不能被复制到其他 Cookie 中使用
+func EncodeSecureCookie(name string, value interface{}, opts SecureCookieOpts) (string, error) {
+	opts = opts.withDefaults()
+	if len(opts.Keys) == 0 {
+		return "", ErrSecureCookieNoKeys
+	}
+	var buf bytes.Buffer
+	if err := opts.Codec.Encode(&buf, value); err != nil {
+		return "", err
+	}
+	data := buf.Bytes()
+
+	key := opts.Keys[0]
+	if opts.Encrypt {
+		gcm, err := cookieCipher(key)
+		if err != nil {
+			return "", err
+		}
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+		data = gcm.Seal(nonce, nonce, data, []byte(name))
+	}
+
+	payload := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint64(payload, uint64(cookieNow().Unix()))
+	payload = append(payload, data...)
+
+	s := base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(cookieMAC(key, name, payload))
+	if len(name)+len(s)+1 > maxCookieBytes {
+		return "", ErrSecureCookieTooLarge
+	}
+	return s, nil
+}
+
+// DecodeSecureCookie 验证并解码 EncodeSecureCookie 生成的值，依次尝试所有的密钥
+func DecodeSecureCookie(name, s string, dst interface{}, opts SecureCookieOpts) error {
+	opts = opts.withDefaults()
+	if len(opts.Keys) == 0 {
+		return ErrSecureCookieNoKeys
+	}
+	i := strings.IndexByte(s, '.')
+	if i < 0 {
+		return ErrSecureCookieInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(s[:i])
+	if err != nil || len(payload) < 8 {
+		return ErrSecureCookieInvalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(s[i+1:])
+	if err != nil {
+		return ErrSecureCookieInvalid
+	}
+
+	var key []byte
+	for _, k := range opts.Keys {
+		if hmac.Equal(mac, cookieMAC(k, name, payload)) {
+			key = k
+			break
+		}
+	}
+	if key == nil {
+		return ErrSecureCookieInvalid
+	}
+
+	if opts.MaxAge > 0 {
+		issued := time.Unix(int64(binary.BigEndian.Uint64(payload)), 0)
+		now := cookieNow()
+		if issued.After(now.Add(time.Minute)) {
+			return ErrSecureCookieInvalid
+		}
+		if now.Sub(issued) > opts.MaxAge {
+			return ErrSecureCookieExpired
+		}
+	}
+
+	data := payload[8:]
+	if opts.Encrypt {
+		gcm, err := cookieCipher(key)
+		if err != nil {
+			return err
+		}
+		if len(data) < gcm.NonceSize() {
+			return ErrSecureCookieInvalid
+		}
+		data, err = gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(name))
+		if err != nil {
+			return ErrSecureCookieInvalid
+		}
+	}
+	return opts.Codec.Decode(bytes.NewReader(data), nil, dst)
+}
+
+// cookieMAC 计算签名，签名和加密使用从同一个密钥派生的不同密钥
+func cookieMAC(key []byte, name string, payload []byte) []byte {
+	h := hmac.New(sha256.New, deriveCookieKey(key, "sign"))
+	h.Write([]byte(name))
+	h.Write([]byte{'|'})
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+// cookieCipher 创建 AES-256-GCM
+func cookieCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(deriveCookieKey(key, "encrypt"))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// deriveCookieKey 从密钥派生指定用途的 32 字节密钥
+func deriveCookieKey(key []byte, purpose string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte("zdpgo-secure-cookie-" + purpose))
+	return h.Sum(nil)
+}
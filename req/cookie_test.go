@@ -0,0 +1,115 @@
+package req
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_api/codec"
+)
+
+type cookiePrefs struct {
+	Theme string `json:"theme"`
+	Size  int    `json:"size"`
+}
+
+func cookieRequest(c *http.Cookie) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(c)
+	return r
+}
+
+func TestSecureCookie(t *testing.T) {
+	oldKey, newKey := []byte(strings.Repeat("o", 32)), []byte(strings.Repeat("n", 32))
+	for _, encrypt := range []bool{false, true} {
+		opts := SecureCookieOpts{Keys: [][]byte{oldKey}, Encrypt: encrypt}
+		s, err := EncodeSecureCookie("prefs", cookiePrefs{"dark", 3}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload, _ := base64.RawURLEncoding.DecodeString(strings.Split(s, ".")[0])
+		if encrypt == strings.Contains(string(payload), "dark") {
+			t.Fatalf("encrypt=%v: unexpected plaintext visibility in %q", encrypt, s)
+		}
+
+		var got cookiePrefs
+		if err := GetSecureCookie(cookieRequest(opts.Cookie("prefs", s)), "prefs", &got, opts); err != nil || got != (cookiePrefs{"dark", 3}) {
+			t.Fatalf("encrypt=%v: expecting decoded cookie but got %+v, %v", encrypt, got, err)
+		}
+
+		// 轮换密钥后旧的 Cookie 仍然有效
+		rotated := SecureCookieOpts{Keys: [][]byte{newKey, oldKey}, Encrypt: encrypt}
+		if err := DecodeSecureCookie("prefs", s, &got, rotated); err != nil {
+			t.Fatalf("encrypt=%v: expecting rotated keys to verify but got %v", encrypt, err)
+		}
+		if err := DecodeSecureCookie("prefs", s, &got, SecureCookieOpts{Keys: [][]byte{newKey}, Encrypt: encrypt}); !errors.Is(err, ErrSecureCookieInvalid) {
+			t.Fatalf("encrypt=%v: expecting retired key to fail but got %v", encrypt, err)
+		}
+
+		if err := DecodeSecureCookie("other", s, &got, opts); !errors.Is(err, ErrSecureCookieInvalid) {
+			t.Fatalf("encrypt=%v: expecting renamed cookie to fail but got %v", encrypt, err)
+		}
+		tampered := []byte(s)
+		tampered[10] ^= 1
+		if err := DecodeSecureCookie("prefs", string(tampered), &got, opts); !errors.Is(err, ErrSecureCookieInvalid) {
+			t.Fatalf("encrypt=%v: expecting tampered cookie to fail but got %v", encrypt, err)
+		}
+	}
+}
+
+func TestSecureCookieMaxAge(t *testing.T) {
+	defer func() { cookieNow = time.Now }()
+	opts := SecureCookieOpts{Keys: [][]byte{[]byte("secret")}, MaxAge: time.Hour}
+
+	now := time.Now()
+	cookieNow = func() time.Time { return now }
+	s, err := EncodeSecureCookie("prefs", "v", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v string
+	cookieNow = func() time.Time { return now.Add(59 * time.Minute) }
+	if err := DecodeSecureCookie("prefs", s, &v, opts); err != nil || v != "v" {
+		t.Fatalf("expecting valid cookie but got %q, %v", v, err)
+	}
+	cookieNow = func() time.Time { return now.Add(2 * time.Hour) }
+	if err := DecodeSecureCookie("prefs", s, &v, opts); !errors.Is(err, ErrSecureCookieExpired) {
+		t.Fatalf("expecting expired cookie but got %v", err)
+	}
+	opts.MaxAge = -1
+	if err := DecodeSecureCookie("prefs", s, &v, opts); err != nil {
+		t.Fatalf("expecting no expiry check but got %v", err)
+	}
+}
+
+func TestSecureCookieOpts(t *testing.T) {
+	opts := SecureCookieOpts{Keys: [][]byte{[]byte("secret")}, Codec: codec.MsgPack}
+	s, err := EncodeSecureCookie("prefs", cookiePrefs{"light", 1}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got cookiePrefs
+	if err := DecodeSecureCookie("prefs", s, &got, opts); err != nil || got.Theme != "light" {
+		t.Fatalf("expecting pluggable codec to round trip but got %+v, %v", got, err)
+	}
+
+	c := opts.Cookie("prefs", s)
+	if !c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteLaxMode || c.Path != "/" || c.MaxAge != 86400 {
+		t.Fatalf("unexpected default attributes %+v", c)
+	}
+
+	if _, err := EncodeSecureCookie("prefs", strings.Repeat("a", 4096), opts); !errors.Is(err, ErrSecureCookieTooLarge) {
+		t.Fatalf("expecting too large error but got %v", err)
+	}
+	if _, err := EncodeSecureCookie("prefs", "v", SecureCookieOpts{}); !errors.Is(err, ErrSecureCookieNoKeys) {
+		t.Fatalf("expecting no keys error but got %v", err)
+	}
+	if err := GetSecureCookie(httptest.NewRequest("GET", "/", nil), "prefs", &got, opts); !errors.Is(err, http.ErrNoCookie) {
+		t.Fatalf("expecting http.ErrNoCookie but got %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+package req
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxJSONBytes JSON 请求体默认的最大字节数
+var DefaultMaxJSONBytes int64 = 1 << 20
+
+// JSONOpts JSON 请求体的解析配置
+type JSONOpts struct {
+	// MaxBytes 请求体的最大字节数，超出时返回 413 错误，默认 DefaultMaxJSONBytes，小于 0 时不限制
+	MaxBytes int64
+
+	// DisallowUnknownFields 请求体中包含目标结构体中不存在的字段时返回错误
+	DisallowUnknownFields bool
+
+	// UseNumber 将数字解析为 json.Number 而不是 float64
+	UseNumber bool
+
+	// AllowAnyContentType 不检查 Content-Type，默认只接受 application/json 以及 +json 结尾的类型
+	AllowAnyContentType bool
+}
+
+// JSONError JSON 请求体的解析错误
+type JSONError struct {
+	// Status 建议响应的状态码：400、413 或 415
+	Status int
+	// Offset 出错位置的字节偏移，未知时为 -1
+	Offset int64
+	// Field 出错的字段路径，例如 user.age
+	Field string
+	// Msg 便于客户端阅读的错误信息
+	Msg string
+	// Err 原始错误
+	Err error
+}
+
+func (e *JSONError) Error() string {
+	return e.Msg
+}
+
+func (e *JSONError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeJSON 使用默认配置解析 JSON 请求体
+// 注意：dst要传其指针，比如 DecodeJSON(r, &user)
+func DecodeJSON(r *http.Request, dst interface{}) error {
+	return DecodeJSONWithOpts(r, dst, JSONOpts{})
+}
+
+// DecodeJSONWithOpts 解析 JSON 请求体，请求体只能包含一个 JSON 文档，
+// 失败时返回 *JSONError，其中包含出错的字节偏移和字段路径：
+//
+//	var user User
+//	if err := req.DecodeJSONWithOpts(r, &user, req.JSONOpts{DisallowUnknownFields: true}); err != nil {
+//		var je *req.JSONError
+//		errors.As(err, &je)
+//		resp.ErrorMap(w, je.Status, "error", je.Msg)
+//		return
+//	}
+func DecodeJSONWithOpts(r *http.Request, dst interface{}, opts JSONOpts) error {
+	if !opts.AllowAnyContentType {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json") {
+			return &JSONError{
+				Status: http.StatusUnsupportedMediaType,
+				Offset: -1,
+				Msg:    "req: Content-Type must be application/json",
+			}
+		}
+	}
+	if r.Body == nil {
+		return &JSONError{Status: http.StatusBadRequest, Offset: -1, Msg: "req: body must not be empty", Err: io.EOF}
+	}
+
+	maxBytes := opts.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = DefaultMaxJSONBytes
+	}
+	body := requestBody(r)
+	if maxBytes > 0 {
+		body = http.MaxBytesReader(nil, body, maxBytes)
+	}
+
+	cr := &countingReader{r: body}
+	dec := json.NewDecoder(cr)
+	if opts.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if opts.UseNumber {
+		dec.UseNumber()
+	}
+
+	if err := dec.Decode(dst); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return jsonError(err, cr.n)
+		}
+		return jsonError(err, dec.InputOffset())
+	}
+
+	// 请求体中只能有一个 JSON 文档，后面只允许空白字符
+	offset := dec.InputOffset()
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return jsonError(err, offset)
+		}
+		return &JSONError{
+			Status: http.StatusBadRequest,
+			Offset: offset,
+			Msg:    fmt.Sprintf("req: body must contain a single JSON document, found extra data at byte %d", offset),
+			Err:    err,
+		}
+	}
+	return nil
+}
+
+// jsonError 将 encoding/json 的错误转换为 *JSONError
+func jsonError(err error, offset int64) *JSONError {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+		mbe       *http.MaxBytesError
+	)
+	je := &JSONError{Status: http.StatusBadRequest, Offset: offset, Err: err}
+	switch {
+	case errors.As(err, &mbe):
+		je.Status = http.StatusRequestEntityTooLarge
+		je.Offset = -1
+		je.Msg = fmt.Sprintf("req: body must not be larger than %d bytes", mbe.Limit)
+	case errors.As(err, &syntaxErr):
+		je.Offset = syntaxErr.Offset
+		je.Msg = fmt.Sprintf("req: body contains malformed JSON at byte %d: %s", syntaxErr.Offset, syntaxErr.Error())
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		je.Msg = fmt.Sprintf("req: body contains malformed JSON, unexpected end at byte %d", offset)
+	case errors.As(err, &typeErr):
+		je.Offset = typeErr.Offset
+		je.Field = typeErr.Field
+		if typeErr.Field == "" {
+			je.Msg = fmt.Sprintf("req: body contains a JSON %s at byte %d, expecting %s", typeErr.Value, typeErr.Offset, typeErr.Type)
+		} else {
+			je.Msg = fmt.Sprintf("req: field %q at byte %d must be %s, got JSON %s", typeErr.Field, typeErr.Offset, typeErr.Type, typeErr.Value)
+		}
+	case errors.Is(err, io.EOF):
+		je.Offset = -1
+		je.Msg = "req: body must not be empty"
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json 没有为未知字段定义错误类型
+		je.Field = strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		je.Msg = fmt.Sprintf("req: body contains unknown field %q at byte %d", je.Field, offset)
+	default:
+		je.Msg = "req: " + err.Error()
+	}
+	return je
+}
+
+// countingReader 记录已经读取的字节数，用于定位请求体意外结束的位置
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,86 @@
+package req
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type jsonUser struct {
+	Name    string `json:"name"`
+	Age     int    `json:"age"`
+	Profile struct {
+		Score int `json:"score"`
+	} `json:"profile"`
+	Extra interface{} `json:"extra"`
+}
+
+func jsonRequest(body string) *http.Request {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	return r
+}
+
+func TestDecodeJSON(t *testing.T) {
+	var u jsonUser
+	if err := DecodeJSONWithOpts(jsonRequest(`{"name":"gopher","extra":12345678901234567890}`+"\n"), &u, JSONOpts{UseNumber: true}); err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "gopher" {
+		t.Fatalf("expecting name gopher but got %q", u.Name)
+	}
+	if n, ok := u.Extra.(json.Number); !ok || n.String() != "12345678901234567890" {
+		t.Fatalf("expecting json.Number but got %#v", u.Extra)
+	}
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	// encoding/json reports unknown fields at different offsets across Go versions.
+	const anyOffset = -2
+
+	tests := []struct {
+		name   string
+		r      *http.Request
+		opts   JSONOpts
+		status int
+		offset int64
+		field  string
+		msg    string
+	}{
+		{"content type", httptest.NewRequest("POST", "/", strings.NewReader(`{}`)), JSONOpts{}, 415, -1, "", "Content-Type"},
+		{"too large", jsonRequest(`{"name":"` + strings.Repeat("a", 100) + `"}`), JSONOpts{MaxBytes: 64}, 413, -1, "", "64 bytes"},
+		{"syntax", jsonRequest(`{"name":"a",}`), JSONOpts{}, 400, 13, "", "byte 13"},
+		{"truncated", jsonRequest(`{"name":`), JSONOpts{}, 400, 8, "", "unexpected end"},
+		{"type", jsonRequest(`{"profile":{"score":"high"}}`), JSONOpts{}, 400, 26, "profile.score", `"profile.score"`},
+		{"unknown field", jsonRequest(`{"name":"a","admin":true}`), JSONOpts{DisallowUnknownFields: true}, 400, anyOffset, "admin", `"admin"`},
+		{"empty", jsonRequest(``), JSONOpts{}, 400, -1, "", "empty"},
+		{"multiple", jsonRequest(`{"name":"a"} {"name":"b"}`), JSONOpts{}, 400, 12, "", "single JSON document"},
+		{"garbage", jsonRequest(`{"name":"a"}xyz`), JSONOpts{}, 400, 12, "", "single JSON document"},
+	}
+	for _, tt := range tests {
+		var u jsonUser
+		err := DecodeJSONWithOpts(tt.r, &u, tt.opts)
+		var je *JSONError
+		if !errors.As(err, &je) {
+			t.Fatalf("%s: expecting *JSONError but got %v", tt.name, err)
+		}
+		if je.Status != tt.status || (tt.offset != anyOffset && je.Offset != tt.offset) || je.Field != tt.field || !strings.Contains(je.Msg, tt.msg) {
+			t.Fatalf("%s: unexpected error %+v", tt.name, je)
+		}
+	}
+}
+
+func TestGetJsonLimit(t *testing.T) {
+	defer func(n int64) { DefaultMaxJSONBytes = n }(DefaultMaxJSONBytes)
+	DefaultMaxJSONBytes = 16
+
+	var u jsonUser
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"`+strings.Repeat("a", 32)+`"}`))
+	var je *JSONError
+	if err := GetJson(r, &u); !errors.As(err, &je) || je.Status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expecting 413 error but got %v", err)
+	}
+}
@@ -0,0 +1,540 @@
+package req
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 列表查询的默认分页大小
+const (
+	DefaultListSize    = 20
+	DefaultListMaxSize = 100
+)
+
+// FieldType 过滤字段的类型，过滤值会被转换为对应的 Go 类型
+type FieldType int
+
+const (
+	FieldString FieldType = iota // string
+	FieldInt                     // int64
+	FieldFloat                   // float64
+	FieldBool                    // bool
+	FieldTime                    // time.Time，支持 RFC3339 和 2006-01-02
+)
+
+// 过滤表达式支持的运算符
+const (
+	OpEq   = "="
+	OpNe   = "!="
+	OpGt   = ">"
+	OpGte  = ">="
+	OpLt   = "<"
+	OpLte  = "<="
+	OpLike = "~"
+	OpIn   = "in"
+)
+
+// symbolOps 符号运算符，较长的运算符在前
+var symbolOps = []string{OpGte, OpLte, OpNe, OpEq, OpGt, OpLt, OpLike}
+
+// fieldNameRegexp 字段名称的格式
+var fieldNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*`)
+
+// ListSchema 列表查询的字段定义，不在定义中的排序、过滤和选择字段都会被拒绝
+type ListSchema struct {
+	// DefaultSize 默认的分页大小，默认 DefaultListSize
+	DefaultSize int
+
+	// MaxSize 最大的分页大小，超出时返回错误，默认 DefaultListMaxSize
+	MaxSize int
+
+	// Sortable 允许排序的字段
+	Sortable []string
+
+	// DefaultSort 没有 sort 参数时使用的排序，例如 "-created_at,id"
+	DefaultSort string
+
+	// Filters 允许过滤的字段及其类型
+	Filters map[string]FieldType
+
+	// Fields 允许通过 fields 参数选择的字段
+	Fields []string
+
+	// Columns 字段对应的数据库列名，不存在时使用字段名
+	Columns map[string]string
+
+	// Placeholder SQL 参数的占位符，"?" 用于 MySQL 和 SQLite，"$" 表示 PostgreSQL 的 $1、$2，默认 "?"
+	Placeholder string
+}
+
+// SortField 一个排序字段
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// Filter 一个过滤条件，Value 已经按照字段类型转换，in 运算符的值在 Values 中
+type Filter struct {
+	Field  string
+	Op     string
+	Value  interface{}
+	Values []interface{}
+}
+
+// ListQuery 解析后的列表查询
+type ListQuery struct {
+	// Page 页码，从 1 开始，使用游标分页时为 0
+	Page int
+	// Size 分页大小
+	Size int
+	// Offset 偏移量，即 (Page-1)*Size
+	Offset int
+	// Cursor 游标，由上一页的 NextCursor 生成
+	Cursor string
+	// After 从游标中解析出的上一页最后一条数据的排序字段值
+	After []interface{}
+	// Sort 排序字段
+	Sort []SortField
+	// Filters 过滤条件，条件之间是 AND 关系
+	Filters []Filter
+	// Fields 选择返回的字段，为空时返回全部字段
+	Fields []string
+
+	schema ListSchema
+}
+
+// ListQueryError 列表查询参数错误
+type ListQueryError struct {
+	// Param 出错的查询参数，例如 sort、filter
+	Param string
+	// Value 出错的参数值
+	Value string
+	// Msg 错误原因
+	Msg string
+}
+
+func (e *ListQueryError) Error() string {
+	return fmt.Sprintf("req: invalid %s %q: %s", e.Param, e.Value, e.Msg)
+}
+
+// ParseListQuery 解析列表查询的参数：
+//
+//	page=2&size=20                         偏移分页
+//	cursor=eyJ...                          游标分页，游标由 NextCursor 生成
+//	sort=-created_at,name                  多字段排序，- 表示降序
+//	filter=age>=18&filter=name~zhang       过滤，支持 = != > >= < <= ~（包含）以及 in
+//	filter=status in (open,closed)
+//	fields=id,name                         选择返回的字段
+//
+// 参数不符合 schema 时返回 *ListQueryError
+func ParseListQuery(r *http.Request, schema ListSchema) (*ListQuery, error) {
+	if schema.DefaultSize <= 0 {
+		schema.DefaultSize = DefaultListSize
+	}
+	if schema.MaxSize <= 0 {
+		schema.MaxSize = DefaultListMaxSize
+	}
+	if schema.Placeholder == "" {
+		schema.Placeholder = "?"
+	}
+
+	query := r.URL.Query()
+	q := &ListQuery{Page: 1, Size: schema.DefaultSize, schema: schema}
+
+	if s := query.Get("size"); s != "" {
+		size, err := strconv.Atoi(s)
+		if err != nil || size < 1 {
+			return nil, &ListQueryError{"size", s, "must be a positive integer"}
+		}
+		if size > schema.MaxSize {
+			return nil, &ListQueryError{"size", s, fmt.Sprintf("must not be greater than %d", schema.MaxSize)}
+		}
+		q.Size = size
+	}
+	if s := query.Get("page"); s != "" {
+		page, err := strconv.Atoi(s)
+		if err != nil || page < 1 {
+			return nil, &ListQueryError{"page", s, "must be a positive integer"}
+		}
+		q.Page = page
+	}
+
+	sort := query.Get("sort")
+	if sort == "" {
+		sort = schema.DefaultSort
+	}
+	if err := q.parseSort(sort); err != nil {
+		return nil, err
+	}
+
+	for _, expr := range query["filter"] {
+		f, err := parseFilter(expr, schema.Filters)
+		if err != nil {
+			return nil, err
+		}
+		q.Filters = append(q.Filters, f)
+	}
+
+	if s := query.Get("fields"); s != "" {
+		for _, field := range strings.Split(s, ",") {
+			field = strings.TrimSpace(field)
+			if !contains(schema.Fields, field) {
+				return nil, &ListQueryError{"fields", s, fmt.Sprintf("field %q cannot be selected", field)}
+			}
+			q.Fields = append(q.Fields, field)
+		}
+	}
+
+	if s := query.Get("cursor"); s != "" {
+		if err := q.parseCursor(s); err != nil {
+			return nil, err
+		}
+	}
+	// 防止 (Page-1)*Size 溢出
+	if q.Page-1 > math.MaxInt/q.Size {
+		return nil, &ListQueryError{"page", strconv.Itoa(q.Page), "is too large"}
+	}
+	q.Offset = (q.Page - 1) * q.Size
+	return q, nil
+}
+
+// parseSort 解析排序字段
+func (q *ListQuery) parseSort(s string) error {
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		sf := SortField{Field: part}
+		if strings.HasPrefix(part, "-") {
+			sf = SortField{Field: part[1:], Desc: true}
+		} else if strings.HasPrefix(part, "+") {
+			sf.Field = part[1:]
+		}
+		if !contains(q.schema.Sortable, sf.Field) {
+			return &ListQueryError{"sort", s, fmt.Sprintf("field %q is not sortable", sf.Field)}
+		}
+		if seen[sf.Field] {
+			return &ListQueryError{"sort", s, fmt.Sprintf("field %q is repeated", sf.Field)}
+		}
+		seen[sf.Field] = true
+		q.Sort = append(q.Sort, sf)
+	}
+	return nil
+}
+
+// parseFilter 解析一个过滤表达式，例如 age>=18、name~zhang、status in (a,b)
+func parseFilter(expr string, fields map[string]FieldType) (Filter, error) {
+	s := strings.TrimSpace(expr)
+	field := fieldNameRegexp.FindString(s)
+	if field == "" {
+		return Filter{}, &ListQueryError{"filter", expr, "expecting a field name"}
+	}
+	typ, ok := fields[field]
+	if !ok {
+		return Filter{}, &ListQueryError{"filter", expr, fmt.Sprintf("field %q cannot be filtered", field)}
+	}
+	rest := strings.TrimSpace(s[len(field):])
+
+	f := Filter{Field: field}
+	if len(rest) > 2 && strings.EqualFold(rest[:2], OpIn) && (rest[2] == ' ' || rest[2] == '(') {
+		list := strings.TrimSpace(rest[2:])
+		if !strings.HasPrefix(list, "(") || !strings.HasSuffix(list, ")") {
+			return Filter{}, &ListQueryError{"filter", expr, "in expects a list such as (a,b)"}
+		}
+		items := list[1 : len(list)-1]
+		if strings.TrimSpace(items) == "" {
+			return Filter{}, &ListQueryError{"filter", expr, "in expects at least one value"}
+		}
+		f.Op = OpIn
+		for _, item := range strings.Split(items, ",") {
+			v, err := convertFilterValue(strings.TrimSpace(item), typ)
+			if err != nil {
+				return Filter{}, &ListQueryError{"filter", expr, err.Error()}
+			}
+			f.Values = append(f.Values, v)
+		}
+		return f, nil
+	}
+
+	for _, op := range symbolOps {
+		if strings.HasPrefix(rest, op) {
+			f.Op = op
+			rest = strings.TrimSpace(rest[len(op):])
+			break
+		}
+	}
+	if f.Op == "" {
+		return Filter{}, &ListQueryError{"filter", expr, "expecting an operator such as =, !=, >, >=, <, <=, ~ or in"}
+	}
+	if f.Op == OpLike && typ != FieldString {
+		return Filter{}, &ListQueryError{"filter", expr, "~ can only be used on string fields"}
+	}
+	if typ == FieldBool && f.Op != OpEq && f.Op != OpNe {
+		return Filter{}, &ListQueryError{"filter", expr, "boolean fields only support = and !="}
+	}
+	v, err := convertFilterValue(rest, typ)
+	if err != nil {
+		return Filter{}, &ListQueryError{"filter", expr, err.Error()}
+	}
+	f.Value = v
+	return f, nil
+}
+
+// convertFilterValue 将过滤值转换为字段类型
+func convertFilterValue(s string, typ FieldType) (interface{}, error) {
+	switch typ {
+	case FieldInt:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", s)
+		}
+		return n, nil
+	case FieldFloat:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", s)
+		}
+		return f, nil
+	case FieldBool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", s)
+		}
+		return b, nil
+	case FieldTime:
+		for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not a time", s)
+	}
+	return s, nil
+}
+
+// parseCursor 解析游标，游标中保存了上一页最后一条数据的排序字段值
+func (q *ListQuery) parseCursor(s string) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return &ListQueryError{"cursor", s, "malformed cursor"}
+	}
+	// 使用 json.Number 解码，避免大整数被转换为 float64 之后丢失精度或者变成科学计数法
+	var after []interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&after); err != nil || len(after) != len(q.Sort) {
+		return &ListQueryError{"cursor", s, "cursor does not match the sort order"}
+	}
+	for i, sf := range q.Sort {
+		typ, ok := q.schema.Filters[sf.Field]
+		if !ok {
+			after[i] = cursorNumber(after[i])
+			continue
+		}
+		raw, ok := after[i].(string)
+		if n, isNumber := after[i].(json.Number); isNumber {
+			raw, ok = n.String(), true
+		}
+		if !ok {
+			raw = fmt.Sprint(after[i])
+		}
+		v, err := convertFilterValue(raw, typ)
+		if err != nil {
+			return &ListQueryError{"cursor", s, err.Error()}
+		}
+		after[i] = v
+	}
+	q.Cursor = s
+	q.After = after
+	q.Page = 1
+	return nil
+}
+
+// cursorNumber 把没有声明类型的排序字段中的 json.Number 转换为 int64 或者 float64
+func cursorNumber(v interface{}) interface{} {
+	n, ok := v.(json.Number)
+	if !ok {
+		return v
+	}
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	f, _ := n.Float64()
+	return f
+}
+
+// NextCursor 根据当前页最后一条数据的排序字段值生成下一页的游标，values 的顺序与 Sort 相同。
+// 排序字段中应该包含唯一的字段（例如 id），否则游标分页可能会跳过数据
+func (q *ListQuery) NextCursor(values ...interface{}) string {
+	b, _ := json.Marshal(values)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// SQLFragment 根据列表查询生成的 SQL 片段，所有的值都通过参数传递
+type SQLFragment struct {
+	// Select 选择的列，没有 fields 参数时为 *
+	Select string
+	// Where 不包含 WHERE 关键字的条件，没有条件时为空
+	Where string
+	// Args Where 中占位符对应的参数
+	Args []interface{}
+	// OrderBy 不包含 ORDER BY 关键字的排序，没有排序时为空
+	OrderBy string
+	// Limit 和 Offset 分页参数
+	Limit  int
+	Offset int
+}
+
+// SQL 生成 SQL 片段，列名只会来自 ListSchema，值只会出现在参数中：
+//
+//	frag := q.SQL()
+//	query := "SELECT " + frag.Select + " FROM users"
+//	if frag.Where != "" {
+//		query += " WHERE " + frag.Where
+//	}
+//	if frag.OrderBy != "" {
+//		query += " ORDER BY " + frag.OrderBy
+//	}
+//	query += fmt.Sprintf(" LIMIT %d OFFSET %d", frag.Limit, frag.Offset)
+//	rows, err := db.Query(query, frag.Args...)
+func (q *ListQuery) SQL() SQLFragment {
+	frag := SQLFragment{Select: "*", Limit: q.Size, Offset: q.Offset}
+
+	if len(q.Fields) > 0 {
+		cols := make([]string, len(q.Fields))
+		for i, f := range q.Fields {
+			cols[i] = q.column(f)
+		}
+		frag.Select = strings.Join(cols, ", ")
+	}
+
+	var conds []string
+	for _, f := range q.Filters {
+		col := q.column(f.Field)
+		switch f.Op {
+		case OpIn:
+			ph := make([]string, len(f.Values))
+			for i, v := range f.Values {
+				ph[i] = q.placeholder(&frag, v)
+			}
+			conds = append(conds, fmt.Sprintf("%s IN (%s)", col, strings.Join(ph, ", ")))
+		case OpLike:
+			conds = append(conds, fmt.Sprintf(`%s LIKE %s ESCAPE '!'`, col, q.placeholder(&frag, "%"+escapeLike(f.Value.(string))+"%")))
+		case OpNe:
+			conds = append(conds, fmt.Sprintf("%s <> %s", col, q.placeholder(&frag, f.Value)))
+		default:
+			conds = append(conds, fmt.Sprintf("%s %s %s", col, f.Op, q.placeholder(&frag, f.Value)))
+		}
+	}
+
+	// 游标分页：(a > ?) OR (a = ? AND b > ?) ...，降序字段使用 <
+	if len(q.After) > 0 {
+		var ors []string
+		for i, sf := range q.Sort {
+			var ands []string
+			for j := 0; j < i; j++ {
+				ands = append(ands, fmt.Sprintf("%s = %s", q.column(q.Sort[j].Field), q.placeholder(&frag, q.After[j])))
+			}
+			op := ">"
+			if sf.Desc {
+				op = "<"
+			}
+			ands = append(ands, fmt.Sprintf("%s %s %s", q.column(sf.Field), op, q.placeholder(&frag, q.After[i])))
+			ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+		}
+		conds = append(conds, "("+strings.Join(ors, " OR ")+")")
+	}
+	frag.Where = strings.Join(conds, " AND ")
+
+	orders := make([]string, len(q.Sort))
+	for i, sf := range q.Sort {
+		orders[i] = q.column(sf.Field) + " ASC"
+		if sf.Desc {
+			orders[i] = q.column(sf.Field) + " DESC"
+		}
+	}
+	frag.OrderBy = strings.Join(orders, ", ")
+	return frag
+}
+
+// Select 只保留 fields 参数中选择的字段，v 可以是结构体、映射或者它们的切片，
+// 字段名称与 JSON 编码相同。没有 fields 参数时原样返回 v
+func (q *ListQuery) Select(v interface{}) (interface{}, error) {
+	if len(q.Fields) == 0 {
+		return v, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if rv := reflect.Indirect(reflect.ValueOf(v)); rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		var items []map[string]interface{}
+		if err := json.Unmarshal(b, &items); err != nil {
+			return nil, err
+		}
+		for i := range items {
+			items[i] = q.pick(items[i])
+		}
+		return items, nil
+	}
+	var item map[string]interface{}
+	if err := json.Unmarshal(b, &item); err != nil {
+		return nil, err
+	}
+	return q.pick(item), nil
+}
+
+// pick 只保留选择的字段
+func (q *ListQuery) pick(item map[string]interface{}) map[string]interface{} {
+	picked := make(map[string]interface{}, len(q.Fields))
+	for _, f := range q.Fields {
+		if v, ok := item[f]; ok {
+			picked[f] = v
+		}
+	}
+	return picked
+}
+
+// column 返回字段对应的列名
+func (q *ListQuery) column(field string) string {
+	if col, ok := q.schema.Columns[field]; ok {
+		return col
+	}
+	return field
+}
+
+// placeholder 添加参数并返回对应的占位符
+func (q *ListQuery) placeholder(frag *SQLFragment, v interface{}) string {
+	frag.Args = append(frag.Args, v)
+	if q.schema.Placeholder == "$" {
+		return "$" + strconv.Itoa(len(frag.Args))
+	}
+	return q.schema.Placeholder
+}
+
+// escapeLike 使用 ! 转义 LIKE 中的通配符，MySQL 默认的 sql_mode 中反斜杠会转义字符串的引号，
+// 所以不使用反斜杠作为转义字符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`!`, `!!`, `%`, `!%`, `_`, `!_`).Replace(s)
+}
+
+// contains 判断切片中是否包含 s
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
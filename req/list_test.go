@@ -0,0 +1,208 @@
+package req
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var userListSchema = ListSchema{
+	MaxSize:     50,
+	Sortable:    []string{"id", "age", "created_at"},
+	DefaultSort: "-created_at,id",
+	Filters: map[string]FieldType{
+		"id":     FieldInt,
+		"age":    FieldInt,
+		"name":   FieldString,
+		"status": FieldString,
+		"active": FieldBool,
+	},
+	Fields:  []string{"id", "name"},
+	Columns: map[string]string{"created_at": "users.created_at"},
+}
+
+func parseList(t *testing.T, query url.Values, schema ListSchema) (*ListQuery, error) {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/users?"+query.Encode(), nil)
+	return ParseListQuery(r, schema)
+}
+
+func TestParseListQuery(t *testing.T) {
+	q, err := parseList(t, url.Values{
+		"page":   {"3"},
+		"size":   {"10"},
+		"sort":   {"-age,id"},
+		"filter": {"age>=18", "name~zh_ang%", "status in (open, closed)", "active=true"},
+		"fields": {"id,name"},
+	}, userListSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Page != 3 || q.Size != 10 || q.Offset != 20 {
+		t.Fatalf("unexpected pagination %+v", q)
+	}
+	if !reflect.DeepEqual(q.Sort, []SortField{{"age", true}, {"id", false}}) {
+		t.Fatalf("unexpected sort %+v", q.Sort)
+	}
+	if len(q.Filters) != 4 || q.Filters[0].Value != int64(18) || q.Filters[3].Value != true {
+		t.Fatalf("unexpected filters %+v", q.Filters)
+	}
+
+	frag := q.SQL()
+	if frag.Select != "id, name" {
+		t.Fatalf("expecting select id, name but got %q", frag.Select)
+	}
+	wantWhere := `age >= ? AND name LIKE ? ESCAPE '!' AND status IN (?, ?) AND active = ?`
+	if frag.Where != wantWhere {
+		t.Fatalf("expecting %q but got %q", wantWhere, frag.Where)
+	}
+	wantArgs := []interface{}{int64(18), `%zh!_ang!%%`, "open", "closed", true}
+	if !reflect.DeepEqual(frag.Args, wantArgs) {
+		t.Fatalf("expecting %v but got %v", wantArgs, frag.Args)
+	}
+	if frag.OrderBy != "age DESC, id ASC" || frag.Limit != 10 || frag.Offset != 20 {
+		t.Fatalf("unexpected order and paging %+v", frag)
+	}
+}
+
+func TestParseListQueryDefaults(t *testing.T) {
+	q, err := parseList(t, url.Values{}, userListSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Page != 1 || q.Size != DefaultListSize {
+		t.Fatalf("unexpected defaults %+v", q)
+	}
+	if frag := q.SQL(); frag.OrderBy != "users.created_at DESC, id ASC" || frag.Select != "*" || frag.Where != "" {
+		t.Fatalf("unexpected default fragment %+v", frag)
+	}
+}
+
+func TestListQueryLike(t *testing.T) {
+	// ESCAPE 子句不能包含反斜杠，MySQL 默认的 sql_mode 中 '\' 是没有结束的字符串
+	tests := []struct {
+		placeholder, where string
+	}{
+		{"?", `name LIKE ? ESCAPE '!'`},
+		{"$", `name LIKE $1 ESCAPE '!'`},
+	}
+	for _, tt := range tests {
+		schema := userListSchema
+		schema.Placeholder = tt.placeholder
+		q, err := parseList(t, url.Values{"filter": {`name~50%_off!\`}}, schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frag := q.SQL()
+		if frag.Where != tt.where {
+			t.Fatalf("%s: expecting %q but got %q", tt.placeholder, tt.where, frag.Where)
+		}
+		if want := []interface{}{`%50!%!_off!!\%`}; !reflect.DeepEqual(frag.Args, want) {
+			t.Fatalf("%s: expecting %v but got %v", tt.placeholder, want, frag.Args)
+		}
+	}
+}
+
+func TestParseListQueryCursor(t *testing.T) {
+	schema := userListSchema
+	schema.Placeholder = "$"
+	q, err := parseList(t, url.Values{"sort": {"-age,id"}, "filter": {"status=open"}}, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor := q.NextCursor(30, 7)
+
+	q, err = parseList(t, url.Values{"sort": {"-age,id"}, "filter": {"status=open"}, "cursor": {cursor}}, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frag := q.SQL()
+	wantWhere := "status = $1 AND ((age < $2) OR (age = $3 AND id > $4))"
+	if frag.Where != wantWhere {
+		t.Fatalf("expecting %q but got %q", wantWhere, frag.Where)
+	}
+	wantArgs := []interface{}{"open", int64(30), int64(30), int64(7)}
+	if !reflect.DeepEqual(frag.Args, wantArgs) {
+		t.Fatalf("expecting %v but got %v", wantArgs, frag.Args)
+	}
+
+	if _, err := parseList(t, url.Values{"sort": {"id"}, "cursor": {cursor}}, schema); err == nil {
+		t.Fatal("expecting cursor mismatch error")
+	}
+}
+
+func TestParseListQueryCursorLargeKey(t *testing.T) {
+	q, err := parseList(t, url.Values{"sort": {"id"}}, userListSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id int64 = 9007199254740993 // 超出 float64 的精度
+	cursor := q.NextCursor(id)
+
+	q, err = parseList(t, url.Values{"sort": {"id"}, "cursor": {cursor}}, userListSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(q.After, []interface{}{id}) {
+		t.Fatalf("expecting cursor %d but got %v", id, q.After)
+	}
+
+	q, _ = parseList(t, url.Values{"sort": {"id"}}, userListSchema)
+	if q, err = parseList(t, url.Values{"sort": {"id"}, "cursor": {q.NextCursor(1234567)}}, userListSchema); err != nil || q.After[0] != int64(1234567) {
+		t.Fatalf("expecting cursor 1234567 but got %v %v", q, err)
+	}
+}
+
+func TestParseListQueryErrors(t *testing.T) {
+	tests := []struct {
+		query url.Values
+		param string
+		msg   string
+	}{
+		{url.Values{"size": {"51"}}, "size", "greater than 50"},
+		{url.Values{"page": {"0"}}, "page", "positive"},
+		{url.Values{"page": {"9223372036854775807"}, "size": {"50"}}, "page", "too large"},
+		{url.Values{"sort": {"password"}}, "sort", "not sortable"},
+		{url.Values{"sort": {"id,-id"}}, "sort", "repeated"},
+		{url.Values{"filter": {"password=x"}}, "filter", "cannot be filtered"},
+		{url.Values{"filter": {"age~1"}}, "filter", "string fields"},
+		{url.Values{"filter": {"age>=old"}}, "filter", "not an integer"},
+		{url.Values{"filter": {"active>true"}}, "filter", "boolean"},
+		{url.Values{"filter": {"status in open"}}, "filter", "list"},
+		{url.Values{"filter": {"status in()"}}, "filter", "at least one value"},
+		{url.Values{"filter": {"status in ( )"}}, "filter", "at least one value"},
+		{url.Values{"filter": {"name; DROP TABLE users"}}, "filter", "operator"},
+		{url.Values{"fields": {"id,password"}}, "fields", "cannot be selected"},
+		{url.Values{"cursor": {"!!"}}, "cursor", "malformed"},
+	}
+	for _, tt := range tests {
+		_, err := parseList(t, tt.query, userListSchema)
+		var lerr *ListQueryError
+		if !errors.As(err, &lerr) || lerr.Param != tt.param || !strings.Contains(lerr.Msg, tt.msg) {
+			t.Fatalf("%v: expecting %s error containing %q but got %v", tt.query, tt.param, tt.msg, err)
+		}
+	}
+}
+
+func TestListQuerySelect(t *testing.T) {
+	type user struct {
+		ID       int    `json:"id"`
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+	q, err := parseList(t, url.Values{"fields": {"name"}}, userListSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := q.Select([]user{{1, "a", "secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{{"name": "a"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expecting %v but got %v", want, got)
+	}
+}
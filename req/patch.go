@@ -0,0 +1,824 @@
+package req
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// PATCH 请求体的媒体类型
+const (
+	MediaTypeJSONPatch  = "application/json-patch+json"
+	MediaTypeMergePatch = "application/merge-patch+json"
+)
+
+// PatchOp JSON Patch（RFC 6902）中的一个操作
+type PatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Patch 解析后的 PATCH 请求体，Type 为 MediaTypeJSONPatch 时使用 Ops，
+// 为 MediaTypeMergePatch 时使用 Merge
+type Patch struct {
+	Type  string
+	Ops   []PatchOp
+	Merge json.RawMessage
+}
+
+// PatchOpts 应用 PATCH 的配置
+type PatchOpts struct {
+	// Allow 允许修改的路径（JSON Pointer），路径本身及其子路径都允许修改，为空时允许所有路径
+	Allow []string
+
+	// Deny 禁止修改的路径（JSON Pointer），优先于 Allow。路径本身、子路径以及上级路径都禁止修改，
+	// 例如禁止 /profile/secret 时，替换 /profile 或者整个文档同样会被拒绝
+	Deny []string
+}
+
+// PatchError 解析或应用 PATCH 的错误
+type PatchError struct {
+	// Status 建议响应的状态码：400 请求体格式错误，403 路径不允许修改，
+	// 409 test 操作失败，415 媒体类型不支持，422 路径不存在等无法应用的操作
+	Status int
+	// Index 出错的操作下标，Merge Patch 时为 -1
+	Index int
+	// Op 出错的操作
+	Op string
+	// Path 出错的路径
+	Path string
+	// Msg 便于客户端阅读的错误信息
+	Msg string
+	// Expected 和 Actual 为 test 操作失败时期望的值和实际的值
+	Expected interface{}
+	Actual   interface{}
+	// Err 原始错误
+	Err error
+}
+
+func (e *PatchError) Error() string {
+	return e.Msg
+}
+
+func (e *PatchError) Unwrap() error {
+	return e.Err
+}
+
+// ParsePatch 根据 Content-Type 解析 JSON Patch 或者 JSON Merge Patch 请求体，
+// 请求体的大小限制与 DecodeJSON 相同
+func ParsePatch(r *http.Request) (*Patch, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	p := &Patch{Type: mediaType}
+	switch mediaType {
+	case MediaTypeJSONPatch:
+		if err := DecodeJSONWithOpts(r, &p.Ops, JSONOpts{AllowAnyContentType: true}); err != nil {
+			return nil, patchDecodeError(err)
+		}
+		for i, op := range p.Ops {
+			if err := checkPatchOp(i, op); err != nil {
+				return nil, err
+			}
+		}
+	case MediaTypeMergePatch:
+		if err := DecodeJSONWithOpts(r, &p.Merge, JSONOpts{AllowAnyContentType: true}); err != nil {
+			return nil, patchDecodeError(err)
+		}
+	default:
+		return nil, &PatchError{
+			Status: http.StatusUnsupportedMediaType,
+			Index:  -1,
+			Msg:    fmt.Sprintf("req: Content-Type must be %s or %s", MediaTypeJSONPatch, MediaTypeMergePatch),
+		}
+	}
+	return p, nil
+}
+
+// patchDecodeError 将 *JSONError 转换为 *PatchError
+func patchDecodeError(err error) error {
+	pe := &PatchError{Status: http.StatusBadRequest, Index: -1, Msg: err.Error(), Err: err}
+	if je, ok := err.(*JSONError); ok {
+		pe.Status = je.Status
+	}
+	return pe
+}
+
+// checkPatchOp 检查操作的格式
+func checkPatchOp(i int, op PatchOp) error {
+	fail := func(msg string) error {
+		return &PatchError{Status: http.StatusBadRequest, Index: i, Op: op.Op, Path: op.Path, Msg: fmt.Sprintf("req: operation %d: %s", i, msg)}
+	}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return fail(`"value" is required`)
+		}
+	case "move", "copy":
+		if _, err := parsePointer(op.From); err != nil {
+			return fail(err.Error())
+		}
+	case "remove":
+	default:
+		return fail(fmt.Sprintf("unknown op %q", op.Op))
+	}
+	if _, err := parsePointer(op.Path); err != nil {
+		return fail(err.Error())
+	}
+	return nil
+}
+
+// Apply 使用默认配置应用 PATCH
+// 注意：dst要传其指针，比如 patch.Apply(&user)
+func (p *Patch) Apply(dst interface{}) error {
+	return p.ApplyWithOpts(dst, PatchOpts{})
+}
+
+// ApplyWithOpts 将 PATCH 应用到结构体或者 map[string]interface{} 上，
+// 字段名称与 JSON 编码相同，omitempty 省略的字段同样可以修改，json:"-" 和未导出的字段保持不变。
+// 路径和 Merge Patch 的键必须与字段的 JSON 名称完全相同，大小写不同或者不存在的成员返回 422 错误。
+// 任何一个操作失败时 dst 保持不变：
+//
+//	patch, err := req.ParsePatch(r)
+//	...
+//	err = patch.ApplyWithOpts(&user, req.PatchOpts{Deny: []string{"/id", "/password"}})
+//	var pe *req.PatchError
+//	if errors.As(err, &pe) {
+//		resp.ErrorMap(w, pe.Status, "error", pe.Msg)
+//		return
+//	}
+func (p *Patch) ApplyWithOpts(dst interface{}, opts PatchOpts) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("req: Apply expects a non-nil pointer, got %T", dst)
+	}
+
+	doc, err := toJSONDoc(dst)
+	if err != nil {
+		return err
+	}
+	if err := completeJSONDoc(rv, doc); err != nil {
+		return err
+	}
+	switch p.Type {
+	case MediaTypeJSONPatch:
+		doc, err = applyJSONPatch(doc, rv.Elem().Type(), p.Ops, opts)
+	case MediaTypeMergePatch:
+		doc, err = applyMergePatch(doc, rv.Elem().Type(), p.Merge, opts)
+	default:
+		return &PatchError{Status: http.StatusUnsupportedMediaType, Index: -1, Msg: fmt.Sprintf("req: unsupported patch type %q", p.Type)}
+	}
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	// 先解码到 dst 的副本中，成功后再替换 dst。副本保留 json:"-" 和未导出的字段，
+	// 只清空参与编码的字段，被删除的字段因此恢复为零值
+	fresh := reflect.New(rv.Elem().Type())
+	fresh.Elem().Set(rv.Elem())
+	resetJSONValue(fresh.Elem(), doc)
+	if err := json.Unmarshal(b, fresh.Interface()); err != nil {
+		return &PatchError{Status: http.StatusUnprocessableEntity, Index: -1, Msg: fmt.Sprintf("req: patched document is invalid: %v", err), Err: err}
+	}
+	rv.Elem().Set(fresh.Elem())
+	return nil
+}
+
+// toJSONDoc 将值转换为通用的 JSON 文档，数字使用 json.Number 以保留精度
+func toJSONDoc(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSONDoc(b)
+}
+
+// patchField 结构体中参与 JSON 编码的字段
+type patchField struct {
+	index    int
+	name     string
+	quoted   bool // 指定了 ,string 选项
+	embedded bool // 没有指定名称的嵌入结构体，字段提升到上级对象中
+}
+
+// patchFields 按照 encoding/json 的规则返回结构体中参与编码的字段，不考虑 omitempty
+func patchFields(t reflect.Type) []patchField {
+	var fields []patchField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && (sf.IsExported() || sf.Type.Kind() == reflect.Struct) {
+				fields = append(fields, patchField{index: i, embedded: true})
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, patchField{index: i, name: name, quoted: strings.Contains(","+opts+",", ",string,")})
+	}
+	return fields
+}
+
+// customJSON 判断类型是否自定义了 JSON 编解码，这些类型的文档结构与字段无关
+func customJSON(t reflect.Type) bool {
+	pt := reflect.PointerTo(t)
+	for _, iface := range []reflect.Type{
+		reflect.TypeOf((*json.Marshaler)(nil)).Elem(),
+		reflect.TypeOf((*json.Unmarshaler)(nil)).Elem(),
+		reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem(),
+		reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem(),
+	} {
+		if t.Implements(iface) || pt.Implements(iface) {
+			return true
+		}
+	}
+	return false
+}
+
+// completeJSONDoc 补全 json.Marshal 因为 omitempty 省略的结构体字段，
+// 使 replace 和 test 能够找到当前为零值的字段
+func completeJSONDoc(v reflect.Value, doc interface{}) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		obj, ok := doc.(map[string]interface{})
+		if !ok || customJSON(v.Type()) {
+			return nil
+		}
+		for _, f := range patchFields(v.Type()) {
+			fv := v.Field(f.index)
+			if f.embedded {
+				if err := completeJSONDoc(fv, obj); err != nil {
+					return err
+				}
+				continue
+			}
+			item, ok := obj[f.name]
+			if !ok {
+				if !fv.CanInterface() {
+					continue
+				}
+				b, err := json.Marshal(fv.Interface())
+				if err != nil {
+					return err
+				}
+				if f.quoted && quotable(fv.Kind()) {
+					b, _ = json.Marshal(string(b))
+				}
+				if item, err = decodeJSONDoc(b); err != nil {
+					return err
+				}
+				obj[f.name] = item
+			}
+			if err := completeJSONDoc(fv, item); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := doc.([]interface{})
+		if !ok || len(arr) != v.Len() {
+			return nil
+		}
+		for i := range arr {
+			if err := completeJSONDoc(v.Index(i), arr[i]); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		obj, ok := doc.(map[string]interface{})
+		if !ok || v.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			if item, ok := obj[iter.Key().String()]; ok {
+				if err := completeJSONDoc(iter.Value(), item); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// quotable 判断 ,string 选项是否对该类型生效
+func quotable(k reflect.Kind) bool {
+	switch k {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// resetJSONValue 清空 v 中参与 JSON 编码的字段，json:"-" 和未导出的字段保持不变。
+// 修改后的文档中仍然是对象的结构体字段递归处理，其他字段直接清空，由随后的解码重新赋值，
+// 因此被删除的字段恢复为零值，map 和切片也不会与原来的值共享
+func resetJSONValue(v reflect.Value, doc interface{}) {
+	if v.Kind() != reflect.Struct || customJSON(v.Type()) {
+		v.Set(reflect.Zero(v.Type()))
+		return
+	}
+	obj, _ := doc.(map[string]interface{})
+	for _, f := range patchFields(v.Type()) {
+		fv := v.Field(f.index)
+		if f.embedded {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				// 复制嵌入的指针，避免解码时修改原来的值
+				p := reflect.New(fv.Type().Elem())
+				p.Elem().Set(fv.Elem())
+				fv.Set(p)
+				fv = p.Elem()
+			}
+			resetJSONValue(fv, obj)
+			continue
+		}
+		if !fv.CanSet() {
+			continue
+		}
+		item, ok := obj[f.name].(map[string]interface{})
+		switch {
+		case ok && fv.Kind() == reflect.Struct:
+			resetJSONValue(fv, item)
+		case ok && fv.Kind() == reflect.Ptr && !fv.IsNil() && fv.Type().Elem().Kind() == reflect.Struct:
+			p := reflect.New(fv.Type().Elem())
+			p.Elem().Set(fv.Elem())
+			resetJSONValue(p.Elem(), item)
+			fv.Set(p)
+		default:
+			fv.Set(reflect.Zero(fv.Type()))
+		}
+	}
+}
+
+// decodeJSONDoc 解码 JSON 文档
+func decodeJSONDoc(b []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// applyJSONPatch 依次执行 JSON Patch 中的操作
+func applyJSONPatch(doc interface{}, t reflect.Type, ops []PatchOp, opts PatchOpts) (interface{}, error) {
+	for i, op := range ops {
+		if err := checkPatchOp(i, op); err != nil {
+			return nil, err
+		}
+		fail := func(status int, msg string) *PatchError {
+			return &PatchError{Status: status, Index: i, Op: op.Op, Path: op.Path, Msg: fmt.Sprintf("req: operation %d (%s %s): %s", i, op.Op, op.Path, msg)}
+		}
+
+		// test 和 copy 会读取数据，也需要检查路径，避免泄露禁止访问的字段
+		paths := []string{op.Path}
+		if op.Op == "move" || op.Op == "copy" {
+			paths = append(paths, op.From)
+		}
+		for _, path := range paths {
+			tokens, _ := parsePointer(path)
+			if err := resolvePath(t, tokens); err != nil {
+				return nil, fail(http.StatusUnprocessableEntity, err.Error())
+			}
+		}
+		for _, path := range paths {
+			if !opts.allowed(path) {
+				return nil, fail(http.StatusForbidden, fmt.Sprintf("path %q is not allowed", path))
+			}
+		}
+
+		var value interface{}
+		if op.Value != nil {
+			v, err := decodeJSONDoc(op.Value)
+			if err != nil {
+				return nil, fail(http.StatusBadRequest, err.Error())
+			}
+			value = v
+		}
+
+		path, _ := parsePointer(op.Path)
+		var err error
+		switch op.Op {
+		case "add":
+			doc, err = pointerAdd(doc, path, value)
+		case "remove":
+			doc, _, err = pointerRemove(doc, path)
+		case "replace":
+			if _, err = pointerGet(doc, path); err == nil {
+				doc, _, err = pointerRemove(doc, path)
+				if err == nil {
+					doc, err = pointerAdd(doc, path, value)
+				}
+			}
+		case "move":
+			from, _ := parsePointer(op.From)
+			if op.Path != op.From && strings.HasPrefix(op.Path, op.From+"/") {
+				return nil, fail(http.StatusUnprocessableEntity, "cannot move a value into one of its children")
+			}
+			var moved interface{}
+			if doc, moved, err = pointerRemove(doc, from); err == nil {
+				doc, err = pointerAdd(doc, path, moved)
+			}
+		case "copy":
+			from, _ := parsePointer(op.From)
+			var copied interface{}
+			if copied, err = pointerGet(doc, from); err == nil {
+				doc, err = pointerAdd(doc, path, deepCopyJSON(copied))
+			}
+		case "test":
+			actual, gerr := pointerGet(doc, path)
+			if gerr != nil {
+				return nil, fail(http.StatusConflict, gerr.Error())
+			}
+			if !equalJSON(actual, value) {
+				pe := fail(http.StatusConflict, "test failed")
+				pe.Expected = value
+				pe.Actual = actual
+				return nil, pe
+			}
+		}
+		if err != nil {
+			return nil, fail(http.StatusUnprocessableEntity, err.Error())
+		}
+	}
+	return doc, nil
+}
+
+// applyMergePatch 执行 JSON Merge Patch：null 删除字段，对象递归合并，其他值直接替换
+func applyMergePatch(doc interface{}, t reflect.Type, raw json.RawMessage, opts PatchOpts) (interface{}, error) {
+	patch, err := decodeJSONDoc(raw)
+	if err != nil {
+		return nil, &PatchError{Status: http.StatusBadRequest, Index: -1, Msg: err.Error(), Err: err}
+	}
+	paths, err := mergePaths(patch, doc, t, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		if !opts.allowed(path) {
+			return nil, &PatchError{Status: http.StatusForbidden, Index: -1, Path: path, Msg: fmt.Sprintf("req: path %q is not allowed", path)}
+		}
+	}
+	return mergePatch(doc, patch), nil
+}
+
+// mergePaths 返回 Merge Patch 会修改的所有叶子路径。null 和非对象的值会删除或替换整个子树，
+// 因此返回它们自身的路径，由 allowed 按照上级路径检查。空对象合并到对象中不会修改任何值，
+// 只有目标不是对象时才会替换原来的值。每一层的键都必须是 t 中的字段，否则返回 422 错误
+func mergePaths(patch, target interface{}, t reflect.Type, prefix string) ([]string, error) {
+	obj, ok := patch.(map[string]interface{})
+	if !ok {
+		return []string{prefix}, nil
+	}
+	targetObj, isObj := target.(map[string]interface{})
+	if len(obj) == 0 {
+		if isObj {
+			return nil, nil
+		}
+		return []string{prefix}, nil
+	}
+	var paths []string
+	for k, v := range obj {
+		path := prefix + "/" + escapePointer(k)
+		mt, err := memberType(t, k)
+		if err != nil {
+			return nil, &PatchError{Status: http.StatusUnprocessableEntity, Index: -1, Path: path, Msg: fmt.Sprintf("req: path %q: %v", path, err)}
+		}
+		sub, err := mergePaths(v, targetObj[k], mt, path)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, sub...)
+	}
+	return paths, nil
+}
+
+// mergePatch 按照 RFC 7396 合并
+func mergePatch(target, patch interface{}) interface{} {
+	obj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for k, v := range obj {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+// resolvePath 检查路径经过的每个结构体成员都是参与 JSON 编码的字段，并且名称与 JSON 编码完全相同。
+// json.Unmarshal 匹配字段名时不区分大小写，不检查时 /role 可以绕过对 /Role 的限制，
+// 不存在的成员也会在解码时被忽略
+func resolvePath(t reflect.Type, path []string) error {
+	for _, token := range path {
+		var err error
+		if t, err = memberType(t, token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// memberType 返回成员的类型，t 为 nil、interface 或者自定义了 JSON 编解码的类型时不再检查，返回 nil
+func memberType(t reflect.Type, token string) (reflect.Type, error) {
+	if t == nil {
+		return nil, nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if customJSON(t) {
+		return nil, nil
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if ft, ok := structMember(t, token); ok {
+			return ft, nil
+		}
+		return nil, fmt.Errorf("member %q does not exist", token)
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return t.Elem(), nil
+	}
+	return nil, nil
+}
+
+// structMember 按照 JSON 名称查找结构体字段，包括嵌入结构体中提升的字段
+func structMember(t reflect.Type, name string) (reflect.Type, bool) {
+	for _, f := range patchFields(t) {
+		sf := t.Field(f.index)
+		if !f.embedded {
+			if f.name == name {
+				return sf.Type, true
+			}
+			continue
+		}
+		et := sf.Type
+		if et.Kind() == reflect.Ptr {
+			et = et.Elem()
+		}
+		if ft, ok := structMember(et, name); ok {
+			return ft, true
+		}
+	}
+	return nil, false
+}
+
+// allowed 判断路径是否允许修改，修改禁止路径的上级路径也会修改禁止路径本身
+func (o PatchOpts) allowed(path string) bool {
+	for _, deny := range o.Deny {
+		if pointerWithin(path, deny) || pointerWithin(deny, path) {
+			return false
+		}
+	}
+	if len(o.Allow) == 0 {
+		return true
+	}
+	for _, allow := range o.Allow {
+		if pointerWithin(path, allow) {
+			return true
+		}
+	}
+	return false
+}
+
+// pointerWithin 判断 path 是否为 prefix 本身或者其子路径
+func pointerWithin(path, prefix string) bool {
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// parsePointer 解析 JSON Pointer（RFC 6901），空字符串表示整个文档
+func parsePointer(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(s, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", s)
+	}
+	tokens := strings.Split(s[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+// escapePointer 转义 JSON Pointer 中的一段
+func escapePointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
+
+// pointerGet 获取路径对应的值
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	cur := doc
+	for _, token := range path {
+		switch c := cur.(type) {
+		case map[string]interface{}:
+			v, ok := c[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q does not exist", token)
+			}
+			cur = v
+		case []interface{}:
+			i, err := arrayIndex(token, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			cur = c[i]
+		default:
+			return nil, fmt.Errorf("cannot traverse into %q", token)
+		}
+	}
+	return cur, nil
+}
+
+// pointerAdd 在路径上添加值，数组中的 - 表示追加到末尾，返回新的文档
+func pointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		c[last] = value
+		return doc, nil
+	case []interface{}:
+		i := len(c)
+		if last != "-" {
+			if i, err = arrayIndex(last, len(c)); err != nil {
+				return nil, err
+			}
+		}
+		arr := append(c[:i:i], append([]interface{}{value}, c[i:]...)...)
+		return setParent(doc, path[:len(path)-1], arr)
+	}
+	return nil, fmt.Errorf("cannot add to %q", last)
+}
+
+// pointerRemove 删除路径上的值，返回新的文档和被删除的值
+func pointerRemove(doc interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, nil, err
+	}
+	last := path[len(path)-1]
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		v, ok := c[last]
+		if !ok {
+			return nil, nil, fmt.Errorf("member %q does not exist", last)
+		}
+		delete(c, last)
+		return doc, v, nil
+	case []interface{}:
+		i, err := arrayIndex(last, len(c)-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		v := c[i]
+		arr := append(c[:i:i], c[i+1:]...)
+		doc, err = setParent(doc, path[:len(path)-1], arr)
+		return doc, v, err
+	}
+	return nil, nil, fmt.Errorf("cannot remove %q", last)
+}
+
+// setParent 替换路径上的数组，数组长度变化后需要写回到父节点中
+func setParent(doc interface{}, path []string, arr []interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return arr, nil
+	}
+	parent, err := pointerGet(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		c[last] = arr
+	case []interface{}:
+		i, _ := arrayIndex(last, len(c)-1)
+		c[i] = arr
+	}
+	return doc, nil
+}
+
+// arrayIndex 解析数组下标，下标不能有前导零且不能超过 max
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if i > max {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+// deepCopyJSON 深拷贝 JSON 文档
+func deepCopyJSON(v interface{}) interface{} {
+	switch c := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(c))
+		for k, item := range c {
+			m[k] = deepCopyJSON(item)
+		}
+		return m
+	case []interface{}:
+		arr := make([]interface{}, len(c))
+		for i, item := range c {
+			arr[i] = deepCopyJSON(item)
+		}
+		return arr
+	}
+	return v
+}
+
+// equalJSON 按照 JSON 的语义比较两个值，1 和 1.0 相等
+func equalJSON(a, b interface{}) bool {
+	switch x := a.(type) {
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		rx, okx := new(big.Rat).SetString(x.String())
+		ry, oky := new(big.Rat).SetString(y.String())
+		return okx && oky && rx.Cmp(ry) == 0
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			w, ok := y[k]
+			if !ok || !equalJSON(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equalJSON(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
@@ -0,0 +1,314 @@
+package req
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type patchUser struct {
+	ID      int               `json:"id"`
+	Name    string            `json:"name"`
+	Email   *string           `json:"email"`
+	Tags    []string          `json:"tags"`
+	Address map[string]string `json:"address,omitempty"`
+}
+
+func patchRequest(contentType, body string) *http.Request {
+	r := httptest.NewRequest("PATCH", "/users/1", strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	return r
+}
+
+func applyPatch(t *testing.T, contentType, body string, dst interface{}, opts PatchOpts) error {
+	t.Helper()
+	p, err := ParsePatch(patchRequest(contentType, body))
+	if err != nil {
+		return err
+	}
+	return p.ApplyWithOpts(dst, opts)
+}
+
+func TestJSONPatch(t *testing.T) {
+	email := "a@example.com"
+	u := patchUser{ID: 1, Name: "a", Email: &email, Tags: []string{"x", "y"}}
+	err := applyPatch(t, MediaTypeJSONPatch, `[
+		{"op":"test","path":"/name","value":"a"},
+		{"op":"replace","path":"/name","value":"b"},
+		{"op":"remove","path":"/email"},
+		{"op":"add","path":"/tags/1","value":"z"},
+		{"op":"add","path":"/tags/-","value":"w"},
+		{"op":"move","from":"/tags/0","path":"/tags/-"},
+		{"op":"add","path":"/address","value":{"a~/b":"c"}},
+		{"op":"copy","from":"/address/a~0~1b","path":"/address/city"}
+	]`, &u, PatchOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := patchUser{ID: 1, Name: "b", Tags: []string{"z", "y", "w", "x"}, Address: map[string]string{"a~/b": "c", "city": "c"}}
+	if !reflect.DeepEqual(u, want) {
+		t.Fatalf("expecting %+v but got %+v", want, u)
+	}
+}
+
+func TestJSONPatchTestFailed(t *testing.T) {
+	u := patchUser{ID: 1, Name: "a"}
+	err := applyPatch(t, MediaTypeJSONPatch, `[{"op":"replace","path":"/name","value":"b"},{"op":"test","path":"/id","value":2}]`, &u, PatchOpts{})
+	var pe *PatchError
+	if !errors.As(err, &pe) || pe.Status != http.StatusConflict || pe.Index != 1 || pe.Path != "/id" {
+		t.Fatalf("expecting test failure but got %#v", err)
+	}
+	if pe.Expected != json.Number("2") || pe.Actual != json.Number("1") {
+		t.Fatalf("expecting expected 2 and actual 1 but got %v and %v", pe.Expected, pe.Actual)
+	}
+	if u.Name != "a" {
+		t.Fatalf("expecting unchanged value after failure but got %q", u.Name)
+	}
+
+	if err := applyPatch(t, MediaTypeJSONPatch, `[{"op":"test","path":"/id","value":1.0}]`, &u, PatchOpts{}); err != nil {
+		t.Fatalf("expecting 1 and 1.0 to be equal but got %v", err)
+	}
+}
+
+func TestJSONPatchErrors(t *testing.T) {
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`[{"op":"jump","path":"/name"}]`, http.StatusBadRequest},
+		{`[{"op":"add","path":"/name"}]`, http.StatusBadRequest},
+		{`[{"op":"add","path":"name","value":1}]`, http.StatusBadRequest},
+		{`[{"op":"remove","path":"/missing"}]`, http.StatusUnprocessableEntity},
+		{`[{"op":"add","path":"/tags/5","value":"x"}]`, http.StatusUnprocessableEntity},
+		{`[{"op":"add","path":"/tags/01","value":"x"}]`, http.StatusUnprocessableEntity},
+		{`[{"op":"move","from":"/address","path":"/address/a"}]`, http.StatusUnprocessableEntity},
+		{`[{"op":"replace","path":"/id","value":"x"}]`, http.StatusUnprocessableEntity},
+		{`{"name":"x"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		u := patchUser{ID: 1, Tags: []string{"a"}, Address: map[string]string{"a": "b"}}
+		err := applyPatch(t, MediaTypeJSONPatch, tt.body, &u, PatchOpts{})
+		var pe *PatchError
+		if !errors.As(err, &pe) || pe.Status != tt.status {
+			t.Fatalf("%s: expecting status %d but got %v", tt.body, tt.status, err)
+		}
+	}
+
+	var pe *PatchError
+	if _, err := ParsePatch(patchRequest("application/json", `{}`)); !errors.As(err, &pe) || pe.Status != http.StatusUnsupportedMediaType {
+		t.Fatalf("expecting 415 but got %v", err)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	email := "a@example.com"
+	u := patchUser{ID: 1, Name: "a", Email: &email, Address: map[string]string{"city": "x", "zip": "1"}}
+	err := applyPatch(t, MediaTypeMergePatch, `{"name":"b","email":null,"address":{"zip":null,"street":"s"}}`, &u, PatchOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := patchUser{ID: 1, Name: "b", Address: map[string]string{"city": "x", "street": "s"}}
+	if !reflect.DeepEqual(u, want) {
+		t.Fatalf("expecting %+v but got %+v", want, u)
+	}
+
+	m := map[string]interface{}{"a": "b", "c": map[string]interface{}{"d": "e"}}
+	if err := applyPatch(t, MediaTypeMergePatch, `{"a":null,"c":{"f":1}}`, &m, PatchOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	wantMap := map[string]interface{}{"c": map[string]interface{}{"d": "e", "f": float64(1)}}
+	if !reflect.DeepEqual(m, wantMap) {
+		t.Fatalf("expecting %v but got %v", wantMap, m)
+	}
+}
+
+func TestPatchPathRules(t *testing.T) {
+	opts := PatchOpts{Allow: []string{"/name", "/address"}, Deny: []string{"/address/zip"}}
+	tests := []struct {
+		contentType, body string
+		forbidden         bool
+	}{
+		{MediaTypeMergePatch, `{"name":"b","address":{"city":"x"}}`, false},
+		{MediaTypeMergePatch, `{"id":2}`, true},
+		{MediaTypeMergePatch, `{"address":{"zip":"2"}}`, true},
+		{MediaTypeMergePatch, `{"address":null}`, true},
+		{MediaTypeMergePatch, `{"address":{}}`, false},
+		{MediaTypeMergePatch, `{}`, false},
+		{MediaTypeMergePatch, `{"address":{"city":null}}`, false},
+		{MediaTypeJSONPatch, `[{"op":"replace","path":"/name","value":"b"}]`, false},
+		{MediaTypeJSONPatch, `[{"op":"replace","path":"/id","value":2}]`, true},
+		{MediaTypeJSONPatch, `[{"op":"copy","from":"/email","path":"/name"}]`, true},
+		{MediaTypeJSONPatch, `[{"op":"test","path":"/address/zip","value":"1"}]`, true},
+		{MediaTypeJSONPatch, `[{"op":"replace","path":"/address","value":{"zip":"2"}}]`, true},
+		{MediaTypeJSONPatch, `[{"op":"add","path":"/address/city","value":"x"}]`, false},
+	}
+	for _, tt := range tests {
+		u := patchUser{ID: 1, Address: map[string]string{"zip": "1"}}
+		err := applyPatch(t, tt.contentType, tt.body, &u, opts)
+		var pe *PatchError
+		forbidden := errors.As(err, &pe) && pe.Status == http.StatusForbidden
+		if forbidden != tt.forbidden || (!tt.forbidden && err != nil) {
+			t.Fatalf("%s: expecting forbidden=%v but got %v", tt.body, tt.forbidden, err)
+		}
+	}
+}
+
+func TestPatchDenyAncestors(t *testing.T) {
+	type profile struct {
+		Secret string `json:"secret"`
+		Bio    string `json:"bio"`
+	}
+	type account struct {
+		Name    string  `json:"name"`
+		Role    string  `json:"role"`
+		Profile profile `json:"profile"`
+	}
+	opts := PatchOpts{Deny: []string{"/role", "/profile/secret"}}
+	tests := []struct {
+		contentType, body string
+		forbidden         bool
+	}{
+		// 替换整个文档
+		{MediaTypeJSONPatch, `[{"op":"replace","path":"","value":{"name":"a","role":"admin"}}]`, true},
+		// 替换上级路径
+		{MediaTypeJSONPatch, `[{"op":"replace","path":"/profile","value":{"secret":"x"}}]`, true},
+		{MediaTypeJSONPatch, `[{"op":"remove","path":"/profile"}]`, true},
+		{MediaTypeJSONPatch, `[{"op":"copy","from":"/profile","path":"/name"}]`, true},
+		{MediaTypeJSONPatch, `[{"op":"replace","path":"/profile/bio","value":"b"}]`, false},
+		// Merge Patch 删除上级路径
+		{MediaTypeMergePatch, `{"profile":null}`, true},
+		{MediaTypeMergePatch, `{"profile":{"bio":"b"}}`, false},
+		{MediaTypeMergePatch, `"role"`, true},
+		// 空对象替换不是对象的字段
+		{MediaTypeMergePatch, `{"role":{}}`, true},
+		{MediaTypeMergePatch, `{"profile":{}}`, false},
+	}
+	for _, tt := range tests {
+		a := account{Name: "a", Role: "user", Profile: profile{Secret: "s"}}
+		err := applyPatch(t, tt.contentType, tt.body, &a, opts)
+		var pe *PatchError
+		forbidden := errors.As(err, &pe) && pe.Status == http.StatusForbidden
+		if forbidden != tt.forbidden || (!tt.forbidden && err != nil) {
+			t.Errorf("%s: expecting forbidden=%v but got %v", tt.body, tt.forbidden, err)
+		}
+		if a.Role != "user" || a.Profile.Secret != "s" {
+			t.Errorf("%s: denied fields were modified: %+v", tt.body, a)
+		}
+	}
+}
+
+func TestPatchKeepsHiddenFields(t *testing.T) {
+	type profile struct {
+		Bio   string `json:"bio"`
+		Token string `json:"-"`
+	}
+	type account struct {
+		Name         string `json:"name"`
+		PasswordHash string `json:"-"`
+		internal     int
+		Profile      profile  `json:"profile"`
+		Extra        *profile `json:"extra"`
+		Tags         []string `json:"tags"`
+	}
+	extra := &profile{Bio: "e", Token: "u"}
+	a := account{Name: "a", PasswordHash: "h", internal: 1, Profile: profile{Bio: "b", Token: "t"}, Extra: extra, Tags: []string{"x"}}
+	err := applyPatch(t, MediaTypeJSONPatch, `[
+		{"op":"replace","path":"/name","value":"b"},
+		{"op":"replace","path":"/profile/bio","value":"c"},
+		{"op":"replace","path":"/extra/bio","value":"f"},
+		{"op":"remove","path":"/tags"}
+	]`, &a, PatchOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := account{Name: "b", PasswordHash: "h", internal: 1, Profile: profile{Bio: "c", Token: "t"}, Extra: &profile{Bio: "f", Token: "u"}}
+	if !reflect.DeepEqual(a, want) {
+		t.Fatalf("expecting %+v but got %+v", want, a)
+	}
+	if extra.Bio != "e" {
+		t.Fatalf("expecting the original pointer to be unchanged but got %+v", extra)
+	}
+
+	if err := applyPatch(t, MediaTypeMergePatch, `{"name":"c","profile":null}`, &a, PatchOpts{}); err != nil {
+		t.Fatal(err)
+	}
+	if a.Name != "c" || a.PasswordHash != "h" || a.internal != 1 || a.Profile != (profile{}) {
+		t.Fatalf("expecting hidden fields to be kept and profile to be removed but got %+v", a)
+	}
+}
+
+func TestPatchOmitEmptyFields(t *testing.T) {
+	type account struct {
+		Name  string `json:"name"`
+		Nick  string `json:"nick,omitempty"`
+		Count int    `json:"count,omitempty,string"`
+		Meta  struct {
+			Note string `json:"note,omitempty"`
+		} `json:"meta"`
+	}
+	var a account
+	err := applyPatch(t, MediaTypeJSONPatch, `[
+		{"op":"test","path":"/nick","value":""},
+		{"op":"replace","path":"/nick","value":"n"},
+		{"op":"test","path":"/count","value":"0"},
+		{"op":"replace","path":"/meta/note","value":"x"}
+	]`, &a, PatchOpts{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Nick != "n" || a.Meta.Note != "x" || a.Count != 0 {
+		t.Fatalf("expecting omitempty fields to be patched but got %+v", a)
+	}
+}
+
+func TestPatchMemberNames(t *testing.T) {
+	type account struct {
+		ID      int
+		Role    string
+		Profile struct {
+			Nick string `json:"nickName"`
+		}
+		Extra map[string]string
+	}
+	opts := PatchOpts{Deny: []string{"/Role", "/Profile/nickName"}}
+	tests := []struct {
+		contentType, body string
+		status            int
+	}{
+		{MediaTypeJSONPatch, `[{"op":"add","path":"/Role","value":"admin"}]`, http.StatusForbidden},
+		{MediaTypeMergePatch, `{"Role":"admin"}`, http.StatusForbidden},
+		// 大小写不同的成员名称会被 json.Unmarshal 接受，必须拒绝
+		{MediaTypeJSONPatch, `[{"op":"add","path":"/role","value":"admin"}]`, http.StatusUnprocessableEntity},
+		{MediaTypeJSONPatch, `[{"op":"replace","path":"/ROLE","value":"admin"}]`, http.StatusUnprocessableEntity},
+		{MediaTypeJSONPatch, `[{"op":"copy","from":"/ID","path":"/role"}]`, http.StatusUnprocessableEntity},
+		{MediaTypeMergePatch, `{"role":"admin"}`, http.StatusUnprocessableEntity},
+		{MediaTypeMergePatch, `{"Profile":{"nickname":"x"}}`, http.StatusUnprocessableEntity},
+		// 不存在的成员
+		{MediaTypeJSONPatch, `[{"op":"add","path":"/unknown","value":1}]`, http.StatusUnprocessableEntity},
+		{MediaTypeMergePatch, `{"unknown":1}`, http.StatusUnprocessableEntity},
+		// 映射的键不受限制
+		{MediaTypeJSONPatch, `[{"op":"add","path":"/Extra","value":{}},{"op":"add","path":"/Extra/role","value":"x"}]`, 0},
+		{MediaTypeMergePatch, `{"ID":2,"Extra":{"Role":"x"}}`, 0},
+	}
+	for _, tt := range tests {
+		a := account{ID: 1, Role: "user"}
+		err := applyPatch(t, tt.contentType, tt.body, &a, opts)
+		var pe *PatchError
+		if tt.status == 0 {
+			if err != nil {
+				t.Errorf("%s: expecting no error but got %v", tt.body, err)
+			}
+			continue
+		}
+		if !errors.As(err, &pe) || pe.Status != tt.status {
+			t.Errorf("%s: expecting status %d but got %v", tt.body, tt.status, err)
+		}
+		if a.Role != "user" {
+			t.Errorf("%s: denied field was modified: %+v", tt.body, a)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package req
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/zhangdapeng520/zdpgo_api/util"
+)
+
+// DefaultBodyMemoryBytes 可重复读取的请求体在内存中保存的最大字节数，超出的部分写入临时文件
+var DefaultBodyMemoryBytes int64 = 64 << 10
+
+// BodyOpts 缓存请求体的配置
+type BodyOpts struct {
+	// MaxBytes 请求体的最大字节数，超出时返回 *BodyError，默认 DefaultMaxBodyBytes，小于 0 时不限制
+	MaxBytes int64
+
+	// MemoryBytes 内存中保存的最大字节数，超出时写入临时文件，默认 DefaultBodyMemoryBytes
+	MemoryBytes int64
+
+	// TempDir 临时文件所在的目录，默认 os.TempDir()
+	TempDir string
+}
+
+// BodyError 缓存请求体的错误
+type BodyError struct {
+	// Status 建议响应的状态码：413 请求体过大，400 读取失败，500 临时文件写入失败
+	Status int
+	// Msg 便于客户端阅读的错误信息
+	Msg string
+	// Err 原始错误
+	Err error
+}
+
+func (e *BodyError) Error() string {
+	return e.Msg
+}
+
+func (e *BodyError) Unwrap() error {
+	return e.Err
+}
+
+// BufferedBody 可以重复读取的请求体，同时计算了 xxhash 和 SHA-256。
+// 它会替换 r.Body，r.Body 本身只能读取一次，每次调用 NewReader 都会得到从头开始的读取器
+type BufferedBody struct {
+	io.Reader
+
+	mem    []byte
+	file   *os.File
+	size   int64
+	xxh    uint64
+	sha256 [sha256.Size]byte
+
+	cleanupOnce sync.Once
+}
+
+// NewReader 返回从头开始读取的读取器，可以在多个协程中同时使用
+func (b *BufferedBody) NewReader() io.ReadCloser {
+	if b.file != nil {
+		return io.NopCloser(io.MultiReader(bytes.NewReader(b.mem), io.NewSectionReader(b.file, 0, b.size-int64(len(b.mem)))))
+	}
+	return io.NopCloser(bytes.NewReader(b.mem))
+}
+
+// Bytes 返回完整的请求体，请求体写入了临时文件时会全部读入内存
+func (b *BufferedBody) Bytes() ([]byte, error) {
+	if b.file == nil {
+		return b.mem, nil
+	}
+	return io.ReadAll(b.NewReader())
+}
+
+// Size 返回请求体的字节数
+func (b *BufferedBody) Size() int64 {
+	return b.size
+}
+
+// Spilled 判断请求体是否写入了临时文件
+func (b *BufferedBody) Spilled() bool {
+	return b.file != nil
+}
+
+// XXHash64 返回请求体的 xxhash，与 util.XXHash64 的结果相同
+func (b *BufferedBody) XXHash64() uint64 {
+	return b.xxh
+}
+
+// SHA256 返回请求体的 SHA-256
+func (b *BufferedBody) SHA256() []byte {
+	sum := b.sha256
+	return sum[:]
+}
+
+// Close 什么也不做，r.Body 被提前关闭后其他中间件和处理器仍然可以读取请求体。
+// 临时文件在请求的 context 结束后删除
+func (b *BufferedBody) Close() error {
+	return nil
+}
+
+// cleanup 关闭并删除临时文件
+func (b *BufferedBody) cleanup() {
+	b.cleanupOnce.Do(func() {
+		if b.file != nil {
+			b.file.Close()
+			os.Remove(b.file.Name())
+		}
+	})
+}
+
+// BufferBody 读取并缓存请求体，之后 r.Body 会被替换为 *BufferedBody，
+// 通过 Body 可以多次得到从头开始的读取器。已经缓存过的请求直接返回原来的 *BufferedBody。
+// 临时文件会在请求的 context 结束后删除，http.Server 在处理器返回后会结束请求的 context
+func BufferBody(r *http.Request, opts BodyOpts) (*BufferedBody, error) {
+	if bb, ok := r.Body.(*BufferedBody); ok {
+		return bb, nil
+	}
+	if opts.MaxBytes == 0 {
+		opts.MaxBytes = DefaultMaxBodyBytes
+	}
+	if opts.MemoryBytes <= 0 {
+		opts.MemoryBytes = DefaultBodyMemoryBytes
+	}
+
+	bb := &BufferedBody{}
+	if r.Body != nil {
+		if err := bb.fill(r.Body, opts); err != nil {
+			bb.cleanup()
+			return nil, err
+		}
+		r.Body.Close()
+	}
+	if bb.file != nil {
+		context.AfterFunc(r.Context(), bb.cleanup)
+	}
+
+	bb.Reader = bb.NewReader()
+	r.Body = bb
+	r.GetBody = func() (io.ReadCloser, error) { return bb.NewReader(), nil }
+	return bb, nil
+}
+
+// fill 从 src 中读取请求体，超出内存限制的部分写入临时文件
+func (b *BufferedBody) fill(src io.Reader, opts BodyOpts) error {
+	xxh := util.NewXXHash64()
+	sha := sha256.New()
+	if opts.MaxBytes > 0 {
+		// 多读一个字节用于判断是否超出限制
+		src = io.LimitReader(src, opts.MaxBytes+1)
+	}
+	src = io.TeeReader(src, io.MultiWriter(xxh, sha))
+
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(src, opts.MemoryBytes))
+	if err != nil {
+		return &BodyError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("req: failed to read body: %v", err), Err: err}
+	}
+	b.mem = buf.Bytes()
+	b.size = n
+
+	if n == opts.MemoryBytes {
+		f, err := os.CreateTemp(opts.TempDir, "zdpgo-body-*")
+		if err != nil {
+			return &BodyError{Status: http.StatusInternalServerError, Msg: "req: failed to create temp file", Err: err}
+		}
+		b.file = f
+		m, err := io.Copy(f, src)
+		b.size += m
+		if err != nil {
+			return &BodyError{Status: http.StatusBadRequest, Msg: fmt.Sprintf("req: failed to read body: %v", err), Err: err}
+		}
+		if m == 0 {
+			// 请求体恰好等于内存限制，不需要临时文件
+			b.cleanup()
+			b.file = nil
+		}
+	}
+
+	if opts.MaxBytes > 0 && b.size > opts.MaxBytes {
+		return &BodyError{
+			Status: http.StatusRequestEntityTooLarge,
+			Msg:    fmt.Sprintf("req: body must not be larger than %d bytes", opts.MaxBytes),
+			Err:    &http.MaxBytesError{Limit: opts.MaxBytes},
+		}
+	}
+	b.xxh = xxh.Sum64()
+	copy(b.sha256[:], sha.Sum(nil))
+	return nil
+}
+
+// Body 返回从头开始读取请求体的读取器，可以在中间件和处理器中多次调用。
+// 请求体还没有缓存时使用默认配置缓存：
+//
+//	body, err := req.Body(r)
+//	if err != nil {
+//		...
+//	}
+//	io.Copy(mac, body)
+//	req.GetJson(r, &user) // 仍然可以读取到完整的请求体
+func Body(r *http.Request) (io.ReadCloser, error) {
+	bb, err := BufferBody(r, BodyOpts{})
+	if err != nil {
+		return nil, err
+	}
+	return bb.NewReader(), nil
+}
+
+// requestBody 返回用于解码的请求体，缓存过的请求体总是从头开始读取
+func requestBody(r *http.Request) io.ReadCloser {
+	if bb, ok := r.Body.(*BufferedBody); ok {
+		return bb.NewReader()
+	}
+	return r.Body
+}
@@ -0,0 +1,98 @@
+package req
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_api/util"
+)
+
+func TestBodyReplay(t *testing.T) {
+	body := `{"name":"gopher","age":3}`
+	r := jsonRequest(body)
+
+	for i := 0; i < 2; i++ {
+		rc, err := Body(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rc)
+		if string(b) != body {
+			t.Fatalf("expecting %q but got %q", body, b)
+		}
+	}
+
+	// 直接读取 r.Body 后仍然可以解码
+	io.ReadAll(r.Body)
+	r.Body.Close()
+	var u jsonUser
+	if err := DecodeJSON(r, &u); err != nil || u.Name != "gopher" {
+		t.Fatalf("expecting decoded body but got %+v, %v", u, err)
+	}
+
+	bb, _ := BufferBody(r, BodyOpts{})
+	if bb.Size() != int64(len(body)) || bb.Spilled() {
+		t.Fatalf("expecting in-memory body of %d bytes", len(body))
+	}
+	if bb.XXHash64() != util.XXHash64(body) {
+		t.Fatal("expecting xxhash to match util.XXHash64")
+	}
+	if sum := sha256.Sum256([]byte(body)); string(bb.SHA256()) != string(sum[:]) {
+		t.Fatal("expecting SHA-256 to match")
+	}
+}
+
+func TestBodySpill(t *testing.T) {
+	body := strings.Repeat("0123456789", 1000)
+	ctx, cancel := context.WithCancel(context.Background())
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body)).WithContext(ctx)
+
+	bb, err := BufferBody(r, BodyOpts{MemoryBytes: 100, TempDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bb.Spilled() || bb.Size() != int64(len(body)) {
+		t.Fatalf("expecting spilled body of %d bytes but got %d", len(body), bb.Size())
+	}
+	for i := 0; i < 2; i++ {
+		b, err := io.ReadAll(bb.NewReader())
+		if err != nil || string(b) != body {
+			t.Fatalf("expecting full body on read %d but got %d bytes, %v", i, len(b), err)
+		}
+	}
+	if bb.XXHash64() != util.XXHash64(body) {
+		t.Fatal("expecting xxhash to match util.XXHash64")
+	}
+
+	name := bb.file.Name()
+	cancel()
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("expecting temp file to be removed after the request")
+}
+
+func TestBodyTooLarge(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(strings.Repeat("a", 101)))
+	_, err := BufferBody(r, BodyOpts{MaxBytes: 100, MemoryBytes: 10, TempDir: t.TempDir()})
+	var be *BodyError
+	if !errors.As(err, &be) || be.Status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expecting 413 but got %v", err)
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader(strings.Repeat("a", 100)))
+	if _, err := BufferBody(r, BodyOpts{MaxBytes: 100, MemoryBytes: 100}); err != nil {
+		t.Fatalf("expecting body at the limit to be accepted but got %v", err)
+	}
+}
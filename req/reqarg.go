@@ -1,10 +1,9 @@
 package req
 
 import (
-	"encoding/json"
-	"io"
+	"github.com/zhangdapeng520/zdpgo_api/api"
+	"github.com/zhangdapeng520/zdpgo_api/qs"
 	"net/http"
-	"zdpgo_api/api"
 )
 
 // GetPath 获取路径参数
@@ -45,6 +44,13 @@ func GetQuerys(r *http.Request, keys ...string) (values []string) {
 	return
 }
 
+// DecodeQuery 将查询参数解码到结构体中，支持嵌套的参数名，字段使用 query 标签：
+// /issues?filter[status][]=open&filter[owner]=5&sort.field=created
+// 注意：dst要传其指针，比如 DecodeQuery(r, &params)
+func DecodeQuery(r *http.Request, dst interface{}) error {
+	return qs.DecodeWithOpts(r.URL.Query(), dst, qs.Opts{Tag: "query"})
+}
+
 // GetForm 获取表单参数
 func GetForm(r *http.Request, keys ...string) (values []string) {
 	r.ParseForm()
@@ -54,14 +60,17 @@ func GetForm(r *http.Request, keys ...string) (values []string) {
 	return
 }
 
-// GetJson 获取JSON参数
+// DecodeForm 将表单参数解码到结构体中，支持嵌套的参数名，字段使用 form 标签
+// 注意：dst要传其指针，比如 DecodeForm(r, &params)
+func DecodeForm(r *http.Request, dst interface{}) error {
+	if err := r.ParseMultipartForm(defaultMultipartMemory); err != nil && err != http.ErrNotMultipart {
+		return err
+	}
+	return qs.DecodeWithOpts(r.PostForm, dst, qs.Opts{Tag: "form"})
+}
+
+// GetJson 获取JSON参数，请求体最大为 DefaultMaxJSONBytes，不检查 Content-Type
 // 注意：jsonObj要传其指针，比如 GetJson(r, &user)
 func GetJson(r *http.Request, jsonObj interface{}) (err error) {
-	var body []byte
-	body, err = io.ReadAll(r.Body)
-	if err != nil {
-		return
-	}
-	err = json.Unmarshal(body, jsonObj)
-	return
+	return DecodeJSONWithOpts(r, jsonObj, JSONOpts{AllowAnyContentType: true})
 }
@@ -0,0 +1,18 @@
+package resp
+
+import (
+	"net/http"
+)
+
+// Unauthorized 响应 401，challenge 是 WWW-Authenticate 响应头，例如 Bearer realm="api"，为空时不设置
+func Unauthorized(w http.ResponseWriter, challenge, msg string) {
+	if challenge != "" {
+		w.Header().Set("WWW-Authenticate", challenge)
+	}
+	ErrorMap(w, http.StatusUnauthorized, "status", false, "code", 1004, "msg", msg)
+}
+
+// Forbidden 响应 403，表示已经认证但是没有权限
+func Forbidden(w http.ResponseWriter, msg string) {
+	ErrorMap(w, http.StatusForbidden, "status", false, "code", 1005, "msg", msg)
+}
@@ -0,0 +1,51 @@
+package resp
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_api/req"
+)
+
+// Conditional 设置 ETag 和 Last-Modified 响应头并判断条件请求，资源没有修改时响应 304，
+// 条件不满足时响应 412。返回 true 表示已经响应，处理器应该直接返回：
+//
+//	if resp.Conditional(w, r, user.Version, user.UpdatedAt) {
+//		return
+//	}
+//
+// 用于乐观锁时，客户端在 PUT、PATCH 和 DELETE 请求中通过 If-Match 带上读取时的 ETag，
+// 版本不一致时响应 412，处理器在更新成功后应该重新设置新的 ETag
+func Conditional(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	etag = req.QuoteETag(etag)
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	switch req.CheckPreconditions(r, etag, lastModified) {
+	case req.PreconditionNotModified:
+		NotModified(w)
+		return true
+	case req.PreconditionFailed:
+		PreconditionFailed(w)
+		return true
+	}
+	return false
+}
+
+// NotModified 响应 304，删除与响应体相关的响应头
+func NotModified(w http.ResponseWriter) {
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// PreconditionFailed 响应 412，表示资源已经被修改
+func PreconditionFailed(w http.ResponseWriter) {
+	ErrorMap(w, http.StatusPreconditionFailed, "status", false, "code", 1003, "msg", "资源已被修改，请刷新后重试")
+}
@@ -0,0 +1,38 @@
+package resp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConditional(t *testing.T) {
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/users/1", nil)
+	if Conditional(w, r, "v1", modified) {
+		t.Fatal("expecting unconditional request to pass")
+	}
+	if w.Header().Get("ETag") != `"v1"` || w.Header().Get("Last-Modified") != "Tue, 02 Jan 2024 03:04:05 GMT" {
+		t.Fatalf("unexpected validators %v", w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	r.Header.Set("If-None-Match", `"v1"`)
+	if !Conditional(w, r, "v1", modified) || w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("expecting 304 but got %d %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("PUT", "/users/1", nil)
+	r.Header.Set("If-Match", `"v0"`)
+	if !Conditional(w, r, "v1", modified) || w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expecting 412 but got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `"code":1003`) {
+		t.Fatalf("expecting error envelope but got %s", w.Body.String())
+	}
+}
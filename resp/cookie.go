@@ -0,0 +1,30 @@
+package resp
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/zhangdapeng520/zdpgo_api/req"
+)
+
+// SetSecureCookie 签名（可选加密）并设置 Cookie，默认设置 HttpOnly、Secure 和 SameSite=Lax，
+// 使用 req.GetSecureCookie 读取：
+//
+//	opts := req.SecureCookieOpts{Keys: [][]byte{newKey, oldKey}, Encrypt: true}
+//	err := resp.SetSecureCookie(w, "prefs", prefs, opts)
+func SetSecureCookie(w http.ResponseWriter, name string, value interface{}, opts req.SecureCookieOpts) error {
+	s, err := req.EncodeSecureCookie(name, value, opts)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, opts.Cookie(name, s))
+	return nil
+}
+
+// DeleteSecureCookie 删除 SetSecureCookie 设置的 Cookie，Path 和 Domain 需要与设置时相同
+func DeleteSecureCookie(w http.ResponseWriter, name string, opts req.SecureCookieOpts) {
+	c := opts.Cookie(name, "")
+	c.MaxAge = -1
+	c.Expires = time.Unix(0, 0)
+	http.SetCookie(w, c)
+}
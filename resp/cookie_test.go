@@ -0,0 +1,34 @@
+package resp
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zhangdapeng520/zdpgo_api/req"
+)
+
+func TestSecureCookie(t *testing.T) {
+	opts := req.SecureCookieOpts{Keys: [][]byte{[]byte("secret")}, Encrypt: true}
+	w := httptest.NewRecorder()
+	if err := SetSecureCookie(w, "prefs", map[string]string{"theme": "dark"}, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, c := range w.Result().Cookies() {
+		if !c.HttpOnly || !c.Secure {
+			t.Fatalf("expecting secure defaults but got %+v", c)
+		}
+		r.AddCookie(c)
+	}
+	var prefs map[string]string
+	if err := req.GetSecureCookie(r, "prefs", &prefs, opts); err != nil || prefs["theme"] != "dark" {
+		t.Fatalf("expecting round trip but got %v, %v", prefs, err)
+	}
+
+	w = httptest.NewRecorder()
+	DeleteSecureCookie(w, "prefs", opts)
+	if c := w.Result().Cookies(); len(c) != 1 || c[0].MaxAge != -1 {
+		t.Fatalf("expecting deletion cookie but got %+v", c)
+	}
+}
@@ -2,7 +2,10 @@ package resp
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+
+	"github.com/zhangdapeng520/zdpgo_api/validate"
 )
 
 // ErrorMap 响应错误的JSON类型的数据
@@ -18,8 +21,8 @@ func ErrorMap(w http.ResponseWriter, statusCode int, kvs ...interface{}) {
 		jsonData["error"] = "服务端错误"
 	}
 	v, _ := json.Marshal(jsonData)
-	w.WriteHeader(statusCode)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
 	w.Write(v)
 }
 
@@ -32,3 +35,18 @@ func ErrorMessage(w http.ResponseWriter, msg string) {
 func ErrorCodeMessage(w http.ResponseWriter, code int, msg string) {
 	ErrorMap(w, 200, "status", false, "code", code, "msg", msg)
 }
+
+// ValidationError 响应参数校验错误，根据请求的 Accept-Language 选择中文或英文的错误信息：
+//
+//	{"status":false,"code":1002,"msg":"name为必填字段","errors":[{"field":"name","rule":"required","message":"name为必填字段"}]}
+//
+// err 不是 validate.Errors 时只响应错误信息
+func ValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	var errs validate.Errors
+	if !errors.As(err, &errs) || len(errs) == 0 {
+		ErrorCodeMessage(w, 1002, err.Error())
+		return
+	}
+	msgs := errs.Messages(validate.Lang(r.Header.Get("Accept-Language")))
+	ErrorMap(w, 200, "status", false, "code", 1002, "msg", msgs[0].Message, "errors", msgs)
+}
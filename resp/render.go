@@ -0,0 +1,62 @@
+package resp
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/zhangdapeng520/zdpgo_api/codec"
+	"github.com/zhangdapeng520/zdpgo_api/middleware"
+)
+
+// Render 根据请求选择编码格式响应数据，默认 JSON。
+// 先使用 middleware.URLFormat 解析出的扩展名，例如 /articles/1.xml，
+// 再根据 Accept 请求头进行内容协商，都无法匹配时响应 406
+func Render(w http.ResponseWriter, r *http.Request, statusCode int, data interface{}) {
+	c := negotiate(r)
+	w.Header().Add("Vary", "Accept")
+	if c == nil {
+		ErrorMap(w, http.StatusNotAcceptable, "status", false, "code", 1001, "msg", "不支持的响应格式："+r.Header.Get("Accept"))
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := c.Encode(&buf, data); err != nil {
+		log.Printf("响应数据编码失败：%v\n", err)
+		ErrorMap(w, http.StatusInternalServerError, "status", false, "code", 1001, "msg", "服务端错误")
+		return
+	}
+
+	contentType := c.MediaType()
+	if strings.HasPrefix(contentType, "text/") || contentType == "application/json" || contentType == "application/xml" {
+		contentType += "; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(statusCode)
+	w.Write(buf.Bytes())
+}
+
+// RenderSuccess 响应成功的数据，数据结构与 Success 相同，编码格式与 Render 相同
+func RenderSuccess(w http.ResponseWriter, r *http.Request, data interface{}) {
+	jsonData := map[string]interface{}{
+		"status": true,
+		"code":   10000,
+		"msg":    "success",
+	}
+	if data != nil {
+		jsonData["data"] = data
+	}
+	Render(w, r, http.StatusOK, jsonData)
+}
+
+// negotiate 选择响应的编解码器
+func negotiate(r *http.Request) codec.Codec {
+	if format, _ := r.Context().Value(middleware.URLFormatCtxKey).(string); format != "" {
+		if c, ok := codec.ByFormat(format); ok {
+			return c
+		}
+	}
+	c, _ := codec.Negotiate(r.Header.Get("Accept"))
+	return c
+}
@@ -0,0 +1,48 @@
+package resp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zhangdapeng520/zdpgo_api/api"
+	"github.com/zhangdapeng520/zdpgo_api/middleware"
+)
+
+func TestRender(t *testing.T) {
+	r := api.NewRouter()
+	r.Use(middleware.URLFormat)
+	r.Get("/articles/{id}", func(w http.ResponseWriter, r *http.Request) {
+		RenderSuccess(w, r, map[string]string{"id": api.URLParam(r, "id")})
+	})
+
+	tests := []struct {
+		path, accept string
+		status       int
+		contentType  string
+		body         string
+	}{
+		{"/articles/1", "", 200, "application/json; charset=utf-8", `"data":{"id":"1"}`},
+		{"/articles/1.xml", "application/json", 200, "application/xml; charset=utf-8", `<data><id>1</id></data>`},
+		{"/articles/1", "text/html, application/xml;q=0.9", 200, "application/xml; charset=utf-8", `<code>10000</code>`},
+		{"/articles/1.cbor", "", 200, "application/cbor", "ddata\xa1bida1"},
+		{"/articles/1", "application/msgpack", 200, "application/msgpack", "\xa2id\xa11"},
+		{"/articles/1", "text/html", 406, "application/json", `"code":1001`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != tt.status || w.Header().Get("Content-Type") != tt.contentType {
+			t.Fatalf("%s %q: unexpected %d %q", tt.path, tt.accept, w.Code, w.Header().Get("Content-Type"))
+		}
+		if !strings.Contains(w.Body.String(), tt.body) {
+			t.Fatalf("%s %q: expecting body to contain %q but got %q", tt.path, tt.accept, tt.body, w.Body.String())
+		}
+	}
+}
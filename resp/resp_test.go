@@ -0,0 +1,25 @@
+package resp
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContentType(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(w *httptest.ResponseRecorder)
+	}{
+		{"ErrorMap", func(w *httptest.ResponseRecorder) { ErrorMap(w, 400, "status", false) }},
+		{"ErrorMessage", func(w *httptest.ResponseRecorder) { ErrorMessage(w, "x") }},
+		{"SuccessMap", func(w *httptest.ResponseRecorder) { SuccessMap(w, "id", 1) }},
+		{"Success", func(w *httptest.ResponseRecorder) { Success(w, nil) }},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		tt.write(w)
+		if ct := w.Result().Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: expecting Content-Type application/json but got %q", tt.name, ct)
+		}
+	}
+}
@@ -27,8 +27,8 @@ func SuccessMap(w http.ResponseWriter, kvs ...interface{}) {
 
 	// 返回
 	v, _ := json.Marshal(jsonData)
-	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
 	w.Write(v)
 }
 
@@ -48,7 +48,7 @@ func Success(w http.ResponseWriter, data interface{}) {
 
 	// 返回
 	v, _ := json.Marshal(jsonData)
-	w.WriteHeader(http.StatusOK)
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
 	w.Write(v)
 }
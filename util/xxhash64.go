@@ -31,6 +31,11 @@ func sum(b []byte) uint64 {
 
 	h += n
 
+	return tail(h, b)
+}
+
+// tail 处理不足 32 字节的剩余数据，并完成最后的混合
+func tail(h uint64, b []byte) uint64 {
 	var i, sz = 0, len(b)
 	for ; i+8 <= sz; i += 8 {
 		k1 := round(0, u64(b[i:i+8:len(b)]))
@@ -73,3 +78,86 @@ func u32(b []byte) uint32 {
 	_ = b[3] // bounds check hint to compiler; see golang.org/issue/14808
 	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
 }
+
+// XXHash64Digest 流式计算 xxhash，实现了 hash.Hash64，适合无法一次性读入内存的数据
+type XXHash64Digest struct {
+	v1, v2, v3, v4 uint64
+	total          uint64
+	mem            [32]byte
+	n              int
+}
+
+// NewXXHash64 创建流式计算 xxhash 的 XXHash64Digest，结果与 XXHash64 相同
+func NewXXHash64() *XXHash64Digest {
+	d := &XXHash64Digest{}
+	d.Reset()
+	return d
+}
+
+// Reset 重置状态
+func (d *XXHash64Digest) Reset() {
+	d.v1 = 6983438078262162902
+	d.v2 = 14029467366897019727
+	d.v3 = 0
+	d.v4 = 7046029288634856825
+	d.total = 0
+	d.n = 0
+}
+
+// Size 返回结果的字节数
+func (d *XXHash64Digest) Size() int { return 8 }
+
+// BlockSize 返回块大小
+func (d *XXHash64Digest) BlockSize() int { return 32 }
+
+// Write 写入数据，总是返回 len(b) 和 nil
+func (d *XXHash64Digest) Write(b []byte) (int, error) {
+	n := len(b)
+	d.total += uint64(n)
+
+	if d.n+len(b) < 32 {
+		d.n += copy(d.mem[d.n:], b)
+		return n, nil
+	}
+	if d.n > 0 {
+		c := copy(d.mem[d.n:], b)
+		d.block(d.mem[:])
+		b = b[c:]
+		d.n = 0
+	}
+	for len(b) >= 32 {
+		d.block(b[:32:32])
+		b = b[32:]
+	}
+	d.n = copy(d.mem[:], b)
+	return n, nil
+}
+
+// block 处理 32 字节的数据块
+func (d *XXHash64Digest) block(b []byte) {
+	d.v1 = round(d.v1, u64(b[0:8:len(b)]))
+	d.v2 = round(d.v2, u64(b[8:16:len(b)]))
+	d.v3 = round(d.v3, u64(b[16:24:len(b)]))
+	d.v4 = round(d.v4, u64(b[24:32:len(b)]))
+}
+
+// Sum64 返回当前的 xxhash，不改变状态
+func (d *XXHash64Digest) Sum64() uint64 {
+	var h uint64 = 2870177450012600261
+	if d.total >= 32 {
+		v1, v2, v3, v4 := d.v1, d.v2, d.v3, d.v4
+		h = (v1<<1 | v1>>63) + (v2<<7 | v2>>57) + (v3<<12 | v3>>52) + (v4<<18 | v4>>46)
+		h = (h^round(0, v1))*11400714785074694791 + 9650029242287828579
+		h = (h^round(0, v2))*11400714785074694791 + 9650029242287828579
+		h = (h^round(0, v3))*11400714785074694791 + 9650029242287828579
+		h = (h^round(0, v4))*11400714785074694791 + 9650029242287828579
+	}
+	h += d.total
+	return tail(h, d.mem[:d.n])
+}
+
+// Sum 将大端序的 xxhash 追加到 b 后面
+func (d *XXHash64Digest) Sum(b []byte) []byte {
+	h := d.Sum64()
+	return append(b, byte(h>>56), byte(h>>48), byte(h>>40), byte(h>>32), byte(h>>24), byte(h>>16), byte(h>>8), byte(h))
+}
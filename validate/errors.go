@@ -0,0 +1,179 @@
+package validate
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLang 无法从 Accept-Language 中匹配到语言时使用的语言
+var DefaultLang = "zh"
+
+// builtinMessages 内置的中英文错误信息模板
+var builtinMessages = map[string]map[string]string{
+	"zh": {
+		"default":    "{field}未通过{rule}校验",
+		"required":   "{field}为必填字段",
+		"min.string": "{field}长度不能少于{param}个字符",
+		"min.number": "{field}不能小于{param}",
+		"min.slice":  "{field}至少包含{param}项",
+		"max.string": "{field}长度不能超过{param}个字符",
+		"max.number": "{field}不能大于{param}",
+		"max.slice":  "{field}最多包含{param}项",
+		"len.string": "{field}长度必须是{param}个字符",
+		"len.number": "{field}必须等于{param}",
+		"len.slice":  "{field}必须包含{param}项",
+		"email":      "{field}必须是有效的邮箱地址",
+		"url":        "{field}必须是有效的URL",
+		"oneof":      "{field}必须是[{param}]中的一个",
+		"regexp":     "{field}格式不正确",
+		"eqfield":    "{field}必须等于{param}",
+		"nefield":    "{field}不能等于{param}",
+		"gtfield":    "{field}必须大于{param}",
+		"gtefield":   "{field}必须大于或等于{param}",
+		"ltfield":    "{field}必须小于{param}",
+		"ltefield":   "{field}必须小于或等于{param}",
+	},
+	"en": {
+		"default":    "{field} failed on the {rule} rule",
+		"required":   "{field} is required",
+		"min.string": "{field} must be at least {param} characters long",
+		"min.number": "{field} must be {param} or greater",
+		"min.slice":  "{field} must contain at least {param} items",
+		"max.string": "{field} must be at most {param} characters long",
+		"max.number": "{field} must be {param} or less",
+		"max.slice":  "{field} must contain at most {param} items",
+		"len.string": "{field} must be exactly {param} characters long",
+		"len.number": "{field} must be equal to {param}",
+		"len.slice":  "{field} must contain exactly {param} items",
+		"email":      "{field} must be a valid email address",
+		"url":        "{field} must be a valid URL",
+		"oneof":      "{field} must be one of [{param}]",
+		"regexp":     "{field} has an invalid format",
+		"eqfield":    "{field} must be equal to {param}",
+		"nefield":    "{field} must not be equal to {param}",
+		"gtfield":    "{field} must be greater than {param}",
+		"gtefield":   "{field} must be greater than or equal to {param}",
+		"ltfield":    "{field} must be less than {param}",
+		"ltefield":   "{field} must be less than or equal to {param}",
+	},
+}
+
+// FieldError 单个字段的校验错误
+type FieldError struct {
+	// Field 字段的路径，例如 email、items[0].name
+	Field string
+	// Rule 未通过的规则，例如 required、min
+	Rule string
+	// Param 规则的参数，例如 min=1 中的 1
+	Param string
+	// Value 字段的值
+	Value interface{}
+
+	v    *Validator
+	kind string
+}
+
+// Error 返回英文的错误信息
+func (e *FieldError) Error() string {
+	return e.Message("en")
+}
+
+// Message 返回指定语言的错误信息，语言不存在时使用 DefaultLang
+func (e *FieldError) Message(lang string) string {
+	v := e.v
+	if v == nil {
+		v = defaultValidator
+	}
+	v.mu.RLock()
+	msgs, ok := v.messages[strings.ToLower(lang)]
+	if !ok {
+		msgs = v.messages[DefaultLang]
+	}
+	tmpl, ok := msgs[e.Rule+"."+e.kind]
+	if !ok {
+		tmpl, ok = msgs[e.Rule]
+	}
+	if !ok {
+		tmpl = msgs["default"]
+	}
+	v.mu.RUnlock()
+
+	if tmpl == "" {
+		tmpl = "{field}: {rule}"
+	}
+	return strings.NewReplacer("{field}", e.Field, "{rule}", e.Rule, "{param}", e.Param).Replace(tmpl)
+}
+
+// Message 字段错误的展示形式，可以直接放进响应中
+type Message struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// Errors 所有字段的校验错误
+type Errors []*FieldError
+
+func (errs Errors) Error() string {
+	msgs := make([]string, 0, len(errs))
+	for _, e := range errs {
+		msgs = append(msgs, e.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Messages 返回指定语言的所有错误信息
+func (errs Errors) Messages(lang string) []Message {
+	msgs := make([]Message, 0, len(errs))
+	for _, e := range errs {
+		msgs = append(msgs, Message{Field: e.Field, Rule: e.Rule, Param: e.Param, Message: e.Message(lang)})
+	}
+	return msgs
+}
+
+// Lang 根据 Accept-Language 请求头选择错误信息的语言，例如 "en-US,en;q=0.9" 选择 en，
+// 没有匹配的语言时返回 DefaultLang
+func Lang(acceptLanguage string) string {
+	return defaultValidator.Lang(acceptLanguage)
+}
+
+// Lang 根据 Accept-Language 请求头选择错误信息的语言
+func (v *Validator) Lang(acceptLanguage string) string {
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		if p, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(p, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			candidates = append(candidates, candidate{strings.ToLower(tag), q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	for _, c := range candidates {
+		// 先匹配完整的语言标签，例如 zh-tw，再匹配主语言，例如 zh
+		if _, ok := v.messages[c.lang]; ok {
+			return c.lang
+		}
+		primary, _, _ := strings.Cut(c.lang, "-")
+		if _, ok := v.messages[primary]; ok {
+			return primary
+		}
+	}
+	return DefaultLang
+}
@@ -0,0 +1,173 @@
+package validate
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// emailRegexp 邮箱地址的格式，只做基本的格式校验
+var emailRegexp = regexp.MustCompile(`^[a-zA-Z0-9.!#$%&'*+/=?^_{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)+$`)
+
+// regexpCache 已经编译的 regexp 规则参数
+var regexpCache sync.Map
+
+// builtinRules 内置的校验规则
+var builtinRules = map[string]RuleFunc{
+	"required": func(f Field) bool { return !f.Value.IsZero() },
+	"min":      func(f Field) bool { return compareSize(f, func(n, p float64) bool { return n >= p }) },
+	"max":      func(f Field) bool { return compareSize(f, func(n, p float64) bool { return n <= p }) },
+	"len":      func(f Field) bool { return compareSize(f, func(n, p float64) bool { return n == p }) },
+	"email": func(f Field) bool {
+		return f.Value.Kind() == reflect.String && emailRegexp.MatchString(f.Value.String())
+	},
+	"url": func(f Field) bool {
+		if f.Value.Kind() != reflect.String {
+			return false
+		}
+		u, err := url.Parse(f.Value.String())
+		return err == nil && u.Scheme != "" && u.Host != ""
+	},
+	"oneof": func(f Field) bool {
+		s := fmt.Sprint(f.Value.Interface())
+		for _, opt := range strings.Fields(f.Param) {
+			if s == opt {
+				return true
+			}
+		}
+		return false
+	},
+	"regexp": func(f Field) bool {
+		if f.Value.Kind() != reflect.String {
+			return false
+		}
+		re, err := compileRegexp(f.Param)
+		return err == nil && re.MatchString(f.Value.String())
+	},
+	"eqfield": func(f Field) bool {
+		other, ok := otherField(f)
+		return ok && equal(f.Value, other)
+	},
+	"nefield": func(f Field) bool {
+		other, ok := otherField(f)
+		return ok && !equal(f.Value, other)
+	},
+	"gtfield":  func(f Field) bool { return compareField(f, func(c int) bool { return c > 0 }) },
+	"gtefield": func(f Field) bool { return compareField(f, func(c int) bool { return c >= 0 }) },
+	"ltfield":  func(f Field) bool { return compareField(f, func(c int) bool { return c < 0 }) },
+	"ltefield": func(f Field) bool { return compareField(f, func(c int) bool { return c <= 0 }) },
+}
+
+// compareSize 比较字段的大小和规则参数：字符串比较字符数，切片和映射比较长度，数字比较数值
+func compareSize(f Field, cmp func(n, p float64) bool) bool {
+	// 参数在解析标签时已经检查过
+	p, err := strconv.ParseFloat(f.Param, 64)
+	if err != nil {
+		return false
+	}
+	n, ok := size(f.Value)
+	return ok && cmp(n, p)
+}
+
+// size 返回字段的大小
+func size(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true
+	}
+	return number(v)
+}
+
+// number 将数字类型的字段转换为 float64
+func number(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// compareField 比较字段和同一结构体中另一个字段的大小，param 是另一个字段的字段名
+func compareField(f Field, cmp func(c int) bool) bool {
+	other, ok := otherField(f)
+	if !ok {
+		return false
+	}
+	c, ok := compare(f.Value, other)
+	return ok && cmp(c)
+}
+
+// otherField 返回跨字段规则中引用的另一个字段，字段为 nil 指针时返回 false
+func otherField(f Field) (reflect.Value, bool) {
+	if !f.Parent.IsValid() {
+		return reflect.Value{}, false
+	}
+	other := f.Parent.FieldByName(f.Param)
+	if !other.IsValid() {
+		return reflect.Value{}, false
+	}
+	for other.Kind() == reflect.Ptr || other.Kind() == reflect.Interface {
+		if other.IsNil() {
+			return reflect.Value{}, false
+		}
+		other = other.Elem()
+	}
+	return other, true
+}
+
+// equal 判断两个值是否相等
+func equal(a, b reflect.Value) bool {
+	if c, ok := compare(a, b); ok {
+		return c == 0
+	}
+	return a.CanInterface() && b.CanInterface() && reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+// compare 比较两个值的大小，只支持数字、字符串和 time.Time
+func compare(a, b reflect.Value) (int, bool) {
+	if a.Type() == timeType && b.Type() == timeType {
+		return a.Interface().(time.Time).Compare(b.Interface().(time.Time)), true
+	}
+	if an, ok := number(a); ok {
+		bn, ok := number(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case an < bn:
+			return -1, true
+		case an > bn:
+			return 1, true
+		}
+		return 0, true
+	}
+	if a.Kind() == reflect.String && b.Kind() == reflect.String {
+		return strings.Compare(a.String(), b.String()), true
+	}
+	return 0, false
+}
+
+// compileRegexp 编译并缓存 regexp 规则的参数
+func compileRegexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := regexpCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regexp %q: %v", pattern, err)
+	}
+	regexpCache.Store(pattern, re)
+	return re, nil
+}
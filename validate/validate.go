@@ -0,0 +1,499 @@
+// Package validate 根据结构体的 validate 标签校验参数，通常在 req.Bind 之后使用：
+//
+//	type CreateUser struct {
+//		Name     string   `json:"name" validate:"required,min=2,max=20"`
+//		Email    string   `json:"email" validate:"required,email"`
+//		Role     string   `json:"role" validate:"oneof=admin user"`
+//		Password string   `json:"password" validate:"required,min=8"`
+//		Confirm  string   `json:"confirm" validate:"eqfield=Password"`
+//		Tags     []string `json:"tags" validate:"max=5,dive,min=1"`
+//	}
+//
+// 规则之间用逗号分隔，regexp 规则的参数可以包含逗号，因此它必须是最后一条规则。
+// 嵌套的结构体以及结构体切片会被递归校验，dive 之后的规则作用于切片或映射的每个元素。
+// 指针和 interface 字段的 required 只检查是否为 nil，指向零值的指针表示参数存在，
+// 例如 ?flag=false 绑定到 *bool 字段时 required 通过，其他规则作用于解引用后的值。
+//
+// 每个结构体类型的标签在第一次校验时解析并检查，未知的规则、无效的参数等标签错误通过 error 返回，
+// 不会在处理请求时 panic。可以在启动时调用 Check 提前发现这些错误。
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// nameTags 用于获取字段展示名称的标签，依次查找，都不存在时使用字段名
+var nameTags = []string{"json", "query", "form", "path", "header", "cookie"}
+
+// Field 传给校验规则的字段信息
+type Field struct {
+	// Value 字段的值，指针已经被解引用
+	Value reflect.Value
+	// Param 规则的参数，例如 min=1 中的 1
+	Param string
+	// Parent 字段所在的结构体，用于跨字段校验
+	Parent reflect.Value
+}
+
+// RuleFunc 校验规则，校验通过时返回 true
+type RuleFunc func(f Field) bool
+
+// Validator 校验器，保存了所有的校验规则和错误信息模板
+type Validator struct {
+	mu       sync.RWMutex
+	rules    map[string]RuleFunc
+	messages map[string]map[string]string
+
+	specs sync.Map // reflect.Type -> []fieldSpec
+}
+
+// fieldSpec 解析后的字段校验规则
+type fieldSpec struct {
+	index     int
+	name      string
+	anonymous bool
+	rules     []rule
+}
+
+// rule 一条校验规则
+type rule struct {
+	name  string
+	param string
+}
+
+// New 创建包含所有内置规则和中英文错误信息的校验器
+func New() *Validator {
+	v := &Validator{
+		rules:    make(map[string]RuleFunc),
+		messages: make(map[string]map[string]string),
+	}
+	for name, fn := range builtinRules {
+		v.rules[name] = fn
+	}
+	for lang, msgs := range builtinMessages {
+		for key, tmpl := range msgs {
+			v.RegisterMessage(lang, key, tmpl)
+		}
+	}
+	return v
+}
+
+// defaultValidator 包级函数使用的校验器
+var defaultValidator = New()
+
+// Struct 使用默认校验器校验结构体
+func Struct(s interface{}) error {
+	return defaultValidator.Struct(s)
+}
+
+// Check 使用默认校验器检查结构体的标签
+func Check(s interface{}) error {
+	return defaultValidator.Check(s)
+}
+
+// Register 在默认校验器中注册校验规则
+func Register(name string, fn RuleFunc) {
+	defaultValidator.Register(name, fn)
+}
+
+// RegisterMessage 在默认校验器中注册错误信息模板
+func RegisterMessage(lang, rule, tmpl string) {
+	defaultValidator.RegisterMessage(lang, rule, tmpl)
+}
+
+// Register 注册校验规则，同名的规则会被覆盖
+func (v *Validator) Register(name string, fn RuleFunc) {
+	if name == "" || fn == nil {
+		panic("validate: rule name and func must not be empty")
+	}
+	if name == "omitempty" || name == "dive" {
+		panic(fmt.Sprintf("validate: %q is a reserved rule name", name))
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.rules[name] = fn
+}
+
+// RegisterMessage 注册错误信息模板，模板中可以使用 {field}、{rule} 和 {param}。
+// rule 可以带上 .string、.number 或 .slice 后缀，为不同类型的字段指定不同的模板，例如 min.string
+func (v *Validator) RegisterMessage(lang, rule, tmpl string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	lang = strings.ToLower(lang)
+	if v.messages[lang] == nil {
+		v.messages[lang] = make(map[string]string)
+	}
+	v.messages[lang][rule] = tmpl
+}
+
+// Struct 校验结构体，s 可以是结构体或者结构体指针。
+// 校验失败时返回 Errors，每个字段最多包含一个错误；标签无效时返回其他错误
+func (v *Validator) Struct(s interface{}) error {
+	rv := reflect.ValueOf(s)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return fmt.Errorf("validate: Struct expects a struct, got nil %T", s)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("validate: Struct expects a struct, got %T", s)
+	}
+
+	var errs Errors
+	if err := v.validateStruct(rv, "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Check 解析并检查结构体以及嵌套结构体的 validate 标签，s 可以是结构体或者结构体指针，
+// 适合在启动时调用，例如 validate.Check(CreateUser{})
+func (v *Validator) Check(s interface{}) error {
+	t := reflect.TypeOf(s)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return fmt.Errorf("validate: Check expects a struct, got %T", s)
+	}
+	_, err := v.fieldSpecs(t)
+	return err
+}
+
+// validateStruct 校验结构体的所有字段，返回的错误表示标签无效
+func (v *Validator) validateStruct(sv reflect.Value, prefix string, errs *Errors) error {
+	specs, err := v.fieldSpecs(sv.Type())
+	if err != nil {
+		return err
+	}
+	for _, f := range specs {
+		fv := sv.Field(f.index)
+		if f.anonymous && len(f.rules) == 0 {
+			err = v.validateNested(fv, strings.TrimSuffix(prefix, "."), errs)
+		} else {
+			err = v.validateField(fv, sv, prefix+f.name, f.rules, errs)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateField 依次执行字段的校验规则，第一条规则失败后不再执行后面的规则
+func (v *Validator) validateField(fv, parent reflect.Value, path string, rules []rule, errs *Errors) error {
+	indirect := false
+	for fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface {
+		indirect = true
+		if fv.IsNil() {
+			for _, r := range rules {
+				if r.name == "dive" {
+					break
+				}
+				if r.name == "required" {
+					*errs = append(*errs, v.newError(path, r, fv, ""))
+					return nil
+				}
+			}
+			return nil
+		}
+		fv = fv.Elem()
+	}
+
+	for i, r := range rules {
+		switch r.name {
+		case "omitempty":
+			if fv.IsZero() {
+				return nil
+			}
+			continue
+		case "dive":
+			return v.dive(fv, parent, path, rules[i+1:], errs)
+		case "required":
+			// 非 nil 的指针即使指向零值也表示参数存在
+			if indirect {
+				continue
+			}
+		}
+
+		// 规则在解析标签时已经检查过，规则不存在只可能是因为字段保存在 interface 中
+		fn, ok := v.rule(r.name)
+		if !ok {
+			return fmt.Errorf("validate: unknown rule %q on field %s", r.name, path)
+		}
+		if !fn(Field{Value: fv, Param: r.param, Parent: parent}) {
+			*errs = append(*errs, v.newError(path, r, fv, kindClass(fv)))
+			return nil
+		}
+	}
+	return v.validateNested(fv, path, errs)
+}
+
+// dive 对切片、数组或映射的每个元素执行剩余的规则
+func (v *Validator) dive(fv, parent reflect.Value, path string, rules []rule, errs *Errors) error {
+	switch fv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < fv.Len(); i++ {
+			if err := v.validateField(fv.Index(i), parent, fmt.Sprintf("%s[%d]", path, i), rules, errs); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range sortedKeys(fv) {
+			if err := v.validateField(fv.MapIndex(key), parent, fmt.Sprintf("%s[%v]", path, key), rules, errs); err != nil {
+				return err
+			}
+		}
+	default:
+		// 静态类型在解析标签时已经检查过，这里只会是 interface 中保存的值
+		return fmt.Errorf("validate: dive on %s field %s", fv.Type(), path)
+	}
+	return nil
+}
+
+// validateNested 递归校验嵌套的结构体以及结构体切片
+func (v *Validator) validateNested(fv reflect.Value, path string, errs *Errors) error {
+	for fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return nil
+		}
+		fv = fv.Elem()
+	}
+
+	prefix := path
+	if prefix != "" {
+		prefix += "."
+	}
+	switch fv.Kind() {
+	case reflect.Struct:
+		if fv.Type() != timeType {
+			return v.validateStruct(fv, prefix, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		if !hasStructElem(fv.Type()) {
+			return nil
+		}
+		for i := 0; i < fv.Len(); i++ {
+			if err := v.validateNested(fv.Index(i), fmt.Sprintf("%s[%d]", path, i), errs); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if !hasStructElem(fv.Type()) {
+			return nil
+		}
+		for _, key := range sortedKeys(fv) {
+			if err := v.validateNested(fv.MapIndex(key), fmt.Sprintf("%s[%v]", path, key), errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rule 返回指定名称的校验规则
+func (v *Validator) rule(name string) (RuleFunc, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	fn, ok := v.rules[name]
+	return fn, ok
+}
+
+// newError 创建字段错误
+func (v *Validator) newError(path string, r rule, fv reflect.Value, kind string) *FieldError {
+	e := &FieldError{Field: path, Rule: r.name, Param: r.param, v: v, kind: kind}
+	if fv.IsValid() && fv.CanInterface() {
+		e.Value = fv.Interface()
+	}
+	return e
+}
+
+// fieldSpecs 解析并检查结构体的校验规则，嵌套的结构体类型也会一并检查。
+// 结果按类型缓存，标签无效的类型不缓存，之后注册了缺少的规则仍然可以使用
+func (v *Validator) fieldSpecs(t reflect.Type) ([]fieldSpec, error) {
+	if specs, ok := v.specs.Load(t); ok {
+		return specs.([]fieldSpec), nil
+	}
+	parsed := make(map[reflect.Type][]fieldSpec)
+	if err := v.parseStruct(t, parsed); err != nil {
+		return nil, err
+	}
+	for typ, specs := range parsed {
+		v.specs.Store(typ, specs)
+	}
+	return parsed[t], nil
+}
+
+// parseStruct 解析结构体以及嵌套结构体的校验规则，保存到 parsed 中
+func (v *Validator) parseStruct(t reflect.Type, parsed map[reflect.Type][]fieldSpec) error {
+	if _, ok := parsed[t]; ok {
+		return nil
+	}
+	if _, ok := v.specs.Load(t); ok {
+		return nil
+	}
+
+	specs := []fieldSpec{}
+	// 先占位，避免递归类型无限解析
+	parsed[t] = specs
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() && !sf.Anonymous {
+			continue
+		}
+		tag := sf.Tag.Get("validate")
+		if tag == "-" {
+			continue
+		}
+		spec := fieldSpec{index: i, name: fieldName(sf), anonymous: sf.Anonymous, rules: parseTag(tag)}
+		if !sf.IsExported() && len(spec.rules) > 0 {
+			continue
+		}
+		if err := v.checkRules(t, sf.Type, spec.rules); err != nil {
+			return fmt.Errorf("validate: field %s.%s: %w", t, sf.Name, err)
+		}
+		if nested := nestedStruct(sf.Type); nested != nil {
+			if err := v.parseStruct(nested, parsed); err != nil {
+				return err
+			}
+		}
+		specs = append(specs, spec)
+	}
+	parsed[t] = specs
+	return nil
+}
+
+// checkRules 检查规则是否存在以及规则的参数是否有效，ft 是规则作用的字段类型，t 是字段所在的结构体
+func (v *Validator) checkRules(t, ft reflect.Type, rules []rule) error {
+	for ft.Kind() == reflect.Ptr {
+		ft = ft.Elem()
+	}
+	for i, r := range rules {
+		switch r.name {
+		case "omitempty":
+			continue
+		case "dive":
+			switch ft.Kind() {
+			case reflect.Slice, reflect.Array, reflect.Map:
+				return v.checkRules(t, ft.Elem(), rules[i+1:])
+			case reflect.Interface:
+				// interface 的实际类型只能在校验时确定
+				return v.checkRules(t, ft, rules[i+1:])
+			}
+			return fmt.Errorf("dive on %s", ft)
+		}
+
+		if _, ok := v.rule(r.name); !ok {
+			return fmt.Errorf("unknown rule %q", r.name)
+		}
+		switch r.name {
+		case "min", "max", "len":
+			if _, err := strconv.ParseFloat(r.param, 64); err != nil {
+				return fmt.Errorf("invalid numeric parameter %q for %s", r.param, r.name)
+			}
+		case "regexp":
+			if _, err := compileRegexp(r.param); err != nil {
+				return err
+			}
+		case "eqfield", "nefield", "gtfield", "gtefield", "ltfield", "ltefield":
+			if _, ok := t.FieldByName(r.param); !ok {
+				return fmt.Errorf("unknown field %q for %s", r.param, r.name)
+			}
+		}
+	}
+	return nil
+}
+
+// nestedStruct 返回字段中需要递归校验的结构体类型，没有时返回 nil
+func nestedStruct(t reflect.Type) reflect.Type {
+	for {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			t = t.Elem()
+			continue
+		case reflect.Struct:
+			if t != timeType {
+				return t
+			}
+		}
+		return nil
+	}
+}
+
+// parseTag 解析 validate 标签，regexp 规则会吞掉剩余的全部内容
+func parseTag(tag string) []rule {
+	var rules []rule
+	for tag != "" {
+		var part string
+		if strings.HasPrefix(tag, "regexp=") {
+			part, tag = tag, ""
+		} else if i := strings.IndexByte(tag, ','); i >= 0 {
+			part, tag = tag[:i], tag[i+1:]
+		} else {
+			part, tag = tag, ""
+		}
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, param, _ := strings.Cut(part, "=")
+		rules = append(rules, rule{name: name, param: param})
+	}
+	return rules
+}
+
+// fieldName 返回字段在错误信息中的名称，优先使用 json、query 等标签中的名称
+func fieldName(sf reflect.StructField) string {
+	for _, tag := range nameTags {
+		name := strings.Split(sf.Tag.Get(tag), ",")[0]
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return sf.Name
+}
+
+// kindClass 返回字段的类型分类，用于选择错误信息模板
+func kindClass(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return "slice"
+	}
+	return ""
+}
+
+// hasStructElem 判断切片、数组或映射的元素是否为结构体
+func hasStructElem(t reflect.Type) bool {
+	t = t.Elem()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && t != timeType
+}
+
+// sortedKeys 返回排序后的映射键，保证错误的顺序稳定
+func sortedKeys(m reflect.Value) []reflect.Value {
+	keys := m.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	return keys
+}
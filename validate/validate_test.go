@@ -0,0 +1,246 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type address struct {
+	City string `json:"city" validate:"required"`
+	Zip  string `json:"zip" validate:"omitempty,regexp=^[0-9]{6}$"`
+}
+
+type signup struct {
+	Name     string            `json:"name" validate:"required,min=2,max=5"`
+	Email    string            `json:"email" validate:"required,email"`
+	Age      int               `query:"age" validate:"min=18,max=130"`
+	Role     string            `json:"role" validate:"oneof=admin user"`
+	Password string            `json:"password" validate:"required,min=8"`
+	Confirm  string            `json:"confirm" validate:"eqfield=Password"`
+	Nickname *string           `json:"nickname" validate:"omitempty,min=3"`
+	Tags     []string          `json:"tags" validate:"max=3,dive,required"`
+	Home     address           `json:"home"`
+	Others   []*address        `json:"others"`
+	Labels   map[string]string `json:"labels" validate:"dive,max=3"`
+	Start    time.Time         `json:"start"`
+	End      time.Time         `json:"end" validate:"gtfield=Start"`
+}
+
+func validSignup() signup {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return signup{
+		Name:     "张三",
+		Email:    "zhangsan@example.com",
+		Age:      20,
+		Role:     "user",
+		Password: "12345678",
+		Confirm:  "12345678",
+		Tags:     []string{"a", "b"},
+		Home:     address{City: "Beijing", Zip: "100000"},
+		Others:   []*address{{City: "Shanghai", Zip: "200000"}},
+		Labels:   map[string]string{"k": "v"},
+		Start:    start,
+		End:      start.Add(time.Hour),
+	}
+}
+
+func fieldRules(err error) map[string]string {
+	var errs Errors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+	m := make(map[string]string)
+	for _, e := range errs {
+		m[e.Field] = e.Rule
+	}
+	return m
+}
+
+func TestStructValid(t *testing.T) {
+	s := validSignup()
+	if err := Struct(&s); err != nil {
+		t.Fatal(err)
+	}
+	if err := Struct(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStructErrors(t *testing.T) {
+	short := "ab"
+	s := validSignup()
+	s.Name = "a"
+	s.Email = "not-an-email"
+	s.Age = 10
+	s.Role = "root"
+	s.Confirm = "different"
+	s.Nickname = &short
+	s.Tags = []string{"a", ""}
+	s.Home.Zip = "12345x"
+	s.Others = append(s.Others, &address{})
+	s.Labels = map[string]string{"long": "abcd"}
+	s.End = s.Start
+
+	got := fieldRules(Struct(s))
+	want := map[string]string{
+		"name":           "min",
+		"email":          "email",
+		"age":            "min",
+		"role":           "oneof",
+		"confirm":        "eqfield",
+		"nickname":       "min",
+		"tags[1]":        "required",
+		"home.zip":       "regexp",
+		"others[1].city": "required",
+		"labels[long]":   "max",
+		"end":            "gtfield",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expecting %v but got %v", want, got)
+	}
+}
+
+func TestNilPointerRequired(t *testing.T) {
+	var s struct {
+		ID *int `json:"id" validate:"required"`
+		V  *int `json:"v" validate:"min=1"`
+	}
+	if got := fieldRules(Struct(s)); !reflect.DeepEqual(got, map[string]string{"id": "required"}) {
+		t.Fatalf("expecting only id to be required but got %v", got)
+	}
+}
+
+func TestPointerToZeroRequired(t *testing.T) {
+	page, flag := 0, false
+	s := struct {
+		Page *int  `json:"page" validate:"required"`
+		Flag *bool `json:"flag" validate:"required"`
+		Size *int  `json:"size" validate:"required,min=1"`
+	}{Page: &page, Flag: &flag, Size: &page}
+	if got := fieldRules(Struct(s)); !reflect.DeepEqual(got, map[string]string{"size": "min"}) {
+		t.Fatalf("expecting only size to fail min but got %v", got)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	var s struct {
+		Name string `json:"name" validate:"required"`
+		Bio  string `json:"bio" validate:"max=3"`
+		Age  int    `json:"age" validate:"max=3"`
+	}
+	s.Bio = "abcd"
+	s.Age = 4
+	var errs Errors
+	if !errors.As(Struct(s), &errs) || len(errs) != 3 {
+		t.Fatalf("expecting 3 errors but got %v", errs)
+	}
+
+	zh := errs.Messages("zh")
+	if zh[0].Message != "name为必填字段" || zh[1].Message != "bio长度不能超过3个字符" || zh[2].Message != "age不能大于3" {
+		t.Fatalf("unexpected zh messages %+v", zh)
+	}
+	en := errs.Messages("en")
+	if en[0].Message != "name is required" || en[1].Message != "bio must be at most 3 characters long" {
+		t.Fatalf("unexpected en messages %+v", en)
+	}
+	if errs[0].Error() != "name is required" {
+		t.Fatalf("expecting English error string but got %q", errs[0].Error())
+	}
+}
+
+func TestLang(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "zh"},
+		{"en-US,en;q=0.9", "en"},
+		{"zh-CN,zh;q=0.9,en;q=0.8", "zh"},
+		{"fr;q=1,en;q=0.5", "en"},
+		{"en;q=0.2,zh-TW;q=0.8", "zh"},
+		{"fr", "zh"},
+	}
+	for _, tt := range tests {
+		if got := Lang(tt.header); got != tt.want {
+			t.Fatalf("Lang(%q): expecting %s but got %s", tt.header, tt.want, got)
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	v := New()
+	v.Register("even", func(f Field) bool { return f.Value.Int()%2 == 0 })
+	v.RegisterMessage("zh", "even", "{field}必须是偶数")
+	v.RegisterMessage("en", "even", "{field} must be even")
+
+	var s struct {
+		N int `json:"n" validate:"even"`
+	}
+	s.N = 3
+	var errs Errors
+	if !errors.As(v.Struct(s), &errs) {
+		t.Fatal("expecting custom rule to fail")
+	}
+	if msg := errs[0].Message("zh"); msg != "n必须是偶数" {
+		t.Fatalf("unexpected message %q", msg)
+	}
+
+	// Rules registered on one validator are not visible to others.
+	if err := Struct(s); err == nil || !strings.Contains(err.Error(), "unknown rule") {
+		t.Fatalf("expecting unknown rule error but got %v", err)
+	}
+}
+
+func TestInvalidTags(t *testing.T) {
+	type inner struct {
+		Code string `validate:"regexp=["`
+	}
+	tests := []struct {
+		s    interface{}
+		want string
+	}{
+		{struct {
+			N int `validate:"min=abc"`
+		}{}, "invalid numeric parameter"},
+		{struct {
+			A string `validate:"eqfield=Missing"`
+		}{}, "unknown field"},
+		{struct {
+			A string `validate:"regexp=(a"`
+		}{}, "invalid regexp"},
+		{struct {
+			A string `validate:"dive,required"`
+		}{}, "dive on string"},
+		{struct {
+			A []string `validate:"dive,nope"`
+		}{}, "unknown rule"},
+		{struct {
+			Items []*inner
+		}{}, "invalid regexp"},
+	}
+	for _, tt := range tests {
+		if err := Check(tt.s); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%T: expecting %q error from Check but got %v", tt.s, tt.want, err)
+		}
+		// 校验时同样返回错误，而不是 panic
+		var errs Errors
+		if err := Struct(tt.s); err == nil || errors.As(err, &errs) {
+			t.Errorf("%T: expecting a tag error from Struct but got %v", tt.s, err)
+		}
+	}
+
+	// 递归类型可以正常解析
+	type node struct {
+		Name     string  `validate:"required"`
+		Children []*node `validate:"dive"`
+	}
+	if err := Check(&node{}); err != nil {
+		t.Fatal(err)
+	}
+	if rules := fieldRules(Struct(node{Name: "a", Children: []*node{{}}})); rules["Children[0].Name"] != "required" {
+		t.Fatalf("expecting nested required error but got %v", rules)
+	}
+}